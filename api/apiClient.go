@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	lq "bargain/liquefy/models"
@@ -38,7 +39,7 @@ type ApiClient interface {
 	DeleteInstance(instanceId uint, apiKey string) error
 
 	CreateJob(job *ContainerJobPublic, apiKey string) uint
-	GetJob(jobId uint, apiKey string) *lq.ContainerJob
+	GetJob(jobId uint, apiKey string) *JobView
 	DeleteJob(jobId uint, apiKey string) error
 }
 
@@ -160,14 +161,14 @@ func (server *apiClient) CreateJob(job *ContainerJobPublic, apiKey string) uint
 	return uint(id)
 }
 
-func (server *apiClient) GetJob(jobId uint, apiKey string) *lq.ContainerJob {
+func (server *apiClient) GetJob(jobId uint, apiKey string) *JobView {
 	targetUrl := fmt.Sprintf("%s/api/job/%d", server.url, jobId)
 	data, err := server.get(targetUrl, apiKey)
 	if err != nil {
 		panic(err)
 	}
 
-	var job lq.ContainerJob
+	var job JobView
 	err = json.Unmarshal(data, &job)
 	if err != nil {
 		panic(err)
@@ -196,14 +197,31 @@ func (server *apiClient) delete(targetUrl string, apiKey string) ([]byte, error)
 	return server.executeHttp("DELETE", targetUrl, apiKey, []byte{})
 }
 
+// Rate limited requests are retried after the delay the server asks for, this many times
+const maxRateLimitRetries = 5
+
 func (server *apiClient) executeHttp(httpType string, targetUrl string, apiKey string, jsonBytes []byte) ([]byte, error) {
-	req, err := http.NewRequest(httpType, targetUrl, bytes.NewBuffer(jsonBytes))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
 	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return []byte{}, err
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(httpType, targetUrl, bytes.NewBuffer(jsonBytes))
+		if err != nil {
+			return []byte{}, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err = client.Do(req)
+		if err != nil {
+			return []byte{}, err
+		}
+
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if resp.StatusCode != StatusTooManyRequests || err != nil || attempt == maxRateLimitRetries {
+			break
+		}
+		resp.Body.Close()
+		log.Infof("Rate limited, retrying %s in %d seconds", targetUrl, retryAfter)
+		time.Sleep(time.Duration(retryAfter) * time.Second)
 	}
 	defer resp.Body.Close()
 
@@ -3,18 +3,14 @@ package api
 import (
 	"errors"
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
 
-	jwt_lib "github.com/dgrijalva/jwt-go"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 	"github.com/pborman/uuid"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"bargain/liquefy/db"
+	"bargain/liquefy/mail"
 	lq "bargain/liquefy/models"
 )
 
@@ -24,17 +20,49 @@ type ApiServer interface {
 
 type apiServer struct {}
 
-func NewApiServer() ApiServer {
+// The tables the handlers use, set by NewApiServer and replaced with a memory store in tests
+var store db.Store = db.NewPostgresStore()
+
+func NewApiServer(dataStore db.Store) ApiServer {
+	store = dataStore
+
+	keys, err := LoadJwtKeySet()
+	if err != nil {
+		panic(err)
+	}
+	jwtKeys = keys
+
+	linkConfig, err := LoadAwsLinkConfig()
+	if err != nil {
+		panic(err)
+	}
+	awsLink = linkConfig
+
+	limiter, err := NewRateLimiterFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	rateLimiter = limiter
+
+	sender, err := mail.NewSenderFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	mailer = sender
 	return apiServer{}
 }
 
 func (server apiServer) Start() {
+	newWebhookDispatcher().Start()
+
 	router := gin.Default()
+	router.Use(RequestID())
+	router.Use(Instrumented())
+	router.Use(LimitRequestBody(MaxRequestBodySize))
 	webserver := router.Group("/private/")
 
 	//TODO: Custom Middlewear to check Webserver Secret
 	//	secretWebserver := "putsecrethere"
-	//  secretJWT := "mySUPERPASSWrod"
 
 	//webserver.Use(func() gin.HandlerFunc {
 	//return func(c *gin.Context) {
@@ -43,105 +71,222 @@ func (server apiServer) Start() {
 	//  }
 	// }})
 
+	// Creating a user returns a default API key with every scope, for scripts to use
 	webserver.POST("/user", func(c *gin.Context) {
 		user := &lq.User{}
-		if c.BindJSON(&user) == nil {
-			createdUser, err := generateUser(user)
-			if err != nil {
-				c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
-			}
-			tokenString, err := generateToken(createdUser.ID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
-			}
-			c.JSON(http.StatusCreated, tokenString)
+		if c.BindJSON(&user) != nil {
+			return
 		}
-	})
-
-	webserver.POST("/user/gentoken", func(c *gin.Context) {
-		//TODO: Check if the user token is valid @Sach can try this maybe
-		userid := c.Param("userid")
-
-		intuserid, err := strconv.Atoi(userid)
+		createdUser, err := generateUser(user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+			return
 		}
-
-		tokenString, err := generateToken(uint(intuserid))
+		key, _, err := newApiKey(createdUser.ID, "default", []string{lq.ScopeAll})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate api key"})
+			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"token": tokenString})
+		c.JSON(http.StatusCreated, key)
 	})
 
+	auth := router.Group("/auth/")
+	auth.Use(RateLimited(authRateLimit))
+	auth.POST("/refresh", RefreshSession)
+	auth.POST("/login", Audited(lq.AuditLogin, "user", ""), Login)
+	auth.POST("/password/reset", RequestPasswordReset)
+	auth.POST("/password/reset/confirm", Audited(lq.AuditPasswordReset, "user", ""), ConfirmPasswordReset)
+
 	/*
 		Set this header in your request to get here.
 		Authorization: Bearer `token`
+		The token is either an access token or an API key
 	*/
 
 	private := router.Group("/api/")
-	private.Use(TokenValidator("mySUPERPASSWrod"))
+	private.Use(TokenValidator(jwtKeys), RateLimited(requestRateLimit))
 
 	// PRIVATE WEBSITE API //
-	private.GET("/user", GetUser)
-	private.POST("/linkAwsAccount", LinkAwsAccount)
-	private.POST("/setupAwsAccount", SetupAwsAccount)
+	private.GET("/user", RequireScope(lq.ScopeRead), GetUser)
+	private.POST("/user/password", Audited(lq.AuditPasswordChange, "user", ""), RequireScope(lq.ScopeAccount),
+		ChangePassword)
+	private.GET("/quota", RequireScope(lq.ScopeRead), GetQuota)
+	private.GET("/user/:userid/quota", RequireScope(lq.ScopeAdmin), GetUserQuota)
+	private.PUT("/user/:userid/quota", Audited(lq.AuditQuotaSet, "user", "userid"), RequireScope(lq.ScopeAdmin),
+		SetUserQuota)
+	private.GET("/aws/policy", RequireScope(lq.ScopeAccount), GetAwsPolicy)
+	private.POST("/linkAwsAccount", Audited(lq.AuditAwsAccountLink, "aws_account", ""), RequireScope(lq.ScopeAccount),
+		LinkAwsAccount)
+	private.POST("/setupAwsAccount", Audited(lq.AuditAwsAccountSetup, "aws_account", ""),
+		RequireScope(lq.ScopeAccount), SetupAwsAccount)
+
+	// API keys
+	private.GET("/keys", RequireScope(lq.ScopeAccount), ListApiKeys)
+	private.POST("/keys", Audited(lq.AuditApiKeyCreate, "api_key", ""), RequireScope(lq.ScopeAccount), CreateApiKey)
+	private.DELETE("/keys/:keyid", Audited(lq.AuditApiKeyRevoke, "api_key", "keyid"), RequireScope(lq.ScopeAccount),
+		RevokeApiKey)
+
+	// Secrets
+	private.GET("/secrets", RequireScope(lq.ScopeRead), ListSecrets)
+	private.POST("/secrets", Audited(lq.AuditSecretCreate, "secret", ""), RequireScope(lq.ScopeAccount), CreateSecret)
+	private.PUT("/secrets/:name", Audited(lq.AuditSecretUpdate, "secret", "name"), RequireScope(lq.ScopeAccount),
+		UpdateSecret)
+	private.DELETE("/secrets/:name", Audited(lq.AuditSecretDelete, "secret", "name"), RequireScope(lq.ScopeAccount),
+		DeleteSecret)
+
+	// Webhooks and the event stream
+	private.GET("/webhooks", RequireScope(lq.ScopeRead), ListWebhooks)
+	private.POST("/webhooks", Audited(lq.AuditWebhookCreate, "webhook", ""), RequireScope(lq.ScopeAccount),
+		CreateWebhook)
+	private.DELETE("/webhooks/:webhookid", Audited(lq.AuditWebhookDelete, "webhook", "webhookid"),
+		RequireScope(lq.ScopeAccount), DeleteWebhook)
+	private.GET("/webhooks/:webhookid/deliveries", RequireScope(lq.ScopeRead), ListWebhookDeliveries)
+	private.GET("/events", RequireScope(lq.ScopeRead), StreamEvents)
+
+	// Audit log
+	private.GET("/audit", RequireScope(lq.ScopeRead), ListAuditEntries)
+
+	// Retention of the history of jobs and instances
+	private.GET("/retention", RequireScope(lq.ScopeRead), GetRetentionPolicy)
+	private.PUT("/retention", Audited(lq.AuditRetentionPolicySet, "retention_policy", ""), RequireScope(lq.ScopeAccount),
+		SetRetentionPolicy)
+
+	// Organizations
+	private.POST("/org", Audited(lq.AuditOrgCreate, "org", ""), RequireScope(lq.ScopeAccount), CreateOrganization)
+	private.GET("/org", RequireScope(lq.ScopeRead), GetOrganization)
+	private.POST("/org/members", Audited(lq.AuditMemberAdd, "user", ""), RequireScope(lq.ScopeAccount), AddMember)
+	private.PUT("/org/members/:userid", Audited(lq.AuditMemberRoleSet, "user", "userid"),
+		RequireScope(lq.ScopeAccount), SetMemberRole)
+	private.DELETE("/org/members/:userid", Audited(lq.AuditMemberRemove, "user", "userid"),
+		RequireScope(lq.ScopeAccount), RemoveMember)
 
 	// THIS STUFF BELOW IS PUBLIC SWAGGER API //
 
 	// Jobs Information
-	private.POST("/job", CreateJob)
-	private.GET("/jobs", ListJobs)
-	private.GET("/job/:jobid", GetJob)
-	private.DELETE("/job/:jobid", DeleteJob)
+	private.POST("/job", Audited(lq.AuditJobCreate, "job", ""), RequireScope(lq.ScopeJobsWrite),
+		RateLimited(jobRateLimit), CreateJob)
+	private.GET("/jobs", RequireScope(lq.ScopeRead), ListJobs)
+	private.POST("/jobs/batch", Audited(lq.AuditJobBatchCreate, "job", ""), RequireScope(lq.ScopeJobsWrite),
+		RateLimited(jobRateLimit), CreateJobsBatch)
+	private.GET("/job/:jobid", RequireScope(lq.ScopeRead), GetJob)
+	private.GET("/job/:jobid/buildlog", RequireScope(lq.ScopeRead), GetJobBuildLog)
+	private.GET("/job/:jobid/events", RequireScope(lq.ScopeRead), GetJobEvents)
+	private.DELETE("/job/:jobid", Audited(lq.AuditJobDelete, "job", "jobid"), RequireScope(lq.ScopeJobsWrite), DeleteJob)
 
 	// Instance Information
-	private.GET("/instances", ListInstances)
-	private.GET("/instance/:instanceid", GetInstance)
-	private.DELETE("/instance/:instanceid", DeleteInstance)
+	private.GET("/instances", RequireScope(lq.ScopeRead), ListInstances)
+	private.GET("/instance/:instanceid", RequireScope(lq.ScopeRead), GetInstance)
+	private.GET("/instance/:instanceid/events", RequireScope(lq.ScopeRead), GetInstanceEvents)
+	private.DELETE("/instance/:instanceid", Audited(lq.AuditInstanceDelete, "instance", "instanceid"),
+		RequireScope(lq.ScopeInstancesWrite), DeleteInstance)
 
 	private.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"error": "Welcome to Liquefy"})
 	})
 
-	router.StaticFile("/api_spec", "./swagger/swagger.json")
+	// VERSIONED PUBLIC API //
+	v1 := router.Group("/v1/")
+	v1.Use(TokenValidator(jwtKeys), RateLimited(requestRateLimit))
+
+	v1.GET("/jobs", RequireScope(lq.ScopeRead), V1ListJobs)
+	v1.POST("/jobs", Audited(lq.AuditJobCreate, "job", ""), RequireScope(lq.ScopeJobsWrite), RateLimited(jobRateLimit),
+		V1CreateJob)
+	v1.GET("/jobs/:jobid", RequireScope(lq.ScopeRead), V1GetJob)
+	v1.GET("/jobs/:jobid/events", RequireScope(lq.ScopeRead), V1GetJobEvents)
+	v1.DELETE("/jobs/:jobid", Audited(lq.AuditJobDelete, "job", "jobid"), RequireScope(lq.ScopeJobsWrite), V1DeleteJob)
+
+	v1.GET("/instances", RequireScope(lq.ScopeRead), V1ListInstances)
+	v1.GET("/instances/:instanceid", RequireScope(lq.ScopeRead), V1GetInstance)
+	v1.GET("/instances/:instanceid/events", RequireScope(lq.ScopeRead), V1GetInstanceEvents)
+	v1.DELETE("/instances/:instanceid", Audited(lq.AuditInstanceDelete, "instance", "instanceid"),
+		RequireScope(lq.ScopeInstancesWrite), V1DeleteInstance)
+
+	// Scraped by Prometheus, like the /metrics of the other services
+	router.GET("/metrics", MetricsHandler)
+
+	apiSpec := OpenApiSpec()
+	router.GET("/api_spec", func(c *gin.Context) {
+		c.JSON(http.StatusOK, apiSpec)
+	})
 	router.Static("/apidoc", "./docs")
 
 	// ROUTER
 	router.Run(":3030")
 }
 
-func TokenValidator(secret string) gin.HandlerFunc {
+// Authenticates requests by either an API key or an access token, and stores the user and the scopes granted to the
+// request in the context
+func TokenValidator(keys *JwtKeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
-
 		//Strip any "" that might be in the auth section
-		c.Request.Header.Set("Authorization", strings.Replace(c.Request.Header.Get("Authorization"), "\"", "", -1))
+		header := strings.Replace(c.Request.Header.Get("Authorization"), "\"", "", -1)
+		if !strings.HasPrefix(header, "Bearer ") {
+			abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "No token provided"))
+			return
+		}
+		raw := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
 
-		token, err := jwt_lib.ParseFromRequest(c.Request, func(token *jwt_lib.Token) (interface{}, error) {
-			b := ([]byte(secret))
-			return b, nil
-		})
+		var userID uint
+		var scopes []string
+		legacy := false
+		if strings.HasPrefix(raw, ApiKeyPrefix) {
+			key, err := store.ApiKeys().GetByHash(hashSecret(raw))
+			if err != nil {
+				abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid API key"))
+				return
+			}
+			if err := store.ApiKeys().MarkUsed(key.ID); err != nil {
+				log.Warn(err)
+			}
+			userID, scopes = key.UserID, key.GetScopes()
+			c.Set("api_key_id", key.ID)
+		} else {
+			var err error
+			userID, scopes, legacy, err = keys.parseAccessToken(raw)
+			if err != nil {
+				log.Errorf("Error: Parsing the bearer jwt token : %s", err)
+				abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Incorrect token provided"))
+				return
+			}
+		}
 
+		user, err := store.Users().Get(userID)
 		if err != nil {
-			log.Errorf("Error: Parsing the bearer jwt token : %s", err)
-			c.AbortWithError(401, errors.New("Incorrect token provided"))
+			log.Errorf("Error Validating User Token : %s", err)
+			abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid User Auth Token"))
+			return
 		}
 
-		if uid, ok := token.Claims["ID"].(float64); ok {
+		// Tokens issued before access tokens expired are only valid until the user is given another one
+		if legacy && raw != user.ApiKey {
+			abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid User Auth Token"))
+			return
+		}
 
-			user, err := db.Users().Get(uint(uid))
-			if err != nil {
-				log.Errorf("Error Validating User Token : %s", err)
-				c.AbortWithError(401, err)
-			}
+		scopes = lq.EffectiveScopes(user, scopes)
 
-			if token.Raw == user.ApiKey {
-				c.Keys = make(map[string]interface{})
-				c.Keys["user"] = user
-				c.Keys["userid"] = user.ID
-			} else {
-				c.AbortWithError(401, errors.New("Invalid User Auth Token"))
-			}
+		membership, err := store.Organizations().GetMembership(user.ID)
+		if err != nil {
+			abortWithApiError(c, internalError("Failed getting organization of user"))
+			return
+		}
+
+		if c.Keys == nil {
+			c.Keys = make(map[string]interface{})
+		}
+		c.Keys["user"] = user
+		c.Keys["userid"] = user.ID
+		c.Keys["scopes"] = scopes
+		c.Keys["membership"] = membership
+	}
+}
+
+// Rejects requests whose token was not granted the scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, _ := c.Keys["scopes"].([]string)
+		if !lq.HasScope(scopes, scope) {
+			abortWithApiError(c, newApiError(http.StatusForbidden, ErrCodeForbidden, "Token lacks the %s scope", scope))
 		}
 	}
 }
@@ -149,53 +294,30 @@ func TokenValidator(secret string) gin.HandlerFunc {
 // User Auth Related functions //
 func generateUser(user *lq.User) (*lq.User, error) {
 	// Check if user exists
-	existingUser, _ := db.Users().GetByEmail(user.Email)
+	existingUser, _ := store.Users().GetByEmail(user.Email)
 
 	if existingUser.ID > 0 {
 		return nil, errors.New("User with email already present")
 	}
 
+	if apiErr := validatePassword(user.Password); apiErr != nil {
+		return nil, apiErr
+	}
+
 	// Hash the user password
-	passBytes := []byte(user.Password)
-	hashedPassword, err := bcrypt.GenerateFromPassword(passBytes, 10)
+	hashedPassword, err := hashPassword(user.Password)
 	if err != nil {
 		return nil, errors.New("Invalid user password")
 	}
 
 	log.Info("Creating user")
 
-	user.Password = string(hashedPassword[:])
+	user.Password = hashedPassword
 	user.PublicID = uuid.NewRandom().String()
-	err = db.Users().Create(user)
+	err = store.Users().Create(user)
 
 	if err != nil {
 		return nil, errors.New("User with email already present")
 	}
 	return user, nil
 }
-
-func generateToken(userid uint) (string, error) {
-	// Create the token
-	token := jwt_lib.New(jwt_lib.GetSigningMethod("HS256"))
-
-	// Set some claims
-	token.Claims["ID"] = userid
-
-	//TODO: Set token Expirations @Sach can try this maybe
-	token.Claims["exp"] = time.Now().Add(time.Hour * 10000).Unix()
-
-	//TODO : Make JWT A env var @Sach can try this maybe
-	// Sign and get the complete encoded token as a string
-	tokenString, err := token.SignedString([]byte("mySUPERPASSWrod"))
-	if err != nil {
-		return "", err
-	}
-
-	//Update the new user uifo
-	err = db.Users().Update(userid,"api_key", tokenString)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
-}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Ids clients send are kept when they are short and plain, so they can be searched for in the audit log
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Entries are exported in batches, so that exporting a long log does not load all of it at once
+const auditExportBatch = 500
+
+// Keys of the context audited handlers set to complete the entry of their request
+const (
+	auditTargetKey = "audit_target" // id of the created target, for actions without it in the path
+	auditUserKey   = "audit_user"   // user of unauthenticated actions, ex: logging in
+)
+
+// Gives every request an id, returned in the X-Request-ID header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Request.Header.Get(RequestIDHeader)
+		if !requestIDRegexp.MatchString(id) {
+			id = uuid.NewRandom().String()
+		}
+		c.Set("request_id", id)
+		c.Writer.Header().Set(RequestIDHeader, id)
+	}
+}
+
+// Records an audit entry of the request once it has been handled. The target is the path parameter targetParam, or
+// the id the handler set with setAuditTarget.
+func Audited(action, targetType, targetParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := newAuditEntry(c, action, c.Writer.Status())
+		entry.TargetType = targetType
+		if targetParam != "" {
+			entry.TargetID = c.Param(targetParam)
+		}
+		if target, ok := c.Keys[auditTargetKey].(string); ok {
+			entry.TargetID = target
+		}
+		if err := store.AuditLog().Append(entry); err != nil {
+			log.WithField("request_id", entry.RequestID).Error("Failed recording audit entry")
+		}
+	}
+}
+
+func setAuditTarget(c *gin.Context, id uint) {
+	c.Set(auditTargetKey, strconv.FormatUint(uint64(id), 10))
+}
+
+func newAuditEntry(c *gin.Context, action string, status int) *lq.AuditEntry {
+	entry := &lq.AuditEntry{
+		ActorType: lq.AuditActorUser,
+		IP:        c.ClientIP(),
+		Action:    action,
+		Status:    status,
+		Outcome:   auditOutcome(status),
+	}
+	entry.RequestID, _ = c.Keys["request_id"].(string)
+
+	user, ok := c.Keys["user"].(*lq.User)
+	if !ok {
+		user, ok = c.Keys[auditUserKey].(*lq.User)
+	}
+	if ok && user != nil {
+		entry.ActorID, entry.ActorName, entry.UserID = user.ID, user.Email, user.ID
+	}
+	if membership, ok := c.Keys["membership"].(*lq.Membership); ok && membership != nil {
+		entry.OrgID = membership.OrgID
+	}
+	if apiErr, ok := c.Keys["api_error"].(*ApiError); ok {
+		entry.Detail = apiErr.Message
+	}
+	return entry
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status < 400:
+		return lq.AuditSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return lq.AuditDenied
+	default:
+		return lq.AuditFailure
+	}
+}
+
+// Lists the audit entries of the user, and those of their organization for admins, most recent first. With
+// format=jsonl every matching entry is exported as JSON lines instead of a page.
+func ListAuditEntries(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+
+	filter := db.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Outcome:    c.Query("outcome"),
+		RequestID:  c.Query("request_id"),
+	}
+	var apiErr *ApiError
+	if filter.ActorID, apiErr = parseIDQuery(c, "actor_id"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if filter.After, apiErr = parseTimeParam(c, "after"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if filter.Before, apiErr = parseTimeParam(c, "before"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	orgAdmin := actor.Role() == lq.RoleAdmin
+
+	if c.Query("format") == "jsonl" {
+		exportAuditEntries(c, actor, orgAdmin, filter)
+		return
+	}
+
+	page, apiErr := parsePageRequest(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	entries, err := store.AuditLog().ListVisibleTo(actor.User.ID, actor.OrgID(), orgAdmin, filter, page)
+	if err != nil {
+		abortWithApiError(c, internalError("Failed listing audit entries"))
+		return
+	}
+
+	count, nextCursor := pageBounds(page, len(entries), func(i int) uint { return entries[i].ID })
+	c.JSON(http.StatusOK, Page{Items: entries[:count], NextCursor: nextCursor})
+}
+
+// Streams every matching entry, one JSON object per line
+func exportAuditEntries(c *gin.Context, actor *Actor, orgAdmin bool, filter db.AuditFilter) {
+	c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+	c.Writer.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Writer.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	page := db.PageRequest{Limit: auditExportBatch}
+	for {
+		entries, err := store.AuditLog().ListVisibleTo(actor.User.ID, actor.OrgID(), orgAdmin, filter, page)
+		if err != nil {
+			// The status was already sent, the export ends early
+			log.Error(err)
+			return
+		}
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		if len(entries) < auditExportBatch {
+			return
+		}
+		page.BeforeID = entries[len(entries)-1].ID
+	}
+}
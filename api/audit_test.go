@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestAuditOutcome(t *testing.T) {
+	assert.Equal(t, lq.AuditSuccess, auditOutcome(http.StatusOK))
+	assert.Equal(t, lq.AuditSuccess, auditOutcome(http.StatusCreated))
+	assert.Equal(t, lq.AuditDenied, auditOutcome(http.StatusUnauthorized))
+	assert.Equal(t, lq.AuditDenied, auditOutcome(http.StatusForbidden))
+	assert.Equal(t, lq.AuditFailure, auditOutcome(http.StatusBadRequest))
+	assert.Equal(t, lq.AuditFailure, auditOutcome(http.StatusInternalServerError))
+}
+
+func TestRequestIDsFromClients(t *testing.T) {
+	assert.True(t, requestIDRegexp.MatchString("7c1e2b0a-5f7e-4d0b-9a57-2f3f0e6c9b1d"))
+	assert.True(t, requestIDRegexp.MatchString("deploy.42_retry-1"))
+
+	assert.False(t, requestIDRegexp.MatchString(""))
+	assert.False(t, requestIDRegexp.MatchString("id with spaces"))
+	assert.False(t, requestIDRegexp.MatchString("id\ninjected: header"))
+	assert.False(t, requestIDRegexp.MatchString(string(make([]byte, 65))))
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"bargain/liquefy/mail"
+	lq "bargain/liquefy/models"
+)
+
+const MinPasswordLength = 8
+const passwordHashCost = 10
+
+// After this many consecutive failed logins the account is locked for LockoutDuration
+var MaxFailedLogins = 5
+var LockoutDuration = time.Duration(15) * time.Minute
+
+var PasswordResetTTL = time.Duration(1) * time.Hour
+
+// Compared against when logging in with an unknown email, so that logins take as long whether the email exists or not
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), passwordHashCost)
+
+var mailer mail.Sender
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmation struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Starts a session with every scope for a user logging in with their email and password
+func Login(c *gin.Context) {
+	request := LoginRequest{}
+	if err := c.BindJSON(&request); err != nil || request.Email == "" || request.Password == "" {
+		abortWithApiError(c, badRequest("An email and password are required"))
+		return
+	}
+
+	invalidCredentials := newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid email or password")
+	user, err := store.Users().GetByEmail(request.Email)
+	if err != nil || user.ID == 0 {
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(request.Password))
+		abortWithApiError(c, invalidCredentials)
+		return
+	}
+
+	c.Set(auditUserKey, user)
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		abortWithApiError(c, accountLocked(user.LockedUntil))
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)) != nil {
+		log.WithFields(log.Fields{"user": user.ID, "ip": c.ClientIP()}).Warn("Failed login")
+		failures, err := store.Users().RecordFailedLogin(user.ID)
+		if err != nil {
+			abortWithApiError(c, internalError("Failed logging in"))
+			return
+		}
+		if until := lockoutUntil(failures, now); until > 0 {
+			log.WithFields(log.Fields{"user": user.ID, "failures": failures}).Warn("Locking user after failed logins")
+			if err := store.Users().Lock(user.ID, until); err != nil {
+				abortWithApiError(c, internalError("Failed logging in"))
+				return
+			}
+			abortWithApiError(c, accountLocked(until))
+			return
+		}
+		abortWithApiError(c, invalidCredentials)
+		return
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil > 0 {
+		if err := store.Users().ResetFailedLogins(user.ID); err != nil {
+			log.Warn(err)
+		}
+	}
+
+	session, err := newSession(user.ID, []string{lq.ScopeAll})
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed starting session"))
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// Changes the password of the user and ends their other sessions. A new session with the scopes of the request is
+// returned as the refresh token of the current session is revoked too.
+func ChangePassword(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	request := ChangePasswordRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid password change: %s", err.Error()))
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)) != nil {
+		abortWithApiError(c, newApiError(http.StatusForbidden, ErrCodeForbidden, "Current password is incorrect"))
+		return
+	}
+
+	if apiErr := setPassword(user.ID, request.NewPassword); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	scopes, _ := c.Keys["scopes"].([]string)
+	session, err := newSession(user.ID, scopes)
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed starting session"))
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// Mails a password reset token to the user. The response is the same whether the email exists or not.
+func RequestPasswordReset(c *gin.Context) {
+	request := PasswordResetRequest{}
+	if err := c.BindJSON(&request); err != nil || request.Email == "" {
+		abortWithApiError(c, badRequest("An email is required"))
+		return
+	}
+
+	accepted := gin.H{"message": "If the email belongs to an account, a password reset was sent to it"}
+	user, err := store.Users().GetByEmail(request.Email)
+	if err != nil || user.ID == 0 {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	token, tokenHash, err := newSecret("")
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed resetting password"))
+		return
+	}
+	err = store.PasswordResets().Create(&lq.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(PasswordResetTTL).UnixNano(),
+	})
+	if err != nil {
+		abortWithApiError(c, internalError("Failed resetting password"))
+		return
+	}
+
+	if err := mailer.Send(user.Email, "Reset your Liquefy password", passwordResetMail(token)); err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed sending password reset"))
+		return
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// Sets a new password with a mailed reset token, which also lifts any lockout and ends every session of the user
+func ConfirmPasswordReset(c *gin.Context) {
+	request := PasswordResetConfirmation{}
+	if err := c.BindJSON(&request); err != nil || request.Token == "" {
+		abortWithApiError(c, badRequest("A reset token is required"))
+		return
+	}
+	if apiErr := validatePassword(request.NewPassword); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	reset, err := store.PasswordResets().Use(hashSecret(request.Token))
+	if err != nil {
+		log.Warn(err)
+		abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid or expired reset token"))
+		return
+	}
+
+	setAuditTarget(c, reset.UserID)
+	if apiErr := setPassword(reset.UserID, request.NewPassword); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// Stores the hash of a new password and revokes the refresh tokens issued with the old one
+func setPassword(userID uint, password string) *ApiError {
+	if apiErr := validatePassword(password); apiErr != nil {
+		return apiErr
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Error(err)
+		return internalError("Failed setting password")
+	}
+	if err := store.Users().SetPassword(userID, hash); err != nil {
+		return internalError("Failed setting password")
+	}
+	if err := store.RefreshTokens().RevokeAllOfUser(userID); err != nil {
+		return internalError("Failed ending sessions")
+	}
+	return nil
+}
+
+func validatePassword(password string) *ApiError {
+	if len(password) < MinPasswordLength {
+		return badRequest("Passwords must be at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", lq.NewErrorf(err, "Failed hashing password")
+	}
+	return string(hash), nil
+}
+
+// When the account should be locked until after the given number of consecutive failed logins, 0 while it should not
+func lockoutUntil(failures int, now time.Time) int64 {
+	if failures < MaxFailedLogins {
+		return 0
+	}
+	return now.Add(LockoutDuration).UnixNano()
+}
+
+func accountLocked(until int64) *ApiError {
+	retry := time.Unix(0, until).Sub(time.Now())
+	return newApiError(http.StatusForbidden, ErrCodeAccountLocked,
+		"Too many failed logins, try again in %d minutes", int(retry.Minutes())+1)
+}
+
+// The reset token links to PASSWORD_RESET_URL when it is set, otherwise the mail holds the token itself
+func passwordResetMail(token string) string {
+	expiry := int(PasswordResetTTL.Minutes())
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		return fmt.Sprintf("Reset your password within %d minutes at %s?token=%s\n\n"+
+			"If you did not ask for a password reset, you can ignore this mail.", expiry, resetURL, url.QueryEscape(token))
+	}
+	return fmt.Sprintf("Reset your password within %d minutes with the token %s\n\n"+
+		"If you did not ask for a password reset, you can ignore this mail.", expiry, token)
+}
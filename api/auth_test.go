@@ -0,0 +1,51 @@
+package api
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestLockoutAfterRepeatedFailures(t *testing.T) {
+	now := time.Now()
+	for failures := 1; failures < MaxFailedLogins; failures++ {
+		assert.Equal(t, int64(0), lockoutUntil(failures, now))
+	}
+
+	until := lockoutUntil(MaxFailedLogins, now)
+	assert.Equal(t, now.Add(LockoutDuration).UnixNano(), until)
+
+	user := &lq.User{LockedUntil: until}
+	assert.True(t, user.IsLocked(now))
+	assert.True(t, user.IsLocked(now.Add(LockoutDuration-time.Second)))
+	assert.False(t, user.IsLocked(now.Add(LockoutDuration)))
+	assert.False(t, (&lq.User{}).IsLocked(now))
+}
+
+func TestAccountLockedError(t *testing.T) {
+	apiErr := accountLocked(time.Now().Add(LockoutDuration).UnixNano())
+	assert.Equal(t, 403, apiErr.Status)
+	assert.Equal(t, ErrCodeAccountLocked, apiErr.Code)
+	assert.True(t, strings.Contains(apiErr.Message, "15 minutes"))
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.NotNil(t, validatePassword(""))
+	assert.NotNil(t, validatePassword("short"))
+	assert.Nil(t, validatePassword("long enough"))
+}
+
+func TestPasswordResetMail(t *testing.T) {
+	defer os.Setenv("PASSWORD_RESET_URL", "")
+
+	os.Setenv("PASSWORD_RESET_URL", "")
+	assert.True(t, strings.Contains(passwordResetMail("abc-123"), "token abc-123"))
+
+	os.Setenv("PASSWORD_RESET_URL", "https://liquefy.io/reset")
+	assert.True(t, strings.Contains(passwordResetMail("abc-123"), "https://liquefy.io/reset?token=abc-123"))
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+// Actor is the user making a request along with their organization membership, which is nil when they do not belong
+// to one. Every handler authorizes access to jobs, instances and the organization through it.
+type Actor struct {
+	User       *lq.User
+	Membership *lq.Membership
+}
+
+func fetchActorFromContext(c *gin.Context) *Actor {
+	membership, _ := c.Keys["membership"].(*lq.Membership)
+	return &Actor{User: fetchUserFromContext(c), Membership: membership}
+}
+
+// The organization the actor submits jobs in, 0 when they do not belong to one
+func (actor *Actor) OrgID() uint {
+	if actor.Membership == nil {
+		return 0
+	}
+	return actor.Membership.OrgID
+}
+
+func (actor *Actor) Role() string {
+	if actor.Membership == nil {
+		return ""
+	}
+	return actor.Membership.Role
+}
+
+// Whether the actor may perform the action on a job or instance. Personal jobs and instances are only accessible to
+// their owner, those of an organization to its members according to their role. Owners can always see what they
+// submitted, even after leaving the organization.
+func (actor *Actor) can(action string, ownerID, orgID uint) bool {
+	if orgID == 0 || (ownerID == actor.User.ID && action == lq.ActionRead) {
+		return ownerID == actor.User.ID
+	}
+	return actor.OrgID() == orgID && lq.RoleAllows(actor.Role(), action)
+}
+
+// Authorizes an action on a job or instance. What the actor cannot see is reported as not found, so that the ids of
+// other users resources are not revealed.
+func (actor *Actor) authorize(action string, ownerID, orgID uint, kind string, id uint) *ApiError {
+	if actor.can(action, ownerID, orgID) {
+		return nil
+	}
+	if actor.can(lq.ActionRead, ownerID, orgID) {
+		return newApiError(http.StatusForbidden, ErrCodeForbidden, "Not allowed to modify %s %d", kind, id)
+	}
+	return notFound("Unable to find %s %d", kind, id)
+}
+
+// Authorizes an action in the organization of the actor, ex: submitting jobs or managing members. The description
+// of what is being done completes the error message.
+func (actor *Actor) authorizeInOrg(action string, description string) *ApiError {
+	if actor.Membership == nil {
+		return notFound("You do not belong to an organization")
+	}
+	if !lq.RoleAllows(actor.Role(), action) {
+		return newApiError(http.StatusForbidden, ErrCodeForbidden, "The %s role cannot %s", actor.Role(), description)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func newActor(userID, orgID uint, role string) *Actor {
+	actor := &Actor{User: &lq.User{ID: userID}}
+	if orgID != 0 {
+		actor.Membership = &lq.Membership{OrgID: orgID, UserID: userID, Role: role}
+	}
+	return actor
+}
+
+func TestPersonalResourcesOnlyAccessibleToOwner(t *testing.T) {
+	owner := newActor(1, 0, "")
+	assert.Nil(t, owner.authorize(lq.ActionWrite, 1, 0, "job", 10))
+
+	// Belonging to an organization does not give access to personal jobs of other members
+	admin := newActor(2, 5, lq.RoleAdmin)
+	apiErr := admin.authorize(lq.ActionRead, 1, 0, "job", 10)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+}
+
+func TestOrganizationResourcesByRole(t *testing.T) {
+	admin := newActor(1, 5, lq.RoleAdmin)
+	member := newActor(2, 5, lq.RoleMember)
+	viewer := newActor(3, 5, lq.RoleViewer)
+	outsider := newActor(4, 6, lq.RoleAdmin)
+
+	// A job submitted by the viewer before being made a viewer
+	assert.Nil(t, admin.authorize(lq.ActionWrite, 3, 5, "job", 10))
+	assert.Nil(t, member.authorize(lq.ActionWrite, 3, 5, "job", 10))
+	assert.Nil(t, viewer.authorize(lq.ActionRead, 3, 5, "job", 10))
+
+	apiErr := viewer.authorize(lq.ActionWrite, 3, 5, "job", 10)
+	assert.Equal(t, http.StatusForbidden, apiErr.Status)
+	assert.Equal(t, ErrCodeForbidden, apiErr.Code)
+
+	apiErr = outsider.authorize(lq.ActionRead, 1, 5, "instance", 11)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+}
+
+func TestFormerMembersKeepSeeingTheirJobs(t *testing.T) {
+	former := newActor(2, 0, "")
+	assert.Nil(t, former.authorize(lq.ActionRead, 2, 5, "job", 10))
+	assert.Equal(t, http.StatusForbidden, former.authorize(lq.ActionWrite, 2, 5, "job", 10).Status)
+}
+
+func TestAuthorizeInOrg(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, newActor(1, 0, "").authorizeInOrg(lq.ActionRead, "see it").Status)
+	assert.Nil(t, newActor(1, 5, lq.RoleMember).authorizeInOrg(lq.ActionWrite, "submit jobs"))
+	assert.Equal(t, http.StatusForbidden, newActor(1, 5, lq.RoleViewer).authorizeInOrg(lq.ActionWrite, "submit jobs").Status)
+	assert.Equal(t, http.StatusForbidden, newActor(1, 5, lq.RoleMember).authorizeInOrg(lq.ActionManage, "add members").Status)
+}
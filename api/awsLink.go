@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	lqCloud "bargain/liquefy/cloudprovider"
+	"bargain/liquefy/common"
+	lq "bargain/liquefy/models"
+)
+
+// Accounts are linked through a role Liquefy assumes with an external id. The external id is derived from the user or
+// organization linking the account, so it cannot be chosen by them and a role trusting one owner's external id cannot
+// be linked by anyone else.
+type AwsLinkConfig struct {
+	ExternalIDSecret []byte
+	LiquefyAccountID string // aws account Liquefy assumes roles from
+}
+
+// The secret outside of production, where roles are not assumed for real
+const devExternalIDSecret = "liquefy-dev-external-id"
+
+var awsLink *AwsLinkConfig
+
+// Loads the role linking configuration from AWS_EXTERNAL_ID_SECRET and LIQUEFY_AWS_ACCOUNT_ID, which production
+// deployments must set
+func LoadAwsLinkConfig() (*AwsLinkConfig, error) {
+	config := &AwsLinkConfig{
+		ExternalIDSecret: []byte(os.Getenv("AWS_EXTERNAL_ID_SECRET")),
+		LiquefyAccountID: os.Getenv("LIQUEFY_AWS_ACCOUNT_ID"),
+	}
+	if common.IsProductionDeployment() {
+		if len(config.ExternalIDSecret) == 0 || config.LiquefyAccountID == "" {
+			return nil, errors.New("AWS_EXTERNAL_ID_SECRET and LIQUEFY_AWS_ACCOUNT_ID are required in production")
+		}
+	} else if len(config.ExternalIDSecret) == 0 {
+		config.ExternalIDSecret = []byte(devExternalIDSecret)
+	}
+	return config, nil
+}
+
+// The external id the role linked by the actor must require
+func (config *AwsLinkConfig) externalID(actor *Actor) string {
+	owner := fmt.Sprintf("user:%d", actor.User.ID)
+	if actor.Membership != nil {
+		owner = fmt.Sprintf("org:%d", actor.OrgID())
+	}
+	mac := hmac.New(sha256.New, config.ExternalIDSecret)
+	mac.Write([]byte(owner))
+	return "lq-" + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+type AwsPolicyView struct {
+	ExternalID  string `json:"external_id"`
+	Policy      string `json:"policy"`       // permissions policy to attach to the role
+	TrustPolicy string `json:"trust_policy"` // trust policy letting Liquefy assume the role
+}
+
+// Returns the policies of the role to link, with the external id of the user or their organization
+func GetAwsPolicy(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	externalID := awsLink.externalID(actor)
+	c.JSON(http.StatusOK, &AwsPolicyView{
+		ExternalID:  externalID,
+		Policy:      lqCloud.PolicyDocument(),
+		TrustPolicy: lqCloud.TrustPolicyDocument(awsLink.LiquefyAccountID, externalID),
+	})
+}
+
+// The account to store for a link request. Only the role or the keys are taken from the request, with the external
+// id of the actor. Production deployments only link roles, access keys are only for local and staging deployments.
+func newLinkedAccount(actor *Actor, request *lq.AwsAccount) (*lq.AwsAccount, *ApiError) {
+	if roleArn := request.GetAwsRoleArn(); roleArn != "" {
+		if !strings.HasPrefix(roleArn, "arn:aws:iam::") || !strings.Contains(roleArn, ":role/") {
+			return nil, badRequest("Invalid role arn %s", roleArn)
+		}
+		externalID := awsLink.externalID(actor)
+		return &lq.AwsAccount{AwsRoleArn: &roleArn, AwsExternalId: &externalID}, nil
+	}
+
+	if common.IsProductionDeployment() {
+		return nil, badRequest("An awsRoleArn is required, see /api/aws/policy for the role to create")
+	}
+	if request.GetAwsAccessKey() == "" || request.GetAwsSecretKey() == "" {
+		return nil, badRequest("An awsRoleArn, or an awsAccessKey and awsSecretKey are required")
+	}
+	return &lq.AwsAccount{AwsAccessKey: request.AwsAccessKey, AwsSecretKey: request.AwsSecretKey}, nil
+}
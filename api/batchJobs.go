@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+// Larger submissions are split by the client
+const MaxBatchJobs = 100
+
+type BatchJobsRequest struct {
+	Jobs []ContainerJobPublic `json:"jobs"`
+}
+
+// BatchJobResult is the outcome of a job of a batch, in the order they were submitted. Either every job of the batch
+// is created, or none is and the results give the error of each invalid job.
+type BatchJobResult struct {
+	Index int       `json:"index"`
+	JobID uint      `json:"job_id,omitempty"`
+	Error *ApiError `json:"error,omitempty"`
+}
+
+type BatchJobsResponse struct {
+	Results []*BatchJobResult `json:"results"`
+}
+
+func newBatchJobsResponse(ids []uint) *BatchJobsResponse {
+	results := make([]*BatchJobResult, len(ids))
+	for i, id := range ids {
+		results[i] = &BatchJobResult{Index: i, JobID: id}
+	}
+	return &BatchJobsResponse{Results: results}
+}
+
+// Validates and creates many jobs in one transaction. Retries of a request with an Idempotency-Key header return the
+// jobs the first request created.
+func CreateJobsBatch(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	request := BatchJobsRequest{}
+	key, replayed, apiErr := bindIdempotentRequest(c, &request)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if replayed != nil {
+		setReplayed(c)
+		setBatchAuditTarget(c, replayed)
+		c.JSON(http.StatusCreated, newBatchJobsResponse(replayed))
+		return
+	}
+
+	if len(request.Jobs) == 0 {
+		abortWithApiError(c, badRequest("No jobs given"))
+		return
+	}
+	if len(request.Jobs) > MaxBatchJobs {
+		abortWithApiError(c, badRequest("At most %d jobs can be submitted at once", MaxBatchJobs))
+		return
+	}
+
+	jobs := make([]*lq.ContainerJob, len(request.Jobs))
+	results := make([]*BatchJobResult, len(request.Jobs))
+	invalid := 0
+	for i, job := range request.Jobs {
+		results[i] = &BatchJobResult{Index: i}
+		if jobs[i], results[i].Error = newContainerJob(actor, job); results[i].Error != nil {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		c.Set("api_error", badRequest("%d of %d jobs are invalid", invalid, len(jobs)))
+		c.JSON(http.StatusBadRequest, &BatchJobsResponse{Results: results})
+		return
+	}
+	cpu := 0.0
+	for _, job := range jobs {
+		cpu += job.Cpu
+	}
+	if apiErr := checkJobQuota(actor.User.ID, len(jobs), cpu); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	ids, raced, apiErr := createJobs(jobs, key)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if raced {
+		setReplayed(c)
+	}
+	setBatchAuditTarget(c, ids)
+	c.JSON(http.StatusCreated, newBatchJobsResponse(ids))
+}
+
+func setBatchAuditTarget(c *gin.Context, ids []uint) {
+	targets := make([]string, len(ids))
+	for i, id := range ids {
+		targets[i] = fmt.Sprint(id)
+	}
+	c.Set(auditTargetKey, strings.Join(targets, ","))
+}
@@ -2,19 +2,26 @@ package main
 
 import (
     "flag"
+    "os"
 
     log "github.com/Sirupsen/logrus"
 
+    lqCloud "bargain/liquefy/cloudprovider"
     "bargain/liquefy/common"
     "bargain/liquefy/db"
     . "bargain/liquefy/api"
     "bargain/liquefy/logging"
+    "bargain/liquefy/tracing"
 )
 
 func main() {
     log.SetLevel(log.DebugLevel)
     dbIp := flag.String("dbIp", "localhost", "the ip of the db server")
     esIp := flag.String("esIp", "localhost", "the ip of the elastic search server")
+    logSinks := flag.String("logSinks", "stdout",
+        "where logs are shipped, comma separated: stdout, file:///path or http://host:port of elasticsearch")
+    traceExporter := flag.String("traceExporter", os.Getenv(tracing.TraceExporterEnv),
+        "where spans are exported: none, stdout or file:///path")
 
     flag.Parse()
 
@@ -23,15 +30,30 @@ func main() {
         if *esIp == "" {
             panic("Production and staging deployments require the esIp flag")
         }
-        log.AddHook(logging.NewElasticHook(*esIp, "9200", "liquefy-", "Provisioner", ""))
     }
-    log.AddHook(logging.NewElasticHook(*esIp,"9200","liquefy-","APIServer",""))
+    sinkSpec := *logSinks
+    if *esIp != "" {
+        sinkSpec += ",http://" + *esIp + ":9200"
+    }
+    sinks, err := logging.ParseSinks(sinkSpec, "liquefy-", "api")
+    if err != nil {
+        panic(err)
+    }
+    logging.Setup("api", nil, sinks...)
 
-    err := db.Connect(*dbIp)
+    exporter, err := tracing.NewExporter(*traceExporter)
     if err != nil {
         panic(err)
     }
+    tracing.SetExporter(exporter)
+
+    err = db.Connect(*dbIp)
+    if err != nil {
+        panic(err)
+    }
+
+    lqCloud.StartCatalogRefresh()
 
-    apiServer := NewApiServer()
+    apiServer := NewApiServer(db.NewPostgresStore())
     apiServer.Start()
 }
\ No newline at end of file
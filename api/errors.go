@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of the /v1 API, clients should switch on these rather than on messages
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeInvalidCursor  = "invalid_cursor"
+	ErrCodeUnauthorized   = "unauthorized"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeAccountLocked  = "account_locked"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeTooLarge       = "request_too_large"
+	ErrCodeRateLimited    = "rate_limited"
+	ErrCodeQuotaExceeded  = "quota_exceeded"
+	ErrCodeIdempotency    = "idempotency_conflict"
+	ErrCodeInternal       = "internal_error"
+)
+
+// Not in net/http before go 1.6
+const (
+	StatusUnprocessableEntity = 422
+	StatusTooManyRequests     = 429
+)
+
+// ApiError is the body of every failed /v1 request, wrapped as {"error": {...}}
+type ApiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ErrorEnvelope struct {
+	Error *ApiError `json:"error"`
+}
+
+func (err *ApiError) Error() string {
+	return err.Message
+}
+
+func newApiError(status int, code string, format string, args ...interface{}) *ApiError {
+	return &ApiError{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func badRequest(format string, args ...interface{}) *ApiError {
+	return newApiError(http.StatusBadRequest, ErrCodeInvalidRequest, format, args...)
+}
+
+func notFound(format string, args ...interface{}) *ApiError {
+	return newApiError(http.StatusNotFound, ErrCodeNotFound, format, args...)
+}
+
+func quotaExceeded(format string, args ...interface{}) *ApiError {
+	return newApiError(StatusTooManyRequests, ErrCodeQuotaExceeded, format, args...)
+}
+
+func internalError(format string, args ...interface{}) *ApiError {
+	return newApiError(http.StatusInternalServerError, ErrCodeInternal, format, args...)
+}
+
+// Writes the error envelope and stops any remaining handlers. The error is kept for the audit entry of the request.
+func abortWithApiError(c *gin.Context, err *ApiError) {
+	c.Set("api_error", err)
+	c.JSON(err.Status, ErrorEnvelope{Error: err})
+	c.Abort()
+}
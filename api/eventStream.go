@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/events"
+	lq "bargain/liquefy/models"
+)
+
+// Comments are sent this often on idle streams, so that proxies do not close them
+const eventStreamHeartbeat = 15 * time.Second
+
+// Streams the events the user can see as server sent events, until the client disconnects. The types query parameter
+// restricts the stream to a comma separated list of event types.
+func StreamEvents(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	types := map[string]bool{}
+	if c.Query("types") != "" {
+		for _, eventType := range strings.Split(c.Query("types"), ",") {
+			if !lq.IsValidEventType(eventType) {
+				abortWithApiError(c, badRequest("Invalid event type %s, expected one of %s", eventType,
+					strings.Join(lq.EventTypes, ", ")))
+				return
+			}
+			types[eventType] = true
+		}
+	}
+
+	received, unsubscribe := events.GetBus().Subscribe()
+	defer unsubscribe()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	closed := c.Writer.CloseNotify()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case event, ok := <-received:
+			if !ok {
+				return
+			}
+			if !event.VisibleTo(actor.User.ID, actor.OrgID()) || (len(types) > 0 && !types[event.Type]) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
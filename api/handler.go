@@ -28,10 +28,32 @@ type ContainerJobPublic struct {
 	SourceType   string           `json:"source_type,omitempty"`
 	SourceImage  string           `json:"source_image,omitempty"`
 	Environment  []lq.EnvVar      `json:"environment,omitempty"`
+	Secrets      []lq.SecretRef   `json:"secrets,omitempty"`
 	PortMappings []lq.PortMapping `json:"port_mappings,omitempty"`
 	Ram          int              `json:"ram,omitempty"`
 	Cpu          float64          `json:"cpu,omitempty"`
 	Gpu          int              `json:"gpu"`
+	Disk         int              `json:"disk,omitempty"`
+
+	// Put the disk on the local instance store volumes, mounted into the container at /scratch
+	InstanceStore bool `json:"instance_store,omitempty"`
+
+	// Service jobs
+	Kind        string          `json:"kind,omitempty"`
+	HealthCheck *lq.HealthCheck `json:"health_check,omitempty"`
+	MaxRestarts int             `json:"max_restarts,omitempty"`
+
+	// Build options for jobs built from a github repository
+	SourceBranch  string `json:"source_branch,omitempty"`
+	SourceCommit  string `json:"source_commit,omitempty"`
+	SourceDir     string `json:"source_dir,omitempty"`
+	Dockerfile    string `json:"dockerfile,omitempty"`
+	BuildRegistry string `json:"build_registry,omitempty"`
+}
+
+func (job ContainerJobPublic) hasBuildOptions() bool {
+	return job.SourceBranch != "" || job.SourceCommit != "" || job.SourceDir != "" ||
+		job.Dockerfile != "" || job.BuildRegistry != ""
 }
 
 // Helper function to parse user from context //
@@ -60,53 +82,92 @@ func GetUser(c *gin.Context) {
 	})
 }
 
+// Links an aws account to the user, or to their organization when they belong to one. The account is linked through
+// a role with the policies from GetAwsPolicy, which are verified before it is stored.
 func LinkAwsAccount(c *gin.Context) {
 	//Get user from the context
-	user := fetchUserFromContext(c)
-	account := &lq.AwsAccount{}
-	if err := c.BindJSON(&account); err != nil {
+	actor := fetchActorFromContext(c)
+	user := actor.User
+	request := &lq.AwsAccount{}
+	if err := c.BindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, err)
 		return
 	}
+	account, apiErr := newLinkedAccount(actor, request)
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
 
-	if user.AwsAccountID != 0 {
+	var org *lq.Organization
+	if actor.Membership != nil {
+		if apiErr := actor.authorizeInOrg(lq.ActionManage, "link the aws account"); apiErr != nil {
+			c.JSON(apiErr.Status, apiErr.Message)
+			return
+		}
+		var err error
+		if org, err = store.Organizations().Get(actor.OrgID()); err != nil {
+			c.JSON(http.StatusInternalServerError, lq.NewErrorf(err, "Failed getting organization").Error())
+			return
+		}
+		if org.AwsAccountID != 0 {
+			c.JSON(http.StatusNotAcceptable, lq.NewErrorf(nil, "Organization %s already has AWS account linked",
+				org.Name).Error())
+			return
+		}
+	} else if user.AwsAccountID != 0 {
 		c.JSON(http.StatusNotAcceptable, lq.NewErrorf(nil, "User %s already has AWS account linked", user.Email).Error())
 		return
 	}
 
 	//Verify Policies
-	awsCloud := lqCloud.NewAwsCloud(account.AwsAccessKey, account.AwsSecretKey)
+	awsCloud := lqCloud.NewAwsCloud(account)
 	if err := awsCloud.VerifyPolicy(); err != nil {
 		c.JSON(http.StatusNotAcceptable, lq.NewErrorf(err, "Failed linking AWS account for user %s", user.Email).Error())
 		return
 	}
 
-	if err := db.AwsAccounts().Create(user.ID, account); err != nil {
+	if org != nil {
+		if err := store.AwsAccounts().CreateForOrganization(org.ID, account); err != nil {
+			c.JSON(http.StatusInternalServerError, lq.NewErrorf(err, "Failed creating aws account for organization %s",
+				org.Name).Error())
+			return
+		}
+	} else if err := store.AwsAccounts().Create(user.ID, account); err != nil {
 		c.JSON(http.StatusInternalServerError, lq.NewErrorf(err, "Failed creating aws account for user %s", user.Email).Error())
 		return
 	}
 
+	setAuditTarget(c, uint(account.GetID()))
 	c.JSON(http.StatusCreated, "")
 }
 
 func SetupAwsAccount(c *gin.Context) {
-	user := fetchUserFromContext(c)
+	actor := fetchActorFromContext(c)
+	if actor.Membership != nil {
+		if apiErr := actor.authorizeInOrg(lq.ActionManage, "set up the aws account"); apiErr != nil {
+			c.JSON(apiErr.Status, apiErr.Message)
+			return
+		}
+	}
 
-	if user.AwsAccountID == 0 {
-		c.JSON(http.StatusNotAcceptable, lq.NewErrorf(nil, "User %s does not have an AWS account linked", user.Email).Error())
+	accountID, err := store.AwsAccounts().GetIDForOwner(actor.User.ID, actor.OrgID())
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, lq.NewErrorf(nil, "User %s does not have an AWS account linked",
+			actor.User.Email).Error())
 		return
 	}
 
-	account, err := db.AwsAccounts().Get(user.AwsAccountID)
+	account, err := store.AwsAccounts().Get(accountID)
 	if err != nil {
 		c.JSON(http.StatusNotAcceptable, lq.NewError("Failed to get user aws account info", err).Error())
 		return
 	}
 
-	awsCloud := lqCloud.NewAwsCloud(account.AwsAccessKey, account.AwsSecretKey)
+	awsCloud := lqCloud.NewAwsCloud(account)
 
 	account, setupError := awsCloud.SetupAwsAccountResources(account)
-	dbErr := db.AwsAccounts().Update(account)
+	dbErr := store.AwsAccounts().Update(account)
 	if setupError != nil {
 		c.JSON(http.StatusPreconditionFailed, setupError.Error())
 	}
@@ -122,120 +183,232 @@ func SetupAwsAccount(c *gin.Context) {
 //-----------------JOBS----------------------//
 
 func ListJobs(c *gin.Context) {
+	actor := fetchActorFromContext(c)
 
-	user := fetchUserFromContext(c)
-
-	var jobs []*lq.ContainerJob
-	jobs, err := db.Jobs().GetAllJobsByUser(user.ID)
+	jobs, err := store.Jobs().ListVisibleTo(actor.User.ID, actor.OrgID(), db.JobFilter{}, db.PageRequest{})
 	if err != nil {
 		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	views := make([]*JobView, len(jobs))
+	for i, job := range jobs {
+		views[i] = newJobView(job, "")
 	}
-	c.JSON(http.StatusOK, &jobs)
+	c.JSON(http.StatusOK, &views)
 }
 
 func GetJob(c *gin.Context) {
-	user := fetchUserFromContext(c)
-	jobID := c.Param("jobid")
-	jid, err := strconv.Atoi(jobID)
-
-	ctJob, err := db.Jobs().Get(uint(jid))
+	actor := fetchActorFromContext(c)
+	view, apiErr := getJobView(actor, c.Param("jobid"))
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
 
+// Fetches a job the actor can see, along with the address of the instance it runs on so clients can connect to
+// services
+func getJobView(actor *Actor, jobID string) (*JobView, *ApiError) {
+	jid, err := strconv.Atoi(jobID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, nil)
+		return nil, notFound("Unable to find job %s", jobID)
 	}
 
-	if ctJob.OwnerID != user.ID {
-		c.JSON(http.StatusNotFound, nil)
+	ctJob, err := store.Jobs().Get(uint(jid))
+	if err != nil {
+		return nil, notFound("Unable to find job %d", jid)
+	}
+	if apiErr := actor.authorize(lq.ActionRead, ctJob.OwnerID, ctJob.OrgID, "job", ctJob.ID); apiErr != nil {
+		return nil, apiErr
 	}
 
-	//TODO: Sanitize fields that should not be public
-	c.JSON(http.StatusOK, &ctJob)
+	hostIP := ""
+	if ctJob.InstanceID != 0 {
+		if instance, err := store.Resources().Get(ctJob.InstanceID); err == nil {
+			hostIP = instance.IP
+		}
+	}
+	return newJobView(ctJob, hostIP), nil
 }
 
+// Creates a job. Retries of a request with an Idempotency-Key header return the job the first request created.
 func CreateJob(c *gin.Context) {
-	var err error
-	user := fetchUserFromContext(c)
+	actor := fetchActorFromContext(c)
 	job := ContainerJobPublic{}
-	if err = c.BindJSON(&job); err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, err.Error())
+	key, replayed, apiErr := bindIdempotentRequest(c, &job)
+	if apiErr != nil {
+		log.Error(apiErr)
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	if replayed != nil {
+		setReplayed(c)
+		setAuditTarget(c, replayed[0])
+		c.JSON(http.StatusCreated, replayed[0])
 		return
 	}
 
-	// Ensure the users account info is correctly Linked
-	if awsAccount,err := db.AwsAccounts().Get(user.AwsAccountID); err != nil{
-		log.Error(fmt.Sprintf("Coudld not fetch aws for %s , err : %s",user.ID,err))
-		c.JSON(http.StatusBadRequest, "Unable to verify users AWS Account Link")
+	ctjob, apiErr := newContainerJob(actor, job)
+	if apiErr != nil {
+		log.Error(apiErr)
+		c.JSON(apiErr.Status, apiErr.Message)
 		return
-	}else{
-		if (awsAccount.GetAwsSecurityGroupIdUsEast1() == "" || awsAccount.GetAwsSecurityGroupIdUsWest1() == "" || awsAccount.GetAwsSshPrivateKeyUsWest2() == "" ){
-			c.JSON(http.StatusBadRequest, "Unable to verify users AWS Account Setup , please re-calibrate")
-			return
+	}
+
+	ids, raced, apiErr := createJobs([]*lq.ContainerJob{ctjob}, key)
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	if raced {
+		setReplayed(c)
+	}
+
+	setAuditTarget(c, ids[0])
+	c.JSON(http.StatusCreated, ids[0])
+}
+
+// Validates a job submitted by a user and converts it into the job that is stored. Members of an organization submit
+// jobs to it, so they run on its aws account.
+func newContainerJob(actor *Actor, job ContainerJobPublic) (*lq.ContainerJob, *ApiError) {
+	user := actor.User
+	if actor.Membership != nil {
+		if apiErr := actor.authorizeInOrg(lq.ActionWrite, "submit jobs"); apiErr != nil {
+			return nil, apiErr
 		}
+	}
+
+	// Ensure the users account info is correctly Linked
+	if awsAccount, err := store.AwsAccounts().GetForOwner(user.ID, actor.OrgID()); err != nil {
+		log.Error(fmt.Sprintf("Coudld not fetch aws for %d , err : %s", user.ID, err))
+		return nil, badRequest("Unable to verify users AWS Account Link")
+	} else {
+		if !lqCloud.IsAccountSetUp(awsAccount) {
+			return nil, badRequest("Unable to verify users AWS Account Setup , please re-calibrate")
+		}
+	}
 
-		//TODO : Validate this fact :
-		//Atleast 4 subnets to being using
+	// Validate the port mappings, a host port of 0 is assigned any free port when the job is launched
+	requestedHostPorts := make(map[int]struct{})
+	for _, mapping := range job.PortMappings {
+		if mapping.ContainerPort <= 0 || mapping.ContainerPort > 65535 {
+			return nil, badRequest("Container port %d is invalid", mapping.ContainerPort)
+		}
+		if mapping.HostPort == 0 {
+			continue
+		}
+		if !lq.IsAgentPort(mapping.HostPort) {
+			return nil, badRequest("Host port %d is not available on Liquefy instances", mapping.HostPort)
+		}
+		if _, requested := requestedHostPorts[mapping.HostPort]; requested {
+			return nil, badRequest("Host port %d is mapped more than once", mapping.HostPort)
+		}
+		requestedHostPorts[mapping.HostPort] = struct{}{}
 	}
 
 	// Convert ContainerJobPublic into ContainerJob
 	portMappingByteString := []byte("[]") // default to empty array
 	if job.PortMappings != nil {
-		portMappingByteString, err = json.Marshal(job.PortMappings)
+		bytes, err := json.Marshal(job.PortMappings)
 		if err != nil {
-			log.Error(err)
-			c.JSON(http.StatusBadRequest, err.Error())
-			return
+			return nil, badRequest("%s", err.Error())
 		}
+		portMappingByteString = bytes
 	}
 
 	// Validate the environment mappings
 	for _, envVar := range job.Environment {
 		if envVar.Variable == "" {
-			msg := "Environment variables cannot have empty keys"
-			log.Error(msg)
-			c.JSON(http.StatusBadRequest, msg)
-			return
+			return nil, badRequest("Environment variables cannot have empty keys")
 		}
 		if envVar.Value == "" {
-			msg := "Environment variables cannot have empty values"
-			log.Error(msg)
-			c.JSON(http.StatusBadRequest, msg)
-			return
+			return nil, badRequest("Environment variables cannot have empty values")
 		}
 	}
 
+	// Validate the secrets, which are resolved when the job is launched
+	if apiErr := validateSecretRefs(user.ID, job.Secrets, job.Environment); apiErr != nil {
+		return nil, apiErr
+	}
+	secretsByteString := []byte("[]")
+	if job.Secrets != nil {
+		bytes, err := json.Marshal(job.Secrets)
+		if err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+		secretsByteString = bytes
+	}
+
+	// Validate the job kind and health check
+	if job.Kind == "" {
+		job.Kind = lq.ContainerJobKindBatch
+	}
+	if job.Kind != lq.ContainerJobKindBatch && job.Kind != lq.ContainerJobKindService {
+		return nil, badRequest("Invalid job kind %s", job.Kind)
+	}
+	if job.Kind != lq.ContainerJobKindService && (job.HealthCheck != nil || job.MaxRestarts != 0) {
+		return nil, badRequest("Health checks and restarts can only be given for service jobs")
+	}
+	if job.MaxRestarts < 0 {
+		return nil, badRequest("Max restarts cannot be negative")
+	}
+
+	healthCheckByteString := []byte("")
+	if job.HealthCheck != nil {
+		if err := job.HealthCheck.Validate(); err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+		job.HealthCheck.SetDefaults()
+		bytes, err := json.Marshal(job.HealthCheck)
+		if err != nil {
+			return nil, badRequest("%s", err.Error())
+		}
+		healthCheckByteString = bytes
+	}
+
 	environmentByteString := []byte("[]") // default to empty array
 	if job.Environment != nil {
-		environmentByteString, err = json.Marshal(job.Environment)
+		bytes, err := json.Marshal(job.Environment)
 		if err != nil {
-			log.Error(err)
-			c.JSON(http.StatusBadRequest, err.Error())
-			return
+			return nil, badRequest("%s", err.Error())
 		}
+		environmentByteString = bytes
 	}
 
-	ctjob := lq.ContainerJob{
+	ctjob := &lq.ContainerJob{
 		Name:           job.Name,
 		Command:        job.Command,
 		SourceImage:    job.SourceImage,
 		Ram:            job.Ram,
 		Cpu:            job.Cpu,
 		Gpu:            job.Gpu,
+		Disk:           job.Disk,
+		InstanceStore:  job.InstanceStore,
 		PortMappings:   string(portMappingByteString),
 		Environment:    string(environmentByteString),
+		Secrets:        string(secretsByteString),
+		Kind:           job.Kind,
+		HealthCheck:    string(healthCheckByteString),
+		MaxRestarts:    job.MaxRestarts,
+		SourceBranch:   job.SourceBranch,
+		SourceCommit:   job.SourceCommit,
+		SourceDir:      job.SourceDir,
+		Dockerfile:     job.Dockerfile,
+		BuildRegistry:  job.BuildRegistry,
 		Status:         mesos.TaskState_TASK_STAGING.Enum().String(),
 		OwnerID:        user.ID,
+		OrgID:          actor.OrgID(),
 		InstanceID:     0,
 		UserTerminated: false,
 	}
 
 	// Validate that a possible instance can fit this job
-	possibleInstances := lqCloud.FindPossibleInstances(job.Cpu, float64(job.Ram), float64(job.Gpu), 0.0)
-	if len(possibleInstances) == 0 || job.Cpu == 0 || job.Ram == 0{
-		msg := "Job cpu/mem/gpu requirements invalid for any AWS instance"
-		log.Error(msg)
-		c.JSON(http.StatusBadRequest, msg)
-		return
+	possibleInstances := lqCloud.FindPossibleInstances(job.Cpu, float64(job.Ram), float64(job.Gpu),
+		float64(job.Disk), job.InstanceStore)
+	if len(possibleInstances) == 0 || job.Cpu == 0 || job.Ram == 0 || job.Disk < 0 {
+		return nil, badRequest("Job cpu/mem/gpu/disk requirements invalid for any AWS instance")
 	}
 
 	// Infer source type from image name
@@ -245,101 +418,170 @@ func CreateJob(c *gin.Context) {
 		ctjob.SourceType = "image"
 	}
 
-	if err := db.Jobs().Create(&ctjob); err != nil {
-		log.Error(lq.NewErrorf(err, "Failed creating job due to internal server error"))
-		c.JSON(http.StatusInternalServerError, "Failed creating job due to internal server error")
+	// Validate the build options
+	if ctjob.SourceType != "code" && job.hasBuildOptions() {
+		return nil, badRequest("Build options can only be given for jobs built from a github repository")
+	}
+	if job.SourceBranch != "" && job.SourceCommit != "" {
+		return nil, badRequest("Only one of source_branch and source_commit can be given")
+	}
+	for _, buildPath := range []string{job.SourceDir, job.Dockerfile} {
+		if strings.HasPrefix(buildPath, "/") || hasParentSegment(buildPath) {
+			return nil, badRequest("Build path %s must be relative to the repository", buildPath)
+		}
+	}
+
+	if apiErr := checkJobQuota(user.ID, 1, job.Cpu); apiErr != nil {
+		return nil, apiErr
 	}
 
-	c.JSON(http.StatusCreated, ctjob.ID)
+	return ctjob, nil
 }
 
-func DeleteJob(context *gin.Context) {
-	user := fetchUserFromContext(context)
+// Whether the path has a .. segment, which could leave the repository. Names like v1..v2 are allowed.
+func hasParentSegment(buildPath string) bool {
+	for _, segment := range strings.Split(buildPath, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
 
-	jobId, err := strconv.Atoi(context.Param("jobid"))
+func GetJobBuildLog(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	jid, err := strconv.Atoi(c.Param("jobid"))
 	if err != nil {
-		context.JSON(http.StatusNotFound, err)
+		c.JSON(http.StatusNotFound, err.Error())
+		return
 	}
 
-	job, err := db.Jobs().Get(uint(jobId))
+	job, err := store.Jobs().Get(uint(jid))
 	if err != nil {
-		context.JSON(http.StatusNotFound, err)
+		c.JSON(http.StatusNotFound, "Unable to find job")
+		return
+	}
+	if apiErr := actor.authorize(lq.ActionRead, job.OwnerID, job.OrgID, "job", job.ID); apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
 	}
 
-	// Verify that the job is owned by this user
-	if job.OwnerID != user.ID {
-		context.JSON(http.StatusUnauthorized, fmt.Sprintf("User %s does not own the job %d", user.Email, jobId))
+	buildLogs, err := store.BuildLogs().GetByJob(job.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("Failed getting build logs of job %d", job.ID))
 		return
 	}
 
-	err = db.Jobs().MarkUserTerminated(uint(jobId))
+	c.JSON(http.StatusOK, &buildLogs)
+}
+
+func DeleteJob(context *gin.Context) {
+	actor := fetchActorFromContext(context)
+	jobId, apiErr := deleteJob(actor, context.Param("jobid"))
+	if apiErr != nil {
+		context.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	context.JSON(http.StatusOK, jobId)
+}
+
+// Marks a job for termination, if the actor is allowed to terminate it
+func deleteJob(actor *Actor, jobID string) (uint, *ApiError) {
+	jobId, err := strconv.Atoi(jobID)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, fmt.Sprintf("Failed marking job %d for termination", jobId))
-	} else {
-		context.JSON(http.StatusOK, jobId)
+		return 0, notFound("Unable to find job %s", jobID)
+	}
+
+	job, err := store.Jobs().Get(uint(jobId))
+	if err != nil {
+		return 0, notFound("Unable to find job %d", jobId)
 	}
+
+	if apiErr := actor.authorize(lq.ActionWrite, job.OwnerID, job.OrgID, "job", job.ID); apiErr != nil {
+		return 0, apiErr
+	}
+
+	if err = store.Jobs().MarkUserTerminated(uint(jobId)); err != nil {
+		return 0, internalError("Failed marking job %d for termination", jobId)
+	}
+	return uint(jobId), nil
 }
 
 //----------------- INSTANCES ----------------------//
 
 func ListInstances(c *gin.Context) {
-	user := fetchUserFromContext(c)
-	instances, err := db.Resources().GetUsersResources(user.ID)
-
+	actor := fetchActorFromContext(c)
+	instances, err := store.Resources().ListVisibleTo(actor.User.ID, actor.OrgID(), db.InstanceFilter{}, db.PageRequest{})
 	if err != nil {
 		c.JSON(http.StatusNotFound, err.Error())
+		return
 	}
 
-	c.JSON(http.StatusOK, &instances)
+	views := make([]*InstanceView, len(instances))
+	for i, instance := range instances {
+		views[i] = newInstanceView(instance)
+	}
+	c.JSON(http.StatusOK, &views)
 }
 
 func GetInstance(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	instance, apiErr := getInstance(actor, c.Param("instanceid"))
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	c.JSON(http.StatusOK, newInstanceView(instance))
+}
 
-	user := fetchUserFromContext(c)
-	instanceID := c.Param("instanceid")
-
+func getInstance(actor *Actor, instanceID string) (*lq.ResourceInstance, *ApiError) {
 	iid, err := strconv.Atoi(instanceID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, err)
+		return nil, notFound("Unable to find instance %s", instanceID)
 	}
 
-	instance, err := db.Resources().Get(uint(iid))
-	if err != nil || (instance.OwnerId != user.ID) {
-		c.JSON(http.StatusNotFound, "Unable to find instance")
+	instance, err := store.Resources().Get(uint(iid))
+	if err != nil {
+		return nil, notFound("Unable to find instance %d", iid)
 	}
-
-	c.JSON(http.StatusOK, &instance)
+	if apiErr := actor.authorize(lq.ActionRead, instance.OwnerId, instance.OrgID, "instance", instance.ID); apiErr != nil {
+		return nil, apiErr
+	}
+	return instance, nil
 }
 
 func DeleteInstance(context *gin.Context) {
-	user := fetchUserFromContext(context)
+	actor := fetchActorFromContext(context)
+	instanceId, apiErr := deleteInstance(actor, context.Param("instanceid"))
+	if apiErr != nil {
+		context.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	context.JSON(http.StatusOK, instanceId)
+}
 
-	instanceId, err := strconv.Atoi(context.Param("instanceid"))
+// Marks an instance for termination, if the actor is allowed to terminate it
+func deleteInstance(actor *Actor, instanceID string) (uint, *ApiError) {
+	instanceId, err := strconv.Atoi(instanceID)
 	if err != nil {
-		context.JSON(http.StatusNotFound, err)
-		return
+		return 0, notFound("Unable to find instance %s", instanceID)
 	}
 
-	instance, err := db.Resources().Get(uint(instanceId))
+	instance, err := store.Resources().Get(uint(instanceId))
 	if err != nil {
-		context.JSON(http.StatusNotFound, err.Error())
-		return
+		return 0, notFound("Unable to find instance %d", instanceId)
 	}
 
-	// Verify that the instance is owned by this user
-	if instance.OwnerId != user.ID {
-		msg := fmt.Sprintf("User %s does not own the instance %d", user.Email, instanceId)
-		log.Warn(msg)
-		context.JSON(http.StatusUnauthorized, msg)
-		return
+	if apiErr := actor.authorize(lq.ActionWrite, instance.OwnerId, instance.OrgID, "instance", instance.ID); apiErr != nil {
+		log.Warnf("User %s cannot terminate instance %d: %s", actor.User.Email, instanceId, apiErr.Message)
+		return 0, apiErr
 	}
 
 	// Mark resource as user terminated
-	if err := db.Resources().MarkUserTerminated(uint(instanceId)); err != nil {
+	if err := store.Resources().MarkUserTerminated(uint(instanceId)); err != nil {
 		err = lq.NewErrorf(err, "Failed updating instance %d as being marked for termination", instanceId)
 		log.Error(err)
-		context.JSON(http.StatusInternalServerError, err.Error())
-	} else {
-		context.JSON(http.StatusOK, instanceId)
+		return 0, internalError("%s", err.Error())
 	}
+	return uint(instanceId), nil
 }
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// Set on responses to retries, which return the jobs created by the first request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Reads the JSON body of a job submission into v. With an Idempotency-Key header, returns the key to create the jobs
+// with, or the ids of the jobs already created with it when the request is a retry.
+func bindIdempotentRequest(c *gin.Context, v interface{}) (*lq.IdempotencyKey, []uint, *ApiError) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, nil, badRequest("Failed reading request: %s", err.Error())
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, nil, badRequest("Invalid request: %s", err.Error())
+	}
+
+	header := c.Request.Header.Get(IdempotencyKeyHeader)
+	if header == "" {
+		return nil, nil, nil
+	}
+	if err := lq.ValidateIdempotencyKey(header); err != nil {
+		return nil, nil, badRequest("%s", err.Error())
+	}
+	user := fetchUserFromContext(c)
+	hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+	key := &lq.IdempotencyKey{UserID: user.ID, Key: header, RequestHash: hex.EncodeToString(hash[:])}
+
+	existing, err := store.IdempotencyKeys().Get(user.ID, header)
+	if err != nil {
+		return nil, nil, internalError("Failed getting idempotency key")
+	}
+	if existing == nil {
+		return key, nil, nil
+	}
+	ids, apiErr := replayIdempotencyKey(key, existing)
+	return nil, ids, apiErr
+}
+
+// The jobs created with an existing key, which must have been used for the same request
+func replayIdempotencyKey(key *lq.IdempotencyKey, existing *lq.IdempotencyKey) ([]uint, *ApiError) {
+	if existing.RequestHash != key.RequestHash {
+		return nil, newApiError(StatusUnprocessableEntity, ErrCodeIdempotency,
+			"Idempotency key %s was already used for another request", key.Key)
+	}
+	ids, err := existing.GetJobIDs()
+	if err != nil {
+		log.Error(err)
+		return nil, internalError("Failed getting jobs of idempotency key")
+	}
+	return ids, nil
+}
+
+// Creates the jobs in one transaction and returns their ids. When a concurrent retry with the same idempotency key
+// created them first, returns the ids of its jobs instead and whether that happened.
+func createJobs(jobs []*lq.ContainerJob, key *lq.IdempotencyKey) ([]uint, bool, *ApiError) {
+	// Every job starts its own trace, which the services it goes through record their spans in
+	spans := make([]*tracing.Span, len(jobs))
+	for i, job := range jobs {
+		spans[i] = tracing.StartSpan("api.create_job", tracing.SpanContext{})
+		spans[i].SetAttribute("user.id", job.OwnerID)
+		job.TraceParent = spans[i].Context().String()
+	}
+
+	err := store.Jobs().CreateMany(jobs, key)
+	for i, job := range jobs {
+		spans[i].SetAttribute("job.id", job.ID)
+		spans[i].Finish(err)
+	}
+	if err != nil {
+		if key != nil {
+			if existing, _ := store.IdempotencyKeys().Get(key.UserID, key.Key); existing != nil {
+				ids, apiErr := replayIdempotencyKey(key, existing)
+				return ids, true, apiErr
+			}
+		}
+		log.Error(err)
+		return nil, false, internalError("Failed creating jobs")
+	}
+
+	ids := make([]uint, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids, false, nil
+}
+
+func setReplayed(c *gin.Context) {
+	c.Writer.Header().Set(IdempotentReplayedHeader, "true")
+}
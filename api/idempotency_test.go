@@ -0,0 +1,87 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
+)
+
+// Points the handlers at an empty memory store, returning a function restoring the previous store
+func useMemoryStore() func() {
+	previous := store
+	store = db.NewMemoryStore()
+	return func() { store = previous }
+}
+
+func TestCreateJobsReplaysIdempotencyKey(t *testing.T) {
+	defer useMemoryStore()()
+
+	key := &lq.IdempotencyKey{UserID: 1, Key: "retry", RequestHash: "hash"}
+	ids, replayed, apiErr := createJobs([]*lq.ContainerJob{{Name: "job", OwnerID: 1}}, key)
+	assert.Nil(t, apiErr)
+	assert.False(t, replayed)
+	assert.Len(t, ids, 1)
+
+	// A concurrent retry gets the jobs of the first request
+	retry := &lq.IdempotencyKey{UserID: 1, Key: "retry", RequestHash: "hash"}
+	replayedIDs, replayed, apiErr := createJobs([]*lq.ContainerJob{{Name: "job", OwnerID: 1}}, retry)
+	assert.Nil(t, apiErr)
+	assert.True(t, replayed)
+	assert.Equal(t, ids, replayedIDs)
+
+	// Another request cannot reuse the key
+	other := &lq.IdempotencyKey{UserID: 1, Key: "retry", RequestHash: "other"}
+	_, _, apiErr = createJobs([]*lq.ContainerJob{{Name: "job", OwnerID: 1}}, other)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, ErrCodeIdempotency, apiErr.Code)
+	}
+}
+
+func TestCheckJobQuota(t *testing.T) {
+	defer useMemoryStore()()
+
+	assert.Nil(t, store.Quotas().Set(&lq.Quota{UserID: 1, MaxActiveJobs: 2, MaxInstances: 1, MaxVCpus: 4}))
+	assert.Nil(t, checkJobQuota(1, 2, 1))
+
+	_, _, apiErr := createJobs([]*lq.ContainerJob{{Name: "job", OwnerID: 1, Cpu: 3}}, nil)
+	assert.Nil(t, apiErr)
+	assert.Nil(t, checkJobQuota(1, 1, 1))
+	assert.NotNil(t, checkJobQuota(1, 2, 1))
+
+	// The vcpus of active jobs count against the quota
+	assert.NotNil(t, checkJobQuota(1, 1, 2))
+
+	// Other users keep the default quota
+	assert.Nil(t, checkJobQuota(2, 2, 1))
+}
+
+func TestCreateJobsStartsTraces(t *testing.T) {
+	defer useMemoryStore()()
+	memory := tracing.NewMemoryExporter()
+	tracing.SetExporter(memory)
+	defer tracing.SetExporter(nil)
+
+	jobs := []*lq.ContainerJob{{Name: "first", OwnerID: 1}, {Name: "second", OwnerID: 1}}
+	ids, _, apiErr := createJobs(jobs, nil)
+	assert.Nil(t, apiErr)
+
+	// Each job is the root of its own trace, persisted with it
+	spans := memory.Spans()
+	if assert.Len(t, spans, 2) {
+		for i, span := range spans {
+			job, err := store.Jobs().Get(ids[i])
+			assert.Nil(t, err)
+			assert.Equal(t, span.Context(), tracing.ContextOf(job.TraceParent))
+			assert.Equal(t, "api.create_job", span.Name)
+			assert.Equal(t, "", span.ParentID)
+			assert.Equal(t, strconv.Itoa(int(ids[i])), span.Attributes["job.id"])
+			assert.Equal(t, span.TraceID, newJobView(job, "").TraceID)
+		}
+		assert.NotEqual(t, spans[0].TraceID, spans[1].TraceID)
+	}
+}
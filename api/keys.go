@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+type ApiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// The key itself is only part of the response that creates it
+type CreatedApiKey struct {
+	*lq.ApiKey
+	Key string `json:"key"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func ListApiKeys(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	keys, err := store.ApiKeys().GetByUser(user.ID)
+	if err != nil {
+		abortWithApiError(c, internalError("Failed listing api keys"))
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func CreateApiKey(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	request := ApiKeyRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid api key request: %s", err.Error()))
+		return
+	}
+
+	if request.Name == "" {
+		abortWithApiError(c, badRequest("Api keys must be named"))
+		return
+	}
+	if len(request.Scopes) == 0 {
+		abortWithApiError(c, badRequest("Api keys must have at least one scope"))
+		return
+	}
+
+	// A key cannot be given more access than the token creating it has
+	granted, _ := c.Keys["scopes"].([]string)
+	for _, scope := range request.Scopes {
+		if !lq.IsValidScope(scope) {
+			abortWithApiError(c, badRequest("Invalid scope %s", scope))
+			return
+		}
+		if !lq.HasScope(granted, scope) {
+			abortWithApiError(c, newApiError(http.StatusForbidden, ErrCodeForbidden,
+				"Cannot create a key with the %s scope", scope))
+			return
+		}
+	}
+
+	secret, key, err := newApiKey(user.ID, request.Name, request.Scopes)
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed creating api key"))
+		return
+	}
+	setAuditTarget(c, key.ID)
+	c.JSON(http.StatusCreated, CreatedApiKey{ApiKey: key, Key: secret})
+}
+
+func RevokeApiKey(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	keyID, err := strconv.Atoi(c.Param("keyid"))
+	if err != nil {
+		abortWithApiError(c, notFound("Unable to find api key %s", c.Param("keyid")))
+		return
+	}
+
+	if err := store.ApiKeys().Revoke(user.ID, uint(keyID)); err != nil {
+		abortWithApiError(c, notFound("Unable to find api key %d", keyID))
+		return
+	}
+	c.JSON(http.StatusOK, keyID)
+}
+
+// Exchanges a refresh token for a new token pair. Every refresh token can only be used once.
+func RefreshSession(c *gin.Context) {
+	request := RefreshRequest{}
+	if err := c.BindJSON(&request); err != nil || request.RefreshToken == "" {
+		abortWithApiError(c, badRequest("A refresh_token is required"))
+		return
+	}
+
+	session, err := refreshSession(request.RefreshToken)
+	if err != nil {
+		log.Warn(err)
+		abortWithApiError(c, newApiError(http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid refresh token"))
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
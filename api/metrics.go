@@ -0,0 +1,57 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/metrics"
+)
+
+// Route of requests that matched none, they are counted together so unknown paths do not each add a series
+const unmatchedRoute = "unmatched"
+
+// Records the latency of every request by method, route template and status
+func Instrumented() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		metrics.APIRequestDuration.With(c.Request.Method, routeTemplate(c.Request.URL.Path, c.Params, status),
+			strconv.Itoa(status)).ObserveSince(start)
+	}
+}
+
+// The route a path matched, with its parameters in place of their values, ex: /api/jobs/:jobid
+func routeTemplate(path string, params gin.Params, status int) string {
+	if len(params) == 0 && status == 404 {
+		return unmatchedRoute
+	}
+	// Parameters are in the order of the path, so each is looked for after the previous one
+	segments := strings.Split(path, "/")
+	next := 0
+	for _, param := range params {
+		// Catch all parameters hold the rest of the path
+		if strings.HasPrefix(param.Value, "/") && strings.HasSuffix(path, param.Value) {
+			prefix := strings.Split(strings.TrimSuffix(path, param.Value), "/")
+			segments = append(segments[:len(prefix)], "*"+param.Key)
+			break
+		}
+		for i := next; i < len(segments); i++ {
+			if segments[i] == param.Value {
+				segments[i] = ":" + param.Key
+				next = i + 1
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Exposes the metrics of the API in the Prometheus text format
+func MetricsHandler(c *gin.Context) {
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	assert.Equal(t, "/v1/jobs", routeTemplate("/v1/jobs", nil, 200))
+	assert.Equal(t, "/v1/jobs/:jobid/events", routeTemplate("/v1/jobs/12/events",
+		gin.Params{{Key: "jobid", Value: "12"}}, 200))
+
+	// Values are replaced in the order of the parameters, not wherever they appear
+	assert.Equal(t, "/api/orgs/:orgid/members/:userid", routeTemplate("/api/orgs/3/members/3",
+		gin.Params{{Key: "orgid", Value: "3"}, {Key: "userid", Value: "3"}}, 200))
+
+	assert.Equal(t, "/apidoc/*filepath", routeTemplate("/apidoc/css/main.css",
+		gin.Params{{Key: "filepath", Value: "/css/main.css"}}, 200))
+
+	// Unknown paths are not each a route
+	assert.Equal(t, unmatchedRoute, routeTemplate("/wp-admin/login.php", nil, 404))
+	assert.Equal(t, "/v1/jobs/:jobid", routeTemplate("/v1/jobs/99", gin.Params{{Key: "jobid", Value: "99"}}, 404))
+}
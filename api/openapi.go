@@ -0,0 +1,221 @@
+package api
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The OpenAPI spec served at /api_spec is generated from the routes below and the types they exchange, so that it
+// stays in sync with the /v1 handlers
+
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string
+	Description string
+}
+
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Params   []apiParam
+	Body     interface{} // request body type
+	Response interface{} // response body type
+	Status   int         // status of a successful response
+	Paged    bool        // whether the response is a Page of Response
+}
+
+var pageParams = []apiParam{
+	{"cursor", "query", "string", "Cursor returned as next_cursor by the previous page"},
+	{"limit", "query", "integer", "Number of items per page, at most 200"},
+}
+
+var archivedParam = apiParam{"archived", "query", "boolean", "List the archived history instead, when it is archived"}
+
+var jobIDParam = apiParam{"jobid", "path", "integer", "Job id"}
+var instanceIDParam = apiParam{"instanceid", "path", "integer", "Instance id"}
+
+var v1Operations = []apiOperation{
+	{
+		Method: "get", Path: "/v1/jobs", Summary: "List jobs, most recently created first",
+		Params: append([]apiParam{
+			{"status", "query", "string", "Only jobs with this status, ex: TASK_RUNNING"},
+			{"name", "query", "string", "Only jobs whose name contains this"},
+			{"instance_id", "query", "integer", "Only jobs assigned to this instance"},
+			{"started_after", "query", "integer", "Only jobs started at or after this unix time"},
+			{"started_before", "query", "integer", "Only jobs started before this unix time"},
+			archivedParam,
+		}, pageParams...),
+		Response: JobView{}, Status: 200, Paged: true,
+	},
+	{
+		Method: "post", Path: "/v1/jobs", Summary: "Create a job",
+		Body: ContainerJobPublic{}, Response: JobView{}, Status: 201,
+	},
+	{
+		Method: "get", Path: "/v1/jobs/{jobid}", Summary: "Get a job",
+		Params: []apiParam{jobIDParam}, Response: JobView{}, Status: 200,
+	},
+	{
+		Method: "get", Path: "/v1/jobs/{jobid}/events",
+		Summary: "Get the status history of a job and the time it spent queued, provisioning, preparing and running",
+		Params:  []apiParam{jobIDParam}, Response: JobTimelineView{}, Status: 200,
+	},
+	{
+		Method: "delete", Path: "/v1/jobs/{jobid}", Summary: "Terminate a job",
+		Params: []apiParam{jobIDParam}, Response: JobView{}, Status: 200,
+	},
+	{
+		Method: "get", Path: "/v1/instances", Summary: "List instances, most recently created first",
+		Params: append([]apiParam{
+			{"status", "query", "string", "Only instances with this status, ex: running"},
+			{"launched_after", "query", "integer", "Only instances launched at or after this unix time"},
+			{"launched_before", "query", "integer", "Only instances launched before this unix time"},
+			archivedParam,
+		}, pageParams...),
+		Response: InstanceView{}, Status: 200, Paged: true,
+	},
+	{
+		Method: "get", Path: "/v1/instances/{instanceid}", Summary: "Get an instance",
+		Params: []apiParam{instanceIDParam}, Response: InstanceView{}, Status: 200,
+	},
+	{
+		Method: "get", Path: "/v1/instances/{instanceid}/events", Summary: "Get the status history of an instance",
+		Params: []apiParam{instanceIDParam}, Response: InstanceTimelineView{}, Status: 200,
+	},
+	{
+		Method: "delete", Path: "/v1/instances/{instanceid}", Summary: "Terminate an instance",
+		Params: []apiParam{instanceIDParam}, Response: InstanceView{}, Status: 200,
+	},
+}
+
+// Generates the OpenAPI 3 spec of the /v1 API
+func OpenApiSpec() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemaRef(reflect.TypeOf(ErrorEnvelope{}), schemas)},
+		},
+	}
+
+	paths := make(map[string]interface{})
+	for _, op := range v1Operations {
+		responseSchema := schemaRef(reflect.TypeOf(op.Response), schemas)
+		if op.Paged {
+			responseSchema = map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"items":       map[string]interface{}{"type": "array", "items": responseSchema},
+					"next_cursor": map[string]interface{}{"type": "string"},
+				},
+			}
+		}
+
+		parameters := []interface{}{}
+		for _, param := range op.Params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        param.Name,
+				"in":          param.In,
+				"required":    param.In == "path",
+				"description": param.Description,
+				"schema":      map[string]interface{}{"type": param.Type},
+			})
+		}
+
+		operation := map[string]interface{}{
+			"summary":    op.Summary,
+			"parameters": parameters,
+			"responses": map[string]interface{}{
+				strconv.Itoa(op.Status): map[string]interface{}{
+					"description": "Success",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": responseSchema},
+					},
+				},
+				"default": errorResponse,
+			},
+		}
+		if op.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemaRef(reflect.TypeOf(op.Body), schemas),
+					},
+				},
+			}
+		}
+
+		if _, ok := paths[op.Path]; !ok {
+			paths[op.Path] = make(map[string]interface{})
+		}
+		paths[op.Path].(map[string]interface{})[op.Method] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "Liquefy API",
+			"version": "v1",
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []interface{}{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// The schema of a type, with named structs added to schemas and referenced
+func schemaRef(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+
+		// Registered before the fields are walked so recursive types terminate
+		schema := map[string]interface{}{"type": "object"}
+		schemas[t.Name()] = schema
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaRef(field.Type, schemas)
+		}
+		schema["properties"] = properties
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
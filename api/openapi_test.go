@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenApiSpec(t *testing.T) {
+	spec := OpenApiSpec()
+
+	paths := spec["paths"].(map[string]interface{})
+	for _, op := range v1Operations {
+		assert.Contains(t, paths[op.Path], op.Method)
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	jobSchema := schemas["JobView"].(map[string]interface{})
+	properties := jobSchema["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, properties["id"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/HealthCheck"}, properties["health_check"])
+	assert.Contains(t, schemas, "ErrorEnvelope")
+	assert.Contains(t, schemas, "ContainerJobPublic")
+
+	// Fields not serialized are left out
+	errorSchema := schemas["ApiError"].(map[string]interface{})
+	assert.NotContains(t, errorSchema["properties"], "Status")
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type MemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type MemberView struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+type OrganizationView struct {
+	*lq.Organization
+	Members []*MemberView `json:"members"`
+}
+
+// Creates an organization with the user creating it as its admin
+func CreateOrganization(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	request := OrganizationRequest{}
+	if err := c.BindJSON(&request); err != nil || request.Name == "" {
+		abortWithApiError(c, badRequest("Organizations must be named"))
+		return
+	}
+	if actor.Membership != nil {
+		abortWithApiError(c, badRequest("You already belong to an organization"))
+		return
+	}
+
+	org := &lq.Organization{Name: request.Name}
+	if err := store.Organizations().Create(org, actor.User.ID); err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed creating organization"))
+		return
+	}
+
+	view, apiErr := getOrganizationView(org.ID)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	setAuditTarget(c, org.ID)
+	c.JSON(http.StatusCreated, view)
+}
+
+func GetOrganization(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	if apiErr := actor.authorizeInOrg(lq.ActionRead, "see the organization"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	view, apiErr := getOrganizationView(actor.OrgID())
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// Adds an existing user who does not belong to an organization yet
+func AddMember(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	if apiErr := actor.authorizeInOrg(lq.ActionManage, "add members"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	request := MemberRequest{}
+	if err := c.BindJSON(&request); err != nil || request.Email == "" {
+		abortWithApiError(c, badRequest("An email is required"))
+		return
+	}
+	if request.Role == "" {
+		request.Role = lq.RoleMember
+	}
+	if !lq.IsValidRole(request.Role) {
+		abortWithApiError(c, badRequest("Invalid role %s", request.Role))
+		return
+	}
+
+	user, err := store.Users().GetByEmail(request.Email)
+	if err != nil || user.ID == 0 {
+		abortWithApiError(c, notFound("Unable to find user %s", request.Email))
+		return
+	}
+	if membership, err := store.Organizations().GetMembership(user.ID); err != nil {
+		abortWithApiError(c, internalError("Failed adding member"))
+		return
+	} else if membership != nil {
+		abortWithApiError(c, badRequest("User %s already belongs to an organization", request.Email))
+		return
+	}
+
+	membership := &lq.Membership{OrgID: actor.OrgID(), UserID: user.ID, Role: request.Role}
+	if err := store.Organizations().AddMember(membership); err != nil {
+		abortWithApiError(c, internalError("Failed adding member"))
+		return
+	}
+	setAuditTarget(c, user.ID)
+	c.JSON(http.StatusCreated, &MemberView{UserID: user.ID, Email: user.Email, Role: membership.Role})
+}
+
+func SetMemberRole(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	if apiErr := actor.authorizeInOrg(lq.ActionManage, "change roles"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userid"))
+	if err != nil {
+		abortWithApiError(c, notFound("Unable to find member %s", c.Param("userid")))
+		return
+	}
+	request := MemberRequest{}
+	if err := c.BindJSON(&request); err != nil || !lq.IsValidRole(request.Role) {
+		abortWithApiError(c, badRequest("A role of admin, member or viewer is required"))
+		return
+	}
+
+	if err := store.Organizations().SetRole(actor.OrgID(), uint(userID), request.Role); err != nil {
+		log.Warn(err)
+		abortWithApiError(c, badRequest("Unable to change the role of user %d, they must be a member and the "+
+			"organization must keep an admin", userID))
+		return
+	}
+	c.JSON(http.StatusOK, userID)
+}
+
+// Removes a member, which admins can do to anyone and members to themselves to leave the organization. Jobs and
+// instances of the member stay with the organization.
+func RemoveMember(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	userID, err := strconv.Atoi(c.Param("userid"))
+	if err != nil {
+		abortWithApiError(c, notFound("Unable to find member %s", c.Param("userid")))
+		return
+	}
+
+	if uint(userID) != actor.User.ID {
+		if apiErr := actor.authorizeInOrg(lq.ActionManage, "remove members"); apiErr != nil {
+			abortWithApiError(c, apiErr)
+			return
+		}
+	} else if actor.Membership == nil {
+		abortWithApiError(c, notFound("You do not belong to an organization"))
+		return
+	}
+
+	if err := store.Organizations().RemoveMember(actor.OrgID(), uint(userID)); err != nil {
+		log.Warn(err)
+		abortWithApiError(c, badRequest("Unable to remove user %d, they must be a member and the organization must "+
+			"keep an admin", userID))
+		return
+	}
+	c.JSON(http.StatusOK, userID)
+}
+
+func getOrganizationView(orgID uint) (*OrganizationView, *ApiError) {
+	org, err := store.Organizations().Get(orgID)
+	if err != nil {
+		return nil, notFound("Unable to find organization %d", orgID)
+	}
+	memberships, err := store.Organizations().GetMembers(orgID)
+	if err != nil {
+		return nil, internalError("Failed getting members of organization %d", orgID)
+	}
+
+	view := &OrganizationView{Organization: org, Members: make([]*MemberView, len(memberships))}
+	for i, membership := range memberships {
+		member := &MemberView{UserID: membership.UserID, Role: membership.Role}
+		if user, err := store.Users().Get(membership.UserID); err == nil {
+			member.Email = user.Email
+		}
+		view.Members[i] = member
+	}
+	return view, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/db"
+)
+
+const DefaultPageLimit = 50
+const MaxPageLimit = 200
+
+const cursorPrefix = "id:"
+
+// Page is the body of every /v1 list request. NextCursor is empty on the last page.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Cursors are opaque to clients, they encode the id of the last item of the previous page
+func encodeCursor(id uint) string {
+	return base64.URLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCursor(cursor string) (uint, *ApiError) {
+	decoded, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return 0, newApiError(http.StatusBadRequest, ErrCodeInvalidCursor, "Cursor %s is invalid", cursor)
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(decoded), cursorPrefix), 10, 32)
+	if err != nil || id == 0 {
+		return 0, newApiError(http.StatusBadRequest, ErrCodeInvalidCursor, "Cursor %s is invalid", cursor)
+	}
+	return uint(id), nil
+}
+
+// Parses the cursor and limit query parameters. One more row than the limit is requested from the database so that
+// the existence of a next page is known without a separate count.
+func parsePageRequest(c *gin.Context) (db.PageRequest, *ApiError) {
+	page := db.PageRequest{Limit: DefaultPageLimit + 1}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > MaxPageLimit {
+			return page, badRequest("Limit must be between 1 and %d", MaxPageLimit)
+		}
+		page.Limit = limit + 1
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		beforeID, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.BeforeID = beforeID
+	}
+	return page, nil
+}
+
+// Trims the extra row requested by parsePageRequest, returning the number of items on the page and the cursor of the
+// next page
+func pageBounds(page db.PageRequest, count int, idAt func(int) uint) (int, string) {
+	limit := page.Limit - 1
+	if count <= limit {
+		return count, ""
+	}
+	return limit, encodeCursor(idAt(limit - 1))
+}
+
+// Parses an optional unix timestamp (in seconds) query parameter to nanoseconds, the unit times are stored in
+func parseTimeParam(c *gin.Context, name string) (int64, *ApiError) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, badRequest("%s must be a unix timestamp in seconds", name)
+	}
+	return seconds * 1e9, nil
+}
+
+func parseIDQuery(c *gin.Context, name string) (uint, *ApiError) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, badRequest("%s must be a positive integer", name)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"bargain/liquefy/db"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id, err := decodeCursor(encodeCursor(42))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(42), id)
+
+	_, err = decodeCursor("not a cursor")
+	assert.Equal(t, ErrCodeInvalidCursor, err.Code)
+
+	_, err = decodeCursor(encodeCursor(0))
+	assert.NotNil(t, err)
+}
+
+func TestPageBounds(t *testing.T) {
+	ids := []uint{9, 8, 7, 6}
+	idAt := func(i int) uint { return ids[i] }
+
+	// The extra row requested means there is a next page, starting after the last row shown
+	count, cursor := pageBounds(db.PageRequest{Limit: 4}, 4, idAt)
+	assert.Equal(t, 3, count)
+	beforeID, _ := decodeCursor(cursor)
+	assert.Equal(t, uint(7), beforeID)
+
+	count, cursor = pageBounds(db.PageRequest{Limit: 5}, 4, idAt)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, "", cursor)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+type QuotaView struct {
+	Quota *lq.Quota      `json:"quota"`
+	Usage *lq.QuotaUsage `json:"usage"`
+}
+
+func getQuotaView(userID uint) (*QuotaView, *ApiError) {
+	quota, err := store.Quotas().GetForUser(userID)
+	if err != nil {
+		return nil, internalError("Failed getting quota")
+	}
+	usage, err := store.Quotas().Usage(userID)
+	if err != nil {
+		log.Error(err)
+		return nil, internalError("Failed getting quota usage")
+	}
+	return &QuotaView{Quota: quota, Usage: usage}, nil
+}
+
+// Rejects jobs that would take the user over their quota of active jobs or vcpus
+func checkJobQuota(userID uint, count int, cpu float64) *ApiError {
+	view, apiErr := getQuotaView(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := view.Quota.AllowsJobs(view.Usage, count, cpu); err != nil {
+		return quotaExceeded("%s", err.Error())
+	}
+	return nil
+}
+
+// The quota of the user and what they use of it
+func GetQuota(c *gin.Context) {
+	view, apiErr := getQuotaView(fetchUserFromContext(c).ID)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// The quota of any user and what they use of it, for operators
+func GetUserQuota(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userid"))
+	if err != nil {
+		abortWithApiError(c, badRequest("Invalid user id %s", c.Param("userid")))
+		return
+	}
+	view, apiErr := getQuotaView(uint(userID))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// Sets the quota of any user, replacing the default one, for operators
+func SetUserQuota(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userid"))
+	if err != nil {
+		abortWithApiError(c, badRequest("Invalid user id %s", c.Param("userid")))
+		return
+	}
+	quota := lq.Quota{}
+	if err := c.BindJSON(&quota); err != nil {
+		abortWithApiError(c, badRequest("Invalid quota: %s", err.Error()))
+		return
+	}
+	if err := quota.Validate(); err != nil {
+		abortWithApiError(c, badRequest("%s", err.Error()))
+		return
+	}
+	if _, err := store.Users().Get(uint(userID)); err != nil {
+		abortWithApiError(c, notFound("Unable to find user %d", userID))
+		return
+	}
+
+	quota.UserID = uint(userID)
+	if err := store.Quotas().Set(&quota); err != nil {
+		abortWithApiError(c, internalError("Failed setting quota"))
+		return
+	}
+	c.JSON(http.StatusOK, &quota)
+}
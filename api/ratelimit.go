@@ -0,0 +1,215 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/cache"
+)
+
+// RateLimit is a token bucket: requests take a token, tokens are added back at Rate per second up to Burst
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitPolicy limits a class of requests per user, and per API key so that one runaway script does not use up
+// the whole budget of its user. Unauthenticated requests are limited per ip with the user limit.
+type RateLimitPolicy struct {
+	Name string
+	User RateLimit
+	Key  RateLimit
+}
+
+var (
+	// Every authenticated request
+	requestRateLimit = RateLimitPolicy{
+		Name: "requests",
+		User: RateLimit{Rate: 20, Burst: 100},
+		Key:  RateLimit{Rate: 10, Burst: 50},
+	}
+	// Creating jobs, each of which may request a spot instance
+	jobRateLimit = RateLimitPolicy{
+		Name: "jobs",
+		User: RateLimit{Rate: 1, Burst: 30},
+		Key:  RateLimit{Rate: 0.5, Burst: 20},
+	}
+	// Logging in and resetting passwords
+	authRateLimit = RateLimitPolicy{
+		Name: "auth",
+		User: RateLimit{Rate: 0.2, Burst: 10},
+	}
+)
+
+// Requests bodies larger than this are rejected
+const MaxRequestBodySize = 1 << 20
+
+type RateLimiter interface {
+	// Takes a token from the bucket of key. When none is left, returns how long until one is added back.
+	Take(key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// The limiter the api server uses, see NewRateLimiterFromEnv
+var rateLimiter RateLimiter = NewMemoryRateLimiter()
+
+// Rate limits are shared by every api server through redis, unless LQ_RATE_LIMIT_BACKEND is memory
+func NewRateLimiterFromEnv() (RateLimiter, error) {
+	switch backend := os.Getenv("LQ_RATE_LIMIT_BACKEND"); backend {
+	case "", "redis":
+		return NewRedisRateLimiter(cache.GetConnection), nil
+	case "memory":
+		return NewMemoryRateLimiter(), nil
+	default:
+		return nil, fmt.Errorf("Invalid LQ_RATE_LIMIT_BACKEND %s, expected redis or memory", backend)
+	}
+}
+
+// Refills the bucket for the time elapsed since it was last taken from and takes a token if there is one
+func takeToken(tokens float64, elapsed time.Duration, limit RateLimit) (float64, bool, time.Duration) {
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	if limit.Rate <= 0 {
+		return tokens, false, time.Hour
+	}
+	retryAfter := time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	return tokens, false, retryAfter
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Keeps buckets in memory, for tests and single api servers
+type memoryRateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (limiter *memoryRateLimiter) Take(key string, limit RateLimit) (bool, time.Duration, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+
+	tokens, allowed, retryAfter := takeToken(b.tokens, now.Sub(b.last), limit)
+	b.tokens, b.last = tokens, now
+	return allowed, retryAfter, nil
+}
+
+// Same algorithm as takeToken, run atomically in redis. Buckets expire once they would be full again.
+var takeTokenScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1]) or burst
+local last = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", now)
+if rate > 0 then
+	redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+end
+return {allowed, tostring(tokens)}
+`)
+
+type redisRateLimiter struct {
+	getConnection func() redis.Conn
+}
+
+func NewRedisRateLimiter(getConnection func() redis.Conn) RateLimiter {
+	return &redisRateLimiter{getConnection: getConnection}
+}
+
+func (limiter *redisRateLimiter) Take(key string, limit RateLimit) (bool, time.Duration, error) {
+	conn := limiter.getConnection()
+	defer conn.Close()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values, err := redis.Values(takeTokenScript.Do(conn, "ratelimit|"+key, limit.Rate, limit.Burst, now))
+	if err != nil {
+		return true, 0, err
+	}
+	var allowed int
+	var tokens float64
+	if _, err := redis.Scan(values, &allowed, &tokens); err != nil {
+		return true, 0, err
+	}
+	if allowed == 1 {
+		return true, 0, nil
+	}
+	_, _, retryAfter := takeToken(tokens, 0, limit)
+	return false, retryAfter, nil
+}
+
+// Rejects requests over the limits of the policy with a 429 and a Retry-After header. Requests are let through when
+// the limiter fails, so that an outage of redis does not take the api down.
+func RateLimited(policy RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := []string{}
+		limits := []RateLimit{}
+		if userID, ok := c.Keys["userid"].(uint); ok {
+			keys, limits = append(keys, fmt.Sprintf("%s|user|%d", policy.Name, userID)), append(limits, policy.User)
+			if keyID, ok := c.Keys["api_key_id"].(uint); ok && policy.Key.Burst > 0 {
+				keys, limits = append(keys, fmt.Sprintf("%s|key|%d", policy.Name, keyID)), append(limits, policy.Key)
+			}
+		} else {
+			keys, limits = append(keys, fmt.Sprintf("%s|ip|%s", policy.Name, c.ClientIP())), append(limits, policy.User)
+		}
+
+		for i, key := range keys {
+			allowed, retryAfter, err := rateLimiter.Take(key, limits[i])
+			if err != nil {
+				log.Warn(fmt.Errorf("Failed rate limiting %s: %s", key, err))
+				continue
+			}
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				c.Writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+				abortWithApiError(c, newApiError(StatusTooManyRequests, ErrCodeRateLimited,
+					"Rate limit of %s exceeded, retry in %d seconds", policy.Name, seconds))
+				return
+			}
+		}
+	}
+}
+
+// Rejects request bodies larger than maxBytes, whether or not they declare their length
+func LimitRequestBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			abortWithApiError(c, newApiError(http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				"Request bodies cannot be larger than %d bytes", maxBytes))
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeToken(t *testing.T) {
+	limit := RateLimit{Rate: 2, Burst: 5}
+
+	tokens, allowed, _ := takeToken(5, 0, limit)
+	assert.True(t, allowed)
+	assert.Equal(t, 4.0, tokens)
+
+	// Buckets never refill past their burst
+	tokens, allowed, _ = takeToken(4, time.Hour, limit)
+	assert.True(t, allowed)
+	assert.Equal(t, 4.0, tokens)
+
+	tokens, allowed, retryAfter := takeToken(0.5, 0, limit)
+	assert.False(t, allowed)
+	assert.Equal(t, 0.5, tokens)
+	assert.Equal(t, 250*time.Millisecond, retryAfter)
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewMemoryRateLimiter().(*memoryRateLimiter)
+	limiter.now = func() time.Time { return now }
+	limit := RateLimit{Rate: 1, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Take("user|1", limit)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, _ := limiter.Take("user|1", limit)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	allowed, _, _ = limiter.Take("user|2", limit)
+	assert.True(t, allowed)
+
+	now = now.Add(time.Second)
+	allowed, _, _ = limiter.Take("user|1", limit)
+	assert.True(t, allowed)
+	allowed, _, _ = limiter.Take("user|1", limit)
+	assert.False(t, allowed)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/retention"
+)
+
+type RetentionPolicyRequest struct {
+	ArchiveAfterDays int `json:"archive_after_days"`
+}
+
+func parsePersonalParam(c *gin.Context) (bool, *ApiError) {
+	param := c.Query("personal")
+	if param == "" {
+		return false, nil
+	}
+	personal, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, badRequest("personal must be true or false")
+	}
+	return personal, nil
+}
+
+// Members follow the policy of their organization, personal selects the policy of their personal history
+func retentionScope(actor *Actor, personal bool) (uint, uint) {
+	if personal {
+		return actor.User.ID, 0
+	}
+	return actor.User.ID, actor.OrgID()
+}
+
+func getRetentionPolicy(actor *Actor, personal bool) (*lq.RetentionPolicy, *ApiError) {
+	userID, orgID := retentionScope(actor, personal)
+	policy, err := store.Retention().GetPolicy(userID, orgID)
+	if err != nil {
+		log.Error(err)
+		return nil, internalError("Failed getting retention policy")
+	}
+	return policy, nil
+}
+
+// Only admins set the policy of an organization
+func setRetentionPolicy(actor *Actor, personal bool, request *RetentionPolicyRequest) (*lq.RetentionPolicy,
+	*ApiError) {
+	userID, orgID := retentionScope(actor, personal)
+	if orgID != 0 {
+		if apiErr := actor.authorizeInOrg(lq.ActionManage, "set the retention policy"); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	policy := &lq.RetentionPolicy{UserID: userID, OrgID: orgID, ArchiveAfterDays: request.ArchiveAfterDays}
+	if err := policy.Validate(); err != nil {
+		return nil, badRequest("%s", err.Error())
+	}
+	if err := store.Retention().SetPolicy(policy); err != nil {
+		log.Error(err)
+		return nil, internalError("Failed setting retention policy")
+	}
+	return policy, nil
+}
+
+// The retention policy of the history of the user, or of their organization
+func GetRetentionPolicy(c *gin.Context) {
+	personal, apiErr := parsePersonalParam(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	policy, apiErr := getRetentionPolicy(fetchActorFromContext(c), personal)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// Sets how long the history of the user, or of their organization, stays in the database before it is archived
+func SetRetentionPolicy(c *gin.Context) {
+	personal, apiErr := parsePersonalParam(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	request := RetentionPolicyRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid retention policy: %s", err.Error()))
+		return
+	}
+	policy, apiErr := setRetentionPolicy(fetchActorFromContext(c), personal, &request)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	setAuditTarget(c, policy.ID)
+	c.JSON(http.StatusOK, policy)
+}
+
+// Whether a /v1 list request is for archived history rather than the history in the database
+func parseArchivedParam(c *gin.Context) (retention.Storage, bool, *ApiError) {
+	param := c.Query("archived")
+	if param == "" {
+		return nil, false, nil
+	}
+	archived, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, false, badRequest("archived must be true or false")
+	}
+	if !archived {
+		return nil, false, nil
+	}
+	storage := retention.GetStorage()
+	if storage == nil {
+		return nil, false, badRequest("History is not archived on this deployment")
+	}
+	return storage, true, nil
+}
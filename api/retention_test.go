@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	defer useMemoryStore()()
+
+	policy, apiErr := getRetentionPolicy(newActor(1, 0, ""), false)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, lq.DefaultArchiveAfterDays, policy.ArchiveAfterDays)
+
+	_, apiErr = setRetentionPolicy(newActor(1, 0, ""), false, &RetentionPolicyRequest{ArchiveAfterDays: 0})
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	_, apiErr = setRetentionPolicy(newActor(1, 0, ""), false, &RetentionPolicyRequest{ArchiveAfterDays: 30})
+	assert.Nil(t, apiErr)
+
+	// Members follow the policy of their organization, which only admins set
+	_, apiErr = setRetentionPolicy(newActor(2, 5, lq.RoleMember), false, &RetentionPolicyRequest{ArchiveAfterDays: 7})
+	assert.Equal(t, http.StatusForbidden, apiErr.Status)
+	_, apiErr = setRetentionPolicy(newActor(3, 5, lq.RoleAdmin), false, &RetentionPolicyRequest{ArchiveAfterDays: 7})
+	assert.Nil(t, apiErr)
+	policy, apiErr = getRetentionPolicy(newActor(2, 5, lq.RoleMember), false)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, 7, policy.ArchiveAfterDays)
+
+	// and keep their own for their personal history
+	_, apiErr = setRetentionPolicy(newActor(1, 5, lq.RoleMember), true, &RetentionPolicyRequest{ArchiveAfterDays: 60})
+	assert.Nil(t, apiErr)
+	policy, apiErr = getRetentionPolicy(newActor(1, 0, ""), false)
+	assert.Nil(t, apiErr)
+	assert.Equal(t, 60, policy.ArchiveAfterDays)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+// Secrets are injected into the containers of jobs, so they are kept small
+const MaxSecretSize = 64 * 1024
+
+type SecretRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Secrets are listed and returned without their value, which cannot be read back once stored
+type SecretView struct {
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func newSecretView(secret *lq.Secret) *SecretView {
+	return &SecretView{
+		Name:      secret.Name,
+		CreatedAt: secret.CreatedAt.Unix(),
+		UpdatedAt: secret.UpdatedAt.Unix(),
+	}
+}
+
+func validateSecretValue(value string) *ApiError {
+	if value == "" {
+		return badRequest("Secrets cannot be empty")
+	}
+	if len(value) > MaxSecretSize {
+		return badRequest("Secrets cannot be larger than %d bytes", MaxSecretSize)
+	}
+	return nil
+}
+
+func ListSecrets(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	secrets, err := store.Secrets().GetByOwner(user.ID)
+	if err != nil {
+		abortWithApiError(c, internalError("Failed listing secrets"))
+		return
+	}
+
+	views := make([]*SecretView, len(secrets))
+	for i, secret := range secrets {
+		views[i] = newSecretView(secret)
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func CreateSecret(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	request := SecretRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid secret: %s", err.Error()))
+		return
+	}
+	if err := lq.ValidateSecretName(request.Name); err != nil {
+		abortWithApiError(c, badRequest("%s", err.Error()))
+		return
+	}
+	if apiErr := validateSecretValue(request.Value); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	missing, err := store.Secrets().MissingNames(user.ID, []string{request.Name})
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed creating secret"))
+		return
+	}
+	if len(missing) == 0 {
+		abortWithApiError(c, badRequest("Secret %s already exists", request.Name))
+		return
+	}
+
+	secret := &lq.Secret{OwnerID: user.ID, Name: request.Name, Value: request.Value}
+	if err := store.Secrets().Create(secret); err != nil {
+		abortWithApiError(c, internalError("Failed creating secret"))
+		return
+	}
+	c.Set(auditTargetKey, secret.Name)
+	c.JSON(http.StatusCreated, newSecretView(secret))
+}
+
+// Replaces the value of a secret. Jobs launched afterwards get the new value.
+func UpdateSecret(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	request := SecretRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid secret: %s", err.Error()))
+		return
+	}
+	if apiErr := validateSecretValue(request.Value); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	if err := store.Secrets().SetValue(user.ID, c.Param("name"), request.Value); err != nil {
+		abortWithApiError(c, notFound("Unable to find secret %s", c.Param("name")))
+		return
+	}
+	c.JSON(http.StatusOK, c.Param("name"))
+}
+
+// Deletes a secret. Jobs referencing it fail when they are launched.
+func DeleteSecret(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	if err := store.Secrets().Delete(user.ID, c.Param("name")); err != nil {
+		abortWithApiError(c, notFound("Unable to find secret %s", c.Param("name")))
+		return
+	}
+	c.JSON(http.StatusOK, c.Param("name"))
+}
+
+// Validates the secrets referenced by a job, which must exist when the job is created
+func validateSecretRefs(ownerID uint, refs []lq.SecretRef, environment []lq.EnvVar) *ApiError {
+	envVars := make(map[string]bool)
+	for _, envVar := range environment {
+		envVars[envVar.Variable] = true
+	}
+	files := make(map[string]bool)
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		if err := ref.Validate(); err != nil {
+			return badRequest("%s", err.Error())
+		}
+		if ref.EnvVar != "" {
+			if envVars[ref.EnvVar] {
+				return badRequest("Environment variable %s is set more than once", ref.EnvVar)
+			}
+			envVars[ref.EnvVar] = true
+		}
+		if ref.File != "" {
+			if files[ref.File] {
+				return badRequest("Secret file %s is written more than once", ref.File)
+			}
+			files[ref.File] = true
+		}
+		names[i] = ref.Name
+	}
+
+	missing, err := store.Secrets().MissingNames(ownerID, names)
+	if err != nil {
+		log.Error(err)
+		return internalError("Failed getting secrets")
+	}
+	if len(missing) > 0 {
+		return badRequest("Secret %s does not exist", missing[0])
+	}
+	return nil
+}
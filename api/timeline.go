@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	lq "bargain/liquefy/models"
+)
+
+// Timelines of the status changes of jobs and instances, answering why a job took long to start
+
+func GetJobEvents(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	view, apiErr := getJobTimeline(actor, c.Param("jobid"))
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// The status history of a job the actor can see, summarized as of now
+func getJobTimeline(actor *Actor, jobID string) (*JobTimelineView, *ApiError) {
+	jid, err := strconv.Atoi(jobID)
+	if err != nil {
+		return nil, notFound("Unable to find job %s", jobID)
+	}
+
+	job, err := store.Jobs().Get(uint(jid))
+	if err != nil {
+		return nil, notFound("Unable to find job %d", jid)
+	}
+	if apiErr := actor.authorize(lq.ActionRead, job.OwnerID, job.OrgID, "job", job.ID); apiErr != nil {
+		return nil, apiErr
+	}
+
+	trackers, err := store.Jobs().GetEvents(job.ID)
+	if err != nil {
+		return nil, internalError("Failed getting events of job %d", job.ID)
+	}
+	return newJobTimelineView(job.ID, trackers, time.Now().UTC().UnixNano()), nil
+}
+
+func GetInstanceEvents(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	view, apiErr := getInstanceTimeline(actor, c.Param("instanceid"))
+	if apiErr != nil {
+		c.JSON(apiErr.Status, apiErr.Message)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func getInstanceTimeline(actor *Actor, instanceID string) (*InstanceTimelineView, *ApiError) {
+	instance, apiErr := getInstance(actor, instanceID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	resourceEvents, err := store.Resources().GetEvents(instance.ID)
+	if err != nil {
+		return nil, internalError("Failed getting events of instance %d", instance.ID)
+	}
+	return newInstanceTimelineView(instance.ID, resourceEvents), nil
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestJobTimeline(t *testing.T) {
+	defer useMemoryStore()()
+
+	job := &lq.ContainerJob{Name: "job", OwnerID: 1}
+	assert.Nil(t, store.Jobs().Create(job))
+	instance := &lq.ResourceInstance{OwnerId: 1}
+	assert.Nil(t, store.Assignments().AssignJob(job.ID, instance, true))
+	assert.Nil(t, store.Resources().SetStatus(instance.ID, lq.ResourceProvisioning, ""))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+
+	view, apiErr := getJobTimeline(newActor(1, 0, ""), strconv.Itoa(int(job.ID)))
+	assert.Nil(t, apiErr)
+	assert.Equal(t, job.ID, view.JobID)
+	if assert.Len(t, view.Events, 3) {
+		assert.Equal(t, "TASK_STAGING", view.Events[0].Status)
+		assert.Equal(t, instance.ID, view.Events[1].InstanceID)
+		assert.Equal(t, lq.ContainerJobStatusLaunched, view.Events[2].Status)
+	}
+	assert.NotNil(t, view.Summary)
+
+	instanceView, apiErr := getInstanceTimeline(newActor(1, 0, ""), strconv.Itoa(int(instance.ID)))
+	assert.Nil(t, apiErr)
+	if assert.Len(t, instanceView.Events, 2) {
+		assert.Equal(t, lq.ResourceProvisioning, instanceView.Events[1].Status)
+	}
+
+	// Timelines are only shown to those who can see the job or instance
+	_, apiErr = getJobTimeline(newActor(2, 0, ""), strconv.Itoa(int(job.ID)))
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+	_, apiErr = getInstanceTimeline(newActor(2, 0, ""), strconv.Itoa(int(instance.ID)))
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+	_, apiErr = getJobTimeline(newActor(1, 0, ""), "job")
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+}
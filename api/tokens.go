@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+
+	"bargain/liquefy/common"
+	lq "bargain/liquefy/models"
+)
+
+var AccessTokenTTL = time.Duration(15) * time.Minute
+var RefreshTokenTTL = time.Duration(30*24) * time.Hour
+
+// API keys are opaque rather than JWTs so they can be told apart from access tokens and revoked
+const ApiKeyPrefix = "lq_"
+
+// The secret tokens were signed with before signing keys were configurable. Local deployments also sign with it by
+// default.
+const devJwtSecret = "mySUPERPASSWrod"
+
+// JwtKeySet holds the keys access tokens are signed with. Tokens are signed with the active key and name it in their
+// kid header, and are verified with whichever key they name, so a new key can be made active while tokens signed
+// with the previous one are still accepted until they expire.
+type JwtKeySet struct {
+	ActiveKid string
+	Keys      map[string][]byte
+
+	// Tokens without a kid were issued by older versions, they are only accepted while they are the users ApiKey and
+	// until the cutoff, if any
+	LegacySecret []byte
+	LegacyCutoff time.Time
+}
+
+var jwtKeys *JwtKeySet
+
+// Loads the signing keys from the environment:
+//
+//	JWT_KEYS           comma separated kid:secret pairs
+//	JWT_ACTIVE_KID     the kid new tokens are signed with, defaults to the first key
+//	JWT_LEGACY_SECRET  secret of tokens without a kid
+//	JWT_LEGACY_CUTOFF  date after which tokens without a kid are rejected, ex: 2016-06-01
+//
+// Anyone who knows the development key can sign tokens, so staging and production refuse to start without JWT_KEYS.
+// Tokens without a kid were valid for over a year when issued, so accepting them there requires a cutoff.
+func LoadJwtKeySet() (*JwtKeySet, error) {
+	keys := &JwtKeySet{
+		ActiveKid:    os.Getenv("JWT_ACTIVE_KID"),
+		Keys:         make(map[string][]byte),
+		LegacySecret: []byte(os.Getenv("JWT_LEGACY_SECRET")),
+	}
+
+	if cutoff := os.Getenv("JWT_LEGACY_CUTOFF"); cutoff != "" {
+		date, err := time.Parse("2006-01-02", cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_LEGACY_CUTOFF %s must be a date, ex: 2016-06-01", cutoff)
+		}
+		keys.LegacyCutoff = date
+	}
+
+	firstKid := ""
+	for _, pair := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("JWT_KEYS must be comma separated kid:secret pairs")
+		}
+		keys.Keys[parts[0]] = []byte(parts[1])
+		if firstKid == "" {
+			firstKid = parts[0]
+		}
+	}
+
+	if len(keys.Keys) == 0 {
+		if !common.AllowsDevelopmentDefaults() {
+			return nil, errors.New("JWT_KEYS is required in staging and production")
+		}
+		keys.Keys["dev"] = []byte(devJwtSecret)
+		firstKid = "dev"
+	}
+	if len(keys.LegacySecret) == 0 && common.AllowsDevelopmentDefaults() {
+		keys.LegacySecret = []byte(devJwtSecret)
+	}
+	if len(keys.LegacySecret) > 0 && keys.LegacyCutoff.IsZero() && !common.AllowsDevelopmentDefaults() {
+		return nil, errors.New("JWT_LEGACY_CUTOFF is required along with JWT_LEGACY_SECRET in staging and production")
+	}
+
+	if keys.ActiveKid == "" {
+		keys.ActiveKid = firstKid
+	}
+	if _, ok := keys.Keys[keys.ActiveKid]; !ok {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %s is not one of JWT_KEYS", keys.ActiveKid)
+	}
+	return keys, nil
+}
+
+// TokenPair is returned whenever a user starts a session or refreshes it
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
+
+// Signs a short lived access token with the active key
+func (keys *JwtKeySet) newAccessToken(userID uint, scopes []string) (string, error) {
+	token := jwt_lib.New(jwt_lib.GetSigningMethod("HS256"))
+	token.Header["kid"] = keys.ActiveKid
+	token.Claims["ID"] = userID
+	token.Claims["scopes"] = strings.Join(scopes, ",")
+	token.Claims["exp"] = time.Now().Add(AccessTokenTTL).Unix()
+	return token.SignedString(keys.Keys[keys.ActiveKid])
+}
+
+// Parses and verifies an access token, returning the user id and scopes it grants
+func (keys *JwtKeySet) parseAccessToken(raw string) (uint, []string, bool, error) {
+	legacy := false
+	token, err := jwt_lib.Parse(raw, func(token *jwt_lib.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt_lib.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			if len(keys.LegacySecret) == 0 {
+				return nil, errors.New("Tokens without a kid are not accepted")
+			}
+			if !keys.LegacyCutoff.IsZero() && time.Now().After(keys.LegacyCutoff) {
+				return nil, errors.New("Tokens without a kid are no longer accepted")
+			}
+			legacy = true
+			return keys.LegacySecret, nil
+		}
+		key, ok := keys.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("Unknown signing key %s", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return 0, nil, false, err
+	}
+
+	uid, ok := token.Claims["ID"].(float64)
+	if !ok {
+		return 0, nil, false, errors.New("Token has no user")
+	}
+
+	scopes := []string{lq.ScopeAll}
+	if !legacy {
+		scopeClaim, _ := token.Claims["scopes"].(string)
+		scopes = lq.ParseScopes(scopeClaim)
+	}
+	return uint(uid), scopes, legacy, nil
+}
+
+// Starts a session for the user with an access token and a refresh token
+func newSession(userID uint, scopes []string) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newSecret("")
+	if err != nil {
+		return nil, err
+	}
+	err = store.RefreshTokens().Create(&lq.RefreshToken{
+		UserID:    userID,
+		TokenHash: refreshHash,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL).UnixNano(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenPair(userID, scopes, refreshToken)
+}
+
+// Exchanges a refresh token for a new access token and refresh token
+func refreshSession(refreshToken string) (*TokenPair, error) {
+	nextToken, nextHash, err := newSecret("")
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := store.RefreshTokens().Rotate(hashSecret(refreshToken), &lq.RefreshToken{
+		TokenHash: nextHash,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL).UnixNano(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenPair(used.UserID, lq.ParseScopes(used.Scopes), nextToken)
+}
+
+func newTokenPair(userID uint, scopes []string, refreshToken string) (*TokenPair, error) {
+	accessToken, err := jwtKeys.newAccessToken(userID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// Creates a named API key, returning the key which is not stored anywhere
+func newApiKey(userID uint, name string, scopes []string) (string, *lq.ApiKey, error) {
+	secret, hash, err := newSecret(ApiKeyPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &lq.ApiKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  secret[:len(ApiKeyPrefix)+6],
+		KeyHash: hash,
+		Scopes:  strings.Join(scopes, ","),
+	}
+	if err := store.ApiKeys().Create(key); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// A random secret and the hash it is stored as
+func newSecret(prefix string) (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", lq.NewErrorf(err, "Failed generating secret")
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(bytes)
+	return secret, hashSecret(secret), nil
+}
+
+// Secrets are random, so an unsalted hash is enough to keep them from being usable if the database leaks
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
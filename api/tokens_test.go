@@ -0,0 +1,117 @@
+package api
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestLoadJwtKeySet(t *testing.T) {
+	defer os.Setenv("JWT_KEYS", "")
+	defer os.Setenv("JWT_ACTIVE_KID", "")
+
+	os.Setenv("JWT_KEYS", "2016-01:first, 2016-02:second")
+	os.Setenv("JWT_ACTIVE_KID", "2016-02")
+	keys, err := LoadJwtKeySet()
+	assert.Nil(t, err)
+	assert.Equal(t, "2016-02", keys.ActiveKid)
+	assert.Equal(t, []byte("first"), keys.Keys["2016-01"])
+
+	os.Setenv("JWT_ACTIVE_KID", "2015-12")
+	_, err = LoadJwtKeySet()
+	assert.NotNil(t, err)
+
+	os.Setenv("JWT_KEYS", "no-secret")
+	_, err = LoadJwtKeySet()
+	assert.NotNil(t, err)
+}
+
+func TestAccessTokenKeyRotation(t *testing.T) {
+	keys := &JwtKeySet{
+		ActiveKid: "old",
+		Keys:      map[string][]byte{"old": []byte("old secret")},
+	}
+	token, err := keys.newAccessToken(7, []string{lq.ScopeRead})
+	assert.Nil(t, err)
+
+	// Tokens signed with the previous key remain valid after a new key is made active
+	keys.Keys["new"] = []byte("new secret")
+	keys.ActiveKid = "new"
+	userID, scopes, legacy, err := keys.parseAccessToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(7), userID)
+	assert.Equal(t, []string{lq.ScopeRead}, scopes)
+	assert.False(t, legacy)
+
+	// Until the previous key is removed
+	delete(keys.Keys, "old")
+	_, _, _, err = keys.parseAccessToken(token)
+	assert.NotNil(t, err)
+}
+
+func TestLegacyAccessToken(t *testing.T) {
+	legacyToken := jwt_lib.New(jwt_lib.GetSigningMethod("HS256"))
+	legacyToken.Claims["ID"] = 3
+	raw, _ := legacyToken.SignedString([]byte("legacy"))
+
+	keys := &JwtKeySet{ActiveKid: "new", Keys: map[string][]byte{"new": []byte("new secret")}}
+	_, _, _, err := keys.parseAccessToken(raw)
+	assert.NotNil(t, err)
+
+	keys.LegacySecret = []byte("legacy")
+	userID, scopes, legacy, err := keys.parseAccessToken(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), userID)
+	assert.Equal(t, []string{lq.ScopeAll}, scopes)
+	assert.True(t, legacy)
+}
+
+func TestLegacyTokensCutoff(t *testing.T) {
+	legacyToken := jwt_lib.New(jwt_lib.GetSigningMethod("HS256"))
+	legacyToken.Claims["ID"] = 3
+	raw, _ := legacyToken.SignedString([]byte("legacy"))
+
+	keys := &JwtKeySet{ActiveKid: "new", Keys: map[string][]byte{"new": []byte("new secret")}}
+	keys.LegacySecret = []byte("legacy")
+	keys.LegacyCutoff = time.Now().Add(time.Hour)
+	_, _, _, err := keys.parseAccessToken(raw)
+	assert.Nil(t, err)
+
+	keys.LegacyCutoff = time.Now().Add(-time.Hour)
+	_, _, _, err = keys.parseAccessToken(raw)
+	assert.NotNil(t, err)
+}
+
+func TestLoadJwtKeySetRequiresKeysInStaging(t *testing.T) {
+	defer os.Setenv("ENV", os.Getenv("ENV"))
+	defer os.Setenv("JWT_KEYS", "")
+	defer os.Setenv("JWT_LEGACY_SECRET", "")
+	defer os.Setenv("JWT_LEGACY_CUTOFF", "")
+
+	os.Setenv("ENV", "STAGING")
+	os.Setenv("JWT_KEYS", "")
+	_, err := LoadJwtKeySet()
+	assert.NotNil(t, err)
+
+	// Legacy tokens are only accepted until a cutoff
+	os.Setenv("JWT_KEYS", "2016-01:first")
+	os.Setenv("JWT_LEGACY_SECRET", "legacy")
+	_, err = LoadJwtKeySet()
+	assert.NotNil(t, err)
+
+	os.Setenv("JWT_LEGACY_CUTOFF", "2016-06-01")
+	keys, err := LoadJwtKeySet()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC), keys.LegacyCutoff)
+
+	// Without a legacy secret, tokens without a kid are rejected
+	os.Setenv("JWT_LEGACY_SECRET", "")
+	keys, err = LoadJwtKeySet()
+	assert.Nil(t, err)
+	assert.Empty(t, keys.LegacySecret)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/retention"
+)
+
+// The /v1 API serves the public representations of jobs and instances, paginates every list, and reports every
+// failure with an ErrorEnvelope
+
+func V1ListJobs(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+
+	page, apiErr := parsePageRequest(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	filter := db.JobFilter{
+		Status: c.Query("status"),
+		Name:   c.Query("name"),
+	}
+	if filter.InstanceID, apiErr = parseIDQuery(c, "instance_id"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if filter.StartedAfter, apiErr = parseTimeParam(c, "started_after"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if filter.StartedBefore, apiErr = parseTimeParam(c, "started_before"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	storage, archived, apiErr := parseArchivedParam(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	var jobs []*lq.ContainerJob
+	var err error
+	if archived {
+		jobs, err = retention.ListArchivedJobs(store, storage, actor.User.ID, actor.OrgID(), filter, page)
+	} else {
+		jobs, err = store.Jobs().ListVisibleTo(actor.User.ID, actor.OrgID(), filter, page)
+	}
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed listing jobs"))
+		return
+	}
+
+	// Instances are fetched once for the host ips of all jobs on the page
+	count, nextCursor := pageBounds(page, len(jobs), func(i int) uint { return jobs[i].ID })
+	hostIPs := make(map[uint]string)
+	views := make([]*JobView, count)
+	for i, job := range jobs[:count] {
+		if _, fetched := hostIPs[job.InstanceID]; !fetched && job.InstanceID != 0 && !archived {
+			if instance, err := store.Resources().Get(job.InstanceID); err == nil {
+				hostIPs[job.InstanceID] = instance.IP
+			}
+		}
+		views[i] = newJobView(job, hostIPs[job.InstanceID])
+		views[i].Archived = archived
+	}
+
+	c.JSON(http.StatusOK, Page{Items: views, NextCursor: nextCursor})
+}
+
+func V1GetJob(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	view, apiErr := getJobView(actor, c.Param("jobid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func V1GetJobEvents(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	view, apiErr := getJobTimeline(actor, c.Param("jobid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// Creates a job. Retries of a request with an Idempotency-Key header return the job the first request created.
+func V1CreateJob(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	job := ContainerJobPublic{}
+	key, replayed, apiErr := bindIdempotentRequest(c, &job)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	if replayed == nil {
+		ctjob, apiErr := newContainerJob(actor, job)
+		if apiErr != nil {
+			abortWithApiError(c, apiErr)
+			return
+		}
+		ids, raced, apiErr := createJobs([]*lq.ContainerJob{ctjob}, key)
+		if apiErr != nil {
+			abortWithApiError(c, apiErr)
+			return
+		}
+		if !raced {
+			setAuditTarget(c, ctjob.ID)
+			c.JSON(http.StatusCreated, newJobView(ctjob, ""))
+			return
+		}
+		replayed = ids
+	}
+
+	// A retry gets the job created by the first request
+	setReplayed(c)
+	ctjob, err := store.Jobs().Get(replayed[0])
+	if err != nil {
+		abortWithApiError(c, internalError("Failed getting job %d", replayed[0]))
+		return
+	}
+	setAuditTarget(c, ctjob.ID)
+	c.JSON(http.StatusCreated, newJobView(ctjob, ""))
+}
+
+func V1DeleteJob(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	if _, apiErr := deleteJob(actor, c.Param("jobid")); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	view, apiErr := getJobView(actor, c.Param("jobid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func V1ListInstances(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+
+	page, apiErr := parsePageRequest(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	filter := db.InstanceFilter{
+		Status: c.Query("status"),
+	}
+	if filter.LaunchedAfter, apiErr = parseTimeParam(c, "launched_after"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if filter.LaunchedBefore, apiErr = parseTimeParam(c, "launched_before"); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	storage, archived, apiErr := parseArchivedParam(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	var instances []*lq.ResourceInstance
+	var err error
+	if archived {
+		instances, err = retention.ListArchivedInstances(store, storage, actor.User.ID, actor.OrgID(), filter, page)
+	} else {
+		instances, err = store.Resources().ListVisibleTo(actor.User.ID, actor.OrgID(), filter, page)
+	}
+	if err != nil {
+		log.Error(err)
+		abortWithApiError(c, internalError("Failed listing instances"))
+		return
+	}
+
+	count, nextCursor := pageBounds(page, len(instances), func(i int) uint { return instances[i].ID })
+	views := make([]*InstanceView, count)
+	for i, instance := range instances[:count] {
+		views[i] = newInstanceView(instance)
+		views[i].Archived = archived
+	}
+
+	c.JSON(http.StatusOK, Page{Items: views, NextCursor: nextCursor})
+}
+
+func V1GetInstance(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	instance, apiErr := getInstance(actor, c.Param("instanceid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, newInstanceView(instance))
+}
+
+func V1GetInstanceEvents(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	view, apiErr := getInstanceTimeline(actor, c.Param("instanceid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func V1DeleteInstance(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	if _, apiErr := deleteInstance(actor, c.Param("instanceid")); apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	instance, apiErr := getInstance(actor, c.Param("instanceid"))
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	c.JSON(http.StatusOK, newInstanceView(instance))
+}
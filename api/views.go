@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
+)
+
+// JobView is the public representation of a job. Internal bookkeeping such as container ids, captured output and
+// the owner is left out, and fields stored as JSON are expanded.
+type JobView struct {
+	ID            uint             `json:"id"`
+	Name          string           `json:"name"`
+	Command       string           `json:"command"`
+	Status        string           `json:"status"`
+	Kind          string           `json:"kind"`
+	SourceType    string           `json:"source_type"`
+	SourceImage   string           `json:"source_image"`
+	Environment   []lq.EnvVar      `json:"environment"`
+	Secrets       []lq.SecretRef   `json:"secrets"`
+	PortMappings  []lq.PortMapping `json:"port_mappings"`
+	Ram           int              `json:"ram"`
+	Cpu           float64          `json:"cpu"`
+	Gpu           int              `json:"gpu"`
+	Disk          int              `json:"disk"`
+	InstanceStore bool             `json:"instance_store"`
+
+	HealthCheck *lq.HealthCheck `json:"health_check,omitempty"`
+	MaxRestarts int             `json:"max_restarts"`
+	Restarts    int             `json:"restarts"`
+	Healthy     bool            `json:"healthy"`
+
+	SourceBranch  string `json:"source_branch,omitempty"`
+	SourceCommit  string `json:"source_commit,omitempty"`
+	SourceDir     string `json:"source_dir,omitempty"`
+	Dockerfile    string `json:"dockerfile,omitempty"`
+	BuildRegistry string `json:"build_registry,omitempty"`
+
+	InstanceID     uint    `json:"instance_id"`
+	HostIP         string  `json:"host_ip"`
+	RetryCount     int     `json:"retry_count"`
+	UserTerminated bool    `json:"user_terminated"`
+	StartTime      int64   `json:"start_time"`
+	EndTime        int64   `json:"end_time"`
+	TotalCost      float64 `json:"total_cost"`
+
+	TraceID  string `json:"trace_id,omitempty"` // trace of the lifecycle of the job, to hand over when reporting issues
+	Archived bool   `json:"archived,omitempty"` // listed from the archive, with archived=true
+}
+
+// InstanceView is the public representation of an instance
+type InstanceView struct {
+	ID             uint    `json:"id"`
+	Status         string  `json:"status"`
+	IP             string  `json:"ip"`
+	LaunchTime     int64   `json:"launch_time"`
+	UserTerminated bool    `json:"user_terminated"`
+	RamTotal       int     `json:"ram_total"`
+	RamUsed        int     `json:"ram_used"`
+	CpuTotal       float64 `json:"cpu_total"`
+	CpuUsed        float64 `json:"cpu_used"`
+	GpuTotal       int     `json:"gpu_total"`
+	GpuUsed        int     `json:"gpu_used"`
+	DiskTotal      int     `json:"disk_total"`
+	DiskUsed       int     `json:"disk_used"`
+
+	AwsInstanceType     string  `json:"aws_instance_type"`
+	AwsAvailabilityZone string  `json:"aws_availability_zone"`
+	AwsSpotPrice        float64 `json:"aws_spot_price"`
+
+	Archived bool `json:"archived,omitempty"` // listed from the archive, with archived=true
+}
+
+func newJobView(job *lq.ContainerJob, hostIP string) *JobView {
+	view := &JobView{
+		ID:             job.ID,
+		Name:           job.Name,
+		Command:        job.Command,
+		Status:         job.Status,
+		Kind:           job.Kind,
+		SourceType:     job.SourceType,
+		SourceImage:    job.SourceImage,
+		Environment:    []lq.EnvVar{},
+		Secrets:        []lq.SecretRef{},
+		PortMappings:   []lq.PortMapping{},
+		Ram:            job.Ram,
+		Cpu:            job.Cpu,
+		Gpu:            job.Gpu,
+		Disk:           job.Disk,
+		InstanceStore:  job.InstanceStore,
+		MaxRestarts:    job.MaxRestarts,
+		Restarts:       job.Restarts,
+		Healthy:        job.Healthy,
+		SourceBranch:   job.SourceBranch,
+		SourceCommit:   job.SourceCommit,
+		SourceDir:      job.SourceDir,
+		Dockerfile:     job.Dockerfile,
+		BuildRegistry:  job.BuildRegistry,
+		InstanceID:     job.InstanceID,
+		HostIP:         hostIP,
+		RetryCount:     job.RetryCount,
+		UserTerminated: job.UserTerminated,
+		StartTime:      job.StartTime,
+		EndTime:        job.EndTime,
+		TotalCost:      job.TotalCost,
+		TraceID:        tracing.ContextOf(job.TraceParent).TraceID,
+	}
+	if view.Kind == "" {
+		view.Kind = lq.ContainerJobKindBatch
+	}
+
+	// These were validated when the job was created, so a failure to parse only hides the field
+	if job.Environment != "" {
+		json.Unmarshal([]byte(job.Environment), &view.Environment)
+	}
+	if refs, err := job.GetSecretRefs(); err == nil {
+		view.Secrets = refs
+	}
+	if portMappings, err := job.GetPortMappings(); err == nil && portMappings != nil {
+		view.PortMappings = portMappings
+	}
+	if check, err := job.GetHealthCheck(); err == nil {
+		view.HealthCheck = check
+	}
+	return view
+}
+
+func newInstanceView(instance *lq.ResourceInstance) *InstanceView {
+	return &InstanceView{
+		ID:                  instance.ID,
+		Status:              instance.Status,
+		IP:                  instance.IP,
+		LaunchTime:          instance.LaunchTime,
+		UserTerminated:      instance.UserTerminated,
+		RamTotal:            instance.RamTotal,
+		RamUsed:             instance.RamUsed,
+		CpuTotal:            instance.CpuTotal,
+		CpuUsed:             instance.CpuUsed,
+		GpuTotal:            instance.GpuTotal,
+		GpuUsed:             instance.GpuUsed,
+		DiskTotal:           instance.DiskTotal,
+		DiskUsed:            instance.DiskUsed,
+		AwsInstanceType:     instance.AwsInstanceType,
+		AwsAvailabilityZone: instance.AwsAvailabilityZone,
+		AwsSpotPrice:        instance.AwsSpotPrice,
+	}
+}
+
+// JobEventView is a status change of a job, at a time in unix nanoseconds
+type JobEventView struct {
+	Status     string `json:"status"`
+	Attempt    int    `json:"attempt"`
+	InstanceID uint   `json:"instance_id"`
+	Message    string `json:"message"`
+	Time       int64  `json:"time"`
+}
+
+// JobTimelineView is the status history of a job, oldest first, along with the time it spent in each phase
+type JobTimelineView struct {
+	JobID   uint                   `json:"job_id"`
+	Events  []*JobEventView        `json:"events"`
+	Summary *lq.JobTimelineSummary `json:"summary"`
+}
+
+// InstanceEventView is a status change of an instance, at a time in unix nanoseconds
+type InstanceEventView struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Time    int64  `json:"time"`
+}
+
+// InstanceTimelineView is the status history of an instance, oldest first
+type InstanceTimelineView struct {
+	InstanceID uint                 `json:"instance_id"`
+	Events     []*InstanceEventView `json:"events"`
+}
+
+func newJobTimelineView(jobID uint, trackers []*lq.ContainerJobTracker, now int64) *JobTimelineView {
+	view := &JobTimelineView{
+		JobID:   jobID,
+		Events:  make([]*JobEventView, len(trackers)),
+		Summary: lq.SummarizeJobTimeline(trackers, now),
+	}
+	for i, tracker := range trackers {
+		view.Events[i] = &JobEventView{
+			Status:     tracker.Status,
+			Attempt:    tracker.Attempt,
+			InstanceID: tracker.InstanceID,
+			Message:    tracker.Msg,
+			Time:       tracker.Time,
+		}
+	}
+	return view
+}
+
+func newInstanceTimelineView(instanceID uint, resourceEvents []*lq.ResourceEvent) *InstanceTimelineView {
+	view := &InstanceTimelineView{
+		InstanceID: instanceID,
+		Events:     make([]*InstanceEventView, len(resourceEvents)),
+	}
+	for i, event := range resourceEvents {
+		view.Events[i] = &InstanceEventView{
+			Status:  event.Status,
+			Message: event.Msg,
+			Time:    event.Time,
+		}
+	}
+	return view
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	"bargain/liquefy/common"
+	"bargain/liquefy/events"
+	lq "bargain/liquefy/models"
+)
+
+const WebhookSecretPrefix = "whsec_"
+
+// Headers of webhook deliveries
+const (
+	WebhookSignatureHeader = "X-Liquefy-Signature"
+	WebhookEventHeader     = "X-Liquefy-Event"
+	WebhookDeliveryHeader  = "X-Liquefy-Delivery"
+)
+
+// Failed deliveries are retried after each of these delays, then given up on
+var webhookRetryDelays = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+}
+
+const webhookTimeout = 10 * time.Second
+
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"` // empty for every type
+}
+
+type WebhookView struct {
+	ID         uint     `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	OrgID      uint     `json:"org_id,omitempty"`
+	CreatedAt  int64    `json:"created_at"`
+	Secret     string   `json:"secret,omitempty"` // only returned when the webhook is created
+}
+
+func newWebhookView(hook *lq.Webhook) *WebhookView {
+	return &WebhookView{
+		ID:         hook.ID,
+		URL:        hook.URL,
+		EventTypes: hook.GetEventTypes(),
+		OrgID:      hook.OrgID,
+		CreatedAt:  hook.CreatedAt.Unix(),
+	}
+}
+
+func ListWebhooks(c *gin.Context) {
+	user := fetchUserFromContext(c)
+	hooks, err := store.Webhooks().GetByOwner(user.ID)
+	if err != nil {
+		abortWithApiError(c, internalError("Failed listing webhooks"))
+		return
+	}
+
+	views := make([]*WebhookView, len(hooks))
+	for i, hook := range hooks {
+		views[i] = newWebhookView(hook)
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// Registers a webhook. The secret deliveries are signed with is returned once.
+func CreateWebhook(c *gin.Context) {
+	actor := fetchActorFromContext(c)
+	request := WebhookRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		abortWithApiError(c, badRequest("Invalid webhook: %s", err.Error()))
+		return
+	}
+	if err := lq.ValidateWebhookURL(request.URL, common.IsProductionDeployment()); err != nil {
+		abortWithApiError(c, badRequest("%s", err.Error()))
+		return
+	}
+	for _, eventType := range request.EventTypes {
+		if !lq.IsValidEventType(eventType) {
+			abortWithApiError(c, badRequest("Invalid event type %s, expected one of %s", eventType,
+				strings.Join(lq.EventTypes, ", ")))
+			return
+		}
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		abortWithApiError(c, internalError("Failed generating webhook secret"))
+		return
+	}
+	hook := &lq.Webhook{
+		OwnerID:    actor.User.ID,
+		OrgID:      actor.OrgID(),
+		URL:        request.URL,
+		EventTypes: strings.Join(request.EventTypes, ","),
+		Secret:     WebhookSecretPrefix + base64.RawURLEncoding.EncodeToString(random),
+	}
+	if err := store.Webhooks().Create(hook); err != nil {
+		abortWithApiError(c, internalError("Failed creating webhook"))
+		return
+	}
+
+	view := newWebhookView(hook)
+	view.Secret = hook.Secret
+	setAuditTarget(c, hook.ID)
+	c.JSON(http.StatusCreated, view)
+}
+
+// Gets a webhook of the user from the webhookid path parameter
+func fetchOwnWebhook(c *gin.Context) (*lq.Webhook, *ApiError) {
+	user := fetchUserFromContext(c)
+	id, err := strconv.Atoi(c.Param("webhookid"))
+	if err != nil {
+		return nil, badRequest("Invalid webhook id %s", c.Param("webhookid"))
+	}
+	hook, err := store.Webhooks().Get(uint(id))
+	if err != nil || hook.OwnerID != user.ID {
+		return nil, notFound("Unable to find webhook %d", id)
+	}
+	return hook, nil
+}
+
+func DeleteWebhook(c *gin.Context) {
+	hook, apiErr := fetchOwnWebhook(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	if err := store.Webhooks().Delete(hook.ID); err != nil {
+		abortWithApiError(c, internalError("Failed deleting webhook"))
+		return
+	}
+	c.JSON(http.StatusOK, hook.ID)
+}
+
+// Lists the deliveries of a webhook, most recent first
+func ListWebhookDeliveries(c *gin.Context) {
+	hook, apiErr := fetchOwnWebhook(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+	page, apiErr := parsePageRequest(c)
+	if apiErr != nil {
+		abortWithApiError(c, apiErr)
+		return
+	}
+
+	deliveries, err := store.Webhooks().GetDeliveries(hook.ID, page)
+	if err != nil {
+		abortWithApiError(c, internalError("Failed listing deliveries"))
+		return
+	}
+	count, nextCursor := pageBounds(page, len(deliveries), func(i int) uint { return deliveries[i].ID })
+	c.JSON(http.StatusOK, Page{Items: deliveries[:count], NextCursor: nextCursor})
+}
+
+// Posts the events of the bus to the webhooks they concern. Every api server runs a dispatcher, deliveries are
+// claimed so that each event is posted once. Failed attempts are stored with the time of the next one, and retried by
+// the dispatcher that claims them once due, so that retries survive restarts.
+type webhookDispatcher struct {
+	client      *http.Client
+	retryDelays []time.Duration
+}
+
+// How often dispatchers look for due retries, how long an attempt may take before another dispatcher retries it,
+// and how many retries a dispatcher takes at once
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookLease        = 2 * webhookTimeout
+	webhookPollLimit    = 50
+)
+
+func newWebhookDispatcher() *webhookDispatcher {
+	transport := &http.Transport{
+		Dial:                publicDial,
+		TLSHandshakeTimeout: webhookTimeout,
+	}
+	return &webhookDispatcher{
+		client:      &http.Client{Transport: transport, Timeout: webhookTimeout},
+		retryDelays: webhookRetryDelays,
+	}
+}
+
+func (dispatcher *webhookDispatcher) Start() {
+	received, _ := events.GetBus().Subscribe()
+	go func() {
+		for event := range received {
+			hooks, err := store.Webhooks().GetForEvent(event)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			for _, hook := range hooks {
+				go dispatcher.deliver(hook, event)
+			}
+		}
+	}()
+
+	// Retries left pending by a previous run are resumed right away
+	go func() {
+		for {
+			dispatcher.retryDue()
+			time.Sleep(webhookPollInterval)
+		}
+	}()
+}
+
+func (dispatcher *webhookDispatcher) deliver(hook *lq.Webhook, event *lq.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	delivery := &lq.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now().Add(webhookLease).UnixNano(),
+	}
+	claimed, err := store.Webhooks().ClaimDelivery(delivery)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if claimed {
+		dispatcher.attempt(hook, delivery)
+	}
+}
+
+// Attempts the deliveries whose retry is due
+func (dispatcher *webhookDispatcher) retryDue() {
+	deliveries, err := store.Webhooks().ClaimDueDeliveries(time.Now(), webhookLease, webhookPollLimit)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, delivery := range deliveries {
+		hook, err := store.Webhooks().GetForDelivery(delivery.WebhookID)
+		if err != nil {
+			log.Error(err)
+			delivery.Status, delivery.Error = lq.WebhookDeliveryFailed, "Webhook deleted"
+			delivery.UpdatedAt = time.Now()
+			if err := store.Webhooks().UpdateDelivery(delivery); err != nil {
+				log.Error(err)
+			}
+			continue
+		}
+		go dispatcher.attempt(hook, delivery)
+	}
+}
+
+// Posts the delivery once, then records whether it was delivered, failed for good, or when to retry it
+func (dispatcher *webhookDispatcher) attempt(hook *lq.Webhook, delivery *lq.WebhookDelivery) {
+	var err error
+	delivery.Attempts++
+	delivery.ResponseCode, err = dispatcher.post(hook, delivery)
+	delivery.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		delivery.Status, delivery.Error = lq.WebhookDeliveryDelivered, ""
+	case delivery.Attempts > len(dispatcher.retryDelays):
+		delivery.Status, delivery.Error = lq.WebhookDeliveryFailed, err.Error()
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = delivery.UpdatedAt.Add(dispatcher.retryDelays[delivery.Attempts-1]).UnixNano()
+	}
+	if err := store.Webhooks().UpdateDelivery(delivery); err != nil {
+		log.Error(err)
+	}
+}
+
+// Posts the signed payload, returning the status code of the response. Any status but 2xx fails the attempt.
+func (dispatcher *webhookDispatcher) post(hook *lq.Webhook, delivery *lq.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Liquefy-Webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.EventID)
+	req.Header.Set(WebhookSignatureHeader, lq.SignWebhookPayload([]byte(hook.Secret), time.Now(), payload))
+
+	resp, err := dispatcher.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Dials only public addresses in production, so that webhooks cannot reach the network of Liquefy, ex: the aws
+// metadata service
+func publicDial(network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) && common.IsProductionDeployment() {
+			return nil, fmt.Errorf("Webhook host %s resolves to the private address %s", host, ip)
+		}
+	}
+	return net.DialTimeout(network, net.JoinHostPort(ips[0].String(), port), webhookTimeout)
+}
+
+var privateNetworks = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10",
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, cidr := range privateNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return ip.IsUnspecified()
+}
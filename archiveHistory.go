@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	database "bargain/liquefy/db"
+	"bargain/liquefy/retention"
+)
+
+const archiveUsage = `Usage: LQ_ARCHIVE_URL=<url> go run archiveHistory.go -masterip=<ip> <command>
+
+Commands:
+  run              archive the history that expired under the retention policies
+  list <userid>    list the archives of a user, and of their organization with -org=<id>
+  restore <key>    put the history of an archive back in the database
+
+LQ_ARCHIVE_URL locates the archives, ex: s3://bucket/prefix or file:///var/lib/liquefy/archive
+`
+
+// Archives the history of jobs and instances, or restores it
+func main() {
+	masterIP := flag.String("masterip", "", "IP on which the master is running")
+	orgID := flag.Uint("org", 0, "organization of the user, for list")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, archiveUsage) }
+	flag.Parse()
+
+	if *masterIP == "" {
+		panic(errors.New("No masterip, please provide valid values"))
+	}
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	storage := retention.GetStorage()
+	if storage == nil {
+		log.Errorf("%s is not set", retention.ArchiveURLEnv)
+		os.Exit(1)
+	}
+	if err := database.Connect(*masterIP); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	if err := runArchive(storage, uint(*orgID), flag.Args()); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
+
+func runArchive(storage retention.Storage, orgID uint, args []string) error {
+	store := database.NewPostgresStore()
+	switch {
+	case args[0] == "run" && len(args) == 1:
+		files, err := retention.NewArchiver(store, storage).Run()
+		for _, file := range files {
+			fmt.Printf("Archived %d jobs and %d instances to %s\n", file.Jobs, file.Instances, file.Key)
+		}
+		if err == nil && len(files) == 0 {
+			fmt.Println("No history expired")
+		}
+		return err
+
+	case args[0] == "list" && len(args) == 2:
+		userID, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid user id %s", args[1])
+		}
+		files, err := store.Retention().ListArchivesVisibleTo(uint(userID), orgID)
+		for _, file := range files {
+			fmt.Printf("%-50s %s %5d jobs %5d instances\n", file.Key, file.CreatedAt.Format(time.RFC3339), file.Jobs,
+				file.Instances)
+		}
+		return err
+
+	case args[0] == "restore" && len(args) == 2:
+		file, err := retention.Restore(store, storage, args[1])
+		if err == nil {
+			fmt.Printf("Restored %d jobs and %d instances from %s\n", file.Jobs, file.Instances, file.Key)
+		}
+		return err
+	}
+
+	flag.Usage()
+	os.Exit(2)
+	return nil
+}
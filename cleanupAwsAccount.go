@@ -21,5 +21,5 @@ func fetchCreds() (*string, *string) {
 
 func main() {
     log.SetLevel(log.DebugLevel)
-    cloud.NewAwsCloud(fetchCreds()).CleanUpAwsAccount()
+    cloud.NewAwsCloudWithKeys(fetchCreds()).CleanUpAwsAccount()
 }
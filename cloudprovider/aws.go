@@ -14,9 +14,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 
+    "bargain/liquefy/metrics"
     lq "bargain/liquefy/models"
     "github.com/aws/aws-sdk-go/service/iam"
-    "strings"
 )
 
 const (
@@ -67,22 +67,10 @@ func (instanceType *InstanceType) StringPtr() *string {
     return &s
 }
 
-// The start of the hard coded, static map of regions and AZs
-var AWSRegionsToAZs = map[Region][]AZ{
-    "us-east-1": []AZ{ "us-east-1a", "us-east-1b", "us-east-1c", "us-east-1e" },
-    "us-west-1": []AZ{ "us-west-1a", "us-west-1b" },
-    "us-west-2": []AZ{ "us-west-2a", "us-west-2b", "us-west-2c" },
-}
+// The configured regions and their AZs, see LoadRegions
+var AWSRegionsToAZs = mustLoadRegions()
 
-var AllAvailabilityZones = []AZ{}
-
-func init() {
-    for _, azs := range AWSRegionsToAZs {
-        for _, az := range azs {
-            AllAvailabilityZones = append(AllAvailabilityZones, az)
-        }
-    }
-}
+var AllAvailabilityZones = availabilityZones(AWSRegionsToAZs)
 
 type AwsCloud interface {
     // Account Mgmt
@@ -101,7 +89,7 @@ type AwsCloud interface {
 
     // Spot Request Mgmt
     CreateSpotInstanceRequest(region Region, az string, imageId string, subnetId string, securityGroupName string,
-        instanceType string, spotPrice float64, resourceId uint) (*ec2.SpotInstanceRequest, error)
+        instanceType string, spotPrice float64, resourceId uint, storage lq.InstanceStorage) (*ec2.SpotInstanceRequest, error)
     GetSpotRequestById(region Region, spotReqId string) (*ec2.SpotInstanceRequest, error)
     GetSpotRequestByInstanceId(region Region, instanceId string) (*ec2.SpotInstanceRequest, error)
     WaitForSpotRequestToFinish(spotReq *ec2.SpotInstanceRequest) (*ec2.SpotInstanceRequest, error)
@@ -127,17 +115,27 @@ type AwsSshKey struct {
 }
 
 type awsCloud struct {
-    awsKey    *string
-    awsSecret *string
+    credentials *credentials.Credentials
+    roleArn     string // role the credentials are assumed from, empty when they are access keys
+}
+
+// Connects to a linked account, through its role when it has one. Role credentials are temporary and refreshed
+// before they expire.
+func NewAwsCloud(account *lq.AwsAccount) AwsCloud {
+    return &awsCloud{
+        credentials: accountCredentials(account),
+        roleArn:     account.GetAwsRoleArn(),
+    }
 }
 
-func NewAwsCloud(awsKey *string, awsSecret *string) AwsCloud {
-	return &awsCloud{awsKey, awsSecret}
+// Connects with access keys directly, ex: to run scripts against an account
+func NewAwsCloudWithKeys(awsKey *string, awsSecret *string) AwsCloud {
+    return NewAwsCloud(&lq.AwsAccount{AwsAccessKey: awsKey, AwsSecretKey: awsSecret})
 }
 
 func (cloud *awsCloud) connect(region Region) *ec2.EC2 {
 	config := &aws.Config{
-		Credentials: credentials.NewStaticCredentials(*cloud.awsKey, *cloud.awsSecret, ""),
+		Credentials: cloud.credentials,
 		Region:      aws.String(region.String()),
 	}
     return ec2.New(session.New(config), config)
@@ -147,7 +145,9 @@ func (cloud *awsCloud) connect(region Region) *ec2.EC2 {
 func (cloud *awsCloud) SetupAwsAccountResources(existingAccount *lq.AwsAccount) (*lq.AwsAccount, error) {
     var setupError error
 
-    for region, azs := range AWSRegionsToAZs {
+    for _, region := range Regions() {
+        azs := AWSRegionsToAZs[region]
+
         // Create SSH key for region if we do not already have a key stored
         if existingAccount.GetSshPrivateKey(region.String()) == "" {
             key, err := cloud.CreateSshKey(region)
@@ -202,48 +202,27 @@ func (cloud *awsCloud) SetupAwsAccountResources(existingAccount *lq.AwsAccount)
     return existingAccount, setupError
 }
 
-func (cloud *awsCloud) VerifyPolicy() error{
-    config := &aws.Config{
-        Credentials: credentials.NewStaticCredentials(*cloud.awsKey, *cloud.awsSecret, ""),
-    }
-
-    svc := iam.New(session.New(config))
-
-    iamPolicyOutput, err := svc.ListPolicies(&iam.ListPoliciesInput{
-        OnlyAttached: aws.Bool(true),
-    })
-    if err != nil {
-        if strings.Contains(err.Error(), "not authorized to perform: iam:ListPolicies") {
-            return lq.NewError("Unable to verify required policies", errors.New("IAMReadOnlyAccess was not found in policies"))
-        }
-        return lq.NewError("Unable to retrieve list of IAM policies", err)
-    }
+// Verifies the account allows every action in RequiredActions, by simulating the policies of the linked role, or of
+// the user owning the access keys
+func (cloud *awsCloud) VerifyPolicy() error {
+    client := NewIamClient(cloud.credentials)
 
-    var containsPolicy = func(item string) bool {
-        for _, policy := range iamPolicyOutput.Policies {
-            if *policy.PolicyName == item {
-                return true
-            }
+    principalArn := cloud.roleArn
+    if principalArn == "" {
+        output, err := client.GetUser(&iam.GetUserInput{})
+        if err != nil {
+            return lq.NewError("Unable to find the user of the access keys", err)
         }
-        return false
-    }
-
-    // If has full access move on
-    if containsPolicy("AmazonEC2FullAccess") {
-        return nil
+        principalArn = aws.StringValue(output.User.Arn)
     }
 
-    // Otherwise we have specific access
-    if ! containsPolicy("IAMReadOnlyAccess") {
-        return lq.NewError("Unable to verify required policies", errors.New("IAMReadOnlyAccess was not found in policies"))
-    }
-    if ! containsPolicy("AmazonS3FullAccess") {
-        return lq.NewError("Unable to verify required policies",errors.New("AmazonS3FullAccess was not found in policies"))
+    denied, err := deniedActions(client, principalArn)
+    if err != nil {
+        return lq.NewError("Unable to verify required policies", err)
     }
-    if ! containsPolicy("AmazonEC2FullAccess") {
-        return lq.NewError("Unable to Verify required policies",errors.New("AmazonEC2FullAccess was not found in policies"))
+    if len(denied) > 0 {
+        return deniedActionsError(principalArn, denied)
     }
-
     return nil
 }
 
@@ -383,24 +362,16 @@ func (cloud *awsCloud) DestroyVPC(region Region, vpcid string) error {
 }
 
 func (cloud *awsCloud) CreateSubnet(region Region, az, vpcId string) (string, error) {
-    index := -1
-    for i, loopAz := range AWSRegionsToAZs[Region(region)] {
-        if az == loopAz.String() {
-            index = i
-            break
-        }
-    }
-    
-    if index == -1 {
+    if AzToRegion(az) != region.String() {
         return "", fmt.Errorf("%s is not an az for %s", az, region.String())
     }
 
 	svc := cloud.connect(region)
 
-    //We need to partition the IP spcace in the VPC into the subnets
-    //We can start by doing this equally and then change it later
-    //We partition by using the index of the az in the AWSRegionsToAZ map
-    subnetCIDR := "10.0." + strconv.Itoa(index) + ".0/24" //
+    subnetCIDR, err := freeSubnetCIDR(svc, az, vpcId)
+    if err != nil {
+        return "", err
+    }
     params := &ec2.CreateSubnetInput{
         CidrBlock:        &subnetCIDR,
         VpcId:            &vpcId,
@@ -418,6 +389,36 @@ func (cloud *awsCloud) CreateSubnet(region Region, az, vpcId string) (string, er
     return *sub.Subnet.SubnetId, nil
 }
 
+// The IP space of the VPC is partitioned equally into a /24 per AZ, picked by the letter of the AZ so that it does not
+// depend on the configured AZs. Subnets created before took the index of their AZ in the configuration, so the first
+// free /24 is used when the one of the letter is taken.
+func freeSubnetCIDR(svc *ec2.EC2, az, vpcId string) (string, error) {
+    resp, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+        Filters: []*ec2.Filter{ newEc2Filter("vpc-id", vpcId) },
+    })
+    if err != nil {
+        return "", lq.NewErrorf(err, "Failed listing the subnets of %s", vpcId)
+    }
+    used := map[string]struct{}{}
+    for _, subnet := range resp.Subnets {
+        used[aws.StringValue(subnet.CidrBlock)] = struct{}{}
+    }
+
+    cidr := func(index int) string {
+        return "10.0." + strconv.Itoa(index) + ".0/24"
+    }
+    letter := int(az[len(az) - 1] - 'a')
+    if _, taken := used[cidr(letter)]; !taken {
+        return cidr(letter), nil
+    }
+    for index := 0; index < 256; index++ {
+        if _, taken := used[cidr(index)]; !taken {
+            return cidr(index), nil
+        }
+    }
+    return "", fmt.Errorf("%s has no free subnet left", vpcId)
+}
+
 func (cloud *awsCloud) CreateSecurityGroup(region Region, vpcId string, sgName string) (string, error) {
 	svc := cloud.connect(region)
 	request := &ec2.DescribeSecurityGroupsInput{}
@@ -809,7 +810,8 @@ func (cloud *awsCloud) CleanUpAwsAccount() {
 }
 
 func (cloud *awsCloud) CreateSpotInstanceRequest(region Region, az string, imageId string, subnetId string,
-    securityGroupId string, instanceType string, spotPrice float64, resourceId uint) (*ec2.SpotInstanceRequest, error) {
+    securityGroupId string, instanceType string, spotPrice float64, resourceId uint,
+    storage lq.InstanceStorage) (*ec2.SpotInstanceRequest, error) {
     log.Infof("Creating spot instance request for resource: %d", resourceId)
     svc := cloud.connect(region)
 
@@ -840,15 +842,7 @@ func (cloud *awsCloud) CreateSpotInstanceRequest(region Region, az string, image
                     DeleteOnTermination: aws.Bool(true),
                 },
             },
-            BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-                &ec2.BlockDeviceMapping{
-                    DeviceName: aws.String("/dev/sda1"),
-                    Ebs: &ec2.EbsBlockDevice{
-                        DeleteOnTermination: aws.Bool(true),
-                        VolumeSize: aws.Int64(50),
-                    },
-                },
-            },
+            BlockDeviceMappings: blockDeviceMappings(storage),
         },
     }
 
@@ -866,6 +860,31 @@ func (cloud *awsCloud) CreateSpotInstanceRequest(region Region, az string, image
     return resp.SpotInstanceRequests[0], nil
 }
 
+// The root volume sized for the jobs of the instance, and when requested its instance store volumes.
+// Instance types with fewer instance store volumes than mapped ignore the rest, and NVMe instance store volumes are
+// always attached.
+func blockDeviceMappings(storage lq.InstanceStorage) []*ec2.BlockDeviceMapping {
+    mappings := []*ec2.BlockDeviceMapping{
+        &ec2.BlockDeviceMapping{
+            DeviceName: aws.String("/dev/sda1"),
+            Ebs: &ec2.EbsBlockDevice{
+                DeleteOnTermination: aws.Bool(true),
+                VolumeSize: aws.Int64(int64(storage.VolumeSize)),
+            },
+        },
+    }
+
+    if storage.InstanceStore {
+        for i := 0; i < MaxInstanceStoreVolumes; i++ {
+            mappings = append(mappings, &ec2.BlockDeviceMapping{
+                DeviceName:  aws.String(fmt.Sprintf("/dev/sd%c", 'b' + i)),
+                VirtualName: aws.String(fmt.Sprintf("ephemeral%d", i)),
+            })
+        }
+    }
+    return mappings
+}
+
 func (cloud *awsCloud) GetSpotRequestById(region Region, spotReqId string) (*ec2.SpotInstanceRequest, error) {
     svc := cloud.connect(region)
 
@@ -914,6 +933,14 @@ func (cloud *awsCloud) WaitForSpotRequestToFinish(spotReq *ec2.SpotInstanceReque
     // downstream backoff
     success := false
     defer func() {
+        // The outcome of the request is the status code it ended with, ex: fulfilled, capacity-not-available
+        code := "unknown"
+        if spotReq.Status != nil && spotReq.Status.Code != nil {
+            code = *spotReq.Status.Code
+        }
+        metrics.SpotRequests.With(code, *spotReq.AvailabilityZoneGroup,
+            *spotReq.LaunchSpecification.InstanceType).Inc()
+
         if !success {
             // Mark market as unavailable
             MarkMarketUnavailable(AZ(*spotReq.AvailabilityZoneGroup),
@@ -1266,358 +1293,5 @@ func (cloud *awsCloud) TagInstance(region Region, instanceId string, tag string)
     return err
 }
 
-var GB = 1024.0
-
-type InstanceInfo struct {
-    Cpu     float64
-    Memory  float64
-    Disk    float64
-    Gpu     float64
-}
-
-// TODO These should be autogenerated
-
-func FindPossibleInstances(cpu, memory, gpu, disk float64) []InstanceType {
-    instances := []InstanceType{}
-    for instance, info := range AvailableInstances {
-        if cpu <= info.Cpu &&
-        memory <= info.Memory &&
-        disk <= info.Disk &&
-        gpu <= info.Gpu {
-            instances = append(instances, InstanceType(instance))
-        }
-    }
-    return instances
-}
-
-
-// We are missing the t2.nano unless we update the SDK
-var AvailableInstances = map[InstanceType]InstanceInfo {
-    ec2.InstanceTypeT2Micro: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 0.5 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeT2Small: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 2.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeT2Medium: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 4.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeT2Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 8.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM4Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 8.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM4Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 16.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM42xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 32.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM44xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 64.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM410xlarge: InstanceInfo{
-        Cpu:    40.0,
-        Memory: 160.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM3Medium: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 3.75 * GB,
-        Disk:   1 * 4.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM3Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 7.5 * GB,
-        Disk:   1 * 32.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM3Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 15.0 * GB,
-        Disk:   2 * 40.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM32xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 30.0 * GB,
-        Disk:   2 * 80.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC4Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 3.75 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC4Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 7.5 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC42xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 15.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC44xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 30.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC48xlarge: InstanceInfo{
-        Cpu:    36.0,
-        Memory: 60.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC3Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 3.75 * GB,
-        Disk:   2 * 16.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC3Xlarge: InstanceInfo{
-        Cpu:    5.0,
-        Memory: 7.5 * GB,
-        Disk:   2 * 40.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC32xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 15.0 * GB,
-        Disk:   2 * 80.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC34xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 30.0 * GB,
-        Disk:   2 * 160.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC38xlarge: InstanceInfo{
-        Cpu:    32.0,
-        Memory: 60.0 * GB,
-        Disk:   2 * 320.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeG22xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 15.0 * GB,
-        Disk:   1 * 60.0 * GB,
-        Gpu:    1.0,
-    },
-    "g2.8xlarge": InstanceInfo{
-        Cpu:    32.0,
-        Memory: 60.0 * GB,
-        Disk:   2 * 120.0 * GB,
-        Gpu:    4.0,
-    },
-    ec2.InstanceTypeR3Large: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 15.25 * GB,
-        Disk:   1 * 32.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeR3Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 30.5 * GB,
-        Disk:   1 * 80.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeR32xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 61.0 * GB,
-        Disk:   1 * 160.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeR34xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 122.0 * GB,
-        Disk:   1 * 320.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeR38xlarge: InstanceInfo{
-        Cpu:    32.0,
-        Memory: 244.0 * GB,
-        Disk:   2 * 320.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeI2Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 30.5 * GB,
-        Disk:   1 * 800.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeI22xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 61.0 * GB,
-        Disk:   2 * 800.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeI24xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 122.0 * GB,
-        Disk:   4 * 800.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeI28xlarge: InstanceInfo{
-        Cpu:    32.0,
-        Memory: 244.0 * GB,
-        Disk:   8 * 800.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeD2Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 30.5 * GB,
-        Disk:   3 * 2000.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeD22xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 61.0 * GB,
-        Disk:   6 * 2000.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeD24xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 122.0 * GB,
-        Disk:   12 * 2000.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeD28xlarge: InstanceInfo{
-        Cpu:    36.0,
-        Memory: 244.0 * GB,
-        Disk:   24 * 2000.0 * GB,
-        Gpu:    0.0,
-    },
-
-    /* OLD GENERATION INSTANCES */
-
-    ec2.InstanceTypeM1Small: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 1.7 * GB,
-        Disk:   1.160 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM1Medium: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 3.75 * GB,
-        Disk:   1 * 410.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM1Large: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 7.5 * GB,
-        Disk:   2 * 420.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM1Xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 15.0 * GB,
-        Disk:   4 * 420.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC1Medium: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 1.7 * GB,
-        Disk:   1 * 350.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeC1Xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 7.0 * GB,
-        Disk:   4 * 420.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeCc28xlarge: InstanceInfo{
-        Cpu:    32.0,
-        Memory: 60.5 * GB,
-        Disk:   4 * 480.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeCg14xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 22.5 * GB,
-        Disk:   2 * 840.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM2Xlarge: InstanceInfo{
-        Cpu:    2.0,
-        Memory: 17.1 * GB,
-        Disk:   1 * 420.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM22xlarge: InstanceInfo{
-        Cpu:    4.0,
-        Memory: 34.2 * GB,
-        Disk:   1 * 850.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeM24xlarge: InstanceInfo{
-        Cpu:    8.0,
-        Memory: 68.4 * GB,
-        Disk:   2 * 840.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeCr18xlarge: InstanceInfo{
-        Cpu:    32.0,
-        Memory: 244.0 * GB,
-        Disk:   2 * 120.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeHi14xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 60.5 * GB,
-        Disk:   2 * 1024.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeHs18xlarge: InstanceInfo{
-        Cpu:    16.0,
-        Memory: 117.0 * GB,
-        Disk:   24 * 2000.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeT1Micro: InstanceInfo{
-        Cpu:    1.0,
-        Memory: 0.613 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-    ec2.InstanceTypeCc14xlarge: InstanceInfo{
-        Cpu:    0.0,
-        Memory: 0.0 * GB,
-        Disk:   0.0 * GB,
-        Gpu:    0.0,
-    },
-}
+// The most instance store volumes of any instance type (d2.8xlarge)
+const MaxInstanceStoreVolumes = 24
@@ -12,7 +12,7 @@ import(
 
 func TestCreateAwsCloud(t *testing.T) {
     Convey("Create new aws cloud with creds", t, func() {
-        NewAwsCloud(fetchCreds())
+        NewAwsCloudWithKeys(fetchCreds())
     })
 }
 
@@ -30,7 +30,7 @@ func TestSetupVPC(t *testing.T) {
 
 	Convey("Setting up Creds", t, func() {
 
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 
 		Convey("Setup VPC in US-West-1", func() {
 			vpcid,err := aws.CreateVPC(testRegion)
@@ -48,7 +48,7 @@ func TestSetupVPC(t *testing.T) {
 func TestSetupSubnets(t *testing.T){
 	Convey("Setting up Creds", t, func() {
 
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 
 		Convey("Setup VPC in US-West-1", func() {
 			vpcid, err := aws.CreateVPC(testRegion)
@@ -77,7 +77,7 @@ func TestSetupSubnets(t *testing.T){
 func TestSecurityGroup(t *testing.T){
 	Convey("Setting up Creds", t, func() {
 
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 
 		Convey("Setup VPC in US-West-1", func() {
 			vpcid,err := aws.CreateVPC(testRegion)
@@ -100,14 +100,14 @@ func TestSecurityGroup(t *testing.T){
 
 func TestCleanupAwsAccount(t *testing.T) {
 	Convey("Cleaning up aws account", t, func() {
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 		aws.CleanUpAwsAccount()
 	})
 }
 
 func TestGettingSpotPrices(t *testing.T) {
 	Convey("Getting spot prices", t, func() {
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 
 		end := time.Now()
 		start := end.Add(time.Duration(-24) * time.Hour)
@@ -127,7 +127,7 @@ func TestGettingSpotPrices(t *testing.T) {
 
 func TestVerifyPolicy(t *testing.T){
 	Convey("Test Policy Verification", t, func() {
-		aws := NewAwsCloud(fetchCreds())
+		aws := NewAwsCloudWithKeys(fetchCreds())
 		err := aws.VerifyPolicy()
 		So(err,ShouldBeNil)
 	})
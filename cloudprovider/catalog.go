@@ -0,0 +1,210 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+var GB = 1024.0
+
+// The catalog file replacing the default catalog, which is reloaded whenever a newer version of it is generated
+const CatalogFileEnv = "LIQUEFY_INSTANCE_CATALOG_FILE"
+
+var CatalogRefreshInterval = time.Duration(10) * time.Minute
+
+// Executors are built for, and images are only created for, this architecture
+const catalogArchitecture = "x86_64"
+
+const (
+	VirtualizationHvm         = "hvm"
+	VirtualizationParavirtual = "paravirtual"
+)
+
+type InstanceInfo struct {
+	Cpu                  float64  `json:"vcpus"`
+	Memory               float64  `json:"memory"`          // MB
+	Disk                 float64  `json:"instanceStorage"` // MB of all the instance store volumes
+	InstanceStoreVolumes int      `json:"instanceStoreVolumes"`
+	Gpu                  float64  `json:"gpus"`
+	GpuModel             string   `json:"gpuModel,omitempty"`
+	Architectures        []string `json:"architectures"`
+	Virtualization       []string `json:"virtualization"`
+	NetworkPerformance   string   `json:"networkPerformance,omitempty"`
+	Regions              []Region `json:"regions"` // regions the instance type is offered in
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (info *InstanceInfo) OfferedIn(region Region) bool {
+	for _, offered := range info.Regions {
+		if offered == region {
+			return true
+		}
+	}
+	return false
+}
+
+// The instance types Liquefy can run, along with the images instances are launched from. The version grows with every
+// generated catalog, so that services only replace their catalog with a newer one.
+type InstanceCatalog struct {
+	Version   int                            `json:"version"`
+	Generated string                         `json:"generated,omitempty"` // when the catalog was generated
+	Images    map[Region]map[string]string   `json:"images"`              // image of each virtualization type
+	Instances map[InstanceType]*InstanceInfo `json:"instances"`
+}
+
+func ParseCatalog(data []byte) (*InstanceCatalog, error) {
+	catalog := &InstanceCatalog{}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, err
+	}
+	if catalog.Version <= 0 {
+		return nil, fmt.Errorf("The catalog has no version")
+	}
+	if len(catalog.Instances) == 0 {
+		return nil, fmt.Errorf("The catalog has no instance types")
+	}
+	for instanceType, info := range catalog.Instances {
+		if info == nil || info.Cpu <= 0 || info.Memory <= 0 || len(info.Virtualization) == 0 {
+			return nil, fmt.Errorf("Instance type %s is missing its vcpus, memory or virtualization", instanceType)
+		}
+	}
+	return catalog, nil
+}
+
+func LoadCatalogFile(path string) (*InstanceCatalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading the instance catalog %s", path)
+	}
+	catalog, err := ParseCatalog(data)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Invalid instance catalog %s", path)
+	}
+	return catalog, nil
+}
+
+// The image to launch an instance type from in a region, preferring HVM images
+func (catalog *InstanceCatalog) ImageId(region Region, instanceType InstanceType) (string, error) {
+	info, ok := catalog.Instances[instanceType]
+	if !ok {
+		return "", fmt.Errorf("Instance type %s is not in the catalog", instanceType)
+	}
+	for _, virtualization := range []string{VirtualizationHvm, VirtualizationParavirtual} {
+		if image := catalog.Images[region][virtualization]; image != "" && contains(info.Virtualization, virtualization) {
+			return image, nil
+		}
+	}
+	return "", fmt.Errorf("There is no image in %s for instance type %s", region, instanceType)
+}
+
+// Whether instances of the type can be launched in the region
+func (catalog *InstanceCatalog) Supports(region Region, instanceType InstanceType) bool {
+	info, ok := catalog.Instances[instanceType]
+	if !ok || !info.OfferedIn(region) || !contains(info.Architectures, catalogArchitecture) {
+		return false
+	}
+	_, err := catalog.ImageId(region, instanceType)
+	return err == nil
+}
+
+var (
+	catalogMutex   sync.RWMutex
+	currentCatalog *InstanceCatalog
+)
+
+func init() {
+	catalog, err := ParseCatalog([]byte(defaultCatalogJSON))
+	if err != nil {
+		log.Fatalf("Invalid default instance catalog: %s", err.Error())
+	}
+	currentCatalog = catalog
+
+	if path := os.Getenv(CatalogFileEnv); path != "" {
+		catalog, err := LoadCatalogFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		currentCatalog = catalog
+	}
+}
+
+// The catalog in use, which must not be modified
+func Catalog() *InstanceCatalog {
+	catalogMutex.RLock()
+	defer catalogMutex.RUnlock()
+	return currentCatalog
+}
+
+// Replaces the catalog in use when the catalog is newer, returning whether it was replaced
+func SetCatalog(catalog *InstanceCatalog) bool {
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+	if catalog.Version <= currentCatalog.Version {
+		return false
+	}
+	currentCatalog = catalog
+	return true
+}
+
+// Reloads the catalog file of CatalogFileEnv every CatalogRefreshInterval, so that regenerating it updates running
+// services. Does nothing when the default catalog is used.
+func StartCatalogRefresh() {
+	path := os.Getenv(CatalogFileEnv)
+	if path == "" {
+		return
+	}
+	go func() {
+		clock := time.NewTicker(CatalogRefreshInterval)
+		for range clock.C {
+			catalog, err := LoadCatalogFile(path)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if SetCatalog(catalog) {
+				log.Infof("Loaded version %d of the instance catalog", catalog.Version)
+			}
+		}
+	}()
+}
+
+// Disk is satisfied by the instance store volumes of the instance when requested, otherwise by its root volume
+func FindPossibleInstances(cpu, memory, gpu, disk float64, instanceStore bool) []InstanceType {
+	instances := []InstanceType{}
+	for instance, info := range Catalog().Instances {
+		if !contains(info.Architectures, catalogArchitecture) {
+			continue
+		}
+		diskCapacity := float64(lq.MaxRootDisk())
+		if instanceStore {
+			if info.Disk == 0 {
+				continue
+			}
+			diskCapacity = info.Disk
+		}
+
+		if cpu <= info.Cpu &&
+			memory <= info.Memory &&
+			disk <= diskCapacity &&
+			gpu <= info.Gpu {
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
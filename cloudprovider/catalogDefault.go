@@ -0,0 +1,937 @@
+// Code generated by generateInstanceCatalog.go.
+// DO NOT EDIT!
+
+package cloudprovider
+
+// The instance catalog used when CatalogFileEnv is not set
+const defaultCatalogJSON = `{
+	"version": 1,
+	"images": {
+		"us-east-1": {
+			"hvm": "ami-07f4c96d",
+			"paravirtual": "ami-988ad1f0"
+		},
+		"us-west-1": {
+			"hvm": "ami-ea76068a",
+			"paravirtual": "ami-397d997d"
+		},
+		"us-west-2": {
+			"hvm": "ami-2fbd504f",
+			"paravirtual": "ami-cb1536fb"
+		}
+	},
+	"instances": {
+		"c1.medium": {
+			"vcpus": 2,
+			"memory": 1740.8,
+			"instanceStorage": 358400,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"i386",
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"c1.xlarge": {
+			"vcpus": 8,
+			"memory": 7168,
+			"instanceStorage": 1720320,
+			"instanceStoreVolumes": 4,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"c3.2xlarge": {
+			"vcpus": 8,
+			"memory": 15360,
+			"instanceStorage": 163840,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c3.4xlarge": {
+			"vcpus": 16,
+			"memory": 30720,
+			"instanceStorage": 327680,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c3.8xlarge": {
+			"vcpus": 32,
+			"memory": 61440,
+			"instanceStorage": 655360,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c3.large": {
+			"vcpus": 2,
+			"memory": 3840,
+			"instanceStorage": 32768,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c3.xlarge": {
+			"vcpus": 5,
+			"memory": 7680,
+			"instanceStorage": 81920,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c4.2xlarge": {
+			"vcpus": 8,
+			"memory": 15360,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c4.4xlarge": {
+			"vcpus": 16,
+			"memory": 30720,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c4.8xlarge": {
+			"vcpus": 36,
+			"memory": 61440,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c4.large": {
+			"vcpus": 2,
+			"memory": 3840,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"c4.xlarge": {
+			"vcpus": 4,
+			"memory": 7680,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"cc2.8xlarge": {
+			"vcpus": 32,
+			"memory": 61952,
+			"instanceStorage": 1966080,
+			"instanceStoreVolumes": 4,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"cg1.4xlarge": {
+			"vcpus": 16,
+			"memory": 23040,
+			"instanceStorage": 1720320,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"cr1.8xlarge": {
+			"vcpus": 32,
+			"memory": 249856,
+			"instanceStorage": 245760,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"d2.2xlarge": {
+			"vcpus": 8,
+			"memory": 62464,
+			"instanceStorage": 12288000,
+			"instanceStoreVolumes": 6,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"d2.4xlarge": {
+			"vcpus": 16,
+			"memory": 124928,
+			"instanceStorage": 24576000,
+			"instanceStoreVolumes": 12,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"d2.8xlarge": {
+			"vcpus": 36,
+			"memory": 249856,
+			"instanceStorage": 49152000,
+			"instanceStoreVolumes": 24,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"d2.xlarge": {
+			"vcpus": 4,
+			"memory": 31232,
+			"instanceStorage": 6144000,
+			"instanceStoreVolumes": 3,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"g2.2xlarge": {
+			"vcpus": 8,
+			"memory": 15360,
+			"instanceStorage": 61440,
+			"instanceStoreVolumes": 1,
+			"gpus": 1,
+			"gpuModel": "NVIDIA GRID K520",
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"g2.8xlarge": {
+			"vcpus": 32,
+			"memory": 61440,
+			"instanceStorage": 245760,
+			"instanceStoreVolumes": 2,
+			"gpus": 4,
+			"gpuModel": "NVIDIA GRID K520",
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"hi1.4xlarge": {
+			"vcpus": 16,
+			"memory": 61952,
+			"instanceStorage": 2097152,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"hs1.8xlarge": {
+			"vcpus": 16,
+			"memory": 119808,
+			"instanceStorage": 49152000,
+			"instanceStoreVolumes": 24,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"i2.2xlarge": {
+			"vcpus": 8,
+			"memory": 62464,
+			"instanceStorage": 1638400,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"i2.4xlarge": {
+			"vcpus": 16,
+			"memory": 124928,
+			"instanceStorage": 3276800,
+			"instanceStoreVolumes": 4,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"i2.8xlarge": {
+			"vcpus": 32,
+			"memory": 249856,
+			"instanceStorage": 6553600,
+			"instanceStoreVolumes": 8,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"i2.xlarge": {
+			"vcpus": 4,
+			"memory": 31232,
+			"instanceStorage": 819200,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m1.large": {
+			"vcpus": 2,
+			"memory": 7680,
+			"instanceStorage": 860160,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m1.medium": {
+			"vcpus": 1,
+			"memory": 3840,
+			"instanceStorage": 419840,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"i386",
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m1.small": {
+			"vcpus": 1,
+			"memory": 1740.8,
+			"instanceStorage": 1187.84,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"i386",
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m1.xlarge": {
+			"vcpus": 4,
+			"memory": 15360,
+			"instanceStorage": 1720320,
+			"instanceStoreVolumes": 4,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m2.2xlarge": {
+			"vcpus": 4,
+			"memory": 35020.8,
+			"instanceStorage": 870400,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m2.4xlarge": {
+			"vcpus": 8,
+			"memory": 70041.6,
+			"instanceStorage": 1720320,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m2.xlarge": {
+			"vcpus": 2,
+			"memory": 17510.4,
+			"instanceStorage": 430080,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"m3.2xlarge": {
+			"vcpus": 8,
+			"memory": 30720,
+			"instanceStorage": 163840,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m3.large": {
+			"vcpus": 2,
+			"memory": 7680,
+			"instanceStorage": 32768,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m3.medium": {
+			"vcpus": 1,
+			"memory": 3840,
+			"instanceStorage": 4096,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m3.xlarge": {
+			"vcpus": 4,
+			"memory": 15360,
+			"instanceStorage": 81920,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm",
+				"paravirtual"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m4.10xlarge": {
+			"vcpus": 40,
+			"memory": 163840,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m4.2xlarge": {
+			"vcpus": 8,
+			"memory": 32768,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m4.4xlarge": {
+			"vcpus": 16,
+			"memory": 65536,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m4.large": {
+			"vcpus": 2,
+			"memory": 8192,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"m4.xlarge": {
+			"vcpus": 4,
+			"memory": 16384,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"r3.2xlarge": {
+			"vcpus": 8,
+			"memory": 62464,
+			"instanceStorage": 163840,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"r3.4xlarge": {
+			"vcpus": 16,
+			"memory": 124928,
+			"instanceStorage": 327680,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"r3.8xlarge": {
+			"vcpus": 32,
+			"memory": 249856,
+			"instanceStorage": 655360,
+			"instanceStoreVolumes": 2,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"r3.large": {
+			"vcpus": 4,
+			"memory": 15616,
+			"instanceStorage": 32768,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"r3.xlarge": {
+			"vcpus": 4,
+			"memory": 31232,
+			"instanceStorage": 81920,
+			"instanceStoreVolumes": 1,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": [
+				"us-east-1",
+				"us-west-1",
+				"us-west-2"
+			]
+		},
+		"t1.micro": {
+			"vcpus": 1,
+			"memory": 627.712,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"i386",
+				"x86_64"
+			],
+			"virtualization": [
+				"paravirtual"
+			],
+			"regions": []
+		},
+		"t2.large": {
+			"vcpus": 2,
+			"memory": 8192,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": []
+		},
+		"t2.medium": {
+			"vcpus": 2,
+			"memory": 4096,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": []
+		},
+		"t2.micro": {
+			"vcpus": 1,
+			"memory": 512,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": []
+		},
+		"t2.small": {
+			"vcpus": 1,
+			"memory": 2048,
+			"instanceStorage": 0,
+			"instanceStoreVolumes": 0,
+			"gpus": 0,
+			"architectures": [
+				"x86_64"
+			],
+			"virtualization": [
+				"hvm"
+			],
+			"regions": []
+		}
+	}
+}
+`
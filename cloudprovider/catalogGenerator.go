@@ -0,0 +1,197 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	lq "bargain/liquefy/models"
+)
+
+// InstanceTypeDescriber describes the instance types offered in a region, with the ec2 DescribeInstanceTypes api
+type InstanceTypeDescriber interface {
+	DescribeInstanceTypes(region Region) (map[InstanceType]*InstanceInfo, error)
+}
+
+// The catalog is generated with the credentials Liquefy itself runs with. Tests stub the ec2 api through this.
+var NewInstanceTypeDescriber = func() InstanceTypeDescriber {
+	return &ec2InstanceTypes{}
+}
+
+// Builds the next version of a catalog from the instance types offered in the regions. Images cannot be described,
+// they are kept from the previous catalog.
+func GenerateCatalog(describer InstanceTypeDescriber, regions []Region, previous *InstanceCatalog,
+	now time.Time) (*InstanceCatalog, error) {
+	catalog := &InstanceCatalog{
+		Version:   previous.Version + 1,
+		Generated: now.UTC().Format(time.RFC3339),
+		Images:    previous.Images,
+		Instances: map[InstanceType]*InstanceInfo{},
+	}
+
+	sorted := append([]Region{}, regions...)
+	sort.Sort(byRegion(sorted))
+	for _, region := range sorted {
+		described, err := describer.DescribeInstanceTypes(region)
+		if err != nil {
+			return nil, lq.NewErrorf(err, "Failed describing the instance types of %s", region)
+		}
+		for instanceType, info := range described {
+			if existing, ok := catalog.Instances[instanceType]; ok {
+				existing.Regions = append(existing.Regions, region)
+				continue
+			}
+			info.Regions = []Region{region}
+			catalog.Instances[instanceType] = info
+		}
+	}
+	if len(catalog.Instances) == 0 {
+		return nil, fmt.Errorf("No instance types are offered in %v", regions)
+	}
+	return catalog, nil
+}
+
+// The catalog as the json file services load
+func (catalog *InstanceCatalog) MarshalFile() ([]byte, error) {
+	data, err := json.MarshalIndent(catalog, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// The catalog as the go source of the default catalog
+func (catalog *InstanceCatalog) MarshalDefault() ([]byte, error) {
+	data, err := catalog.MarshalFile()
+	if err != nil {
+		return nil, err
+	}
+	source := "// Code generated by generateInstanceCatalog.go.\n// DO NOT EDIT!\n\npackage cloudprovider\n\n" +
+		"// The instance catalog used when CatalogFileEnv is not set\nconst defaultCatalogJSON = `" + string(data) + "`\n"
+	return []byte(source), nil
+}
+
+type ec2InstanceTypes struct{}
+
+// The shapes of the DescribeInstanceTypes api, which is newer than the vendored ec2 client. Requests are made through
+// the client with a newer api version.
+const describeInstanceTypesVersion = "2016-11-15"
+
+type describeInstanceTypesInput struct {
+	MaxResults *int64  `type:"integer"`
+	NextToken  *string `type:"string"`
+}
+
+type describeInstanceTypesOutput struct {
+	InstanceTypes []*describedInstanceType `locationName:"instanceTypeSet" locationNameList:"item" type:"list"`
+	NextToken     *string                  `locationName:"nextToken" type:"string"`
+}
+
+type describedInstanceType struct {
+	InstanceType                 *string              `locationName:"instanceType" type:"string"`
+	SupportedVirtualizationTypes []*string            `locationName:"supportedVirtualizationTypes" locationNameList:"item" type:"list"`
+	ProcessorInfo                *describedProcessor  `locationName:"processorInfo" type:"structure"`
+	VCpuInfo                     *describedVCpus      `locationName:"vCpuInfo" type:"structure"`
+	MemoryInfo                   *describedMemory     `locationName:"memoryInfo" type:"structure"`
+	InstanceStorageInfo          *describedStorage    `locationName:"instanceStorageInfo" type:"structure"`
+	GpuInfo                      *describedGpus       `locationName:"gpuInfo" type:"structure"`
+	NetworkInfo                  *describedNetworking `locationName:"networkInfo" type:"structure"`
+}
+
+type describedProcessor struct {
+	SupportedArchitectures []*string `locationName:"supportedArchitectures" locationNameList:"item" type:"list"`
+}
+
+type describedVCpus struct {
+	DefaultVCpus *int64 `locationName:"defaultVCpus" type:"integer"`
+}
+
+type describedMemory struct {
+	SizeInMiB *int64 `locationName:"sizeInMiB" type:"long"`
+}
+
+type describedStorage struct {
+	TotalSizeInGB *int64           `locationName:"totalSizeInGB" type:"long"`
+	Disks         []*describedDisk `locationName:"disks" locationNameList:"item" type:"list"`
+}
+
+type describedDisk struct {
+	Count *int64 `locationName:"count" type:"integer"`
+}
+
+type describedGpus struct {
+	Gpus []*describedGpu `locationName:"gpus" locationNameList:"item" type:"list"`
+}
+
+type describedGpu struct {
+	Count        *int64  `locationName:"count" type:"integer"`
+	Manufacturer *string `locationName:"manufacturer" type:"string"`
+	Name         *string `locationName:"name" type:"string"`
+}
+
+type describedNetworking struct {
+	NetworkPerformance *string `locationName:"networkPerformance" type:"string"`
+}
+
+func (describer *ec2InstanceTypes) DescribeInstanceTypes(region Region) (map[InstanceType]*InstanceInfo, error) {
+	svc := ec2.New(session.New(&aws.Config{Region: aws.String(region.String())}))
+	operation := &request.Operation{Name: "DescribeInstanceTypes", HTTPMethod: "POST", HTTPPath: "/"}
+
+	instances := map[InstanceType]*InstanceInfo{}
+	input := &describeInstanceTypesInput{MaxResults: aws.Int64(100)}
+	for {
+		output := &describeInstanceTypesOutput{}
+		req := svc.NewRequest(operation, input, output)
+		req.ClientInfo.APIVersion = describeInstanceTypesVersion
+		if err := req.Send(); err != nil {
+			return nil, err
+		}
+		for _, described := range output.InstanceTypes {
+			instances[InstanceType(aws.StringValue(described.InstanceType))] = described.info()
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			return instances, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+func (described *describedInstanceType) info() *InstanceInfo {
+	info := &InstanceInfo{
+		Architectures:  []string{},
+		Virtualization: aws.StringValueSlice(described.SupportedVirtualizationTypes),
+	}
+	if described.ProcessorInfo != nil {
+		info.Architectures = aws.StringValueSlice(described.ProcessorInfo.SupportedArchitectures)
+	}
+	if described.VCpuInfo != nil {
+		info.Cpu = float64(aws.Int64Value(described.VCpuInfo.DefaultVCpus))
+	}
+	if described.MemoryInfo != nil {
+		info.Memory = float64(aws.Int64Value(described.MemoryInfo.SizeInMiB))
+	}
+	if described.InstanceStorageInfo != nil {
+		info.Disk = float64(aws.Int64Value(described.InstanceStorageInfo.TotalSizeInGB)) * GB
+		for _, disk := range described.InstanceStorageInfo.Disks {
+			info.InstanceStoreVolumes += int(aws.Int64Value(disk.Count))
+		}
+	}
+	if described.GpuInfo != nil {
+		for _, gpu := range described.GpuInfo.Gpus {
+			info.Gpu += float64(aws.Int64Value(gpu.Count))
+			if info.GpuModel == "" {
+				info.GpuModel = aws.StringValue(gpu.Manufacturer) + " " + aws.StringValue(gpu.Name)
+			}
+		}
+	}
+	if described.NetworkInfo != nil {
+		info.NetworkPerformance = aws.StringValue(described.NetworkInfo.NetworkPerformance)
+	}
+	return info
+}
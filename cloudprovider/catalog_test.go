@@ -0,0 +1,142 @@
+package cloudprovider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	catalog := Catalog()
+	assert.True(t, catalog.Version > 0)
+	assert.Equal(t, 15360.0, catalog.Instances["g2.2xlarge"].Memory)
+
+	image, err := catalog.ImageId("us-east-1", "c3.large")
+	assert.Nil(t, err)
+	assert.Equal(t, "ami-07f4c96d", image)
+
+	_, err = catalog.ImageId("eu-west-1", "c3.large")
+	assert.NotNil(t, err)
+	_, err = catalog.ImageId("us-east-1", "x9.large")
+	assert.NotNil(t, err)
+
+	assert.True(t, catalog.Supports("us-west-2", "g2.2xlarge"))
+	assert.False(t, catalog.Supports("us-west-2", "t2.micro"))
+	assert.False(t, catalog.Supports("eu-west-1", "g2.2xlarge"))
+}
+
+func TestImageIdByVirtualization(t *testing.T) {
+	catalog := &InstanceCatalog{
+		Images: map[Region]map[string]string{
+			"us-east-1": {VirtualizationHvm: "ami-hvm", VirtualizationParavirtual: "ami-pv"},
+			"us-west-1": {VirtualizationParavirtual: "ami-pv"},
+		},
+		Instances: map[InstanceType]*InstanceInfo{
+			"m1.small": {Virtualization: []string{VirtualizationParavirtual}},
+			"m3.large": {Virtualization: []string{VirtualizationHvm, VirtualizationParavirtual}},
+			"m4.large": {Virtualization: []string{VirtualizationHvm}},
+		},
+	}
+
+	image, _ := catalog.ImageId("us-east-1", "m1.small")
+	assert.Equal(t, "ami-pv", image)
+	image, _ = catalog.ImageId("us-east-1", "m3.large")
+	assert.Equal(t, "ami-hvm", image)
+	image, _ = catalog.ImageId("us-west-1", "m3.large")
+	assert.Equal(t, "ami-pv", image)
+	_, err := catalog.ImageId("us-west-1", "m4.large")
+	assert.NotNil(t, err)
+}
+
+func TestFindPossibleInstances(t *testing.T) {
+	instances := FindPossibleInstances(32, 200000, 0, 0, false)
+	assert.Contains(t, instances, InstanceType("cr1.8xlarge"))
+	assert.NotContains(t, instances, InstanceType("c3.8xlarge"))
+
+	instances = FindPossibleInstances(1, 1024, 4, 0, false)
+	assert.Equal(t, []InstanceType{"g2.8xlarge"}, instances)
+
+	// Only instance types with instance store volumes satisfy disk with them
+	for _, instance := range FindPossibleInstances(1, 1024, 0, 1024, true) {
+		assert.True(t, Catalog().Instances[instance].Disk >= 1024, instance.String())
+	}
+	assert.NotContains(t, FindPossibleInstances(1, 1024, 0, 1024, true), InstanceType("m4.large"))
+}
+
+func TestParseCatalog(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(`{"version": 3, "images": {"us-east-1": {"hvm": "ami-1"}},
+		"instances": {"m4.large": {"vcpus": 2, "memory": 8192, "virtualization": ["hvm"], "regions": ["us-east-1"]}}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, catalog.Version)
+	assert.True(t, catalog.Instances["m4.large"].OfferedIn("us-east-1"))
+
+	for _, invalid := range []string{
+		`[]`,
+		`{"instances": {"m4.large": {"vcpus": 2, "memory": 8192, "virtualization": ["hvm"]}}}`,
+		`{"version": 1, "instances": {}}`,
+		`{"version": 1, "instances": {"m4.large": {"memory": 8192, "virtualization": ["hvm"]}}}`,
+		`{"version": 1, "instances": {"m4.large": {"vcpus": 2, "memory": 8192}}}`,
+		`{"version": 1, "instances": {"m4.large": null}}`,
+	} {
+		_, err := ParseCatalog([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSetCatalog(t *testing.T) {
+	previous := Catalog()
+	defer func() { currentCatalog = previous }()
+
+	assert.False(t, SetCatalog(&InstanceCatalog{Version: previous.Version}))
+	assert.Equal(t, previous, Catalog())
+
+	newer := &InstanceCatalog{Version: previous.Version + 1}
+	assert.True(t, SetCatalog(newer))
+	assert.Equal(t, newer, Catalog())
+}
+
+type stubDescriber map[Region]map[InstanceType]*InstanceInfo
+
+func (describer stubDescriber) DescribeInstanceTypes(region Region) (map[InstanceType]*InstanceInfo, error) {
+	instances, ok := describer[region]
+	if !ok {
+		return nil, errors.New("Unknown region")
+	}
+	return instances, nil
+}
+
+func TestGenerateCatalog(t *testing.T) {
+	info := func() *InstanceInfo {
+		return &InstanceInfo{Cpu: 2, Memory: 8192, Architectures: []string{"x86_64"},
+			Virtualization: []string{VirtualizationHvm}}
+	}
+	describer := stubDescriber{
+		"us-west-2": {"m4.large": info(), "c4.large": info()},
+		"us-east-1": {"m4.large": info()},
+	}
+	previous := Catalog()
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	catalog, err := GenerateCatalog(describer, []Region{"us-west-2", "us-east-1"}, previous, now)
+	assert.Nil(t, err)
+	assert.Equal(t, previous.Version+1, catalog.Version)
+	assert.Equal(t, "2016-03-01T12:00:00Z", catalog.Generated)
+	assert.Equal(t, previous.Images, catalog.Images)
+	assert.Equal(t, []Region{"us-east-1", "us-west-2"}, catalog.Instances["m4.large"].Regions)
+	assert.Equal(t, []Region{"us-west-2"}, catalog.Instances["c4.large"].Regions)
+	assert.True(t, catalog.Supports("us-east-1", "m4.large"))
+	assert.False(t, catalog.Supports("us-east-1", "c4.large"))
+
+	data, err := catalog.MarshalFile()
+	assert.Nil(t, err)
+	parsed, err := ParseCatalog(data)
+	assert.Nil(t, err)
+	assert.Equal(t, catalog, parsed)
+
+	_, err = GenerateCatalog(describer, []Region{"eu-west-1"}, previous, now)
+	assert.NotNil(t, err)
+	_, err = GenerateCatalog(stubDescriber{"us-east-1": {}}, []Region{"us-east-1"}, previous, now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,106 @@
+package cloudprovider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	lq "bargain/liquefy/models"
+)
+
+// How long credentials of an assumed role last, and how long before they expire they are refreshed
+var RoleSessionDuration = time.Duration(1) * time.Hour
+var RoleCredentialsExpiryWindow = time.Duration(5) * time.Minute
+
+const RoleSessionName = "liquefy"
+
+// StsClient is the part of the STS api used to assume roles of linked accounts
+type StsClient interface {
+	AssumeRole(*sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error)
+}
+
+// IamClient is the part of the IAM api used to verify linked accounts allow what Liquefy does
+type IamClient interface {
+	GetUser(*iam.GetUserInput) (*iam.GetUserOutput, error)
+	SimulatePrincipalPolicy(*iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error)
+}
+
+// Clients are created through these so tests can stub the STS and IAM apis. Roles are assumed with the credentials
+// Liquefy itself runs with, ex: its instance profile.
+var NewStsClient = func() StsClient {
+	return sts.New(session.New())
+}
+
+var NewIamClient = func(creds *credentials.Credentials) IamClient {
+	return iam.New(session.New(&aws.Config{Credentials: creds}))
+}
+
+// Assumed role credentials are shared by every AwsCloud of the same role, so the role is only assumed again once
+// they are about to expire
+var roleCredentials = make(map[string]*credentials.Credentials)
+var roleCredentialsMutex sync.Mutex
+
+// Credentials for an account, temporary credentials of its role when it was linked with one and its access keys
+// otherwise
+func accountCredentials(account *lq.AwsAccount) *credentials.Credentials {
+	if account.GetAwsRoleArn() == "" {
+		return credentials.NewStaticCredentials(account.GetAwsAccessKey(), account.GetAwsSecretKey(), "")
+	}
+	return RoleCredentials(account.GetAwsRoleArn(), account.GetAwsExternalId())
+}
+
+func RoleCredentials(roleArn, externalID string) *credentials.Credentials {
+	roleCredentialsMutex.Lock()
+	defer roleCredentialsMutex.Unlock()
+
+	key := roleArn + "|" + externalID
+	if creds, ok := roleCredentials[key]; ok {
+		return creds
+	}
+	creds := credentials.NewCredentials(&assumeRoleProvider{
+		client:     NewStsClient(),
+		roleArn:    roleArn,
+		externalID: externalID,
+	})
+	roleCredentials[key] = creds
+	return creds
+}
+
+// assumeRoleProvider retrieves temporary credentials by assuming a role with an external id
+type assumeRoleProvider struct {
+	client     StsClient
+	roleArn    string
+	externalID string
+	expiration time.Time
+}
+
+func (provider *assumeRoleProvider) Retrieve() (credentials.Value, error) {
+	output, err := provider.client.AssumeRole(&sts.AssumeRoleInput{
+		RoleArn:         aws.String(provider.roleArn),
+		ExternalId:      aws.String(provider.externalID),
+		RoleSessionName: aws.String(RoleSessionName),
+		DurationSeconds: aws.Int64(int64(RoleSessionDuration / time.Second)),
+	})
+	if err != nil {
+		return credentials.Value{}, lq.NewErrorf(err, "Failed assuming role %s", provider.roleArn)
+	}
+	if output.Credentials == nil {
+		return credentials.Value{}, lq.NewErrorf(nil, "Assuming role %s returned no credentials", provider.roleArn)
+	}
+
+	provider.expiration = aws.TimeValue(output.Credentials.Expiration).Add(-RoleCredentialsExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+	}, nil
+}
+
+func (provider *assumeRoleProvider) IsExpired() bool {
+	return time.Now().After(provider.expiration)
+}
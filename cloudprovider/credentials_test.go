@@ -0,0 +1,150 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+type stubSts struct {
+	inputs     []*sts.AssumeRoleInput
+	expiration time.Time
+	err        error
+}
+
+func (client *stubSts) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	client.inputs = append(client.inputs, input)
+	if client.err != nil {
+		return nil, client.err
+	}
+	return &sts.AssumeRoleOutput{Credentials: &sts.Credentials{
+		AccessKeyId:     aws.String("ASIA" + string(rune('0'+len(client.inputs)))),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(client.expiration),
+	}}, nil
+}
+
+type stubIam struct {
+	userArn string
+	denied  map[string]bool
+	inputs  []*iam.SimulatePrincipalPolicyInput
+}
+
+func (client *stubIam) GetUser(*iam.GetUserInput) (*iam.GetUserOutput, error) {
+	return &iam.GetUserOutput{User: &iam.User{Arn: aws.String(client.userArn)}}, nil
+}
+
+func (client *stubIam) SimulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	client.inputs = append(client.inputs, input)
+	results := []*iam.EvaluationResult{}
+	for _, action := range input.ActionNames {
+		decision := "allowed"
+		if client.denied[*action] {
+			decision = "implicitDeny"
+		}
+		results = append(results, &iam.EvaluationResult{EvalActionName: action, EvalDecision: aws.String(decision)})
+	}
+	return &iam.SimulatePolicyResponse{EvaluationResults: results, IsTruncated: aws.Bool(false)}, nil
+}
+
+func stubClients(stsClient StsClient, iamClient IamClient) func() {
+	newSts, newIam := NewStsClient, NewIamClient
+	NewStsClient = func() StsClient { return stsClient }
+	NewIamClient = func(*credentials.Credentials) IamClient { return iamClient }
+	roleCredentials = make(map[string]*credentials.Credentials)
+	return func() {
+		NewStsClient, NewIamClient = newSts, newIam
+		roleCredentials = make(map[string]*credentials.Credentials)
+	}
+}
+
+func roleAccount(roleArn, externalID string) *lq.AwsAccount {
+	return &lq.AwsAccount{AwsRoleArn: &roleArn, AwsExternalId: &externalID}
+}
+
+func TestRoleCredentialsAreCachedUntilExpiry(t *testing.T) {
+	client := &stubSts{expiration: time.Now().Add(time.Hour)}
+	defer stubClients(client, nil)()
+
+	account := roleAccount("arn:aws:iam::123456789012:role/liquefy", "lq-ext")
+	first, err := accountCredentials(account).Get()
+	assert.Nil(t, err)
+	second, err := accountCredentials(account).Get()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(client.inputs))
+	assert.Equal(t, first, second)
+	assert.Equal(t, "token", first.SessionToken)
+	assert.Equal(t, "lq-ext", *client.inputs[0].ExternalId)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/liquefy", *client.inputs[0].RoleArn)
+}
+
+func TestRoleCredentialsAreRefreshedBeforeExpiry(t *testing.T) {
+	// Expiring within the window, so they are stale as soon as they are retrieved
+	client := &stubSts{expiration: time.Now().Add(RoleCredentialsExpiryWindow / 2)}
+	defer stubClients(client, nil)()
+
+	creds := accountCredentials(roleAccount("arn:aws:iam::123456789012:role/liquefy", "lq-ext"))
+	first, err := creds.Get()
+	assert.Nil(t, err)
+	second, err := creds.Get()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(client.inputs))
+	assert.NotEqual(t, first.AccessKeyID, second.AccessKeyID)
+}
+
+func TestRoleCredentialsFailure(t *testing.T) {
+	defer stubClients(&stubSts{err: errors.New("AccessDenied")}, nil)()
+
+	_, err := accountCredentials(roleAccount("arn:aws:iam::123456789012:role/liquefy", "wrong")).Get()
+	assert.NotNil(t, err)
+}
+
+func TestVerifyPolicyOfRole(t *testing.T) {
+	client := &stubIam{denied: map[string]bool{"ec2:RequestSpotInstances": true}}
+	defer stubClients(&stubSts{expiration: time.Now().Add(time.Hour)}, client)()
+
+	cloud := NewAwsCloud(roleAccount("arn:aws:iam::123456789012:role/liquefy", "lq-ext"))
+	err := cloud.VerifyPolicy()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ec2:RequestSpotInstances")
+	assert.Equal(t, "arn:aws:iam::123456789012:role/liquefy", *client.inputs[0].PolicySourceArn)
+	assert.Equal(t, len(RequiredActions), len(client.inputs[0].ActionNames))
+
+	client.denied = nil
+	assert.Nil(t, cloud.VerifyPolicy())
+}
+
+func TestVerifyPolicyOfAccessKeys(t *testing.T) {
+	client := &stubIam{userArn: "arn:aws:iam::123456789012:user/liquefy"}
+	defer stubClients(nil, client)()
+
+	assert.Nil(t, NewAwsCloudWithKeys(aws.String("key"), aws.String("secret")).VerifyPolicy())
+	assert.Equal(t, "arn:aws:iam::123456789012:user/liquefy", *client.inputs[0].PolicySourceArn)
+}
+
+func TestPolicyDocuments(t *testing.T) {
+	policy := policyDocument{}
+	assert.Nil(t, json.Unmarshal([]byte(PolicyDocument()), &policy))
+	assert.Equal(t, 1, len(policy.Statement))
+	actions := policy.Statement[0].Action.([]interface{})
+	assert.Equal(t, len(RequiredActions), len(actions))
+	for _, action := range RequiredActions {
+		assert.Contains(t, actions, action)
+	}
+
+	trust := TrustPolicyDocument("111122223333", "lq-ext")
+	assert.Contains(t, trust, "arn:aws:iam::111122223333:root")
+	assert.Contains(t, trust, `"sts:ExternalId": "lq-ext"`)
+}
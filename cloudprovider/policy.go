@@ -0,0 +1,131 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	lq "bargain/liquefy/models"
+)
+
+// Every action Liquefy performs in a linked account. The policy built from them is published for users to attach to
+// the role they link, and VerifyPolicy checks each of them is allowed.
+var RequiredActions = []string{
+	// Account setup and clean up
+	"ec2:CreateKeyPair",
+	"ec2:DeleteKeyPair",
+	"ec2:CreateVpc",
+	"ec2:DeleteVpc",
+	"ec2:DescribeVpcs",
+	"ec2:CreateSubnet",
+	"ec2:DeleteSubnet",
+	"ec2:DescribeSubnets",
+	"ec2:CreateInternetGateway",
+	"ec2:AttachInternetGateway",
+	"ec2:DetachInternetGateway",
+	"ec2:DeleteInternetGateway",
+	"ec2:DescribeInternetGateways",
+	"ec2:CreateRoute",
+	"ec2:DescribeRouteTables",
+	"ec2:DeleteRouteTable",
+	"ec2:CreateSecurityGroup",
+	"ec2:DeleteSecurityGroup",
+	"ec2:DescribeSecurityGroups",
+	"ec2:AuthorizeSecurityGroupIngress",
+	"ec2:CreateTags",
+
+	// Instances
+	"ec2:DescribeSpotPriceHistory",
+	"ec2:RequestSpotInstances",
+	"ec2:DescribeSpotInstanceRequests",
+	"ec2:CancelSpotInstanceRequests",
+	"ec2:DescribeInstances",
+	"ec2:TerminateInstances",
+
+	// Verifying this policy
+	"iam:GetUser",
+	"iam:SimulatePrincipalPolicy",
+}
+
+type policyStatement struct {
+	Effect    string                 `json:"Effect"`
+	Action    interface{}            `json:"Action"`
+	Resource  string                 `json:"Resource,omitempty"`
+	Principal map[string]string      `json:"Principal,omitempty"`
+	Condition map[string]interface{} `json:"Condition,omitempty"`
+}
+
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+// The least privilege policy the linked role needs
+func PolicyDocument() string {
+	actions := append([]string{}, RequiredActions...)
+	sort.Strings(actions)
+	return marshalPolicy(policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{
+			{Effect: "Allow", Action: actions, Resource: "*"},
+		},
+	})
+}
+
+// The trust policy that lets the Liquefy aws account assume the linked role, only with the external id Liquefy gave
+// the account
+func TrustPolicyDocument(liquefyAccountID, externalID string) string {
+	return marshalPolicy(policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{
+			{
+				Effect:    "Allow",
+				Action:    "sts:AssumeRole",
+				Principal: map[string]string{"AWS": "arn:aws:iam::" + liquefyAccountID + ":root"},
+				Condition: map[string]interface{}{
+					"StringEquals": map[string]string{"sts:ExternalId": externalID},
+				},
+			},
+		},
+	})
+}
+
+func marshalPolicy(policy policyDocument) string {
+	bytes, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}
+
+// Simulates each required action for the principal, returning those that are not allowed
+func deniedActions(client IamClient, principalArn string) ([]string, error) {
+	denied := []string{}
+	input := &iam.SimulatePrincipalPolicyInput{PolicySourceArn: aws.String(principalArn)}
+	for _, action := range RequiredActions {
+		input.ActionNames = append(input.ActionNames, aws.String(action))
+	}
+	for {
+		output, err := client.SimulatePrincipalPolicy(input)
+		if err != nil {
+			return nil, lq.NewErrorf(err, "Failed simulating the policy of %s", principalArn)
+		}
+		for _, result := range output.EvaluationResults {
+			if aws.StringValue(result.EvalDecision) != "allowed" {
+				denied = append(denied, aws.StringValue(result.EvalActionName))
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return denied, nil
+		}
+		input.Marker = output.Marker
+	}
+}
+
+func deniedActionsError(principalArn string, denied []string) error {
+	return lq.NewErrorf(nil, "%s is not allowed to perform %s, attach the Liquefy policy to it", principalArn,
+		strings.Join(denied, ", "))
+}
@@ -0,0 +1,118 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+// The file listing the regions Liquefy runs instances in, as a json object of each region to its availability zones
+const RegionsFileEnv = "LIQUEFY_AWS_REGIONS_FILE"
+
+// The regions used when RegionsFileEnv is not set
+var DefaultRegions = map[Region][]AZ{
+	"us-east-1": []AZ{"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1e"},
+	"us-west-1": []AZ{"us-west-1a", "us-west-1b"},
+	"us-west-2": []AZ{"us-west-2a", "us-west-2b", "us-west-2c"},
+}
+
+// Loads the regions of the file RegionsFileEnv points to, or the default regions when it is not set
+func LoadRegions() (map[Region][]AZ, error) {
+	path := os.Getenv(RegionsFileEnv)
+	if path == "" {
+		return DefaultRegions, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading the regions of %s", path)
+	}
+	regions, err := ParseRegions(data)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Invalid regions in %s", path)
+	}
+	return regions, nil
+}
+
+// Parses a json object of each region to its availability zones, which are named after their region
+func ParseRegions(data []byte) (map[Region][]AZ, error) {
+	regions := map[Region][]AZ{}
+	if err := json.Unmarshal(data, &regions); err != nil {
+		return nil, err
+	}
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("No regions are configured")
+	}
+	for region, azs := range regions {
+		if len(azs) == 0 {
+			return nil, fmt.Errorf("Region %s has no availability zones", region)
+		}
+		for _, az := range azs {
+			if len(az) != len(region)+1 || az.GetRegion() != region || az[len(az)-1] < 'a' || az[len(az)-1] > 'z' {
+				return nil, fmt.Errorf("%s is not an availability zone of %s", az, region)
+			}
+		}
+	}
+	return regions, nil
+}
+
+func mustLoadRegions() map[Region][]AZ {
+	regions, err := LoadRegions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return regions
+}
+
+type byRegion []Region
+
+func (list byRegion) Len() int           { return len(list) }
+func (list byRegion) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list byRegion) Less(i, j int) bool { return list[i] < list[j] }
+
+type byAZ []AZ
+
+func (list byAZ) Len() int           { return len(list) }
+func (list byAZ) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list byAZ) Less(i, j int) bool { return list[i] < list[j] }
+
+// The configured regions, sorted
+func Regions() []Region {
+	regions := []Region{}
+	for region := range AWSRegionsToAZs {
+		regions = append(regions, region)
+	}
+	sort.Sort(byRegion(regions))
+	return regions
+}
+
+// Every availability zone of the regions, sorted
+func availabilityZones(regions map[Region][]AZ) []AZ {
+	azs := []AZ{}
+	for _, regionAzs := range regions {
+		azs = append(azs, regionAzs...)
+	}
+	sort.Sort(byAZ(azs))
+	return azs
+}
+
+// Whether jobs of the account can be matched to a market, which takes a region with an ssh key, a security group and
+// a subnet set up. Regions configured since the account was set up do not keep it from running jobs.
+func IsAccountSetUp(account *lq.AwsAccount) bool {
+	for region, azs := range AWSRegionsToAZs {
+		if account.GetSshPrivateKey(region.String()) == "" || account.GetSecurityGroupId(region.String()) == "" {
+			continue
+		}
+		for _, az := range azs {
+			if account.GetSubnetId(az.String()) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
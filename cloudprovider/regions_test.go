@@ -0,0 +1,42 @@
+package cloudprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestParseRegions(t *testing.T) {
+	regions, err := ParseRegions([]byte(`{"eu-west-1": ["eu-west-1b", "eu-west-1a"], "us-east-1": ["us-east-1a"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []AZ{"eu-west-1b", "eu-west-1a"}, regions["eu-west-1"])
+	assert.Equal(t, []AZ{"eu-west-1a", "eu-west-1b", "us-east-1a"}, availabilityZones(regions))
+
+	for _, invalid := range []string{
+		`{}`,
+		`{"eu-west-1": []}`,
+		`{"eu-west-1": ["us-east-1a"]}`,
+		`{"eu-west-1": ["eu-west-1"]}`,
+		`{"eu-west-1": ["eu-west-1ab"]}`,
+		`["eu-west-1a"]`,
+	} {
+		_, err := ParseRegions([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestIsAccountSetUp(t *testing.T) {
+	account := &lq.AwsAccount{}
+	account.SetSshPrivateKey("us-west-2", "key")
+	account.SetSecurityGroupId("us-west-2", "sg-1")
+	assert.False(t, IsAccountSetUp(account))
+
+	// Unconfigured regions do not count
+	account.SetSubnetId("eu-west-1a", "subnet-1")
+	assert.False(t, IsAccountSetUp(account))
+
+	account.SetSubnetId("us-west-2b", "subnet-2")
+	assert.True(t, IsAccountSetUp(account))
+}
@@ -22,4 +22,10 @@ func IsStagingDeployment() bool {
 
 func IsLocalDeployment() bool {
     return os.Getenv("ENV") == "LOCAL"
-}
\ No newline at end of file
+}
+
+// Staging and production must be configured with real secrets and services, only other deployments may fall back
+// to development defaults for what is not configured
+func AllowsDevelopmentDefaults() bool {
+    return !IsProductionDeployment() && !IsStagingDeployment()
+}
@@ -39,7 +39,7 @@ func main() {
 			SourceImage: "nbatlivala/test",
 			PortMappings: []lq.PortMapping{
 				{
-					HostPort: 80 + i,
+					HostPort: 0, // any free port, see assigned_ports of the job
 					ContainerPort: 80,
 				},
 			},
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+type ApiKeysTable interface {
+	Create(key *lq.ApiKey) error
+	GetByHash(keyHash string) (*lq.ApiKey, error)
+	GetByUser(userID uint) ([]*lq.ApiKey, error)
+	Revoke(userID, keyID uint) error
+	MarkUsed(keyID uint) error
+}
+
+type apiKeysTable struct{}
+
+func ApiKeys() ApiKeysTable {
+	return &apiKeysTable{}
+}
+
+func (table *apiKeysTable) Create(key *lq.ApiKey) error {
+	query := db.Create(key)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating api key %s for user %d", key.Name, key.UserID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Get a key that has not been revoked by the hash of the key
+func (table *apiKeysTable) GetByHash(keyHash string) (*lq.ApiKey, error) {
+	var key lq.ApiKey
+	query := db.Where("key_hash = ? AND revoked_at = 0", keyHash).First(&key)
+	if query.Error != nil {
+		return &key, lq.NewErrorf(query.Error, "Failed getting api key")
+	}
+	return &key, nil
+}
+
+func (table *apiKeysTable) GetByUser(userID uint) ([]*lq.ApiKey, error) {
+	keys := []*lq.ApiKey{}
+	query := db.Where("user_id = ?", userID).Order("id").Find(&keys)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting api keys of user %d", userID)
+		log.Error(err)
+		return keys, err
+	}
+	return keys, nil
+}
+
+func (table *apiKeysTable) Revoke(userID, keyID uint) error {
+	query := db.Model(&lq.ApiKey{}).Where("id = ? AND user_id = ? AND revoked_at = 0", keyID, userID).
+		UpdateColumn("revoked_at", time.Now().UTC().UnixNano())
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed revoking api key %d of user %d", keyID, userID)
+		log.Error(err)
+		return err
+	}
+	if query.RowsAffected == 0 {
+		return lq.NewErrorf(nil, "User %d has no api key %d to revoke", userID, keyID)
+	}
+	return nil
+}
+
+func (table *apiKeysTable) MarkUsed(keyID uint) error {
+	query := db.Model(&lq.ApiKey{}).Where("id = ?", keyID).UpdateColumn("last_used_at", time.Now().UTC().UnixNano())
+	if query.Error != nil {
+		return lq.NewErrorf(query.Error, "Failed marking api key %d as used", keyID)
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package db
 
 import (
+    "fmt"
+    "time"
+
     lq "bargain/liquefy/models"
 )
 
@@ -22,12 +25,18 @@ func (table *assignmentsTable) AssignJob(jobID uint, resource *lq.ResourceInstan
     defer TxCommitOrRollback(tx, &err, "Failed assigning job %d to resource %v", jobID, resource)
 
     if createResource {
-        if err = Resources().CreateInTx(tx, resource); err != nil {
+        if err = createResourceInTx(tx, resource); err != nil {
             return
         }
     }
 
-    if err = db.Find(&job, jobID).UpdateColumn("instance_id", resource.ID).Error; err != nil {
+    if err = tx.Find(&job, jobID).UpdateColumn("instance_id", resource.ID).Error; err != nil {
+        return
+    }
+
+    job.InstanceID = resource.ID
+    msg := fmt.Sprintf("Assigned to instance %d", resource.ID)
+    if err = tx.Create(newJobTracker(&job, job.Status, msg, time.Now().UTC().UnixNano())).Error; err != nil {
         return
     }
 
@@ -43,6 +52,10 @@ func (table *assignmentsTable) AssignJob(jobID uint, resource *lq.ResourceInstan
         return
     }
 
+    if err = tx.Model(&resource).UpdateColumn("disk_used", resource.DiskUsed + job.Disk).Error; err != nil {
+        return
+    }
+
     return nil
 }
 
@@ -69,6 +82,12 @@ func (table *assignmentsTable) UnassignJob(jobID uint) (err error) {
         return
     }
 
+    job.InstanceID = 0
+    msg := fmt.Sprintf("Unassigned from instance %d", instance.ID)
+    if err = tx.Create(newJobTracker(&job, job.Status, msg, time.Now().UTC().UnixNano())).Error; err != nil {
+        return
+    }
+
     if err = tx.Model(&instance).UpdateColumn("ram_used", instance.RamUsed - job.Ram).Error; err != nil {
         return
     }
@@ -81,5 +100,9 @@ func (table *assignmentsTable) UnassignJob(jobID uint) (err error) {
         return
     }
 
+    if err = tx.Model(&instance).UpdateColumn("disk_used", instance.DiskUsed - job.Disk).Error; err != nil {
+        return
+    }
+
     return
 }
\ No newline at end of file
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+// The audit log is append only, entries are never updated or deleted through it
+type AuditLogTable interface {
+	Append(entry *lq.AuditEntry) error
+	ListVisibleTo(userID, orgID uint, orgAdmin bool, filter AuditFilter, page PageRequest) ([]*lq.AuditEntry, error)
+}
+
+type auditLogTable struct{}
+
+func AuditLog() AuditLogTable {
+	return &auditLogTable{}
+}
+
+func (table *auditLogTable) Append(entry *lq.AuditEntry) error {
+	entry.ID = 0
+	if entry.Time == 0 {
+		entry.Time = time.Now().UTC().UnixNano()
+	}
+	query := db.Create(entry)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed appending audit entry %s", entry.Action)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Users see the entries concerning them, admins of an organization also see the entries of the organization
+func (table *auditLogTable) ListVisibleTo(userID, orgID uint, orgAdmin bool, filter AuditFilter,
+	page PageRequest) ([]*lq.AuditEntry, error) {
+	visible := db.Where("user_id = ?", userID)
+	if orgAdmin && orgID != 0 {
+		visible = db.Where("user_id = ? OR org_id = ?", userID, orgID)
+	}
+
+	entries := []*lq.AuditEntry{}
+	query := page.apply(filter.apply(visible)).Find(&entries)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed listing audit entries of user %d", userID)
+		log.Error(err)
+		return entries, err
+	}
+	return entries, nil
+}
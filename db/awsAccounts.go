@@ -3,12 +3,19 @@ package db
 import (
 	lq "bargain/liquefy/models"
 	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
 )
 
 type AwsAccountTable interface {
 	Create(uint, *lq.AwsAccount) error
+	CreateForOrganization(uint, *lq.AwsAccount) error
 	Update(*lq.AwsAccount) error
 	Get(uint) (*lq.AwsAccount, error)
+	GetForOwner(ownerID, orgID uint) (*lq.AwsAccount, error)
+	GetIDForOwner(ownerID, orgID uint) (uint, error)
+	GetAll() ([]*lq.AwsAccount, error)
+	GetOwner(accountID uint) (ownerID, orgID uint, err error)
+	ReencryptAll() (int, error)
 }
 
 type awsAccountTable struct{}
@@ -24,6 +31,10 @@ func (table *awsAccountTable) Get(id uint) (*lq.AwsAccount, error) {
 		log.Error(query.Error)
 		return &res, query.Error
 	}
+	if err := loadRegions(&db, &res); err != nil {
+		log.Error(err)
+		return &res, err
+	}
 
 	decryptErr := decryptAccountSecrets(&res)
 	if decryptErr != nil {
@@ -34,50 +45,315 @@ func (table *awsAccountTable) Get(id uint) (*lq.AwsAccount, error) {
 	return &res, nil
 }
 
-func encryptAccountSecrets(awsAccount *lq.AwsAccount) {
-	encoder := NewEncoder()
+// Get the account jobs and instances of the owner run on, which is the account of the organization they were created
+// in, or the personal account of the owner when orgID is 0
+func (table *awsAccountTable) GetForOwner(ownerID, orgID uint) (*lq.AwsAccount, error) {
+	accountID, err := table.GetIDForOwner(ownerID, orgID)
+	if err != nil {
+		return &lq.AwsAccount{}, err
+	}
+	return table.Get(accountID)
+}
 
-	encryptedAccessKey := string(
-		encoder.Encode([]byte(*awsAccount.AwsAccessKey)))
-	encryptedSecret := string(
-		encoder.Encode([]byte(*awsAccount.AwsSecretKey)))
-	
-	awsAccount.AwsAccessKey = &encryptedAccessKey
-	awsAccount.AwsSecretKey = &encryptedSecret
+func (table *awsAccountTable) GetIDForOwner(ownerID, orgID uint) (uint, error) {
+	return accountIDForOwner(Organizations(), Users(), ownerID, orgID)
 }
 
-func decryptAccountSecrets(awsAccount *lq.AwsAccount) error {
-	encoder := NewEncoder()
+func accountIDForOwner(orgs OrganizationsTable, users UsersTable, ownerID, orgID uint) (uint, error) {
+	if orgID != 0 {
+		org, err := orgs.Get(orgID)
+		if err != nil {
+			return 0, err
+		}
+		if org.AwsAccountID == 0 {
+			return 0, lq.NewErrorf(nil, "Organization %d has no aws account linked", orgID)
+		}
+		return org.AwsAccountID, nil
+	}
 
-	decoded, err := encoder.Decode([]byte(*awsAccount.AwsSecretKey))
+	user, err := users.Get(ownerID)
 	if err != nil {
-		return lq.NewErrorf(err, "Failed to decode secret for account %d", *awsAccount.ID)
+		return 0, err
+	}
+	if user.AwsAccountID == 0 {
+		return 0, lq.NewErrorf(nil, "User %d has no aws account linked", ownerID)
+	}
+	return user.AwsAccountID, nil
+}
+
+// The organization the account is linked to, or the user when it is a personal account
+func (table *awsAccountTable) GetOwner(accountID uint) (ownerID, orgID uint, err error) {
+	var org lq.Organization
+	query := db.Where("aws_account_id = ?", accountID).First(&org)
+	if query.Error == nil {
+		return 0, org.ID, nil
+	}
+	if !query.RecordNotFound() {
+		return 0, 0, lq.NewErrorf(query.Error, "Failed getting organization of aws account %d", accountID)
+	}
+
+	var user lq.User
+	if err := db.Where("aws_account_id = ?", accountID).First(&user).Error; err != nil {
+		return 0, 0, lq.NewErrorf(err, "Failed getting owner of aws account %d", accountID)
+	}
+	return user.ID, 0, nil
+}
+
+func (table *awsAccountTable) GetAll() ([]*lq.AwsAccount, error) {
+	accounts := []*lq.AwsAccount{}
+	query := db.Find(&accounts)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting all aws accounts")
+		log.Error(err)
+		return accounts, err
+	}
+	if err := loadRegions(&db, accounts...); err != nil {
+		log.Error(err)
+		return accounts, err
+	}
+
+	for _, account := range accounts {
+		if err := decryptAccountSecrets(account); err != nil {
+			log.Error(err)
+			return accounts, err
+		}
+	}
+	return accounts, nil
+}
+
+// Loads the resources the accounts have in each region
+func loadRegions(tx *gorm.DB, accounts ...*lq.AwsAccount) error {
+	if len(accounts) == 0 {
+		return nil
 	}
-	decryptedSecret := string(decoded)
+	accountIDs := []uint32{}
+	byAccount := map[uint32]*lq.AwsAccount{}
+	for _, account := range accounts {
+		account.Regions = nil
+		accountIDs = append(accountIDs, account.GetID())
+		byAccount[account.GetID()] = account
+	}
+
+	regions := []*lq.AwsAccountRegion{}
+	if err := tx.Where("aws_account_id IN (?)", accountIDs).Order("region").Find(&regions).Error; err != nil {
+		return lq.NewErrorf(err, "Failed getting regions of aws accounts %v", accountIDs)
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+	regionIDs := []uint32{}
+	byRegion := map[uint32]*lq.AwsAccountRegion{}
+	for _, region := range regions {
+		regionIDs = append(regionIDs, region.GetID())
+		byRegion[region.GetID()] = region
+		account := byAccount[region.GetAwsAccountID()]
+		account.Regions = append(account.Regions, region)
+	}
+
+	subnets := []*lq.AwsSubnet{}
+	query := tx.Where("aws_account_region_id IN (?)", regionIDs).Order("availability_zone").Find(&subnets)
+	if query.Error != nil {
+		return lq.NewErrorf(query.Error, "Failed getting subnets of aws accounts %v", accountIDs)
+	}
+	for _, subnet := range subnets {
+		region := byRegion[subnet.GetAwsAccountRegionID()]
+		region.Subnets = append(region.Subnets, subnet)
+	}
+	return nil
+}
+
+// Stores the account and its resources in each region, adding the regions and subnets that are new
+func saveAccount(tx *gorm.DB, awsAccount *lq.AwsAccount) error {
+	if err := tx.Save(awsAccount).Error; err != nil {
+		return err
+	}
+	accountID := awsAccount.GetID()
+	for _, region := range awsAccount.Regions {
+		region.AwsAccountID = &accountID
+		if err := tx.Save(region).Error; err != nil {
+			return lq.NewErrorf(err, "Failed saving %s of aws account %d", region.GetRegion(), accountID)
+		}
+		regionID := region.GetID()
+		for _, subnet := range region.Subnets {
+			subnet.AwsAccountRegionID = &regionID
+			if err := tx.Save(subnet).Error; err != nil {
+				return lq.NewErrorf(err, "Failed saving subnet of %s of aws account %d", subnet.GetAvailabilityZone(),
+					accountID)
+			}
+		}
+	}
+	return nil
+}
+
+// The secrets of an account that are stored encrypted. Accounts linked through a role have no access keys.
+func accountSecrets(awsAccount *lq.AwsAccount) []**string {
+	secrets := []**string{
+		&awsAccount.AwsAccessKey,
+		&awsAccount.AwsSecretKey,
+	}
+	return append(secrets, accountSshKeys(awsAccount)...)
+}
+
+// Ssh keys were stored as plaintext before they were encrypted, unlike the access keys
+func accountSshKeys(awsAccount *lq.AwsAccount) []**string {
+	keys := []**string{}
+	for _, region := range awsAccount.Regions {
+		keys = append(keys, &region.SshPrivateKey)
+	}
+	return keys
+}
 
-	decoded, err = encoder.Decode([]byte(*awsAccount.AwsAccessKey))
+func encryptAccountSecrets(awsAccount *lq.AwsAccount) error {
+	encoder, err := NewEncoder()
 	if err != nil {
-		return lq.NewErrorf(err, "Failed to decode access key for account %d", *awsAccount.ID)
+		return err
 	}
-	decryptedAccessKey := string(decoded)
 
-	awsAccount.AwsAccessKey = &decryptedAccessKey
-	awsAccount.AwsSecretKey = &decryptedSecret
+	for _, secret := range accountSecrets(awsAccount) {
+		if *secret == nil || **secret == "" {
+			continue
+		}
+		encrypted, err := encoder.Encode([]byte(**secret))
+		if err != nil {
+			return lq.NewErrorf(err, "Failed to encrypt secret for account %d", awsAccount.GetID())
+		}
+		encryptedSecret := string(encrypted)
+		*secret = &encryptedSecret
+	}
 	return nil
 }
 
-func (table *awsAccountTable) Create(userID uint, awsAccount *lq.AwsAccount) error {
-	encryptAccountSecrets(awsAccount)
-	query := db.Create(awsAccount)
+func decryptAccountSecrets(awsAccount *lq.AwsAccount) error {
+	encoder, err := NewEncoder()
+	if err != nil {
+		return err
+	}
 
-	if query.Error != nil {
+	sshKeys := map[**string]bool{}
+	for _, key := range accountSshKeys(awsAccount) {
+		sshKeys[key] = true
+	}
+
+	for _, secret := range accountSecrets(awsAccount) {
+		if *secret == nil || **secret == "" {
+			continue
+		}
+		decode := encoder.Decode
+		if sshKeys[secret] {
+			decode = encoder.DecodeLegacyPlaintext
+		}
+		decoded, err := decode([]byte(**secret))
+		if err != nil {
+			return lq.NewErrorf(err, "Failed to decode secret for account %d", awsAccount.GetID())
+		}
+		decryptedSecret := string(decoded)
+		*secret = &decryptedSecret
+	}
+	return nil
+}
+
+// Runs store with the secrets of the account encrypted, leaving the account with its plaintext secrets afterwards
+func withEncryptedSecrets(awsAccount *lq.AwsAccount, store func() error) error {
+	plaintext := []*string{}
+	for _, secret := range accountSecrets(awsAccount) {
+		plaintext = append(plaintext, *secret)
+	}
+	defer func() {
+		for i, secret := range accountSecrets(awsAccount) {
+			*secret = plaintext[i]
+		}
+	}()
+
+	if err := encryptAccountSecrets(awsAccount); err != nil {
+		log.Error(err)
+		return err
+	}
+	return store()
+}
+
+// Whether any secret of the account is not encrypted with the active master key
+func needsReencryption(encoder *EnvelopeEncoder, awsAccount *lq.AwsAccount) bool {
+	for _, secret := range accountSecrets(awsAccount) {
+		if *secret != nil && **secret != "" && encoder.NeedsReencryption([]byte(**secret)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Re-encrypts the secrets of every account that are not encrypted with the active master key, returning how many
+// accounts were re-encrypted. Every account is locked and re-encrypted in its own transaction while the accounts stay
+// in use, since values encrypted with either key can be read throughout. Accounts that fail are logged and skipped,
+// so the rotation can be run again until every account is on the active key.
+func (table *awsAccountTable) ReencryptAll() (int, error) {
+	ids := []uint{}
+	if err := db.Model(&lq.AwsAccount{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, lq.NewErrorf(err, "Failed listing aws accounts to re-encrypt")
+	}
+
+	reencrypted := 0
+	var failed error
+	for _, id := range ids {
+		done, err := table.reencrypt(id)
+		if err != nil {
+			log.Error(err)
+			failed = lq.NewErrorf(err, "Failed re-encrypting some aws accounts")
+			continue
+		}
+		if done {
+			log.Infof("Re-encrypted secrets of aws account %d", id)
+			reencrypted++
+		}
+	}
+	return reencrypted, failed
+}
+
+func (table *awsAccountTable) reencrypt(id uint) (done bool, err error) {
+	encoder, err := NewEncoder()
+	if err != nil {
+		return false, err
+	}
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed re-encrypting aws account %d", id)
+
+	var account lq.AwsAccount
+	if err = tx.Raw("SELECT * FROM aws_account WHERE id = ? FOR UPDATE", id).Scan(&account).Error; err != nil {
+		return
+	}
+	if err = loadRegions(tx, &account); err != nil {
+		return
+	}
+	if !needsReencryption(encoder, &account) {
+		return
+	}
+
+	if err = decryptAccountSecrets(&account); err != nil {
+		return
+	}
+	if err = encryptAccountSecrets(&account); err != nil {
+		return
+	}
+	if err = saveAccount(tx, &account); err != nil {
+		return
+	}
+	return true, nil
+}
+
+func (table *awsAccountTable) Create(userID uint, awsAccount *lq.AwsAccount) error {
+	err := withEncryptedSecrets(awsAccount, func() (err error) {
+		tx := db.Begin()
+		defer TxCommitOrRollback(tx, &err, "Failed creating aws account of user %d", userID)
+		return saveAccount(tx, awsAccount)
+	})
+	if err != nil {
 		log.Error("Failed creating aws account")
-		log.Error(query.Error)
-		return query.Error
+		log.Error(err)
+		return err
 	}
 
 	var user lq.User
-	query = db.Find(&user, userID)
+	query := db.Find(&user, userID)
 	if query.Error != nil {
 		log.Error("Failed find user when creating aws account")
 		log.Error(query.Error)
@@ -94,12 +370,29 @@ func (table *awsAccountTable) Create(userID uint, awsAccount *lq.AwsAccount) err
 	return nil
 }
 
+func (table *awsAccountTable) CreateForOrganization(orgID uint, awsAccount *lq.AwsAccount) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed creating aws account for organization %d", orgID)
+
+	err = withEncryptedSecrets(awsAccount, func() error {
+		return saveAccount(tx, awsAccount)
+	})
+	if err != nil {
+		return
+	}
+	err = tx.Model(&lq.Organization{}).Where("id = ?", orgID).UpdateColumn("aws_account_id", awsAccount.ID).Error
+	return
+}
+
 func (table *awsAccountTable) Update(account *lq.AwsAccount) error {
-	encryptAccountSecrets(account)
-	query := db.Save(account)
-	if query.Error != nil {
+	err := withEncryptedSecrets(account, func() (err error) {
+		tx := db.Begin()
+		defer TxCommitOrRollback(tx, &err, "Failed updating aws account %d", account.GetID())
+		return saveAccount(tx, account)
+	})
+	if err != nil {
 		log.Error("Failed updating aws account")
-		log.Error(query.Error)
+		log.Error(err)
 	}
-	return query.Error
+	return err
 }
@@ -0,0 +1,45 @@
+package db
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+type BuildLogsTable interface {
+	Create(jobID uint, attempt int, buildLog string) error
+	GetByJob(jobID uint) ([]*lq.ContainerJobBuildLog, error)
+}
+
+type buildLogsTable struct{}
+
+func BuildLogs() BuildLogsTable {
+	return &buildLogsTable{}
+}
+
+func (table *buildLogsTable) Create(jobID uint, attempt int, buildLog string) error {
+	entry := &lq.ContainerJobBuildLog{
+		ContainerJobID: jobID,
+		Attempt:        attempt,
+		Log:            buildLog,
+	}
+	query := db.Create(entry)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating build log for job %d", jobID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Build logs of a job, one per attempt that built an image, ordered by attempt
+func (table *buildLogsTable) GetByJob(jobID uint) ([]*lq.ContainerJobBuildLog, error) {
+	buildLogs := []*lq.ContainerJobBuildLog{}
+	query := db.Where("container_job_id = ?", jobID).Order("attempt, id").Find(&buildLogs)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting build logs for job %d", jobID)
+		log.Error(err)
+		return buildLogs, err
+	}
+	return buildLogs, nil
+}
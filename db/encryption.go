@@ -7,73 +7,161 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
+
+	lq "bargain/liquefy/models"
 )
 
-//32-bit AES encryption key
-//WARNING: changing this means being unable to decrypt secrets encrypted with another key
-var LQ_CIPHER_KEY = []byte("bydaf8n3h1pf1cmajtfajs39gd3ic2tr")
+// Secrets are stored with envelope encryption: every value is encrypted with its own AES-GCM data key, and the data
+// key is stored alongside the ciphertext wrapped by a master key of the KeyProvider, with the id of that master key:
+//
+//	v2:<master key id>:<wrapped data key>:<nonce and ciphertext>
+//
+// Values encrypted with a master key that is no longer active stay readable as long as the provider still has the
+// key, and are rotated to the active key by AwsAccounts().ReencryptAll.
+const envelopePrefix = "v2:"
+
+// Key secrets were AES-CFB encrypted with before envelope encryption. It is only used to read values that have not
+// been re-encrypted yet.
+var legacyCipherKey = []byte("bydaf8n3h1pf1cmajtfajs39gd3ic2tr")
 
 type lqEncoder interface {
-	Encode(src []byte) []byte
+	Encode(src []byte) ([]byte, error)
 	Decode(src []byte) ([]byte, error)
 }
 
 type Base64Encoder struct{}
 
-func (b *Base64Encoder) Encode(src []byte) []byte {
-	return []byte(base64.StdEncoding.EncodeToString(src))
+func (b *Base64Encoder) Encode(src []byte) ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(src)), nil
 }
 
 func (b *Base64Encoder) Decode(src []byte) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(string(src))
 }
 
-type AESEncoder struct{}
+// EnvelopeEncoder encrypts values with data keys wrapped by the master keys of its provider
+type EnvelopeEncoder struct {
+	provider KeyProvider
+}
 
-// Encode encodes plaintext into AES ciphertext and finally hex encodes the ciphertext to store in DB
-// Mostly ripped from https://golang.org/pkg/crypto/cipher/#example_NewCFBEncrypter
-func (a *AESEncoder) Encode(src []byte) []byte {
-	block, err := aes.NewCipher(LQ_CIPHER_KEY)
+func (e *EnvelopeEncoder) Encode(src []byte) ([]byte, error) {
+	dataKey, wrappedKey, keyID, err := e.provider.GenerateDataKey()
 	if err != nil {
-		panic(err)
+		return nil, lq.NewError("Failed generating data key", err)
 	}
 
-	// The IV needs to be unique, but not secure. Therefore it's common to
-	// include it at the beginning of the ciphertext.
-	ciphertext := make([]byte, aes.BlockSize+len(src))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic(err)
+	sealed, err := sealGCM(dataKey, src)
+	if err != nil {
+		return nil, err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], src)
+	encoded := fmt.Sprintf("%s%s:%s:%s", envelopePrefix, keyID,
+		base64.RawStdEncoding.EncodeToString(wrappedKey), base64.RawStdEncoding.EncodeToString(sealed))
+	return []byte(encoded), nil
+}
+
+func (e *EnvelopeEncoder) Decode(src []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(src), envelopePrefix) {
+		return decodeLegacy(src)
+	}
 
-	// It's important to remember that ciphertexts must be authenticated
-	// (i.e. by using crypto/hmac) as well as being encrypted in order to
-	// be secure.
+	parts := strings.Split(strings.TrimPrefix(string(src), envelopePrefix), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed encrypted value")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, lq.NewError("Malformed data key", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, lq.NewError("Malformed ciphertext", err)
+	}
 
-	// Hex encode ciphertext so we can store in the DB
-	dst := make([]byte, hex.EncodedLen(len(ciphertext)))
-	hex.Encode(dst, ciphertext)
-	return dst
+	dataKey, err := e.provider.DecryptDataKey(parts[0], wrappedKey)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed decrypting data key of master key %s", parts[0])
+	}
+	return openGCM(dataKey, sealed)
+}
+
+// Decodes a value that was stored as plaintext before it was encrypted, ex: ssh keys. Values that are neither
+// envelope encrypted nor hex encoded legacy ciphertext are such plaintext, and are returned as is until they are
+// re-encrypted.
+func (e *EnvelopeEncoder) DecodeLegacyPlaintext(src []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(src), envelopePrefix) && !isHex(src) {
+		return src, nil
+	}
+	return e.Decode(src)
+}
+
+func isHex(src []byte) bool {
+	_, err := hex.DecodeString(string(src))
+	return err == nil
 }
 
-// Decode decodes a hex-encoded bytestring to AES ciphertext and then to plaintext
-// Mostly ripped from https://golang.org/pkg/crypto/cipher/#example_NewCFBDecrypter
-func (a *AESEncoder) Decode(src []byte) ([]byte, error) {
-	// First things first decode hex text to ciphertext
+// Whether a value was encrypted with another key than the active master key, including values that are not
+// envelope encrypted at all
+func (e *EnvelopeEncoder) NeedsReencryption(src []byte) bool {
+	return !strings.HasPrefix(string(src), envelopePrefix+e.provider.ActiveKeyID()+":")
+}
+
+// Encrypts and authenticates plaintext, prefixing it with the random nonce
+func sealGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, lq.NewError("Invalid encryption key", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, lq.NewError("Failed creating GCM cipher", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, lq.NewError("Failed generating nonce", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openGCM(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, lq.NewError("Invalid encryption key", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, lq.NewError("Failed creating GCM cipher", err)
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, lq.NewError("Ciphertext failed authentication", err)
+	}
+	return plaintext, nil
+}
+
+// Decodes hex encoded AES-CFB ciphertext written before envelope encryption. It is not authenticated, so anything
+// hex decodable decrypts to something, only values that fail to decode are rejected.
+func decodeLegacy(src []byte) ([]byte, error) {
 	ciphertext := make([]byte, hex.DecodedLen(len(src)))
-	hex.Decode(ciphertext, src)
+	if _, err := hex.Decode(ciphertext, src); err != nil {
+		return nil, lq.NewError("Malformed legacy ciphertext", err)
+	}
 
-	block, err := aes.NewCipher(LQ_CIPHER_KEY)
+	block, err := aes.NewCipher(legacyCipherKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// The IV needs to be unique, but not secure. Therefore it's common to
-	// include it at the beginning of the ciphertext.
+	// The IV is stored at the beginning of the ciphertext
 	if len(ciphertext) < aes.BlockSize {
 		return nil, errors.New("ciphertext too short")
 	}
@@ -81,14 +169,38 @@ func (a *AESEncoder) Decode(src []byte) ([]byte, error) {
 	ciphertext = ciphertext[aes.BlockSize:]
 
 	stream := cipher.NewCFBDecrypter(block, iv)
-
-	// XORKeyStream can work in-place if the two arguments are the same.
 	stream.XORKeyStream(ciphertext, ciphertext)
 	return ciphertext, nil
 }
 
-func NewEncoder() lqEncoder {
-	// The Base64Encoder is far more naive and won't be as secure
-	// so default to AES
-	return &AESEncoder{}
+var keyProvider KeyProvider
+var keyProviderMutex sync.Mutex
+
+// Sets the provider of the master keys secrets are encrypted with, ex: for tests
+func SetKeyProvider(provider KeyProvider) {
+	keyProviderMutex.Lock()
+	defer keyProviderMutex.Unlock()
+	keyProvider = provider
+}
+
+// The key provider configured by the environment, loaded the first time secrets are encrypted or decrypted
+func getKeyProvider() (KeyProvider, error) {
+	keyProviderMutex.Lock()
+	defer keyProviderMutex.Unlock()
+	if keyProvider == nil {
+		provider, err := KeyProviderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		keyProvider = provider
+	}
+	return keyProvider, nil
+}
+
+func NewEncoder() (*EnvelopeEncoder, error) {
+	provider, err := getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+	return &EnvelopeEncoder{provider: provider}, nil
 }
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	lq "bargain/liquefy/models"
+)
+
+// PageRequest selects up to Limit rows in descending id order, starting after the row with id BeforeID
+type PageRequest struct {
+	BeforeID uint
+	Limit    int
+}
+
+func (page PageRequest) apply(query *gorm.DB) *gorm.DB {
+	if page.BeforeID != 0 {
+		query = query.Where("id < ?", page.BeforeID)
+	}
+	query = query.Order("id desc")
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit)
+	}
+	return query
+}
+
+// Whether the page includes the row with the id, the rows must then be sorted and cut with limit
+func (page PageRequest) Includes(id uint) bool {
+	return page.BeforeID == 0 || id < page.BeforeID
+}
+
+// Cuts a page of count rows sorted by descending id
+func (page PageRequest) limit(count int) int {
+	if page.Limit > 0 && count > page.Limit {
+		return page.Limit
+	}
+	return count
+}
+
+// Selects the rows owned by the user or belonging to their organization
+func visibleTo(userID, orgID uint) *gorm.DB {
+	if orgID == 0 {
+		return db.Where("owner_id = ?", userID)
+	}
+	return db.Where("owner_id = ? OR org_id = ?", userID, orgID)
+}
+
+func isVisibleTo(userID, orgID, ownerID, rowOrgID uint) bool {
+	return ownerID == userID || (orgID != 0 && rowOrgID == orgID)
+}
+
+// JobFilter narrows down listed jobs, zero values match every job. Times are unix nanoseconds.
+type JobFilter struct {
+	Status        string
+	Name          string // matches any job whose name contains it
+	InstanceID    uint
+	StartedAfter  int64
+	StartedBefore int64
+}
+
+func (filter JobFilter) apply(query *gorm.DB) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Name != "" {
+		query = query.Where("name LIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.InstanceID != 0 {
+		query = query.Where("instance_id = ?", filter.InstanceID)
+	}
+	if filter.StartedAfter != 0 {
+		query = query.Where("start_time >= ?", filter.StartedAfter)
+	}
+	if filter.StartedBefore != 0 {
+		query = query.Where("start_time < ?", filter.StartedBefore)
+	}
+	return query
+}
+
+// Matches tells whether the filter selects the job, as apply does for stored jobs
+func (filter JobFilter) Matches(job *lq.ContainerJob) bool {
+	return (filter.Status == "" || job.Status == filter.Status) &&
+		(filter.Name == "" || strings.Contains(job.Name, filter.Name)) &&
+		(filter.InstanceID == 0 || job.InstanceID == filter.InstanceID) &&
+		(filter.StartedAfter == 0 || job.StartTime >= filter.StartedAfter) &&
+		(filter.StartedBefore == 0 || job.StartTime < filter.StartedBefore)
+}
+
+// InstanceFilter narrows down listed instances, zero values match every instance. Times are unix nanoseconds.
+type InstanceFilter struct {
+	Status         string
+	LaunchedAfter  int64
+	LaunchedBefore int64
+}
+
+func (filter InstanceFilter) apply(query *gorm.DB) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.LaunchedAfter != 0 {
+		query = query.Where("launch_time >= ?", filter.LaunchedAfter)
+	}
+	if filter.LaunchedBefore != 0 {
+		query = query.Where("launch_time < ?", filter.LaunchedBefore)
+	}
+	return query
+}
+
+// Matches tells whether the filter selects the instance, as apply does for stored instances
+func (filter InstanceFilter) Matches(resource *lq.ResourceInstance) bool {
+	return (filter.Status == "" || resource.Status == filter.Status) &&
+		(filter.LaunchedAfter == 0 || resource.LaunchTime >= filter.LaunchedAfter) &&
+		(filter.LaunchedBefore == 0 || resource.LaunchTime < filter.LaunchedBefore)
+}
+
+// AuditFilter narrows down listed audit entries, zero values match every entry. Times are unix nanoseconds.
+type AuditFilter struct {
+	Action     string
+	ActorID    uint
+	TargetType string
+	TargetID   string
+	Outcome    string
+	RequestID  string
+	After      int64
+	Before     int64
+}
+
+func (filter AuditFilter) apply(query *gorm.DB) *gorm.DB {
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.After != 0 {
+		query = query.Where("time >= ?", filter.After)
+	}
+	if filter.Before != 0 {
+		query = query.Where("time < ?", filter.Before)
+	}
+	return query
+}
+
+func (filter AuditFilter) matches(entry *lq.AuditEntry) bool {
+	return (filter.Action == "" || entry.Action == filter.Action) &&
+		(filter.ActorID == 0 || entry.ActorID == filter.ActorID) &&
+		(filter.TargetType == "" || entry.TargetType == filter.TargetType) &&
+		(filter.TargetID == "" || entry.TargetID == filter.TargetID) &&
+		(filter.Outcome == "" || entry.Outcome == filter.Outcome) &&
+		(filter.RequestID == "" || entry.RequestID == filter.RequestID) &&
+		(filter.After == 0 || entry.Time >= filter.After) &&
+		(filter.Before == 0 || entry.Time < filter.Before)
+}
+
+// Escapes the wildcards of LIKE patterns so user input only matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
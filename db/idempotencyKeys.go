@@ -0,0 +1,54 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+
+	lq "bargain/liquefy/models"
+)
+
+type IdempotencyKeysTable interface {
+	Get(userID uint, key string) (*lq.IdempotencyKey, error)
+}
+
+type idempotencyKeysTable struct{}
+
+func IdempotencyKeys() IdempotencyKeysTable {
+	return &idempotencyKeysTable{}
+}
+
+// Get the key the user submitted jobs with, nil if they did not or it expired
+func (table *idempotencyKeysTable) Get(userID uint, key string) (*lq.IdempotencyKey, error) {
+	var idempotencyKey lq.IdempotencyKey
+	query := db.Where("user_id = ? AND key = ?", userID, key).First(&idempotencyKey)
+	if query.RecordNotFound() {
+		return nil, nil
+	}
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting idempotency key of user %d", userID)
+		log.Error(err)
+		return nil, err
+	}
+	if idempotencyKey.IsExpired(time.Now()) {
+		return nil, nil
+	}
+	return &idempotencyKey, nil
+}
+
+// Stores the key with the jobs created for it. An expired key of the user is replaced, a live one makes the
+// unique index fail the transaction.
+func createIdempotencyKeyInTx(tx *gorm.DB, key *lq.IdempotencyKey, jobIDs []uint) error {
+	if err := key.SetJobIDs(jobIDs); err != nil {
+		return err
+	}
+	expired := time.Now().Add(-lq.IdempotencyKeyTTL)
+	query := tx.Where("user_id = ? AND key = ? AND created_at < ?", key.UserID, key.Key, expired).
+		Delete(&lq.IdempotencyKey{})
+	if query.Error != nil {
+		return query.Error
+	}
+	key.ID = 0
+	return tx.Create(key).Error
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 
 	lq "bargain/liquefy/models"
@@ -13,19 +14,25 @@ const MAX_RETRIES = 3
 
 type ContainerJobsTable interface {
 	Create(job *lq.ContainerJob) error
+	CreateMany(jobs []*lq.ContainerJob, key *lq.IdempotencyKey) error
 
 	Get(jobID uint) (*lq.ContainerJob, error)
 	GetActiveJobsOnResource(resourceID uint) ([]*lq.ContainerJob, error)
 	GetAssignedJobsByInstances(instanceIDs []uint) ([]*lq.ContainerJob, error)
 	GetUnassignedJobsByUser(userID uint) ([]*lq.ContainerJob, error)
 	GetAllJobsByUser(userID uint) ([]*lq.ContainerJob, error)
+	ListVisibleTo(userID, orgID uint, filter JobFilter, page PageRequest) ([]*lq.ContainerJob, error)
 	GetNonTerminatedUserTerminatedJobs() ([]*lq.ContainerJob, error)
+	GetEvents(jobID uint) ([]*lq.ContainerJobTracker, error)
 
 	GetAllNonCompletedJobs() ([]*lq.ContainerJob, error)
 
 	SetStatus(jobId uint, status string, statusMsg string) (err error)
 	SetTotalCost(jobID uint, cost float64) error
+	GetCostSince(ownerID uint, since int64) (float64, error)
 	SetContainerId(jobID uint, containerId string) error
+	SetHealth(jobID uint, healthy bool, restarts int, statusMsg string) error
+	SetAssignedPorts(jobID uint, assignedPorts string) error
 
 	MarkUserTerminated(jobId uint) error
 	Delete(jobID uint) error
@@ -41,22 +48,37 @@ func (table *containerJobsTable) Create(job *lq.ContainerJob) (err error) {
 	tx := db.Begin()
 	defer TxCommitOrRollback(tx, &err, "Failed creating job: %v", job)
 
-	job.Status = mesos.TaskState_TASK_STAGING.String()
-	if err = tx.Create(job).Error; err != nil {
-		return
+	err = createJobInTx(tx, job)
+	return
+}
+
+// Creates every job or none of them. When submitted with an idempotency key, the key is stored with the ids of the
+// jobs, and creating them fails if the user already submitted jobs with the key.
+func (table *containerJobsTable) CreateMany(jobs []*lq.ContainerJob, key *lq.IdempotencyKey) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed creating %d jobs", len(jobs))
+
+	ids := make([]uint, len(jobs))
+	for i, job := range jobs {
+		if err = createJobInTx(tx, job); err != nil {
+			return
+		}
+		ids[i] = job.ID
 	}
 
-	jobEvent := &lq.ContainerJobTracker{
-		ContainerJobID: job.ID,
-		Time:           time.Now().UTC().UnixNano(),
-		InstanceID:     0,
-		Status:         mesos.TaskState_TASK_STAGING.String(),
-		Attempt:        job.RetryCount,
+	if key != nil {
+		err = createIdempotencyKeyInTx(tx, key, ids)
 	}
-	if err = tx.Create(&jobEvent).Error; err != nil {
+	return
+}
+
+func createJobInTx(tx *gorm.DB, job *lq.ContainerJob) (err error) {
+	job.Status = mesos.TaskState_TASK_STAGING.String()
+	if err = tx.Create(job).Error; err != nil {
 		return
 	}
 
+	err = tx.Create(newJobTracker(job, job.Status, "", time.Now().UTC().UnixNano())).Error
 	return
 }
 
@@ -106,7 +128,7 @@ func (table *containerJobsTable) GetUnassignedJobsByUser(userID uint) ([]*lq.Con
 	query := db.Where("status = ? AND instance_id = 0 AND owner_id = ? AND user_terminated = false",
 		mesos.TaskState_TASK_STAGING.String(), userID).Find(&jobs)
 	if query.Error != nil {
-		err := lq.NewErrorf(query.Error, "Failed getting unassigned jobs by user %s", userID)
+		err := lq.NewErrorf(query.Error, "Failed getting unassigned jobs by user %d", userID)
 		log.Error(err)
 		return jobs, err
 	}
@@ -117,7 +139,20 @@ func (table *containerJobsTable) GetAllJobsByUser(userID uint) ([]*lq.ContainerJ
 	jobs := []*lq.ContainerJob{}
 	query := db.Where("owner_id = ?", userID).Find(&jobs)
 	if query.Error != nil {
-		err := lq.NewErrorf(query.Error, "Failed get all jobs by user %s", userID)
+		err := lq.NewErrorf(query.Error, "Failed get all jobs by user %d", userID)
+		log.Error(err)
+		return jobs, err
+	}
+	return jobs, nil
+}
+
+// Lists the jobs of the user and, when orgID is not 0, every job submitted in the organization
+func (table *containerJobsTable) ListVisibleTo(userID, orgID uint, filter JobFilter,
+	page PageRequest) ([]*lq.ContainerJob, error) {
+	jobs := []*lq.ContainerJob{}
+	query := page.apply(filter.apply(visibleTo(userID, orgID))).Find(&jobs)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed listing jobs of user %d", userID)
 		log.Error(err)
 		return jobs, err
 	}
@@ -137,17 +172,39 @@ func (table *containerJobsTable) GetNonTerminatedUserTerminatedJobs() ([]*lq.Con
 	return jobs, nil
 }
 
+// The status history of a job, oldest first
+func (table *containerJobsTable) GetEvents(jobID uint) ([]*lq.ContainerJobTracker, error) {
+	trackers := []*lq.ContainerJobTracker{}
+	query := db.Where("container_job_id = ?", jobID).Order("time, id").Find(&trackers)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting events of job %d", jobID)
+		log.Error(err)
+		return trackers, err
+	}
+	return trackers, nil
+}
+
 func (table *containerJobsTable) SetTotalCost(jobID uint, cost float64) error {
-	sql := fmt.Sprintf("UPDATE container_job SET total_cost = %f WHERE id = %d", cost, jobID)
-	query := db.Exec(sql)
+	query := db.Model(&lq.ContainerJob{}).Where("id = ?", jobID).UpdateColumn("total_cost", cost)
 	if query.Error != nil {
-		err := lq.NewErrorf(query.Error, "Unable to set total cost %f for job %s", cost, jobID)
+		err := lq.NewErrorf(query.Error, "Unable to set total cost %f for job %d", cost, jobID)
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
+// The total cost of the jobs of the owner that ended since the unix nano time
+func (table *containerJobsTable) GetCostSince(ownerID uint, since int64) (float64, error) {
+	var cost float64
+	row := db.Model(&lq.ContainerJob{}).Where("owner_id = ? AND end_time >= ?", ownerID, since).
+		Select("COALESCE(SUM(total_cost), 0)").Row()
+	if err := row.Scan(&cost); err != nil {
+		return 0, lq.NewErrorf(err, "Failed getting costs of user %d", ownerID)
+	}
+	return cost, nil
+}
+
 // Get all jobs that are  not  (failed, finished, or killed)
 func (table *containerJobsTable) GetAllNonCompletedJobs() ([]*lq.ContainerJob, error) {
 	jobs := []*lq.ContainerJob{}
@@ -162,8 +219,7 @@ func (table *containerJobsTable) GetAllNonCompletedJobs() ([]*lq.ContainerJob, e
 }
 
 func (table *containerJobsTable) SetContainerId(jobID uint, containerId string) error {
-	sql := fmt.Sprintf("UPDATE container_job SET container_id = '%s' WHERE id = %d", containerId, jobID)
-	query := db.Exec(sql)
+	query := db.Model(&lq.ContainerJob{}).Where("id = ?", jobID).UpdateColumn("container_id", containerId)
 	if query.Error != nil {
 		err := lq.NewErrorf(query.Error, "Failed updating job %d with containerId %s", jobID, containerId)
 		log.Error(err)
@@ -172,9 +228,40 @@ func (table *containerJobsTable) SetContainerId(jobID uint, containerId string)
 	return nil
 }
 
+func (table *containerJobsTable) SetAssignedPorts(jobID uint, assignedPorts string) error {
+	query := db.Model(&lq.ContainerJob{}).Where("id = ?", jobID).UpdateColumn("assigned_ports", assignedPorts)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed updating job %d with assigned ports %s", jobID, assignedPorts)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Records the readiness and restart count reported for a running service job
+func (table *containerJobsTable) SetHealth(jobID uint, healthy bool, restarts int, statusMsg string) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed setting health of job %d", jobID)
+
+	var job lq.ContainerJob
+	if err = tx.Find(&job, jobID).Error; err != nil {
+		return
+	}
+
+	err = tx.Model(&job).UpdateColumns(map[string]interface{}{
+		"healthy":  healthy,
+		"restarts": restarts,
+	}).Error
+	if err != nil {
+		return
+	}
+
+	err = tx.Create(newJobTracker(&job, job.Status, statusMsg, time.Now().UTC().UnixNano())).Error
+	return
+}
+
 func (table *containerJobsTable) MarkUserTerminated(jobId uint) error {
-	sql := fmt.Sprintf("UPDATE container_job SET user_terminated = true WHERE id = %d", jobId)
-	query := db.Exec(sql)
+	query := db.Model(&lq.ContainerJob{}).Where("id = ?", jobId).UpdateColumn("user_terminated", true)
 	if query.Error != nil {
 		err := lq.NewErrorf(query.Error, "Failed updating job %d as user terminated", jobId)
 		return err
@@ -187,48 +274,48 @@ func (table *containerJobsTable) SetStatus(jobId uint, status string, statusMsg
 	tx := db.Begin()
 	defer TxCommitOrRollback(tx, &err, "Failed setting job %d status to %s", jobId, status)
 
-	now := time.Now().UTC().UnixNano()
 	var job lq.ContainerJob
 	if err = tx.Find(&job, jobId).Error; err != nil {
 		return
 	}
 
-	if err = validateStateTransition(job.Status, status); err != nil {
+	trackers, err := applyJobStatus(&job, status, statusMsg, time.Now().UTC().UnixNano())
+	if err != nil {
 		return
 	}
-
-	// Create job status event
-	jobEvent := &lq.ContainerJobTracker{
-		ContainerJobID: jobId,
-		Time:           now,
-		InstanceID:     job.InstanceID,
-		Status:         status,
-		Attempt:        job.RetryCount,
-		Msg:            statusMsg,
+	for _, tracker := range trackers {
+		if err = tx.Create(tracker).Error; err != nil {
+			return
+		}
 	}
-	if err = tx.Create(&jobEvent).Error; err != nil {
-		return
+
+	err = tx.Model(&job).UpdateColumns(map[string]interface{}{
+		"status":      job.Status,
+		"start_time":  job.StartTime,
+		"end_time":    job.EndTime,
+		"retry_count": job.RetryCount,
+	}).Error
+	return
+}
+
+// Applies a status change to the job, returning the events tracking it. Jobs that errored or were lost are set back
+// to staging to be retried, until they did so MAX_RETRIES times.
+func applyJobStatus(job *lq.ContainerJob, status, statusMsg string, now int64) ([]*lq.ContainerJobTracker, error) {
+	if err := validateStateTransition(job.Status, status); err != nil {
+		return nil, err
 	}
+	trackers := []*lq.ContainerJobTracker{newJobTracker(job, status, statusMsg, now)}
 
 	// Update start time if necessary
 	if lq.ContainerJobStatusLaunched == status {
-		sql := fmt.Sprintf("UPDATE container_job SET start_time = %d WHERE id = %d", now, jobId)
-		if err = tx.Exec(sql).Error; err != nil {
-			return
-		}
+		job.StartTime = now
 	}
 
 	// Update the retry count if the status is failed or lost and reset the status to staging
 	if mesos.TaskState_TASK_ERROR.String() == status || mesos.TaskState_TASK_LOST.String() == status {
 		if job.RetryCount < MAX_RETRIES {
-			// increment the retry count
-			job.RetryCount += 1
-			sql := fmt.Sprintf("UPDATE container_job SET retry_count = %d WHERE id = %d", job.RetryCount, jobId)
-			if err = tx.Exec(sql).Error; err != nil {
-				return
-			}
-
 			// retry job by setting status to staging
+			job.RetryCount += 1
 			status = mesos.TaskState_TASK_STAGING.String()
 			statusMsg = "Retrying"
 		} else {
@@ -236,38 +323,29 @@ func (table *containerJobsTable) SetStatus(jobId uint, status string, statusMsg
 			status = mesos.TaskState_TASK_FAILED.String()
 			statusMsg = "Failed, no more retries"
 		}
-
-		// persist the new status change event
-		jobEvent := &lq.ContainerJobTracker{
-			ContainerJobID: jobId,
-			Time:           time.Now().UTC().UnixNano(),
-			InstanceID:     job.InstanceID,
-			Status:         status,
-			Attempt:        job.RetryCount,
-			Msg:            statusMsg,
-		}
-		if err = tx.Create(&jobEvent).Error; err != nil {
-			return
-		}
+		trackers = append(trackers, newJobTracker(job, status, statusMsg, now))
 	}
 
 	// Update end time if necessary
 	if status == mesos.TaskState_TASK_KILLED.String() ||
 		status == mesos.TaskState_TASK_FAILED.String() ||
 		status == mesos.TaskState_TASK_FINISHED.String() {
-		sql := fmt.Sprintf("UPDATE container_job SET end_time = %d WHERE id = %d", now, jobId)
-		if err = tx.Exec(sql).Error; err != nil {
-			return
-		}
+		job.EndTime = now
 	}
 
-	// Persist the status in the job
-	sql := fmt.Sprintf("UPDATE container_job SET status = '%s' WHERE id = %d", status, jobId)
-	if err = tx.Exec(sql).Error; err != nil {
-		return
-	}
+	job.Status = status
+	return trackers, nil
+}
 
-	return
+func newJobTracker(job *lq.ContainerJob, status, statusMsg string, now int64) *lq.ContainerJobTracker {
+	return &lq.ContainerJobTracker{
+		ContainerJobID: job.ID,
+		Time:           now,
+		InstanceID:     job.InstanceID,
+		Status:         status,
+		Attempt:        job.RetryCount,
+		Msg:            statusMsg,
+	}
 }
 
 func (table *containerJobsTable) Delete(jobID uint) error {
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"bargain/liquefy/common"
+	lq "bargain/liquefy/models"
+)
+
+// KeyProvider holds the master keys data keys are wrapped with. It follows the interface of a KMS so that master keys
+// can be kept outside of Liquefy, the LocalKeyProvider keeps them in memory.
+type KeyProvider interface {
+	// The id of the master key new data keys are wrapped with
+	ActiveKeyID() string
+	// A new data key, in plaintext and wrapped by the active master key
+	GenerateDataKey() (dataKey []byte, wrappedKey []byte, keyID string, err error)
+	// Unwraps a data key wrapped by the master key keyID
+	DecryptDataKey(keyID string, wrappedKey []byte) ([]byte, error)
+}
+
+const dataKeySize = 32
+
+// Key ids are stored with every encrypted value, so they are kept short
+const maxKeyIDLength = 32
+
+// LocalKeyProvider wraps data keys with AES-GCM master keys it holds in memory
+type LocalKeyProvider struct {
+	activeKeyID string
+	keys        map[string][]byte
+}
+
+func NewLocalKeyProvider(activeKeyID string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	for keyID, key := range keys {
+		if keyID == "" || len(keyID) > maxKeyIDLength || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("Invalid master key id %s", keyID)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("Master key %s must be 32 bytes", keyID)
+		}
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("Active master key %s is not one of the master keys", activeKeyID)
+	}
+	return &LocalKeyProvider{activeKeyID: activeKeyID, keys: keys}, nil
+}
+
+func (provider *LocalKeyProvider) ActiveKeyID() string {
+	return provider.activeKeyID
+}
+
+func (provider *LocalKeyProvider) GenerateDataKey() ([]byte, []byte, string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, "", lq.NewError("Failed generating data key", err)
+	}
+	wrappedKey, err := sealGCM(provider.keys[provider.activeKeyID], dataKey)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return dataKey, wrappedKey, provider.activeKeyID, nil
+}
+
+func (provider *LocalKeyProvider) DecryptDataKey(keyID string, wrappedKey []byte) ([]byte, error) {
+	key, ok := provider.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown master key %s", keyID)
+	}
+	return openGCM(key, wrappedKey)
+}
+
+// Loads the key provider from the environment:
+//
+//	LQ_KEY_PROVIDER     env to read the master keys from LQ_MASTER_KEYS, file to read them from LQ_MASTER_KEY_FILE
+//	LQ_MASTER_KEYS      comma separated id:key pairs, keys being 32 base64 encoded bytes
+//	LQ_MASTER_KEY_FILE  file with an id:key pair per line
+//	LQ_MASTER_KEY_ID    the id of the key new secrets are encrypted with, defaults to the first key
+//
+// The development key is the cipher key secrets were encrypted with before master keys, which is in the source, so
+// secrets of staging and production accounts are never encrypted with it.
+func KeyProviderFromEnv() (KeyProvider, error) {
+	switch os.Getenv("LQ_KEY_PROVIDER") {
+	case "", "env":
+	case "file":
+		return NewFileKeyProvider(os.Getenv("LQ_MASTER_KEY_FILE"), os.Getenv("LQ_MASTER_KEY_ID"))
+	default:
+		return nil, fmt.Errorf("Unknown LQ_KEY_PROVIDER %s", os.Getenv("LQ_KEY_PROVIDER"))
+	}
+
+	firstKeyID, keys, err := parseMasterKeys(strings.Split(os.Getenv("LQ_MASTER_KEYS"), ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if !common.AllowsDevelopmentDefaults() {
+			return nil, errors.New("LQ_MASTER_KEYS is required in staging and production")
+		}
+		firstKeyID = "dev"
+		keys["dev"] = legacyCipherKey
+	}
+	return NewLocalKeyProvider(activeOrFirst(os.Getenv("LQ_MASTER_KEY_ID"), firstKeyID), keys)
+}
+
+// A LocalKeyProvider of the master keys in a file, with an id:key pair per line. Lines starting with # are ignored.
+// The active key defaults to the first one when activeKeyID is empty.
+func NewFileKeyProvider(path string, activeKeyID string) (*LocalKeyProvider, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading master keys from %s", path)
+	}
+	firstKeyID, keys, err := parseMasterKeys(strings.Split(string(contents), "\n"))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s has no master keys", path)
+	}
+	return NewLocalKeyProvider(activeOrFirst(activeKeyID, firstKeyID), keys)
+}
+
+func activeOrFirst(activeKeyID, firstKeyID string) string {
+	if activeKeyID != "" {
+		return activeKeyID
+	}
+	return firstKeyID
+}
+
+// Parses id:key pairs, returning the first id with the keys
+func parseMasterKeys(pairs []string) (string, map[string][]byte, error) {
+	firstKeyID := ""
+	keys := make(map[string][]byte)
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" || strings.HasPrefix(pair, "#") {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", nil, errors.New("Master keys must be id:key pairs")
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", nil, lq.NewErrorf(err, "Master key %s is not base64 encoded", parts[0])
+		}
+		keys[parts[0]] = key
+		if firstKeyID == "" {
+			firstKeyID = parts[0]
+		}
+	}
+	return firstKeyID, keys, nil
+}
@@ -0,0 +1,453 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	lq "bargain/liquefy/models"
+)
+
+type memoryAwsAccountTable struct {
+	store *MemoryStore
+}
+
+// Must be called with the mutex held
+func (table *memoryAwsAccountTable) create(awsAccount *lq.AwsAccount) {
+	id := uint32(table.store.newID())
+	awsAccount.ID = &id
+	table.save(awsAccount)
+}
+
+// Stores a copy of the account, giving ids to its new regions and subnets. Must be called with the mutex held.
+func (table *memoryAwsAccountTable) save(awsAccount *lq.AwsAccount) {
+	accountID := awsAccount.GetID()
+	for _, region := range awsAccount.Regions {
+		if region.ID == nil {
+			id := uint32(table.store.newID())
+			region.ID = &id
+		}
+		region.AwsAccountID = &accountID
+		regionID := region.GetID()
+		for _, subnet := range region.Subnets {
+			if subnet.ID == nil {
+				id := uint32(table.store.newID())
+				subnet.ID = &id
+			}
+			subnet.AwsAccountRegionID = &regionID
+		}
+	}
+	table.store.awsAccounts[uint(accountID)] = proto.Clone(awsAccount).(*lq.AwsAccount)
+}
+
+func (table *memoryAwsAccountTable) Create(userID uint, awsAccount *lq.AwsAccount) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	user, ok := table.store.users[userID]
+	if !ok {
+		return notFound("Failed creating aws account of user %d", userID)
+	}
+	table.create(awsAccount)
+	user.AwsAccountID = uint(awsAccount.GetID())
+	return nil
+}
+
+func (table *memoryAwsAccountTable) CreateForOrganization(orgID uint, awsAccount *lq.AwsAccount) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	table.create(awsAccount)
+	if org, ok := table.store.organizations[orgID]; ok {
+		org.AwsAccountID = uint(awsAccount.GetID())
+	}
+	return nil
+}
+
+func (table *memoryAwsAccountTable) Update(account *lq.AwsAccount) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if account.ID == nil {
+		table.create(account)
+		return nil
+	}
+	table.save(account)
+	return nil
+}
+
+func (table *memoryAwsAccountTable) Get(id uint) (*lq.AwsAccount, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	account, ok := table.store.awsAccounts[id]
+	if !ok {
+		return &lq.AwsAccount{}, notFound("Failed getting aws account %d", id)
+	}
+	return proto.Clone(account).(*lq.AwsAccount), nil
+}
+
+func (table *memoryAwsAccountTable) GetForOwner(ownerID, orgID uint) (*lq.AwsAccount, error) {
+	accountID, err := table.GetIDForOwner(ownerID, orgID)
+	if err != nil {
+		return &lq.AwsAccount{}, err
+	}
+	return table.Get(accountID)
+}
+
+func (table *memoryAwsAccountTable) GetIDForOwner(ownerID, orgID uint) (uint, error) {
+	return accountIDForOwner(table.store.Organizations(), table.store.Users(), ownerID, orgID)
+}
+
+func (table *memoryAwsAccountTable) GetAll() ([]*lq.AwsAccount, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id := range table.store.awsAccounts {
+		ids = append(ids, id)
+	}
+	accounts := []*lq.AwsAccount{}
+	for _, id := range ascending(ids) {
+		accounts = append(accounts, proto.Clone(table.store.awsAccounts[id]).(*lq.AwsAccount))
+	}
+	return accounts, nil
+}
+
+func (table *memoryAwsAccountTable) GetOwner(accountID uint) (ownerID, orgID uint, err error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	orgIDs := []uint{}
+	for id, org := range table.store.organizations {
+		if org.AwsAccountID == accountID {
+			orgIDs = append(orgIDs, id)
+		}
+	}
+	if len(orgIDs) > 0 {
+		return 0, ascending(orgIDs)[0], nil
+	}
+
+	userIDs := []uint{}
+	for id, user := range table.store.users {
+		if user.AwsAccountID == accountID {
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return 0, 0, notFound("Failed getting owner of aws account %d", accountID)
+	}
+	return ascending(userIDs)[0], 0, nil
+}
+
+// Secrets are not encrypted in memory, there is nothing to re-encrypt
+func (table *memoryAwsAccountTable) ReencryptAll() (int, error) {
+	return 0, nil
+}
+
+type memorySecretsTable struct {
+	store *MemoryStore
+}
+
+// Must be called with the mutex held
+func (table *memorySecretsTable) get(ownerID uint, name string) *lq.Secret {
+	for _, secret := range table.store.secrets {
+		if secret.OwnerID == ownerID && secret.Name == name {
+			return secret
+		}
+	}
+	return nil
+}
+
+func (table *memorySecretsTable) Create(secret *lq.Secret) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if table.get(secret.OwnerID, secret.Name) != nil {
+		return lq.NewErrorf(nil, "Failed creating secret %s for user %d, the secret exists", secret.Name,
+			secret.OwnerID)
+	}
+	secret.Model = table.store.newModel()
+	stored := *secret
+	table.store.secrets[secret.ID] = &stored
+	return nil
+}
+
+type byName []*lq.Secret
+
+func (secrets byName) Len() int           { return len(secrets) }
+func (secrets byName) Swap(i, j int)      { secrets[i], secrets[j] = secrets[j], secrets[i] }
+func (secrets byName) Less(i, j int) bool { return secrets[i].Name < secrets[j].Name }
+
+func (table *memorySecretsTable) GetByOwner(ownerID uint) ([]*lq.Secret, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	secrets := []*lq.Secret{}
+	for _, secret := range table.store.secrets {
+		if secret.OwnerID == ownerID {
+			copied := *secret
+			copied.Value = ""
+			secrets = append(secrets, &copied)
+		}
+	}
+	sort.Sort(byName(secrets))
+	return secrets, nil
+}
+
+func (table *memorySecretsTable) SetValue(ownerID uint, name string, value string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	secret := table.get(ownerID, name)
+	if secret == nil {
+		return lq.NewErrorf(nil, "User %d has no secret %s", ownerID, name)
+	}
+	secret.Value = value
+	secret.UpdatedAt = time.Now()
+	return nil
+}
+
+func (table *memorySecretsTable) Delete(ownerID uint, name string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	secret := table.get(ownerID, name)
+	if secret == nil {
+		return lq.NewErrorf(nil, "User %d has no secret %s", ownerID, name)
+	}
+	delete(table.store.secrets, secret.ID)
+	return nil
+}
+
+func (table *memorySecretsTable) MissingNames(ownerID uint, names []string) ([]string, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	missing := []string{}
+	for _, name := range names {
+		if table.get(ownerID, name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+func (table *memorySecretsTable) Resolve(ownerID uint, refs []lq.SecretRef) ([]lq.ResolvedSecret, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	resolved := []lq.ResolvedSecret{}
+	for _, ref := range refs {
+		secret := table.get(ownerID, ref.Name)
+		if secret == nil {
+			return resolved, lq.NewErrorf(nil, "Secret %s does not exist", ref.Name)
+		}
+		resolved = append(resolved, lq.ResolvedSecret{SecretRef: ref, Value: secret.Value})
+	}
+	return resolved, nil
+}
+
+// Secrets are not encrypted in memory, there is nothing to re-encrypt
+func (table *memorySecretsTable) ReencryptAll() (int, error) {
+	return 0, nil
+}
+
+type memoryWebhooksTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryWebhooksTable) Create(hook *lq.Webhook) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	hook.Model = table.store.newModel()
+	stored := *hook
+	table.store.webhooks[hook.ID] = &stored
+	return nil
+}
+
+func (table *memoryWebhooksTable) Get(webhookID uint) (*lq.Webhook, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	hook, ok := table.store.webhooks[webhookID]
+	if !ok {
+		return nil, notFound("Failed getting webhook %d", webhookID)
+	}
+	copied := *hook
+	copied.Secret = ""
+	return &copied, nil
+}
+
+// The webhooks matching in ascending id order, with their secrets
+func (table *memoryWebhooksTable) find(matches func(*lq.Webhook) bool) []*lq.Webhook {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, hook := range table.store.webhooks {
+		if matches(hook) {
+			ids = append(ids, id)
+		}
+	}
+	hooks := []*lq.Webhook{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.webhooks[id]
+		hooks = append(hooks, &copied)
+	}
+	return hooks
+}
+
+func (table *memoryWebhooksTable) GetByOwner(ownerID uint) ([]*lq.Webhook, error) {
+	hooks := table.find(func(hook *lq.Webhook) bool { return hook.OwnerID == ownerID })
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+func (table *memoryWebhooksTable) GetForEvent(event *lq.Event) ([]*lq.Webhook, error) {
+	return table.find(func(hook *lq.Webhook) bool { return hook.Accepts(event) }), nil
+}
+
+func (table *memoryWebhooksTable) GetForDelivery(webhookID uint) (*lq.Webhook, error) {
+	hooks := table.find(func(hook *lq.Webhook) bool { return hook.ID == webhookID })
+	if len(hooks) == 0 {
+		return nil, notFound("Failed getting webhook %d", webhookID)
+	}
+	return hooks[0], nil
+}
+
+func (table *memoryWebhooksTable) Delete(webhookID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	delete(table.store.webhooks, webhookID)
+	return nil
+}
+
+func (table *memoryWebhooksTable) ClaimDelivery(delivery *lq.WebhookDelivery) (bool, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	for _, existing := range table.store.deliveries {
+		if existing.WebhookID == delivery.WebhookID && existing.EventID == delivery.EventID {
+			return false, nil
+		}
+	}
+	delivery.ID = table.store.newID()
+	delivery.Status = lq.WebhookDeliveryPending
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	stored := *delivery
+	table.store.deliveries[delivery.ID] = &stored
+	return true, nil
+}
+
+func (table *memoryWebhooksTable) ClaimDueDeliveries(now time.Time, lease time.Duration,
+	limit int) ([]*lq.WebhookDelivery, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	due := []*lq.WebhookDelivery{}
+	for _, delivery := range table.store.deliveries {
+		if delivery.Status == lq.WebhookDeliveryPending && delivery.NextAttemptAt <= now.UnixNano() {
+			due = append(due, delivery)
+		}
+	}
+	sort.Sort(byNextAttempt(due))
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := []*lq.WebhookDelivery{}
+	for _, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease).UnixNano()
+		copied := *delivery
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries, nil
+}
+
+type byNextAttempt []*lq.WebhookDelivery
+
+func (d byNextAttempt) Len() int           { return len(d) }
+func (d byNextAttempt) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byNextAttempt) Less(i, j int) bool { return d[i].NextAttemptAt < d[j].NextAttemptAt }
+
+func (table *memoryWebhooksTable) UpdateDelivery(delivery *lq.WebhookDelivery) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if delivery.Status != lq.WebhookDeliveryPending {
+		delivery.Payload = ""
+		delivery.NextAttemptAt = 0
+	}
+	if stored, ok := table.store.deliveries[delivery.ID]; ok {
+		stored.Status = delivery.Status
+		stored.Attempts = delivery.Attempts
+		stored.ResponseCode = delivery.ResponseCode
+		stored.Error = delivery.Error
+		stored.Payload = delivery.Payload
+		stored.NextAttemptAt = delivery.NextAttemptAt
+		stored.UpdatedAt = delivery.UpdatedAt
+	}
+	return nil
+}
+
+func (table *memoryWebhooksTable) GetDeliveries(webhookID uint, page PageRequest) ([]*lq.WebhookDelivery, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, delivery := range table.store.deliveries {
+		if delivery.WebhookID == webhookID && page.Includes(id) {
+			ids = append(ids, id)
+		}
+	}
+	deliveries := []*lq.WebhookDelivery{}
+	for _, id := range descending(ids)[:page.limit(len(ids))] {
+		copied := *table.store.deliveries[id]
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries, nil
+}
+
+type memoryAuditLogTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryAuditLogTable) Append(entry *lq.AuditEntry) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	entry.ID = table.store.newID()
+	if entry.Time == 0 {
+		entry.Time = time.Now().UTC().UnixNano()
+	}
+	stored := *entry
+	table.store.auditEntries[entry.ID] = &stored
+	return nil
+}
+
+func (table *memoryAuditLogTable) ListVisibleTo(userID, orgID uint, orgAdmin bool, filter AuditFilter,
+	page PageRequest) ([]*lq.AuditEntry, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, entry := range table.store.auditEntries {
+		visible := entry.UserID == userID || (orgAdmin && orgID != 0 && entry.OrgID == orgID)
+		if visible && filter.matches(entry) && page.Includes(id) {
+			ids = append(ids, id)
+		}
+	}
+	entries := []*lq.AuditEntry{}
+	for _, id := range descending(ids)[:page.limit(len(ids))] {
+		copied := *table.store.auditEntries[id]
+		entries = append(entries, &copied)
+	}
+	return entries, nil
+}
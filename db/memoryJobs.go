@@ -0,0 +1,621 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+
+	lq "bargain/liquefy/models"
+)
+
+type memoryJobsTable struct {
+	store *MemoryStore
+}
+
+// Must be called with the mutex held
+func (table *memoryJobsTable) create(job *lq.ContainerJob) {
+	job.ID = table.store.newID()
+	job.Status = mesos.TaskState_TASK_STAGING.String()
+	stored := *job
+	table.store.jobs[job.ID] = &stored
+	table.store.addJobTracker(newJobTracker(job, job.Status, "", time.Now().UTC().UnixNano()))
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) addJobTracker(tracker *lq.ContainerJobTracker) {
+	tracker.Model = store.newModel()
+	store.jobTrackers = append(store.jobTrackers, tracker)
+}
+
+func (table *memoryJobsTable) Create(job *lq.ContainerJob) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	table.create(job)
+	return nil
+}
+
+func (table *memoryJobsTable) CreateMany(jobs []*lq.ContainerJob, key *lq.IdempotencyKey) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	idempotencyKeys := &memoryIdempotencyKeysTable{table.store}
+	if key != nil && idempotencyKeys.live(key.UserID, key.Key) != nil {
+		return lq.NewErrorf(nil, "Failed creating %d jobs, user %d submitted jobs with key %s already", len(jobs),
+			key.UserID, key.Key)
+	}
+
+	ids := make([]uint, len(jobs))
+	for i, job := range jobs {
+		table.create(job)
+		ids[i] = job.ID
+	}
+	if key != nil {
+		return idempotencyKeys.create(key, ids)
+	}
+	return nil
+}
+
+func (table *memoryJobsTable) Get(jobID uint) (*lq.ContainerJob, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	job, ok := table.store.jobs[jobID]
+	if !ok {
+		return &lq.ContainerJob{}, notFound("Failed getting job %d", jobID)
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// The jobs matching, in ascending id order
+func (table *memoryJobsTable) find(matches func(*lq.ContainerJob) bool) []*lq.ContainerJob {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, job := range table.store.jobs {
+		if matches(job) {
+			ids = append(ids, id)
+		}
+	}
+	jobs := []*lq.ContainerJob{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.jobs[id]
+		jobs = append(jobs, &copied)
+	}
+	return jobs
+}
+
+func (table *memoryJobsTable) GetActiveJobsOnResource(resourceID uint) ([]*lq.ContainerJob, error) {
+	active := []string{
+		mesos.TaskState_TASK_STAGING.String(),
+		lq.ContainerJobStatusLaunched,
+		mesos.TaskState_TASK_STARTING.String(),
+		mesos.TaskState_TASK_RUNNING.String(),
+	}
+	return table.find(func(job *lq.ContainerJob) bool {
+		return job.InstanceID == resourceID && stateInList(job.Status, active)
+	}), nil
+}
+
+func (table *memoryJobsTable) GetAssignedJobsByInstances(instanceIDs []uint) ([]*lq.ContainerJob, error) {
+	instances := map[uint]bool{}
+	for _, id := range instanceIDs {
+		instances[id] = true
+	}
+	return table.find(func(job *lq.ContainerJob) bool {
+		return job.Status == mesos.TaskState_TASK_STAGING.String() && instances[job.InstanceID] && !job.UserTerminated
+	}), nil
+}
+
+func (table *memoryJobsTable) GetUnassignedJobsByUser(userID uint) ([]*lq.ContainerJob, error) {
+	return table.find(func(job *lq.ContainerJob) bool {
+		return job.Status == mesos.TaskState_TASK_STAGING.String() && job.InstanceID == 0 &&
+			job.OwnerID == userID && !job.UserTerminated
+	}), nil
+}
+
+func (table *memoryJobsTable) GetAllJobsByUser(userID uint) ([]*lq.ContainerJob, error) {
+	return table.find(func(job *lq.ContainerJob) bool {
+		return job.OwnerID == userID
+	}), nil
+}
+
+func (table *memoryJobsTable) ListVisibleTo(userID, orgID uint, filter JobFilter,
+	page PageRequest) ([]*lq.ContainerJob, error) {
+	jobs := table.find(func(job *lq.ContainerJob) bool {
+		return isVisibleTo(userID, orgID, job.OwnerID, job.OrgID) && filter.Matches(job) && page.Includes(job.ID)
+	})
+	listed := []*lq.ContainerJob{}
+	for i := len(jobs) - 1; i >= len(jobs)-page.limit(len(jobs)); i-- {
+		listed = append(listed, jobs[i])
+	}
+	return listed, nil
+}
+
+func (table *memoryJobsTable) GetNonTerminatedUserTerminatedJobs() ([]*lq.ContainerJob, error) {
+	return table.find(func(job *lq.ContainerJob) bool {
+		return job.UserTerminated && !job.IsTerminated()
+	}), nil
+}
+
+func (table *memoryJobsTable) GetEvents(jobID uint) ([]*lq.ContainerJobTracker, error) {
+	return table.store.JobTrackers(jobID), nil
+}
+
+func (table *memoryJobsTable) GetAllNonCompletedJobs() ([]*lq.ContainerJob, error) {
+	return table.find(func(job *lq.ContainerJob) bool {
+		return !job.IsTerminated()
+	}), nil
+}
+
+func (table *memoryJobsTable) SetStatus(jobId uint, status string, statusMsg string) error {
+	table.store.mutex.Lock()
+	stored, ok := table.store.jobs[jobId]
+	if !ok {
+		table.store.mutex.Unlock()
+		return notFound("Failed setting job %d status to %s", jobId, status)
+	}
+	job := *stored
+	trackers, err := applyJobStatus(&job, status, statusMsg, time.Now().UTC().UnixNano())
+	if err != nil {
+		table.store.mutex.Unlock()
+		return lq.NewErrorf(err, "Failed setting job %d status to %s", jobId, status)
+	}
+	for _, tracker := range trackers {
+		table.store.addJobTracker(tracker)
+	}
+	*stored = job
+	table.store.mutex.Unlock()
+	return nil
+}
+
+// Updates the job if it exists, like an update of the rows with its id
+func (table *memoryJobsTable) update(jobID uint, update func(*lq.ContainerJob)) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if job, ok := table.store.jobs[jobID]; ok {
+		update(job)
+	}
+}
+
+func (table *memoryJobsTable) SetTotalCost(jobID uint, cost float64) error {
+	table.update(jobID, func(job *lq.ContainerJob) { job.TotalCost = cost })
+	return nil
+}
+
+func (table *memoryJobsTable) GetCostSince(ownerID uint, since int64) (float64, error) {
+	cost := 0.0
+	for _, job := range table.find(func(job *lq.ContainerJob) bool {
+		return job.OwnerID == ownerID && job.EndTime >= since
+	}) {
+		cost += job.TotalCost
+	}
+	return cost, nil
+}
+
+func (table *memoryJobsTable) SetContainerId(jobID uint, containerId string) error {
+	table.update(jobID, func(job *lq.ContainerJob) { job.ContainerId = containerId })
+	return nil
+}
+
+func (table *memoryJobsTable) SetAssignedPorts(jobID uint, assignedPorts string) error {
+	table.update(jobID, func(job *lq.ContainerJob) { job.AssignedPorts = assignedPorts })
+	return nil
+}
+
+func (table *memoryJobsTable) SetHealth(jobID uint, healthy bool, restarts int, statusMsg string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	job, ok := table.store.jobs[jobID]
+	if !ok {
+		return notFound("Failed setting health of job %d", jobID)
+	}
+	job.Healthy, job.Restarts = healthy, restarts
+	table.store.addJobTracker(newJobTracker(job, job.Status, statusMsg, time.Now().UTC().UnixNano()))
+	return nil
+}
+
+func (table *memoryJobsTable) MarkUserTerminated(jobId uint) error {
+	table.update(jobId, func(job *lq.ContainerJob) { job.UserTerminated = true })
+	return nil
+}
+
+func (table *memoryJobsTable) Delete(jobID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	delete(table.store.jobs, jobID)
+	return nil
+}
+
+type memoryAssignmentsTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryAssignmentsTable) AssignJob(jobID uint, resource *lq.ResourceInstance, createResource bool) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	job, ok := table.store.jobs[jobID]
+	if !ok {
+		return notFound("Failed assigning job %d to resource %v", jobID, resource)
+	}
+	if createResource {
+		(&memoryResourcesTable{table.store}).create(resource)
+	}
+	stored, ok := table.store.resources[resource.ID]
+	if !ok {
+		return notFound("Failed assigning job %d to resource %v", jobID, resource)
+	}
+
+	job.InstanceID = resource.ID
+	table.store.addJobTracker(newJobTracker(job, job.Status, fmt.Sprintf("Assigned to instance %d", resource.ID),
+		time.Now().UTC().UnixNano()))
+	resource.RamUsed += job.Ram
+	resource.CpuUsed += job.Cpu
+	resource.GpuUsed += job.Gpu
+	resource.DiskUsed += job.Disk
+	stored.RamUsed, stored.CpuUsed, stored.GpuUsed, stored.DiskUsed =
+		resource.RamUsed, resource.CpuUsed, resource.GpuUsed, resource.DiskUsed
+	return nil
+}
+
+func (table *memoryAssignmentsTable) UnassignJob(jobID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	job, ok := table.store.jobs[jobID]
+	if !ok {
+		return notFound("Failed unassigning job %d", jobID)
+	}
+	if job.InstanceID == 0 {
+		return nil
+	}
+	instance, ok := table.store.resources[job.InstanceID]
+	if !ok {
+		return notFound("Failed unassigning job %d", jobID)
+	}
+
+	job.InstanceID = 0
+	table.store.addJobTracker(newJobTracker(job, job.Status, fmt.Sprintf("Unassigned from instance %d", instance.ID),
+		time.Now().UTC().UnixNano()))
+	instance.RamUsed -= job.Ram
+	instance.CpuUsed -= job.Cpu
+	instance.GpuUsed -= job.Gpu
+	instance.DiskUsed -= job.Disk
+	return nil
+}
+
+type memoryResourcesTable struct {
+	store *MemoryStore
+}
+
+// Must be called with the mutex held
+func (table *memoryResourcesTable) create(resource *lq.ResourceInstance) {
+	resource.ID = table.store.newID()
+	resource.Status = lq.ResourceStatusNew
+	stored := *resource
+	table.store.resources[resource.ID] = &stored
+	table.store.addResourceEvent(newResourceEvent(resource.ID, resource.Status, ""))
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) addResourceEvent(event *lq.ResourceEvent) {
+	event.ID = store.newID()
+	store.resourceEvents = append(store.resourceEvents, event)
+}
+
+func (table *memoryResourcesTable) Get(resourceID uint) (*lq.ResourceInstance, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	resource, ok := table.store.resources[resourceID]
+	if !ok {
+		return &lq.ResourceInstance{}, notFound("Failed fetching resource %d", resourceID)
+	}
+	copied := *resource
+	return &copied, nil
+}
+
+// The resources matching, in ascending id order
+func (table *memoryResourcesTable) find(matches func(*lq.ResourceInstance) bool) []*lq.ResourceInstance {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, resource := range table.store.resources {
+		if matches(resource) {
+			ids = append(ids, id)
+		}
+	}
+	resources := []*lq.ResourceInstance{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.resources[id]
+		resources = append(resources, &copied)
+	}
+	return resources
+}
+
+func withStatus(statuses ...string) func(*lq.ResourceInstance) bool {
+	return func(resource *lq.ResourceInstance) bool {
+		return stateInList(resource.Status, statuses)
+	}
+}
+
+func (table *memoryResourcesTable) Update(resourceId uint, resource *lq.ResourceInstance) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	resource.ID = resourceId
+	if stored, ok := table.store.resources[resourceId]; ok {
+		updateNonZero(stored, resource)
+	}
+	return nil
+}
+
+func (table *memoryResourcesTable) GetNewResources() ([]*lq.ResourceInstance, error) {
+	return table.find(withStatus(lq.ResourceStatusNew)), nil
+}
+
+func (table *memoryResourcesTable) GetTerminatedResourceIdsWithAssignedJobs() ([]uint, error) {
+	table.store.mutex.Lock()
+	assigned := map[uint]bool{}
+	for _, job := range table.store.jobs {
+		assigned[job.InstanceID] = true
+	}
+	table.store.mutex.Unlock()
+
+	terminated := withStatus(lq.ResourceStatusDeprovisioning, lq.ResourceStatusDeprovisioned)
+	resourceIds := []uint{}
+	for _, resource := range table.find(terminated) {
+		if assigned[resource.ID] {
+			resourceIds = append(resourceIds, resource.ID)
+		}
+	}
+	return resourceIds, nil
+}
+
+func (table *memoryResourcesTable) GetUsersResources(userID uint) ([]*lq.ResourceInstance, error) {
+	return table.find(func(resource *lq.ResourceInstance) bool {
+		return resource.OwnerId == userID
+	}), nil
+}
+
+func (table *memoryResourcesTable) ListVisibleTo(userID, orgID uint, filter InstanceFilter,
+	page PageRequest) ([]*lq.ResourceInstance, error) {
+	resources := table.find(func(resource *lq.ResourceInstance) bool {
+		return isVisibleTo(userID, orgID, resource.OwnerId, resource.OrgID) && filter.Matches(resource) &&
+			page.Includes(resource.ID)
+	})
+	listed := []*lq.ResourceInstance{}
+	for i := len(resources) - 1; i >= len(resources)-page.limit(len(resources)); i-- {
+		listed = append(listed, resources[i])
+	}
+	return listed, nil
+}
+
+func (table *memoryResourcesTable) GetUsersProvisionedResources(userID uint) ([]*lq.ResourceInstance, error) {
+	provisioned := withStatus(lq.ResourceStatusProvisioned, lq.ResourceStatusRunning)
+	return table.find(func(resource *lq.ResourceInstance) bool {
+		return resource.OwnerId == userID && provisioned(resource)
+	}), nil
+}
+
+func (table *memoryResourcesTable) GetAllProvisionedResources() ([]*lq.ResourceInstance, error) {
+	return table.find(withStatus(lq.ResourceStatusProvisioned)), nil
+}
+
+func (table *memoryResourcesTable) GetAllProvisionedOrRunningResources() ([]*lq.ResourceInstance, error) {
+	return table.find(withStatus(lq.ResourceStatusProvisioned, lq.ResourceStatusRunning)), nil
+}
+
+func (table *memoryResourcesTable) GetEvents(resourceId uint) ([]*lq.ResourceEvent, error) {
+	return table.store.ResourceEvents(resourceId), nil
+}
+
+func (table *memoryResourcesTable) GetRunningUserTerminatedResources() ([]*lq.ResourceInstance, error) {
+	running := withStatus(lq.ResourceStatusRunning)
+	return table.find(func(resource *lq.ResourceInstance) bool {
+		return resource.UserTerminated && running(resource)
+	}), nil
+}
+
+func (table *memoryResourcesTable) SetStatus(resourceId uint, status, msg string) error {
+	table.store.mutex.Lock()
+	stored, ok := table.store.resources[resourceId]
+	if !ok {
+		table.store.mutex.Unlock()
+		return notFound("Failed setting resource %d status to %s", resourceId, status)
+	}
+	if !isValidResourceTransition(stored.Status, status) {
+		table.store.mutex.Unlock()
+		return lq.NewErrorf(nil, "Invalid resource state transition: %s to %s", stored.Status, status)
+	}
+	stored.Status = status
+	table.store.addResourceEvent(newResourceEvent(resourceId, status, msg))
+	table.store.mutex.Unlock()
+	return nil
+}
+
+// Updates the resource if it exists, like an update of the rows with its id
+func (table *memoryResourcesTable) update(resourceId uint, update func(*lq.ResourceInstance)) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if resource, ok := table.store.resources[resourceId]; ok {
+		update(resource)
+	}
+	return nil
+}
+
+func (table *memoryResourcesTable) SetInstanceId(resourceId uint, instanceId string) error {
+	return table.update(resourceId, func(resource *lq.ResourceInstance) { resource.AwsInstanceId = instanceId })
+}
+
+func (table *memoryResourcesTable) SetLaunchTime(resourceId uint, launchTime int64) error {
+	return table.update(resourceId, func(resource *lq.ResourceInstance) { resource.LaunchTime = launchTime })
+}
+
+func (table *memoryResourcesTable) SetIP(resourceId uint, ip string) error {
+	return table.update(resourceId, func(resource *lq.ResourceInstance) { resource.IP = ip })
+}
+
+func (table *memoryResourcesTable) SetStorage(resourceId uint, storage lq.InstanceStorage) error {
+	return table.update(resourceId, func(resource *lq.ResourceInstance) {
+		resource.DiskTotal = storage.DiskTotal
+		resource.AwsVolumeSize = storage.VolumeSize
+		resource.AwsInstanceStore = storage.InstanceStore
+	})
+}
+
+func (table *memoryResourcesTable) MarkUserTerminated(resourceId uint) error {
+	return table.update(resourceId, func(resource *lq.ResourceInstance) { resource.UserTerminated = true })
+}
+
+func (table *memoryResourcesTable) Delete(resourceId uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	delete(table.store.resources, resourceId)
+	return nil
+}
+
+type memoryBuildLogsTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryBuildLogsTable) Create(jobID uint, attempt int, buildLog string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	entry := &lq.ContainerJobBuildLog{ContainerJobID: jobID, Attempt: attempt, Log: buildLog}
+	entry.Model = table.store.newModel()
+	table.store.buildLogs[entry.ID] = entry
+	return nil
+}
+
+type byAttempt []*lq.ContainerJobBuildLog
+
+func (logs byAttempt) Len() int      { return len(logs) }
+func (logs byAttempt) Swap(i, j int) { logs[i], logs[j] = logs[j], logs[i] }
+func (logs byAttempt) Less(i, j int) bool {
+	return logs[i].Attempt < logs[j].Attempt || (logs[i].Attempt == logs[j].Attempt && logs[i].ID < logs[j].ID)
+}
+
+func (table *memoryBuildLogsTable) GetByJob(jobID uint) ([]*lq.ContainerJobBuildLog, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	buildLogs := []*lq.ContainerJobBuildLog{}
+	for _, entry := range table.store.buildLogs {
+		if entry.ContainerJobID == jobID {
+			copied := *entry
+			buildLogs = append(buildLogs, &copied)
+		}
+	}
+	sort.Sort(byAttempt(buildLogs))
+	return buildLogs, nil
+}
+
+type memoryIdempotencyKeysTable struct {
+	store *MemoryStore
+}
+
+// The key of the user that did not expire, must be called with the mutex held
+func (table *memoryIdempotencyKeysTable) live(userID uint, key string) *lq.IdempotencyKey {
+	for _, idempotencyKey := range table.store.idempotencyKeys {
+		if idempotencyKey.UserID == userID && idempotencyKey.Key == key && !idempotencyKey.IsExpired(time.Now()) {
+			return idempotencyKey
+		}
+	}
+	return nil
+}
+
+// Stores the key, replacing an expired key of the user. Must be called with the mutex held.
+func (table *memoryIdempotencyKeysTable) create(key *lq.IdempotencyKey, jobIDs []uint) error {
+	if err := key.SetJobIDs(jobIDs); err != nil {
+		return err
+	}
+	for id, existing := range table.store.idempotencyKeys {
+		if existing.UserID == key.UserID && existing.Key == key.Key {
+			delete(table.store.idempotencyKeys, id)
+		}
+	}
+	key.ID = table.store.newID()
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	stored := *key
+	table.store.idempotencyKeys[key.ID] = &stored
+	return nil
+}
+
+func (table *memoryIdempotencyKeysTable) Get(userID uint, key string) (*lq.IdempotencyKey, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	idempotencyKey := table.live(userID, key)
+	if idempotencyKey == nil {
+		return nil, nil
+	}
+	copied := *idempotencyKey
+	return &copied, nil
+}
+
+type memoryQuotasTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryQuotasTable) GetForUser(userID uint) (*lq.Quota, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	quota, ok := table.store.quotas[userID]
+	if !ok {
+		return lq.DefaultQuota(userID), nil
+	}
+	copied := *quota
+	return &copied, nil
+}
+
+func (table *memoryQuotasTable) Set(quota *lq.Quota) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if existing, ok := table.store.quotas[quota.UserID]; ok {
+		quota.Model = existing.Model
+		quota.UpdatedAt = time.Now()
+	} else {
+		quota.Model = table.store.newModel()
+	}
+	stored := *quota
+	table.store.quotas[quota.UserID] = &stored
+	return nil
+}
+
+func (table *memoryQuotasTable) Usage(userID uint) (*lq.QuotaUsage, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	usage := &lq.QuotaUsage{}
+	for _, job := range table.store.jobs {
+		if job.OwnerID == userID && !lq.IsTerminalJobStatus(job.Status) {
+			usage.ActiveJobs++
+			usage.ActiveJobCpus += job.Cpu
+		}
+	}
+	for _, resource := range table.store.resources {
+		if resource.OwnerId == userID && resource.Status != lq.ResourceStatusDeprovisioning &&
+			resource.Status != lq.ResourceStatusDeprovisioned {
+			usage.Instances++
+			usage.VCpus += resource.CpuTotal
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	lq "bargain/liquefy/models"
+)
+
+type memoryRetentionTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryRetentionTable) GetPolicy(userID, orgID uint) (*lq.RetentionPolicy, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	scope := lq.DefaultRetentionPolicy(userID, orgID)
+	for _, policy := range table.store.retention {
+		if policy.UserID == scope.UserID && policy.OrgID == scope.OrgID {
+			copied := *policy
+			return &copied, nil
+		}
+	}
+	return scope, nil
+}
+
+func (table *memoryRetentionTable) SetPolicy(policy *lq.RetentionPolicy) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if policy.OrgID != 0 {
+		policy.UserID = 0
+	}
+	policy.Model = table.store.newModel()
+	for _, existing := range table.store.retention {
+		if existing.UserID == policy.UserID && existing.OrgID == policy.OrgID {
+			policy.Model = existing.Model
+			policy.UpdatedAt = time.Now()
+		}
+	}
+	stored := *policy
+	table.store.retention[policy.ID] = &stored
+	return nil
+}
+
+func (table *memoryRetentionTable) Scopes() ([]lq.RetentionScope, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	found := map[lq.RetentionScope]bool{}
+	scopes := []lq.RetentionScope{}
+	add := func(scope lq.RetentionScope) {
+		if !found[scope] {
+			found[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, id := range table.store.jobIDs() {
+		if job := table.store.jobs[id]; job.IsTerminated() {
+			add(lq.RetentionScope{OwnerID: job.OwnerID, OrgID: job.OrgID})
+		}
+	}
+	for _, id := range table.store.resourceIDs() {
+		if resource := table.store.resources[id]; resource.Status == lq.ResourceStatusDeprovisioned {
+			add(lq.RetentionScope{OwnerID: resource.OwnerId, OrgID: resource.OrgID})
+		}
+	}
+	return scopes, nil
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) jobIDs() []uint {
+	ids := []uint{}
+	for id := range store.jobs {
+		ids = append(ids, id)
+	}
+	return ascending(ids)
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) resourceIDs() []uint {
+	ids := []uint{}
+	for id := range store.resources {
+		ids = append(ids, id)
+	}
+	return ascending(ids)
+}
+
+func (table *memoryRetentionTable) ExpiredJobs(scope lq.RetentionScope, before int64,
+	limit int) ([]*lq.ArchivedJob, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	archived := []*lq.ArchivedJob{}
+	for _, id := range table.store.jobIDs() {
+		job := table.store.jobs[id]
+		if len(archived) == limit || job.OwnerID != scope.OwnerID || job.OrgID != scope.OrgID ||
+			!job.IsTerminated() || job.EndTime >= before || job.RestoredAt >= before {
+			continue
+		}
+		copied := *job
+		expired := &lq.ArchivedJob{Job: &copied, Events: []*lq.ContainerJobTracker{},
+			BuildLogs: []*lq.ContainerJobBuildLog{}}
+		for _, tracker := range table.store.jobTrackers {
+			if tracker.ContainerJobID == job.ID {
+				copiedTracker := *tracker
+				expired.Events = append(expired.Events, &copiedTracker)
+			}
+		}
+		for _, buildLog := range table.store.buildLogs {
+			if buildLog.ContainerJobID == job.ID {
+				copiedLog := *buildLog
+				expired.BuildLogs = append(expired.BuildLogs, &copiedLog)
+			}
+		}
+		sort.Sort(byAttempt(expired.BuildLogs))
+		archived = append(archived, expired)
+	}
+	return archived, nil
+}
+
+func (table *memoryRetentionTable) ExpiredInstances(scope lq.RetentionScope, before int64,
+	limit int) ([]*lq.ArchivedInstance, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	archived := []*lq.ArchivedInstance{}
+	for _, id := range table.store.resourceIDs() {
+		resource := table.store.resources[id]
+		if len(archived) == limit || resource.OwnerId != scope.OwnerID || resource.OrgID != scope.OrgID ||
+			resource.Status != lq.ResourceStatusDeprovisioned || resource.RestoredAt >= before {
+			continue
+		}
+		copied := *resource
+		expired := &lq.ArchivedInstance{Instance: &copied, Events: []*lq.ResourceEvent{}}
+		changedSince := false
+		for _, event := range table.store.resourceEvents {
+			if event.InstanceID == resource.ID {
+				copiedEvent := *event
+				expired.Events = append(expired.Events, &copiedEvent)
+				changedSince = changedSince || event.Time >= before
+			}
+		}
+		if !changedSince {
+			archived = append(archived, expired)
+		}
+	}
+	return archived, nil
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) deleteHistory(jobs []*lq.ArchivedJob, instances []*lq.ArchivedInstance) {
+	jobIDs, instanceIDs := archivedIDs(jobs, instances)
+	deletedJobs := map[uint]bool{}
+	for _, id := range jobIDs {
+		deletedJobs[id] = true
+		delete(store.jobs, id)
+	}
+	trackers := []*lq.ContainerJobTracker{}
+	for _, tracker := range store.jobTrackers {
+		if !deletedJobs[tracker.ContainerJobID] {
+			trackers = append(trackers, tracker)
+		}
+	}
+	store.jobTrackers = trackers
+	for id, buildLog := range store.buildLogs {
+		if deletedJobs[buildLog.ContainerJobID] {
+			delete(store.buildLogs, id)
+		}
+	}
+
+	deletedInstances := map[uint]bool{}
+	for _, id := range instanceIDs {
+		deletedInstances[id] = true
+		delete(store.resources, id)
+	}
+	resourceEvents := []*lq.ResourceEvent{}
+	for _, event := range store.resourceEvents {
+		if !deletedInstances[event.InstanceID] {
+			resourceEvents = append(resourceEvents, event)
+		}
+	}
+	store.resourceEvents = resourceEvents
+}
+
+func (table *memoryRetentionTable) Archive(file *lq.ArchiveFile, jobs []*lq.ArchivedJob,
+	instances []*lq.ArchivedInstance) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	for _, existing := range table.store.archiveFiles {
+		if existing.Key == file.Key {
+			return lq.NewErrorf(nil, "Failed archiving history to %s, the archive exists already", file.Key)
+		}
+	}
+	file.Model = table.store.newModel()
+	stored := *file
+	table.store.archiveFiles[file.ID] = &stored
+	table.store.deleteHistory(jobs, instances)
+	return nil
+}
+
+func (table *memoryRetentionTable) Restore(file *lq.ArchiveFile, jobs []*lq.ArchivedJob,
+	instances []*lq.ArchivedInstance) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	table.store.deleteHistory(jobs, instances)
+	for _, archived := range jobs {
+		job := *archived.Job
+		table.store.jobs[job.ID] = &job
+		for _, tracker := range archived.Events {
+			copied := *tracker
+			table.store.jobTrackers = append(table.store.jobTrackers, &copied)
+		}
+		for _, buildLog := range archived.BuildLogs {
+			copied := *buildLog
+			table.store.buildLogs[copied.ID] = &copied
+		}
+	}
+	for _, archived := range instances {
+		resource := *archived.Instance
+		table.store.resources[resource.ID] = &resource
+		for _, event := range archived.Events {
+			copied := *event
+			table.store.resourceEvents = append(table.store.resourceEvents, &copied)
+		}
+	}
+	for id, existing := range table.store.archiveFiles {
+		if existing.Key == file.Key {
+			delete(table.store.archiveFiles, id)
+		}
+	}
+	return nil
+}
+
+func (table *memoryRetentionTable) GetArchive(key string) (*lq.ArchiveFile, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	for _, file := range table.store.archiveFiles {
+		if file.Key == key {
+			copied := *file
+			return &copied, nil
+		}
+	}
+	return &lq.ArchiveFile{}, notFound("Failed getting archive %s", key)
+}
+
+func (table *memoryRetentionTable) ListArchivesVisibleTo(userID, orgID uint) ([]*lq.ArchiveFile, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, file := range table.store.archiveFiles {
+		if isVisibleTo(userID, orgID, file.OwnerID, file.OrgID) {
+			ids = append(ids, id)
+		}
+	}
+	files := []*lq.ArchiveFile{}
+	for _, id := range descending(ids) {
+		copied := *table.store.archiveFiles[id]
+		files = append(files, &copied)
+	}
+	return files, nil
+}
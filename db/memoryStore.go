@@ -0,0 +1,639 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+
+	lq "bargain/liquefy/models"
+)
+
+// MemoryStore keeps every table in memory, for unit tests of the services. It behaves like the postgres tables,
+// including their unique constraints, except that secrets are stored unencrypted. Rows are copied in and out, so
+// changing a returned row does not change the store.
+type MemoryStore struct {
+	mutex  sync.Mutex
+	nextID uint // ids are unique across tables
+
+	users           map[uint]*lq.User
+	apiKeys         map[uint]*lq.ApiKey
+	refreshTokens   map[uint]*lq.RefreshToken
+	passwordResets  map[uint]*lq.PasswordReset
+	organizations   map[uint]*lq.Organization
+	memberships     map[uint]*lq.Membership
+	secrets         map[uint]*lq.Secret
+	webhooks        map[uint]*lq.Webhook
+	deliveries      map[uint]*lq.WebhookDelivery
+	idempotencyKeys map[uint]*lq.IdempotencyKey
+	quotas          map[uint]*lq.Quota
+	auditEntries    map[uint]*lq.AuditEntry
+	jobs            map[uint]*lq.ContainerJob
+	jobTrackers     []*lq.ContainerJobTracker
+	buildLogs       map[uint]*lq.ContainerJobBuildLog
+	resources       map[uint]*lq.ResourceInstance
+	resourceEvents  []*lq.ResourceEvent
+	awsAccounts     map[uint]*lq.AwsAccount
+	retention       map[uint]*lq.RetentionPolicy
+	archiveFiles    map[uint]*lq.ArchiveFile
+	frameworkID     string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:           make(map[uint]*lq.User),
+		apiKeys:         make(map[uint]*lq.ApiKey),
+		refreshTokens:   make(map[uint]*lq.RefreshToken),
+		passwordResets:  make(map[uint]*lq.PasswordReset),
+		organizations:   make(map[uint]*lq.Organization),
+		memberships:     make(map[uint]*lq.Membership),
+		secrets:         make(map[uint]*lq.Secret),
+		webhooks:        make(map[uint]*lq.Webhook),
+		deliveries:      make(map[uint]*lq.WebhookDelivery),
+		idempotencyKeys: make(map[uint]*lq.IdempotencyKey),
+		quotas:          make(map[uint]*lq.Quota),
+		auditEntries:    make(map[uint]*lq.AuditEntry),
+		jobs:            make(map[uint]*lq.ContainerJob),
+		buildLogs:       make(map[uint]*lq.ContainerJobBuildLog),
+		resources:       make(map[uint]*lq.ResourceInstance),
+		awsAccounts:     make(map[uint]*lq.AwsAccount),
+		retention:       make(map[uint]*lq.RetentionPolicy),
+		archiveFiles:    make(map[uint]*lq.ArchiveFile),
+	}
+}
+
+func (store *MemoryStore) ApiKeys() ApiKeysTable         { return &memoryApiKeysTable{store} }
+func (store *MemoryStore) Assignments() AssignmentsTable { return &memoryAssignmentsTable{store} }
+func (store *MemoryStore) AuditLog() AuditLogTable       { return &memoryAuditLogTable{store} }
+func (store *MemoryStore) AwsAccounts() AwsAccountTable  { return &memoryAwsAccountTable{store} }
+func (store *MemoryStore) BuildLogs() BuildLogsTable     { return &memoryBuildLogsTable{store} }
+func (store *MemoryStore) IdempotencyKeys() IdempotencyKeysTable {
+	return &memoryIdempotencyKeysTable{store}
+}
+func (store *MemoryStore) Jobs() ContainerJobsTable          { return &memoryJobsTable{store} }
+func (store *MemoryStore) Mesos() MesosTable                 { return &memoryMesosTable{store} }
+func (store *MemoryStore) Organizations() OrganizationsTable { return &memoryOrganizationsTable{store} }
+func (store *MemoryStore) PasswordResets() PasswordResetsTable {
+	return &memoryPasswordResetsTable{store}
+}
+func (store *MemoryStore) Quotas() QuotasTable               { return &memoryQuotasTable{store} }
+func (store *MemoryStore) RefreshTokens() RefreshTokensTable { return &memoryRefreshTokensTable{store} }
+func (store *MemoryStore) Resources() ResourcesTable         { return &memoryResourcesTable{store} }
+func (store *MemoryStore) Retention() RetentionTable         { return &memoryRetentionTable{store} }
+func (store *MemoryStore) Secrets() SecretsTable             { return &memorySecretsTable{store} }
+func (store *MemoryStore) Users() UsersTable                 { return &memoryUsersTable{store} }
+func (store *MemoryStore) Webhooks() WebhooksTable           { return &memoryWebhooksTable{store} }
+
+// The status history of a job, oldest first
+func (store *MemoryStore) JobTrackers(jobID uint) []*lq.ContainerJobTracker {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	trackers := []*lq.ContainerJobTracker{}
+	for _, tracker := range store.jobTrackers {
+		if tracker.ContainerJobID == jobID {
+			copied := *tracker
+			trackers = append(trackers, &copied)
+		}
+	}
+	return trackers
+}
+
+// The status history of a resource, oldest first
+func (store *MemoryStore) ResourceEvents(resourceID uint) []*lq.ResourceEvent {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	resourceEvents := []*lq.ResourceEvent{}
+	for _, event := range store.resourceEvents {
+		if event.InstanceID == resourceID {
+			copied := *event
+			resourceEvents = append(resourceEvents, &copied)
+		}
+	}
+	return resourceEvents
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) newID() uint {
+	store.nextID++
+	return store.nextID
+}
+
+// Must be called with the mutex held
+func (store *MemoryStore) newModel() gorm.Model {
+	now := time.Now()
+	return gorm.Model{ID: store.newID(), CreatedAt: now, UpdatedAt: now}
+}
+
+func notFound(format string, params ...interface{}) error {
+	return lq.NewErrorf(gorm.RecordNotFound, format, params...)
+}
+
+type uintSlice []uint
+
+func (ids uintSlice) Len() int           { return len(ids) }
+func (ids uintSlice) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+func (ids uintSlice) Less(i, j int) bool { return ids[i] < ids[j] }
+
+func ascending(ids []uint) []uint {
+	sort.Sort(uintSlice(ids))
+	return ids
+}
+
+func descending(ids []uint) []uint {
+	sort.Sort(sort.Reverse(uintSlice(ids)))
+	return ids
+}
+
+// Sets the field of a row stored in the column, as gorm names columns
+func setColumn(row interface{}, column string, value interface{}) error {
+	fields := reflect.ValueOf(row).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		if gorm.ToDBName(fields.Type().Field(i).Name) != column {
+			continue
+		}
+		converted := reflect.ValueOf(value)
+		if !converted.Type().ConvertibleTo(fields.Field(i).Type()) {
+			return lq.NewErrorf(nil, "Cannot set column %s to %v", column, value)
+		}
+		fields.Field(i).Set(converted.Convert(fields.Field(i).Type()))
+		return nil
+	}
+	return lq.NewErrorf(nil, "No column %s", column)
+}
+
+// Copies the fields of src that are not zero to dst, like gorm updates with a struct
+func updateNonZero(dst, src interface{}) {
+	to := reflect.ValueOf(dst).Elem()
+	from := reflect.ValueOf(src).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		field := from.Field(i)
+		if !reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			to.Field(i).Set(field)
+		}
+	}
+}
+
+type memoryUsersTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryUsersTable) Create(user *lq.User) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if user.ID == 0 {
+		user.ID = table.store.newID()
+	}
+	stored := *user
+	table.store.users[user.ID] = &stored
+	return nil
+}
+
+func (table *memoryUsersTable) Get(userID uint) (*lq.User, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	user, ok := table.store.users[userID]
+	if !ok {
+		return &lq.User{}, notFound("Failed getting user %d", userID)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (table *memoryUsersTable) GetByEmail(email string) (*lq.User, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, user := range table.store.users {
+		if user.Email == email {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return &lq.User{}, notFound("Failed getting user by email %s", email)
+	}
+	copied := *table.store.users[ascending(ids)[0]]
+	return &copied, nil
+}
+
+func (table *memoryUsersTable) GetAll() ([]*lq.User, error) {
+	return table.find(func(user *lq.User) bool { return true }), nil
+}
+
+func (table *memoryUsersTable) GetAllWithPendingJobs() ([]*lq.User, error) {
+	table.store.mutex.Lock()
+	pending := map[uint]bool{}
+	for _, job := range table.store.jobs {
+		if job.Status == mesos.TaskState_TASK_STAGING.String() {
+			pending[job.OwnerID] = true
+		}
+	}
+	orgsWithAccount := map[uint]bool{}
+	for id, org := range table.store.organizations {
+		orgsWithAccount[id] = org.AwsAccountID > 0
+	}
+	hasAccount := map[uint]bool{}
+	for _, membership := range table.store.memberships {
+		hasAccount[membership.UserID] = orgsWithAccount[membership.OrgID]
+	}
+	table.store.mutex.Unlock()
+
+	return table.find(func(user *lq.User) bool {
+		return pending[user.ID] && (user.AwsAccountID > 0 || hasAccount[user.ID])
+	}), nil
+}
+
+func (table *memoryUsersTable) find(matches func(*lq.User) bool) []*lq.User {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, user := range table.store.users {
+		if matches(user) {
+			ids = append(ids, id)
+		}
+	}
+	users := []*lq.User{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.users[id]
+		users = append(users, &copied)
+	}
+	return users
+}
+
+func (table *memoryUsersTable) update(userID uint, update func(*lq.User) error) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	user, ok := table.store.users[userID]
+	if !ok {
+		return notFound("Failed updating user %d", userID)
+	}
+	return update(user)
+}
+
+func (table *memoryUsersTable) Update(userID uint, field string, value string) error {
+	return table.update(userID, func(user *lq.User) error {
+		return setColumn(user, field, value)
+	})
+}
+
+func (table *memoryUsersTable) RecordFailedLogin(userID uint) (int, error) {
+	failures := 0
+	err := table.update(userID, func(user *lq.User) error {
+		user.FailedLogins++
+		failures = user.FailedLogins
+		return nil
+	})
+	return failures, err
+}
+
+func (table *memoryUsersTable) Lock(userID uint, until int64) error {
+	return table.update(userID, func(user *lq.User) error {
+		user.FailedLogins, user.LockedUntil = 0, until
+		return nil
+	})
+}
+
+func (table *memoryUsersTable) ResetFailedLogins(userID uint) error {
+	return table.update(userID, func(user *lq.User) error {
+		user.FailedLogins, user.LockedUntil = 0, 0
+		return nil
+	})
+}
+
+func (table *memoryUsersTable) SetPassword(userID uint, passwordHash string) error {
+	return table.update(userID, func(user *lq.User) error {
+		user.Password, user.FailedLogins, user.LockedUntil = passwordHash, 0, 0
+		return nil
+	})
+}
+
+type memoryApiKeysTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryApiKeysTable) Create(key *lq.ApiKey) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	for _, existing := range table.store.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return lq.NewErrorf(nil, "Failed creating api key %s for user %d, the key exists", key.Name, key.UserID)
+		}
+	}
+	key.Model = table.store.newModel()
+	stored := *key
+	table.store.apiKeys[key.ID] = &stored
+	return nil
+}
+
+func (table *memoryApiKeysTable) GetByHash(keyHash string) (*lq.ApiKey, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	for _, key := range table.store.apiKeys {
+		if key.KeyHash == keyHash && key.RevokedAt == 0 {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return &lq.ApiKey{}, notFound("Failed getting api key")
+}
+
+func (table *memoryApiKeysTable) GetByUser(userID uint) ([]*lq.ApiKey, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, key := range table.store.apiKeys {
+		if key.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	keys := []*lq.ApiKey{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.apiKeys[id]
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+func (table *memoryApiKeysTable) Revoke(userID, keyID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	key, ok := table.store.apiKeys[keyID]
+	if !ok || key.UserID != userID || key.RevokedAt != 0 {
+		return lq.NewErrorf(nil, "User %d has no api key %d to revoke", userID, keyID)
+	}
+	key.RevokedAt = time.Now().UTC().UnixNano()
+	return nil
+}
+
+func (table *memoryApiKeysTable) MarkUsed(keyID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if key, ok := table.store.apiKeys[keyID]; ok {
+		key.LastUsedAt = time.Now().UTC().UnixNano()
+	}
+	return nil
+}
+
+type memoryRefreshTokensTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryRefreshTokensTable) Create(token *lq.RefreshToken) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	table.create(token)
+	return nil
+}
+
+// Must be called with the mutex held
+func (table *memoryRefreshTokensTable) create(token *lq.RefreshToken) {
+	token.Model = table.store.newModel()
+	stored := *token
+	table.store.refreshTokens[token.ID] = &stored
+}
+
+func (table *memoryRefreshTokensTable) Rotate(tokenHash string, next *lq.RefreshToken) (*lq.RefreshToken, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	now := time.Now().UTC().UnixNano()
+	for _, token := range table.store.refreshTokens {
+		if token.TokenHash != tokenHash || token.RevokedAt != 0 || token.ExpiresAt <= now {
+			continue
+		}
+		token.RevokedAt = now
+		next.UserID = token.UserID
+		next.Scopes = token.Scopes
+		table.create(next)
+		used := *token
+		return &used, nil
+	}
+	return &lq.RefreshToken{}, notFound("Failed rotating refresh token")
+}
+
+func (table *memoryRefreshTokensTable) RevokeAllOfUser(userID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	now := time.Now().UTC().UnixNano()
+	for _, token := range table.store.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == 0 {
+			token.RevokedAt = now
+		}
+	}
+	return nil
+}
+
+type memoryPasswordResetsTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryPasswordResetsTable) Create(reset *lq.PasswordReset) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	reset.Model = table.store.newModel()
+	stored := *reset
+	table.store.passwordResets[reset.ID] = &stored
+	return nil
+}
+
+func (table *memoryPasswordResetsTable) Use(tokenHash string) (*lq.PasswordReset, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	now := time.Now().UTC().UnixNano()
+	for _, reset := range table.store.passwordResets {
+		if reset.TokenHash != tokenHash || reset.UsedAt != 0 || reset.ExpiresAt <= now {
+			continue
+		}
+		used := *reset
+		for _, other := range table.store.passwordResets {
+			if other.UserID == reset.UserID && other.UsedAt == 0 {
+				other.UsedAt = now
+			}
+		}
+		return &used, nil
+	}
+	return &lq.PasswordReset{}, notFound("Failed using password reset")
+}
+
+type memoryOrganizationsTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryOrganizationsTable) Create(org *lq.Organization, adminID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if table.membership(adminID) != nil {
+		return lq.NewErrorf(nil, "Failed creating organization %s, user %d is a member of another", org.Name,
+			adminID)
+	}
+	org.Model = table.store.newModel()
+	stored := *org
+	table.store.organizations[org.ID] = &stored
+	table.addMember(&lq.Membership{OrgID: org.ID, UserID: adminID, Role: lq.RoleAdmin})
+	return nil
+}
+
+func (table *memoryOrganizationsTable) Get(orgID uint) (*lq.Organization, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	org, ok := table.store.organizations[orgID]
+	if !ok {
+		return &lq.Organization{}, notFound("Failed getting organization %d", orgID)
+	}
+	copied := *org
+	return &copied, nil
+}
+
+func (table *memoryOrganizationsTable) SetAwsAccount(orgID, awsAccountID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if org, ok := table.store.organizations[orgID]; ok {
+		org.AwsAccountID = awsAccountID
+	}
+	return nil
+}
+
+// Must be called with the mutex held
+func (table *memoryOrganizationsTable) membership(userID uint) *lq.Membership {
+	for _, membership := range table.store.memberships {
+		if membership.UserID == userID {
+			return membership
+		}
+	}
+	return nil
+}
+
+func (table *memoryOrganizationsTable) GetMembership(userID uint) (*lq.Membership, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	membership := table.membership(userID)
+	if membership == nil {
+		return nil, nil
+	}
+	copied := *membership
+	return &copied, nil
+}
+
+func (table *memoryOrganizationsTable) GetMembers(orgID uint) ([]*lq.Membership, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	ids := []uint{}
+	for id, membership := range table.store.memberships {
+		if membership.OrgID == orgID {
+			ids = append(ids, id)
+		}
+	}
+	members := []*lq.Membership{}
+	for _, id := range ascending(ids) {
+		copied := *table.store.memberships[id]
+		members = append(members, &copied)
+	}
+	return members, nil
+}
+
+func (table *memoryOrganizationsTable) AddMember(membership *lq.Membership) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if table.membership(membership.UserID) != nil {
+		return lq.NewErrorf(nil, "Failed adding user %d to organization %d, they are a member already",
+			membership.UserID, membership.OrgID)
+	}
+	table.addMember(membership)
+	return nil
+}
+
+// Must be called with the mutex held
+func (table *memoryOrganizationsTable) addMember(membership *lq.Membership) {
+	membership.Model = table.store.newModel()
+	stored := *membership
+	table.store.memberships[membership.ID] = &stored
+}
+
+func (table *memoryOrganizationsTable) SetRole(orgID, userID uint, role string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	membership := table.membership(userID)
+	if membership == nil || membership.OrgID != orgID {
+		return lq.NewErrorf(nil, "User %d is not a member", userID)
+	}
+	previous := membership.Role
+	membership.Role = role
+	if !table.hasAdmin(orgID) {
+		membership.Role = previous
+		return lq.NewErrorf(nil, "Organization %d must keep an admin", orgID)
+	}
+	return nil
+}
+
+func (table *memoryOrganizationsTable) RemoveMember(orgID, userID uint) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	membership := table.membership(userID)
+	if membership == nil || membership.OrgID != orgID {
+		return lq.NewErrorf(nil, "User %d is not a member", userID)
+	}
+	delete(table.store.memberships, membership.ID)
+	if !table.hasAdmin(orgID) {
+		table.store.memberships[membership.ID] = membership
+		return lq.NewErrorf(nil, "Organization %d must keep an admin", orgID)
+	}
+	return nil
+}
+
+// Must be called with the mutex held
+func (table *memoryOrganizationsTable) hasAdmin(orgID uint) bool {
+	for _, membership := range table.store.memberships {
+		if membership.OrgID == orgID && membership.Role == lq.RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryMesosTable struct {
+	store *MemoryStore
+}
+
+func (table *memoryMesosTable) SetFrameworkId(frameworkId string) error {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	if table.store.frameworkID != "" {
+		return lq.NewErrorf(nil, "Framework id already exists")
+	}
+	table.store.frameworkID = frameworkId
+	return nil
+}
+
+func (table *memoryMesosTable) GetFrameworkId() (string, error) {
+	table.store.mutex.Lock()
+	defer table.store.mutex.Unlock()
+
+	return table.store.frameworkID, nil
+}
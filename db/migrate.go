@@ -0,0 +1,271 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+
+	"bargain/liquefy/common"
+	"bargain/liquefy/db/migrations"
+	lq "bargain/liquefy/models"
+)
+
+// Key of the postgres advisory lock taken while migrating, so that migrations run at the same time wait on each other
+const migrationLockKey = 7369806
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil when pending
+}
+
+// Migrations are applied in a transaction each, along with recording their version in schema_migrations. They only
+// go forward in production, down and reset are meant for development databases.
+type MigrationsTable interface {
+	Up() ([]*migrations.Migration, error)
+	Down() (*migrations.Migration, error)
+	Status() ([]*MigrationStatus, error)
+	Version() (int, error)
+	Baseline() error
+	Reset() error
+}
+
+type migrationsTable struct{}
+
+func Migrations() MigrationsTable {
+	return &migrationsTable{}
+}
+
+type schemaMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (table *migrationsTable) createVersionTable() error {
+	query := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamp with time zone NOT NULL
+	)`)
+	if query.Error != nil {
+		return lq.NewErrorf(query.Error, "Failed creating schema_migrations")
+	}
+	return nil
+}
+
+func (table *migrationsTable) applied(tx *gorm.DB) ([]*schemaMigration, error) {
+	applied := []*schemaMigration{}
+	query := tx.Table("schema_migrations").Order("version").Find(&applied)
+	if query.Error != nil {
+		return applied, lq.NewErrorf(query.Error, "Failed getting applied migrations")
+	}
+	return applied, nil
+}
+
+func (table *migrationsTable) isApplied(tx *gorm.DB, version int) (bool, error) {
+	count := 0
+	query := tx.Table("schema_migrations").Where("version = ?", version).Count(&count)
+	if query.Error != nil {
+		return false, lq.NewErrorf(query.Error, "Failed checking migration %d", version)
+	}
+	return count > 0, nil
+}
+
+// Whether the tables were created by initDB.go, before migrations
+func (table *migrationsTable) hasLegacySchema() (bool, error) {
+	count := 0
+	row := db.Raw("SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() "+
+		"AND table_name = ?", "user").Row()
+	if err := row.Scan(&count); err != nil {
+		return false, lq.NewErrorf(err, "Failed checking for tables created without migrations")
+	}
+	return count > 0, nil
+}
+
+// The version of the last applied migration, 0 if none is
+func (table *migrationsTable) Version() (int, error) {
+	if err := table.createVersionTable(); err != nil {
+		return 0, err
+	}
+	applied, err := table.applied(&db)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Applies the pending migrations in order, returning those applied
+func (table *migrationsTable) Up() ([]*migrations.Migration, error) {
+	applied := []*migrations.Migration{}
+	all := migrations.All()
+	if err := migrations.Validate(all); err != nil {
+		return applied, lq.NewErrorf(err, "Invalid migrations")
+	}
+
+	version, err := table.Version()
+	if err != nil {
+		return applied, err
+	}
+	if version == 0 {
+		legacy, err := table.hasLegacySchema()
+		if err != nil {
+			return applied, err
+		}
+		if legacy {
+			return applied, lq.NewErrorf(nil, "The database was created without migrations, baseline it first")
+		}
+	}
+
+	for _, migration := range all {
+		if migration.Version <= version {
+			continue
+		}
+		ran, err := table.apply(migration)
+		if err != nil {
+			return applied, err
+		}
+		if ran {
+			log.Infof("Applied migration %s", migration)
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Runs the up script of a migration, unless another process applied it while waiting on the lock
+func (table *migrationsTable) apply(migration *migrations.Migration) (ran bool, err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed applying migration %s", migration)
+
+	if err = tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+		return
+	}
+	var applied bool
+	if applied, err = table.isApplied(tx, migration.Version); err != nil || applied {
+		return
+	}
+	if err = tx.Exec(migration.Up).Error; err != nil {
+		return
+	}
+	err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Name, time.Now()).Error
+	return err == nil, err
+}
+
+// Reverts the last applied migration, returning it
+func (table *migrationsTable) Down() (migration *migrations.Migration, err error) {
+	if common.IsProductionDeployment() {
+		return nil, lq.NewErrorf(nil, "Migrations are not reverted in production, add a migration instead")
+	}
+	version, err := table.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, lq.NewErrorf(nil, "No migration to revert")
+	}
+	migration = migrations.Get(version)
+	if migration == nil {
+		return nil, lq.NewErrorf(nil, "Migration %d is unknown to this version of liquefy", version)
+	}
+	if !migration.IsReversible() {
+		return nil, lq.NewErrorf(nil, "Migration %s cannot be reverted", migration)
+	}
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed reverting migration %s", migration)
+
+	if err = tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+		return
+	}
+	if err = tx.Exec(migration.Down).Error; err != nil {
+		return
+	}
+	err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+	return
+}
+
+// Every known migration along with when it was applied, followed by migrations applied by a newer version of
+// liquefy
+func (table *migrationsTable) Status() ([]*MigrationStatus, error) {
+	statuses := []*MigrationStatus{}
+	if err := table.createVersionTable(); err != nil {
+		return statuses, err
+	}
+	applied, err := table.applied(&db)
+	if err != nil {
+		return statuses, err
+	}
+
+	appliedAt := map[int]time.Time{}
+	for _, migration := range applied {
+		appliedAt[migration.Version] = migration.AppliedAt
+	}
+	for _, migration := range migrations.All() {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	for _, migration := range applied {
+		if migrations.Get(migration.Version) == nil {
+			at := migration.AppliedAt
+			statuses = append(statuses, &MigrationStatus{Version: migration.Version, Name: migration.Name, AppliedAt: &at})
+		}
+	}
+	return statuses, nil
+}
+
+// Records the initial schema as applied without running it, for databases created by initDB.go
+func (table *migrationsTable) Baseline() error {
+	version, err := table.Version()
+	if err != nil {
+		return err
+	}
+	if version != 0 {
+		return lq.NewErrorf(nil, "The database is already at version %d", version)
+	}
+	initial := migrations.Get(1)
+	query := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		initial.Version, initial.Name, time.Now())
+	if query.Error != nil {
+		return lq.NewErrorf(query.Error, "Failed baselining the database")
+	}
+	return nil
+}
+
+// Drops every table of the schema, including schema_migrations, so that the next Up starts from an empty database
+func (table *migrationsTable) Reset() (err error) {
+	if common.IsProductionDeployment() {
+		return lq.NewErrorf(nil, "The database is not reset in production")
+	}
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed resetting the database")
+
+	tables := []string{}
+	rows, err := tx.Raw("SELECT table_name FROM information_schema.tables " +
+		"WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'").Rows()
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	for _, name := range tables {
+		if err = tx.Exec(`DROP TABLE "` + name + `" CASCADE`).Error; err != nil {
+			return
+		}
+	}
+	return
+}
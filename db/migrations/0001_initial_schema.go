@@ -0,0 +1,362 @@
+package migrations
+
+// The schema initDB.go created, so that existing databases can be baselined at this version
+func init() {
+	register(&Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: `
+CREATE TABLE "user" (
+	id serial PRIMARY KEY,
+	api_key varchar(255),
+	username varchar(255),
+	password varchar(255),
+	firstname varchar(255),
+	lastname varchar(255),
+	email varchar(255),
+	public_id varchar(255),
+	aws_account_id integer,
+	github_oauth_token varchar(255),
+	bitbucket_oauth_token varchar(255),
+	bitbucket_refresh_token varchar(255),
+	failed_logins integer,
+	locked_until bigint
+);
+
+CREATE TABLE api_key (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	name varchar(255) NOT NULL,
+	prefix varchar(255),
+	key_hash varchar(255) NOT NULL,
+	scopes varchar(255),
+	last_used_at bigint,
+	revoked_at bigint
+);
+CREATE INDEX idx_api_key_deleted_at ON api_key (deleted_at);
+CREATE INDEX idx_api_key_user_id ON api_key (user_id);
+CREATE UNIQUE INDEX uix_api_key_key_hash ON api_key (key_hash);
+
+CREATE TABLE refresh_token (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	token_hash varchar(255) NOT NULL,
+	scopes varchar(255),
+	expires_at bigint,
+	revoked_at bigint
+);
+CREATE INDEX idx_refresh_token_deleted_at ON refresh_token (deleted_at);
+CREATE INDEX idx_refresh_token_user_id ON refresh_token (user_id);
+CREATE UNIQUE INDEX uix_refresh_token_token_hash ON refresh_token (token_hash);
+
+CREATE TABLE password_reset (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	token_hash varchar(255) NOT NULL,
+	expires_at bigint,
+	used_at bigint
+);
+CREATE INDEX idx_password_reset_deleted_at ON password_reset (deleted_at);
+CREATE INDEX idx_password_reset_user_id ON password_reset (user_id);
+CREATE UNIQUE INDEX uix_password_reset_token_hash ON password_reset (token_hash);
+
+CREATE TABLE organization (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	name varchar(255) NOT NULL,
+	aws_account_id integer
+);
+CREATE INDEX idx_organization_deleted_at ON organization (deleted_at);
+
+CREATE TABLE membership (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	org_id integer NOT NULL,
+	user_id integer NOT NULL,
+	role varchar(255) NOT NULL
+);
+CREATE INDEX idx_membership_deleted_at ON membership (deleted_at);
+CREATE INDEX idx_membership_org_id ON membership (org_id);
+CREATE UNIQUE INDEX uix_membership_user_id ON membership (user_id);
+
+CREATE TABLE secret (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	owner_id integer NOT NULL,
+	name varchar(255) NOT NULL,
+	value text NOT NULL
+);
+CREATE INDEX idx_secret_deleted_at ON secret (deleted_at);
+CREATE UNIQUE INDEX idx_secret_owner_name ON secret (owner_id, name);
+
+CREATE TABLE webhook (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	owner_id integer NOT NULL,
+	org_id integer,
+	url text NOT NULL,
+	event_types varchar(255),
+	secret text NOT NULL
+);
+CREATE INDEX idx_webhook_deleted_at ON webhook (deleted_at);
+CREATE INDEX idx_webhook_owner_id ON webhook (owner_id);
+CREATE INDEX idx_webhook_org_id ON webhook (org_id);
+
+CREATE TABLE webhook_delivery (
+	id serial PRIMARY KEY,
+	webhook_id integer NOT NULL,
+	event_id varchar(255) NOT NULL,
+	event_type varchar(255),
+	status varchar(255),
+	attempts integer,
+	response_code integer,
+	error text,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone
+);
+CREATE UNIQUE INDEX idx_delivery_webhook_event ON webhook_delivery (webhook_id, event_id);
+
+CREATE TABLE idempotency_key (
+	id serial PRIMARY KEY,
+	user_id integer NOT NULL,
+	key varchar(255) NOT NULL,
+	request_hash varchar(255) NOT NULL,
+	job_ids text NOT NULL,
+	created_at timestamp with time zone
+);
+CREATE UNIQUE INDEX idx_idempotency_user_key ON idempotency_key (user_id, key);
+CREATE INDEX idx_idempotency_key_created_at ON idempotency_key (created_at);
+
+CREATE TABLE quota (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	max_active_jobs integer,
+	max_instances integer,
+	max_v_cpus numeric,
+	monthly_budget numeric
+);
+CREATE INDEX idx_quota_deleted_at ON quota (deleted_at);
+CREATE UNIQUE INDEX uix_quota_user_id ON quota (user_id);
+
+CREATE TABLE audit_entry (
+	id serial PRIMARY KEY,
+	time bigint NOT NULL,
+	actor_type varchar(255) NOT NULL,
+	actor_id integer,
+	actor_name varchar(255),
+	user_id integer,
+	org_id integer,
+	ip varchar(255),
+	request_id varchar(255),
+	action varchar(255) NOT NULL,
+	target_type varchar(255),
+	target_id varchar(255),
+	outcome varchar(255) NOT NULL,
+	status integer,
+	detail text
+);
+CREATE INDEX idx_audit_entry_time ON audit_entry (time);
+CREATE INDEX idx_audit_entry_user_id ON audit_entry (user_id);
+CREATE INDEX idx_audit_entry_org_id ON audit_entry (org_id);
+CREATE INDEX idx_audit_entry_request_id ON audit_entry (request_id);
+CREATE INDEX idx_audit_entry_action ON audit_entry (action);
+-- The audit log is append only
+CREATE RULE audit_entry_no_update AS ON UPDATE TO audit_entry DO INSTEAD NOTHING;
+CREATE RULE audit_entry_no_delete AS ON DELETE TO audit_entry DO INSTEAD NOTHING;
+
+CREATE TABLE container_job_group (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	name varchar(255),
+	owner_id integer,
+	status varchar(255),
+	mode varchar(255)
+);
+CREATE INDEX idx_container_job_group_deleted_at ON container_job_group (deleted_at);
+
+CREATE TABLE container_job (
+	id serial PRIMARY KEY,
+	name varchar(255),
+	command varchar(255),
+	owner_id integer,
+	org_id integer,
+	status varchar(255),
+	source_image varchar(255),
+	source_type varchar(255),
+	environment varchar(255),
+	secrets varchar(255),
+	port_mappings varchar(255),
+	assigned_ports varchar(255),
+	kind varchar(255),
+	health_check varchar(255),
+	max_restarts integer,
+	source_branch varchar(255),
+	source_commit varchar(255),
+	source_dir varchar(255),
+	dockerfile varchar(255),
+	build_registry varchar(255),
+	ram integer,
+	cpu numeric,
+	gpu integer,
+	disk integer,
+	instance_store boolean,
+	instance_id integer,
+	container_id varchar(255),
+	retry_count integer,
+	restarts integer,
+	healthy boolean,
+	user_terminated boolean,
+	start_time bigint,
+	end_time bigint,
+	total_cost numeric,
+	output varchar(255),
+	begin_delimiter varchar(255),
+	end_delimiter varchar(255)
+);
+
+CREATE TABLE resource_instance (
+	id serial PRIMARY KEY,
+	owner_id integer,
+	org_id integer,
+	ram_total integer,
+	ram_used integer,
+	cpu_total numeric,
+	cpu_used numeric,
+	gpu_total integer,
+	gpu_used integer,
+	disk_total integer,
+	disk_used integer,
+	status varchar(255),
+	launch_time bigint,
+	ip varchar(255),
+	slave_id varchar(255),
+	user_terminated boolean,
+	aws_instance_id varchar(255),
+	aws_availability_zone varchar(255),
+	aws_instance_type varchar(255),
+	aws_spot_price numeric,
+	aws_volume_size integer,
+	aws_instance_store boolean
+);
+
+CREATE TABLE container_job_tracker (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	container_job_id integer NOT NULL,
+	time bigint NOT NULL,
+	instance_id integer,
+	status varchar(255) NOT NULL,
+	attempt integer NOT NULL,
+	msg varchar(255) NOT NULL
+);
+CREATE INDEX idx_container_job_tracker_deleted_at ON container_job_tracker (deleted_at);
+
+CREATE TABLE container_job_build_log (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	container_job_id integer NOT NULL,
+	attempt integer NOT NULL,
+	log text
+);
+CREATE INDEX idx_container_job_build_log_deleted_at ON container_job_build_log (deleted_at);
+
+-- x_x_x__unrecognized is the column gorm maps the XXX_unrecognized field of the protobuf message to
+CREATE TABLE aws_account (
+	id serial PRIMARY KEY,
+	aws_access_key varchar(255),
+	aws_secret_key varchar(255),
+	aws_vpc_id_us_east1 varchar(255),
+	aws_ssh_private_key_us_east1 text UNIQUE,
+	aws_security_group_name_us_east1 varchar(255),
+	aws_security_group_id_us_east1 varchar(255),
+	aws_subnet_id_us_east1_a varchar(255),
+	aws_subnet_id_us_east1_b varchar(255),
+	aws_subnet_id_us_east1_c varchar(255),
+	aws_subnet_id_us_east1_d varchar(255),
+	aws_subnet_id_us_east1_e varchar(255),
+	aws_vpc_id_us_west1 varchar(255),
+	aws_ssh_private_key_us_west1 text UNIQUE,
+	aws_security_group_name_us_west1 varchar(255),
+	aws_security_group_id_us_west1 varchar(255),
+	aws_subnet_id_us_west1_a varchar(255),
+	aws_subnet_id_us_west1_b varchar(255),
+	aws_subnet_id_us_west1_c varchar(255),
+	aws_subnet_id_us_west1_d varchar(255),
+	aws_subnet_id_us_west1_e varchar(255),
+	aws_vpc_id_us_west2 varchar(255),
+	aws_ssh_private_key_us_west2 text UNIQUE,
+	aws_security_group_name_us_west2 varchar(255),
+	aws_security_group_id_us_west2 varchar(255),
+	aws_subnet_id_us_west2_a varchar(255),
+	aws_subnet_id_us_west2_b varchar(255),
+	aws_subnet_id_us_west2_c varchar(255),
+	aws_subnet_id_us_west2_d varchar(255),
+	aws_subnet_id_us_west2_e varchar(255),
+	error varchar(255),
+	aws_role_arn varchar(255),
+	aws_external_id varchar(255),
+	x_x_x__unrecognized bytea
+);
+
+CREATE TABLE resource_events (
+	id serial PRIMARY KEY,
+	instance_id integer NOT NULL,
+	status varchar(255) NOT NULL,
+	time bigint NOT NULL,
+	msg varchar(1024) NOT NULL
+);
+
+CREATE TABLE mesos_info (
+	framework_id varchar(1024) UNIQUE NOT NULL
+);
+`,
+		Down: `
+DROP TABLE mesos_info;
+DROP TABLE resource_events;
+DROP TABLE aws_account;
+DROP TABLE container_job_build_log;
+DROP TABLE container_job_tracker;
+DROP TABLE resource_instance;
+DROP TABLE container_job;
+DROP TABLE container_job_group;
+DROP TABLE audit_entry;
+DROP TABLE quota;
+DROP TABLE idempotency_key;
+DROP TABLE webhook_delivery;
+DROP TABLE webhook;
+DROP TABLE secret;
+DROP TABLE membership;
+DROP TABLE organization;
+DROP TABLE password_reset;
+DROP TABLE refresh_token;
+DROP TABLE api_key;
+DROP TABLE "user";
+`,
+	})
+}
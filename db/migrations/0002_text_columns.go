@@ -0,0 +1,29 @@
+package migrations
+
+// Json encoded job fields and envelope encrypted aws credentials do not fit in varchar(255). The ssh key columns are
+// already text in databases created after envelope encryption.
+func init() {
+	register(&Migration{
+		Version: 2,
+		Name:    "text_columns",
+		Up: `
+ALTER TABLE container_job
+	ALTER COLUMN command TYPE text,
+	ALTER COLUMN environment TYPE text,
+	ALTER COLUMN secrets TYPE text,
+	ALTER COLUMN port_mappings TYPE text,
+	ALTER COLUMN assigned_ports TYPE text,
+	ALTER COLUMN health_check TYPE text,
+	ALTER COLUMN output TYPE text;
+
+ALTER TABLE aws_account
+	ALTER COLUMN aws_access_key TYPE text,
+	ALTER COLUMN aws_secret_key TYPE text,
+	ALTER COLUMN aws_ssh_private_key_us_east1 TYPE text,
+	ALTER COLUMN aws_ssh_private_key_us_west1 TYPE text,
+	ALTER COLUMN aws_ssh_private_key_us_west2 TYPE text;
+`,
+		// Narrowing the columns back would truncate values
+		Down: "",
+	})
+}
@@ -0,0 +1,98 @@
+package migrations
+
+// Moves the vpc, security group, ssh key and subnets of the us-east-1, us-west-1 and us-west-2 columns of aws_account
+// into a row per region and per availability zone, so that supporting a region does not change the schema. Ssh keys
+// are moved as stored, which is plaintext for accounts set up before they were encrypted: they are read as legacy
+// plaintext until AwsAccounts().ReencryptAll encrypts them.
+func init() {
+	register(&Migration{
+		Version: 3,
+		Name:    "aws_account_regions",
+		Up: `
+CREATE TABLE aws_account_region (
+	id serial PRIMARY KEY,
+	aws_account_id integer NOT NULL,
+	region varchar(255) NOT NULL,
+	vpc_id varchar(255),
+	security_group_id varchar(255),
+	security_group_name varchar(255),
+	ssh_private_key text UNIQUE,
+	x_x_x__unrecognized bytea
+);
+CREATE UNIQUE INDEX idx_aws_account_region ON aws_account_region (aws_account_id, region);
+
+CREATE TABLE aws_subnet (
+	id serial PRIMARY KEY,
+	aws_account_region_id integer NOT NULL,
+	availability_zone varchar(255) NOT NULL,
+	subnet_id varchar(255),
+	x_x_x__unrecognized bytea
+);
+CREATE UNIQUE INDEX idx_aws_subnet_zone ON aws_subnet (aws_account_region_id, availability_zone);
+
+INSERT INTO aws_account_region (aws_account_id, region, vpc_id, security_group_id, security_group_name, ssh_private_key)
+SELECT account.id, region.* FROM aws_account account CROSS JOIN LATERAL (VALUES
+	('us-east-1', account.aws_vpc_id_us_east1, account.aws_security_group_id_us_east1,
+		account.aws_security_group_name_us_east1, account.aws_ssh_private_key_us_east1),
+	('us-west-1', account.aws_vpc_id_us_west1, account.aws_security_group_id_us_west1,
+		account.aws_security_group_name_us_west1, account.aws_ssh_private_key_us_west1),
+	('us-west-2', account.aws_vpc_id_us_west2, account.aws_security_group_id_us_west2,
+		account.aws_security_group_name_us_west2, account.aws_ssh_private_key_us_west2)
+) AS region (region, vpc_id, security_group_id, security_group_name, ssh_private_key)
+WHERE COALESCE(region.vpc_id, region.security_group_id, region.ssh_private_key) IS NOT NULL;
+
+INSERT INTO aws_subnet (aws_account_region_id, availability_zone, subnet_id)
+SELECT region.id, zone.availability_zone, zone.subnet_id FROM aws_account account
+JOIN aws_account_region region ON region.aws_account_id = account.id
+CROSS JOIN LATERAL (VALUES
+	('us-east-1a', account.aws_subnet_id_us_east1_a),
+	('us-east-1b', account.aws_subnet_id_us_east1_b),
+	('us-east-1c', account.aws_subnet_id_us_east1_c),
+	('us-east-1d', account.aws_subnet_id_us_east1_d),
+	('us-east-1e', account.aws_subnet_id_us_east1_e),
+	('us-west-1a', account.aws_subnet_id_us_west1_a),
+	('us-west-1b', account.aws_subnet_id_us_west1_b),
+	('us-west-1c', account.aws_subnet_id_us_west1_c),
+	('us-west-1d', account.aws_subnet_id_us_west1_d),
+	('us-west-1e', account.aws_subnet_id_us_west1_e),
+	('us-west-2a', account.aws_subnet_id_us_west2_a),
+	('us-west-2b', account.aws_subnet_id_us_west2_b),
+	('us-west-2c', account.aws_subnet_id_us_west2_c),
+	('us-west-2d', account.aws_subnet_id_us_west2_d),
+	('us-west-2e', account.aws_subnet_id_us_west2_e)
+) AS zone (availability_zone, subnet_id)
+WHERE region.region = left(zone.availability_zone, -1) AND zone.subnet_id <> '';
+
+ALTER TABLE aws_account
+	DROP COLUMN aws_vpc_id_us_east1,
+	DROP COLUMN aws_ssh_private_key_us_east1,
+	DROP COLUMN aws_security_group_name_us_east1,
+	DROP COLUMN aws_security_group_id_us_east1,
+	DROP COLUMN aws_subnet_id_us_east1_a,
+	DROP COLUMN aws_subnet_id_us_east1_b,
+	DROP COLUMN aws_subnet_id_us_east1_c,
+	DROP COLUMN aws_subnet_id_us_east1_d,
+	DROP COLUMN aws_subnet_id_us_east1_e,
+	DROP COLUMN aws_vpc_id_us_west1,
+	DROP COLUMN aws_ssh_private_key_us_west1,
+	DROP COLUMN aws_security_group_name_us_west1,
+	DROP COLUMN aws_security_group_id_us_west1,
+	DROP COLUMN aws_subnet_id_us_west1_a,
+	DROP COLUMN aws_subnet_id_us_west1_b,
+	DROP COLUMN aws_subnet_id_us_west1_c,
+	DROP COLUMN aws_subnet_id_us_west1_d,
+	DROP COLUMN aws_subnet_id_us_west1_e,
+	DROP COLUMN aws_vpc_id_us_west2,
+	DROP COLUMN aws_ssh_private_key_us_west2,
+	DROP COLUMN aws_security_group_name_us_west2,
+	DROP COLUMN aws_security_group_id_us_west2,
+	DROP COLUMN aws_subnet_id_us_west2_a,
+	DROP COLUMN aws_subnet_id_us_west2_b,
+	DROP COLUMN aws_subnet_id_us_west2_c,
+	DROP COLUMN aws_subnet_id_us_west2_d,
+	DROP COLUMN aws_subnet_id_us_west2_e;
+`,
+		// Regions added since cannot be moved back into columns
+		Down: "",
+	})
+}
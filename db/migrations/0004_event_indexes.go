@@ -0,0 +1,17 @@
+package migrations
+
+// The status history of a job or an instance is read in time order by the timeline api
+func init() {
+	register(&Migration{
+		Version: 4,
+		Name:    "event_indexes",
+		Up: `
+CREATE INDEX idx_container_job_tracker_job ON container_job_tracker (container_job_id, time);
+CREATE INDEX idx_resource_events_instance ON resource_events (instance_id, time);
+`,
+		Down: `
+DROP INDEX idx_resource_events_instance;
+DROP INDEX idx_container_job_tracker_job;
+`,
+	})
+}
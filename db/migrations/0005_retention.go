@@ -0,0 +1,45 @@
+package migrations
+
+// Retention policies of users and organizations, and the archives their history is moved to
+func init() {
+	register(&Migration{
+		Version: 5,
+		Name:    "retention",
+		Up: `
+CREATE TABLE retention_policy (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id integer NOT NULL,
+	org_id integer NOT NULL,
+	archive_after_days integer NOT NULL
+);
+CREATE INDEX idx_retention_policy_deleted_at ON retention_policy (deleted_at);
+CREATE UNIQUE INDEX idx_retention_policy_scope ON retention_policy (user_id, org_id);
+
+CREATE TABLE archive_file (
+	id serial PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	key varchar(255) NOT NULL UNIQUE,
+	owner_id integer NOT NULL,
+	org_id integer NOT NULL,
+	jobs integer,
+	instances integer,
+	archived_before bigint
+);
+CREATE INDEX idx_archive_file_deleted_at ON archive_file (deleted_at);
+CREATE INDEX idx_archive_file_owner_id ON archive_file (owner_id);
+CREATE INDEX idx_archive_file_org_id ON archive_file (org_id);
+
+CREATE INDEX idx_container_job_end_time ON container_job (end_time);
+`,
+		Down: `
+DROP INDEX idx_container_job_end_time;
+DROP TABLE archive_file;
+DROP TABLE retention_policy;
+`,
+	})
+}
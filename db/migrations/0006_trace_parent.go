@@ -0,0 +1,17 @@
+package migrations
+
+// Jobs and the resources provisioned for them carry the trace their lifecycle is recorded in
+func init() {
+	register(&Migration{
+		Version: 6,
+		Name:    "trace_parent",
+		Up: `
+ALTER TABLE container_job ADD COLUMN trace_parent varchar(55) NOT NULL DEFAULT '';
+ALTER TABLE resource_instance ADD COLUMN trace_parent varchar(55) NOT NULL DEFAULT '';
+`,
+		Down: `
+ALTER TABLE resource_instance DROP COLUMN trace_parent;
+ALTER TABLE container_job DROP COLUMN trace_parent;
+`,
+	})
+}
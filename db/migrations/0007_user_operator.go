@@ -0,0 +1,15 @@
+package migrations
+
+// Operators of Liquefy are granted the admin scope, which manages the quotas of every user
+func init() {
+	register(&Migration{
+		Version: 7,
+		Name:    "user_operator",
+		Up: `
+ALTER TABLE "user" ADD COLUMN operator boolean NOT NULL DEFAULT false;
+`,
+		Down: `
+ALTER TABLE "user" DROP COLUMN operator;
+`,
+	})
+}
@@ -0,0 +1,22 @@
+package migrations
+
+// Pending webhook deliveries keep their payload and when to attempt them next, so that retries survive restarts.
+// Deliveries left pending before were retried in memory by an api server, so their retries are lost.
+func init() {
+	register(&Migration{
+		Version: 8,
+		Name:    "webhook_retries",
+		Up: `
+ALTER TABLE webhook_delivery
+	ADD COLUMN payload text NOT NULL DEFAULT '',
+	ADD COLUMN next_attempt_at bigint NOT NULL DEFAULT 0;
+CREATE INDEX idx_delivery_due ON webhook_delivery (status, next_attempt_at);
+
+UPDATE webhook_delivery SET status = 'failed', error = 'Retries lost when upgrading' WHERE status = 'pending';
+`,
+		Down: `
+DROP INDEX idx_delivery_due;
+ALTER TABLE webhook_delivery DROP COLUMN next_attempt_at, DROP COLUMN payload;
+`,
+	})
+}
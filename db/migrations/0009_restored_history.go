@@ -0,0 +1,17 @@
+package migrations
+
+// History restored from an archive records when, so that it is only archived again once it expires anew
+func init() {
+	register(&Migration{
+		Version: 9,
+		Name:    "restored_history",
+		Up: `
+ALTER TABLE container_job ADD COLUMN restored_at bigint NOT NULL DEFAULT 0;
+ALTER TABLE resource_instance ADD COLUMN restored_at bigint NOT NULL DEFAULT 0;
+`,
+		Down: `
+ALTER TABLE resource_instance DROP COLUMN restored_at;
+ALTER TABLE container_job DROP COLUMN restored_at;
+`,
+	})
+}
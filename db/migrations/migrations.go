@@ -0,0 +1,66 @@
+// Package migrations holds the versioned sql migrations of the liquefy schema. Each migration is a go file, so that
+// they are compiled into every binary. Released migrations are never edited: change the schema with a new migration.
+package migrations
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when the migration cannot be reverted
+}
+
+func (migration *Migration) IsReversible() bool {
+	return migration.Down != ""
+}
+
+func (migration *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", migration.Version, migration.Name)
+}
+
+var registered = []*Migration{}
+
+func register(migration *Migration) {
+	registered = append(registered, migration)
+}
+
+type byVersion []*Migration
+
+func (list byVersion) Len() int           { return len(list) }
+func (list byVersion) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list byVersion) Less(i, j int) bool { return list[i].Version < list[j].Version }
+
+// Every migration, in the order they are applied
+func All() []*Migration {
+	sorted := make([]*Migration, len(registered))
+	copy(sorted, registered)
+	sort.Sort(byVersion(sorted))
+	return sorted
+}
+
+// Get the migration of a version, nil if there is none
+func Get(version int) *Migration {
+	for _, migration := range registered {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+// Checks that versions start at 1 and follow each other, so that two branches adding the same version conflict
+func Validate(migrations []*Migration) error {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return fmt.Errorf("Migration %s should have version %d", migration, i+1)
+		}
+		if migration.Name == "" || migration.Up == "" {
+			return fmt.Errorf("Migration %s has no name or no up script", migration)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisteredMigrationsAreValid(t *testing.T) {
+	assert.Nil(t, Validate(All()))
+}
+
+func TestValidate(t *testing.T) {
+	first := &Migration{Version: 1, Name: "first", Up: "CREATE TABLE a (id integer)"}
+	second := &Migration{Version: 2, Name: "second", Up: "CREATE TABLE b (id integer)"}
+	third := &Migration{Version: 3, Name: "third", Up: "CREATE TABLE c (id integer)"}
+
+	assert.Nil(t, Validate([]*Migration{first, second, third}))
+	assert.NotNil(t, Validate([]*Migration{second, third}))                      // does not start at 1
+	assert.NotNil(t, Validate([]*Migration{first, third}))                       // gap
+	assert.NotNil(t, Validate([]*Migration{first, second, second}))              // duplicate version
+	assert.NotNil(t, Validate([]*Migration{first, {Version: 2, Name: "empty"}})) // no up script
+}
+
+func TestAllIsSorted(t *testing.T) {
+	all := All()
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i-1].Version < all[i].Version)
+	}
+	assert.Equal(t, all[0], Get(1))
+	assert.Nil(t, Get(len(all)+1))
+}
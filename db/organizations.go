@@ -0,0 +1,143 @@
+package db
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+
+	lq "bargain/liquefy/models"
+)
+
+type OrganizationsTable interface {
+	Create(org *lq.Organization, adminID uint) error
+	Get(orgID uint) (*lq.Organization, error)
+	SetAwsAccount(orgID, awsAccountID uint) error
+
+	GetMembership(userID uint) (*lq.Membership, error)
+	GetMembers(orgID uint) ([]*lq.Membership, error)
+	AddMember(membership *lq.Membership) error
+	SetRole(orgID, userID uint, role string) error
+	RemoveMember(orgID, userID uint) error
+}
+
+type organizationsTable struct{}
+
+func Organizations() OrganizationsTable {
+	return &organizationsTable{}
+}
+
+// Creates the organization with the user creating it as its first admin
+func (table *organizationsTable) Create(org *lq.Organization, adminID uint) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed creating organization %s", org.Name)
+
+	if err = tx.Create(org).Error; err != nil {
+		return
+	}
+	err = tx.Create(&lq.Membership{OrgID: org.ID, UserID: adminID, Role: lq.RoleAdmin}).Error
+	return
+}
+
+func (table *organizationsTable) Get(orgID uint) (*lq.Organization, error) {
+	var org lq.Organization
+	query := db.Find(&org, orgID)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting organization %d", orgID)
+		log.Error(err)
+		return &org, err
+	}
+	return &org, nil
+}
+
+func (table *organizationsTable) SetAwsAccount(orgID, awsAccountID uint) error {
+	query := db.Model(&lq.Organization{}).Where("id = ?", orgID).UpdateColumn("aws_account_id", awsAccountID)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed setting aws account of organization %d", orgID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Get the membership of the user, nil when the user does not belong to an organization
+func (table *organizationsTable) GetMembership(userID uint) (*lq.Membership, error) {
+	var membership lq.Membership
+	query := db.Where("user_id = ?", userID).First(&membership)
+	if query.RecordNotFound() {
+		return nil, nil
+	}
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting membership of user %d", userID)
+		log.Error(err)
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (table *organizationsTable) GetMembers(orgID uint) ([]*lq.Membership, error) {
+	members := []*lq.Membership{}
+	query := db.Where("org_id = ?", orgID).Order("id").Find(&members)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting members of organization %d", orgID)
+		log.Error(err)
+		return members, err
+	}
+	return members, nil
+}
+
+func (table *organizationsTable) AddMember(membership *lq.Membership) error {
+	query := db.Create(membership)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed adding user %d to organization %d", membership.UserID,
+			membership.OrgID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Changes the role of a member. An organization always keeps at least one admin.
+func (table *organizationsTable) SetRole(orgID, userID uint, role string) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed setting role of user %d in organization %d", userID, orgID)
+
+	query := tx.Model(&lq.Membership{}).Where("org_id = ? AND user_id = ?", orgID, userID).UpdateColumn("role", role)
+	if err = query.Error; err != nil {
+		return
+	}
+	if query.RowsAffected == 0 {
+		err = lq.NewErrorf(nil, "User %d is not a member", userID)
+		return
+	}
+	err = ensureAdminRemains(tx, orgID)
+	return
+}
+
+// Removes a member. An organization always keeps at least one admin.
+func (table *organizationsTable) RemoveMember(orgID, userID uint) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed removing user %d from organization %d", userID, orgID)
+
+	// Memberships are deleted for good, so that the user can join an organization again
+	query := tx.Unscoped().Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&lq.Membership{})
+	if err = query.Error; err != nil {
+		return
+	}
+	if query.RowsAffected == 0 {
+		err = lq.NewErrorf(nil, "User %d is not a member", userID)
+		return
+	}
+	err = ensureAdminRemains(tx, orgID)
+	return
+}
+
+func ensureAdminRemains(tx *gorm.DB, orgID uint) error {
+	var admins int
+	query := tx.Model(&lq.Membership{}).Where("org_id = ? AND role = ?", orgID, lq.RoleAdmin).Count(&admins)
+	if query.Error != nil {
+		return query.Error
+	}
+	if admins == 0 {
+		return lq.NewErrorf(nil, "Organization %d must keep an admin", orgID)
+	}
+	return nil
+}
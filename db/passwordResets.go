@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+type PasswordResetsTable interface {
+	Create(reset *lq.PasswordReset) error
+	Use(tokenHash string) (*lq.PasswordReset, error)
+}
+
+type passwordResetsTable struct{}
+
+func PasswordResets() PasswordResetsTable {
+	return &passwordResetsTable{}
+}
+
+func (table *passwordResetsTable) Create(reset *lq.PasswordReset) error {
+	query := db.Create(reset)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating password reset for user %d", reset.UserID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Marks an unexpired reset token as used. The update is guarded on the token not being used already, so a token can
+// only reset a password once even by concurrent requests. Every other outstanding token of the user is used up too.
+func (table *passwordResetsTable) Use(tokenHash string) (reset *lq.PasswordReset, err error) {
+	reset = &lq.PasswordReset{}
+	now := time.Now().UTC().UnixNano()
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed using password reset")
+
+	if err = tx.Where("token_hash = ? AND used_at = 0 AND expires_at > ?", tokenHash, now).First(reset).Error; err != nil {
+		return
+	}
+
+	query := tx.Model(&lq.PasswordReset{}).Where("user_id = ? AND used_at = 0", reset.UserID).UpdateColumn("used_at", now)
+	if err = query.Error; err != nil {
+		return
+	}
+	if query.RowsAffected == 0 {
+		err = lq.NewErrorf(nil, "Password reset %d was already used", reset.ID)
+	}
+	return
+}
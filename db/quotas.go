@@ -0,0 +1,86 @@
+package db
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+type QuotasTable interface {
+	GetForUser(userID uint) (*lq.Quota, error)
+	Set(quota *lq.Quota) error
+	Usage(userID uint) (*lq.QuotaUsage, error)
+}
+
+type quotasTable struct{}
+
+func Quotas() QuotasTable {
+	return &quotasTable{}
+}
+
+// Get the quota of the user, the default quota when none was set for them
+func (table *quotasTable) GetForUser(userID uint) (*lq.Quota, error) {
+	var quota lq.Quota
+	query := db.Where("user_id = ?", userID).First(&quota)
+	if query.RecordNotFound() {
+		return lq.DefaultQuota(userID), nil
+	}
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting quota of user %d", userID)
+		log.Error(err)
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// Creates or replaces the quota of a user
+func (table *quotasTable) Set(quota *lq.Quota) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed setting quota of user %d", quota.UserID)
+
+	var existing lq.Quota
+	query := tx.Where("user_id = ?", quota.UserID).First(&existing)
+	if query.RecordNotFound() {
+		quota.ID = 0
+		err = tx.Create(quota).Error
+		return
+	}
+	if err = query.Error; err != nil {
+		return
+	}
+	quota.ID = existing.ID
+	err = tx.Model(&existing).UpdateColumns(map[string]interface{}{
+		"max_active_jobs": quota.MaxActiveJobs,
+		"max_instances":   quota.MaxInstances,
+		"max_v_cpus":      quota.MaxVCpus,
+		"monthly_budget":  quota.MonthlyBudget,
+	}).Error
+	return
+}
+
+// What the user runs: the jobs and instances they own, including those they run in organizations. Usage is counted
+// per user, not per organization.
+func (table *quotasTable) Usage(userID uint) (*lq.QuotaUsage, error) {
+	usage := &lq.QuotaUsage{}
+
+	jobs := db.Model(&lq.ContainerJob{}).Where("owner_id = ? AND status NOT IN (?)", userID,
+		lq.TerminalJobStatuses)
+	if err := jobs.Count(&usage.ActiveJobs).Error; err != nil {
+		return usage, lq.NewErrorf(err, "Failed counting active jobs of user %d", userID)
+	}
+	row := jobs.Select("COALESCE(SUM(cpu), 0)").Row()
+	if err := row.Scan(&usage.ActiveJobCpus); err != nil {
+		return usage, lq.NewErrorf(err, "Failed counting vcpus of the active jobs of user %d", userID)
+	}
+
+	instances := db.Model(&lq.ResourceInstance{}).Where("owner_id = ? AND status NOT IN (?)", userID,
+		[]string{lq.ResourceStatusDeprovisioning, lq.ResourceStatusDeprovisioned})
+	if err := instances.Count(&usage.Instances).Error; err != nil {
+		return usage, lq.NewErrorf(err, "Failed counting instances of user %d", userID)
+	}
+	row := instances.Select("COALESCE(SUM(cpu_total), 0)").Row()
+	if err := row.Scan(&usage.VCpus); err != nil {
+		return usage, lq.NewErrorf(err, "Failed counting vcpus of user %d", userID)
+	}
+	return usage, nil
+}
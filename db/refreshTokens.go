@@ -0,0 +1,70 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+type RefreshTokensTable interface {
+	Create(token *lq.RefreshToken) error
+	Rotate(tokenHash string, next *lq.RefreshToken) (*lq.RefreshToken, error)
+	RevokeAllOfUser(userID uint) error
+}
+
+type refreshTokensTable struct{}
+
+func RefreshTokens() RefreshTokensTable {
+	return &refreshTokensTable{}
+}
+
+func (table *refreshTokensTable) Create(token *lq.RefreshToken) error {
+	query := db.Create(token)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating refresh token for user %d", token.UserID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Revokes a valid refresh token and creates the next one for the same user and scopes. The revocation is guarded on
+// the token not being revoked already, so a refresh token can only be used once even by concurrent requests.
+func (table *refreshTokensTable) Rotate(tokenHash string, next *lq.RefreshToken) (used *lq.RefreshToken, err error) {
+	used = &lq.RefreshToken{}
+	now := time.Now().UTC().UnixNano()
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed rotating refresh token")
+
+	if err = tx.Where("token_hash = ? AND revoked_at = 0 AND expires_at > ?", tokenHash, now).First(used).Error; err != nil {
+		return
+	}
+
+	query := tx.Model(&lq.RefreshToken{}).Where("id = ? AND revoked_at = 0", used.ID).UpdateColumn("revoked_at", now)
+	if err = query.Error; err != nil {
+		return
+	}
+	if query.RowsAffected == 0 {
+		err = lq.NewErrorf(nil, "Refresh token %d was already used", used.ID)
+		return
+	}
+
+	next.UserID = used.UserID
+	next.Scopes = used.Scopes
+	err = tx.Create(next).Error
+	return
+}
+
+func (table *refreshTokensTable) RevokeAllOfUser(userID uint) error {
+	query := db.Model(&lq.RefreshToken{}).Where("user_id = ? AND revoked_at = 0", userID).
+		UpdateColumn("revoked_at", time.Now().UTC().UnixNano())
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed revoking refresh tokens of user %d", userID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
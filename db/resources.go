@@ -9,7 +9,6 @@ import (
 )
 
 type ResourcesTable interface {
-    CreateInTx(*gorm.DB, *lq.ResourceInstance) error
     Get(resourceID uint) (*lq.ResourceInstance, error)
     Update(resourceId uint, resource *lq.ResourceInstance) error
 
@@ -17,11 +16,14 @@ type ResourcesTable interface {
     GetTerminatedResourceIdsWithAssignedJobs() ([]uint, error)
 
     GetUsersResources(userID uint) ([]*lq.ResourceInstance, error)
+    ListVisibleTo(userID, orgID uint, filter InstanceFilter, page PageRequest) ([]*lq.ResourceInstance, error)
     GetUsersProvisionedResources(userID uint) ([]*lq.ResourceInstance, error)
 
     GetAllProvisionedResources() ([]*lq.ResourceInstance, error)
     GetAllProvisionedOrRunningResources() ([]*lq.ResourceInstance, error)
 
+    GetEvents(resourceId uint) ([]*lq.ResourceEvent, error)
+
     // Status changing
     SetStatus(resourceId uint, status, msg string) error
 
@@ -29,6 +31,7 @@ type ResourcesTable interface {
     SetInstanceId(resourceId uint, status string) error
     SetLaunchTime(resourceId uint, launchTime int64) error
     SetIP(resourceId uint, ip string) error
+    SetStorage(resourceId uint, storage lq.InstanceStorage) error
 
     GetRunningUserTerminatedResources() ([]*lq.ResourceInstance, error)
     MarkUserTerminated(resourceId uint) error
@@ -42,7 +45,7 @@ func Resources() ResourcesTable {
     return &resourcesTable{}
 }
 
-func (table *resourcesTable) CreateInTx(tx *gorm.DB, resource *lq.ResourceInstance) error {
+func createResourceInTx(tx *gorm.DB, resource *lq.ResourceInstance) error {
     resource.Status = lq.ResourceStatusNew
 
     if err := tx.Create(resource).Error; err != nil {
@@ -77,13 +80,13 @@ func (table *resourcesTable) GetNewResources() ([]*lq.ResourceInstance, error) {
 func (table *resourcesTable) GetTerminatedResourceIdsWithAssignedJobs() ([]uint, error) {
     resourceIds := []uint{}
 
-    rows, err := db.Raw(fmt.Sprintf("SELECT id FROM resource_instance WHERE " +
-        "status = '%s' OR status = '%s' AND " +
+    rows, err := db.Raw("SELECT id FROM resource_instance WHERE (status = ? OR status = ?) AND " +
         "(SELECT COUNT(*) FROM container_job WHERE instance_id = resource_instance.id) > 0",
-        lq.ResourceStatusDeprovisioning, lq.ResourceStatusDeprovisioned)).Rows()
+        lq.ResourceStatusDeprovisioning, lq.ResourceStatusDeprovisioned).Rows()
     if err != nil {
         return resourceIds, lq.NewErrorf(err, "Failed getting all terminated resources with assigned jobs")
     }
+    defer rows.Close()
     for rows.Next() {
         var id uint
         err = rows.Scan(&id)
@@ -106,6 +109,17 @@ func (table *resourcesTable)  GetUsersResources(userID uint) ([]*lq.ResourceInst
     return resources, nil
 }
 
+// Lists the resources of the user and, when orgID is not 0, every resource launched for the organization
+func (table *resourcesTable) ListVisibleTo(userID, orgID uint, filter InstanceFilter,
+    page PageRequest) ([]*lq.ResourceInstance, error) {
+    resources := []*lq.ResourceInstance{}
+    query := page.apply(filter.apply(visibleTo(userID, orgID))).Find(&resources)
+    if query.Error != nil {
+        return resources, lq.NewErrorf(query.Error, "Failed listing resources of user %d", userID)
+    }
+    return resources, nil
+}
+
 func (table *resourcesTable) GetUsersProvisionedResources(userID uint) ([]*lq.ResourceInstance, error) {
     activeResources := []*lq.ResourceInstance{}
     query := db.Where("(status = ? OR status = ?) AND owner_id = ?",
@@ -163,41 +177,48 @@ func (table *resourcesTable) SetStatus(resourceId uint, status, msg string) (err
         return
     }
 
-    err = table.setStatusTx(tx, resourceId, resource.Status, status, msg)
+    if !isValidResourceTransition(resource.Status, status) {
+        err = fmt.Errorf("Invalid resource state transition: %s to %s", resource.Status, status)
+        return
+    }
+
+    if err = tx.Model(&resource).UpdateColumn("status", status).Error; err != nil {
+        return
+    }
 
+    err = trackStatus(tx, resourceId, status, msg)
     return
 }
 
-func (table *resourcesTable) setStatusTx(tx *gorm.DB, resourceId uint, currentStatus, newStatus, msg string) error {
-    if ! table.validateStateTransition(currentStatus, newStatus) {
-        return fmt.Errorf("Invalid resource state transition: %s to %s", currentStatus, newStatus)
+// The status history of a resource, oldest first
+func (table *resourcesTable) GetEvents(resourceId uint) ([]*lq.ResourceEvent, error) {
+    resourceEvents := []*lq.ResourceEvent{}
+    query := db.Table("resource_events").Where("instance_id = ?", resourceId).Order("time, id").Find(&resourceEvents)
+    if query.Error != nil {
+        return resourceEvents, lq.NewErrorf(query.Error, "Failed fetching events of resource %d", resourceId)
     }
+    return resourceEvents, nil
+}
 
-    if err := tx.Exec(fmt.Sprintf(
-    "UPDATE resource_instance SET status = '%s' WHERE id = %d", newStatus, resourceId)).Error; err != nil {
-        return err
+func trackStatus(tx *gorm.DB, resourceId uint, status, msg string) (err error) {
+    if err = tx.Table("resource_events").Create(newResourceEvent(resourceId, status, msg)).Error; err != nil {
+        err = lq.NewError("Failed creating resource event", err)
     }
-
-    return trackStatus(tx, resourceId, newStatus, msg)
+    return
 }
 
-func trackStatus(tx *gorm.DB, resourceId uint, status, msg string) (err error) {
+func newResourceEvent(resourceId uint, status, msg string) *lq.ResourceEvent {
     // truncate message if necessary
     maxMsgLen := 1024
     if len(msg) > maxMsgLen {
         msg = msg[:maxMsgLen]
     }
-    event := &lq.ResourceEvent{
+    return &lq.ResourceEvent{
         InstanceID: resourceId,
         Status: status,
         Time: time.Now().UTC().UnixNano(),
         Msg: msg,
     }
-
-    if err = tx.Table("resource_events").Create(event).Error; err != nil {
-        err = lq.NewError("Failed creating resource event", err)
-    }
-    return
 }
 
 func (table *resourcesTable) SetLaunchTime(resourceId uint, launchTime int64) error {
@@ -224,9 +245,20 @@ func (table *resourcesTable) SetIP(resourceId uint, ip string) error {
     return query.Error
 }
 
+func (table *resourcesTable) SetStorage(resourceId uint, storage lq.InstanceStorage) error {
+    query := db.Model(&lq.ResourceInstance{}).Where("id = ?", resourceId).UpdateColumns(map[string]interface{}{
+        "disk_total":         storage.DiskTotal,
+        "aws_volume_size":    storage.VolumeSize,
+        "aws_instance_store": storage.InstanceStore,
+    })
+    if query.Error != nil {
+        log.Error(query.Error)
+    }
+    return query.Error
+}
+
 func (table *resourcesTable) MarkUserTerminated(resourceId uint) error {
-    sql := fmt.Sprintf("UPDATE resource_instance SET user_terminated = true WHERE id = %d", resourceId)
-    query := db.Exec(sql)
+    query := db.Model(&lq.ResourceInstance{}).Where("id = ?", resourceId).UpdateColumn("user_terminated", true)
     if query.Error != nil {
         return lq.NewErrorf(query.Error, "Failed updating resource %d as user terminated", resourceId)
     }
@@ -241,7 +273,7 @@ func (table *resourcesTable) Delete(resourceId uint) (err error) {
     return query.Error
 }
 
-func (table *resourcesTable) validateStateTransition(currentState, newState string) bool {
+func isValidResourceTransition(currentState, newState string) bool {
     validTransitions := make(map[string][]string)
 
     validTransitions[lq.ResourceStatusNew] = []string{
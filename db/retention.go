@@ -0,0 +1,284 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+
+	lq "bargain/liquefy/models"
+)
+
+// RetentionTable holds the retention policies, finds the history they expire and moves it to and from archives.
+// Archiving and restoring a file are transactional, the rows are only deleted once the archive file is recorded.
+type RetentionTable interface {
+	GetPolicy(userID, orgID uint) (*lq.RetentionPolicy, error)
+	SetPolicy(policy *lq.RetentionPolicy) error
+
+	Scopes() ([]lq.RetentionScope, error)
+	ExpiredJobs(scope lq.RetentionScope, before int64, limit int) ([]*lq.ArchivedJob, error)
+	ExpiredInstances(scope lq.RetentionScope, before int64, limit int) ([]*lq.ArchivedInstance, error)
+	Archive(file *lq.ArchiveFile, jobs []*lq.ArchivedJob, instances []*lq.ArchivedInstance) error
+	Restore(file *lq.ArchiveFile, jobs []*lq.ArchivedJob, instances []*lq.ArchivedInstance) error
+
+	GetArchive(key string) (*lq.ArchiveFile, error)
+	ListArchivesVisibleTo(userID, orgID uint) ([]*lq.ArchiveFile, error)
+}
+
+type retentionTable struct{}
+
+func Retention() RetentionTable {
+	return &retentionTable{}
+}
+
+var terminatedJobStatuses = []string{
+	mesos.TaskState_TASK_FAILED.String(),
+	mesos.TaskState_TASK_FINISHED.String(),
+	mesos.TaskState_TASK_KILLED.String(),
+}
+
+// The policy of an organization, or of a user outside of one, the default policy when none was set for them
+func (table *retentionTable) GetPolicy(userID, orgID uint) (*lq.RetentionPolicy, error) {
+	scope := lq.DefaultRetentionPolicy(userID, orgID)
+	var policy lq.RetentionPolicy
+	query := db.Where("user_id = ? AND org_id = ?", scope.UserID, scope.OrgID).First(&policy)
+	if query.RecordNotFound() {
+		return scope, nil
+	}
+	if query.Error != nil {
+		return nil, lq.NewErrorf(query.Error, "Failed getting retention policy of user %d in org %d", userID, orgID)
+	}
+	return &policy, nil
+}
+
+// Creates or replaces the policy of a user or an organization
+func (table *retentionTable) SetPolicy(policy *lq.RetentionPolicy) (err error) {
+	if policy.OrgID != 0 {
+		policy.UserID = 0
+	}
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed setting retention policy of user %d in org %d", policy.UserID,
+		policy.OrgID)
+
+	var existing lq.RetentionPolicy
+	query := tx.Where("user_id = ? AND org_id = ?", policy.UserID, policy.OrgID).First(&existing)
+	if query.RecordNotFound() {
+		policy.ID = 0
+		err = tx.Create(policy).Error
+		return
+	}
+	if err = query.Error; err != nil {
+		return
+	}
+	policy.ID = existing.ID
+	err = tx.Model(&existing).UpdateColumn("archive_after_days", policy.ArchiveAfterDays).Error
+	return
+}
+
+// The scopes with terminated jobs or deprovisioned instances, which may have expired
+func (table *retentionTable) Scopes() ([]lq.RetentionScope, error) {
+	scopes := []lq.RetentionScope{}
+	rows, err := db.Raw("SELECT owner_id, org_id FROM container_job WHERE status IN (?) "+
+		"UNION SELECT owner_id, org_id FROM resource_instance WHERE status = ?",
+		terminatedJobStatuses, lq.ResourceStatusDeprovisioned).Rows()
+	if err != nil {
+		return scopes, lq.NewErrorf(err, "Failed getting retention scopes")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		scope := lq.RetentionScope{}
+		if err = rows.Scan(&scope.OwnerID, &scope.OrgID); err != nil {
+			return scopes, lq.NewErrorf(err, "Failed getting retention scopes")
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// Terminated jobs of the scope that ended before the time, in ascending id order. Restored jobs expire once they
+// were also restored before the time.
+func (table *retentionTable) ExpiredJobs(scope lq.RetentionScope, before int64, limit int) ([]*lq.ArchivedJob,
+	error) {
+	archived := []*lq.ArchivedJob{}
+	jobs := []*lq.ContainerJob{}
+	query := db.Where("owner_id = ? AND org_id = ? AND status IN (?) AND end_time < ? AND restored_at < ?",
+		scope.OwnerID, scope.OrgID, terminatedJobStatuses, before, before).Order("id").Limit(limit).Find(&jobs)
+	if query.Error != nil {
+		return archived, lq.NewErrorf(query.Error, "Failed getting expired jobs of %v", scope)
+	}
+	if len(jobs) == 0 {
+		return archived, nil
+	}
+
+	ids := make([]uint, len(jobs))
+	byID := make(map[uint]*lq.ArchivedJob)
+	for i, job := range jobs {
+		ids[i] = job.ID
+		byID[job.ID] = &lq.ArchivedJob{Job: job, Events: []*lq.ContainerJobTracker{},
+			BuildLogs: []*lq.ContainerJobBuildLog{}}
+		archived = append(archived, byID[job.ID])
+	}
+
+	trackers := []*lq.ContainerJobTracker{}
+	if err := db.Where("container_job_id IN (?)", ids).Order("time, id").Find(&trackers).Error; err != nil {
+		return archived, lq.NewErrorf(err, "Failed getting events of expired jobs of %v", scope)
+	}
+	for _, tracker := range trackers {
+		byID[tracker.ContainerJobID].Events = append(byID[tracker.ContainerJobID].Events, tracker)
+	}
+
+	buildLogs := []*lq.ContainerJobBuildLog{}
+	if err := db.Where("container_job_id IN (?)", ids).Order("attempt, id").Find(&buildLogs).Error; err != nil {
+		return archived, lq.NewErrorf(err, "Failed getting build logs of expired jobs of %v", scope)
+	}
+	for _, buildLog := range buildLogs {
+		byID[buildLog.ContainerJobID].BuildLogs = append(byID[buildLog.ContainerJobID].BuildLogs, buildLog)
+	}
+	return archived, nil
+}
+
+// Deprovisioned instances of the scope whose status last changed before the time, in ascending id order. Restored
+// instances expire once they were also restored before the time.
+func (table *retentionTable) ExpiredInstances(scope lq.RetentionScope, before int64,
+	limit int) ([]*lq.ArchivedInstance, error) {
+	archived := []*lq.ArchivedInstance{}
+	resources := []*lq.ResourceInstance{}
+	query := db.Where("owner_id = ? AND org_id = ? AND status = ? AND restored_at < ? AND NOT EXISTS "+
+		"(SELECT 1 FROM resource_events WHERE instance_id = resource_instance.id AND time >= ?)",
+		scope.OwnerID, scope.OrgID, lq.ResourceStatusDeprovisioned, before, before).Order("id").Limit(limit).
+		Find(&resources)
+	if query.Error != nil {
+		return archived, lq.NewErrorf(query.Error, "Failed getting expired instances of %v", scope)
+	}
+	if len(resources) == 0 {
+		return archived, nil
+	}
+
+	ids := make([]uint, len(resources))
+	byID := make(map[uint]*lq.ArchivedInstance)
+	for i, resource := range resources {
+		ids[i] = resource.ID
+		byID[resource.ID] = &lq.ArchivedInstance{Instance: resource, Events: []*lq.ResourceEvent{}}
+		archived = append(archived, byID[resource.ID])
+	}
+
+	resourceEvents := []*lq.ResourceEvent{}
+	query = db.Table("resource_events").Where("instance_id IN (?)", ids).Order("time, id").Find(&resourceEvents)
+	if query.Error != nil {
+		return archived, lq.NewErrorf(query.Error, "Failed getting events of expired instances of %v", scope)
+	}
+	for _, event := range resourceEvents {
+		byID[event.InstanceID].Events = append(byID[event.InstanceID].Events, event)
+	}
+	return archived, nil
+}
+
+func archivedIDs(jobs []*lq.ArchivedJob, instances []*lq.ArchivedInstance) ([]uint, []uint) {
+	jobIDs := make([]uint, len(jobs))
+	for i, job := range jobs {
+		jobIDs[i] = job.Job.ID
+	}
+	instanceIDs := make([]uint, len(instances))
+	for i, instance := range instances {
+		instanceIDs[i] = instance.Instance.ID
+	}
+	return jobIDs, instanceIDs
+}
+
+// Records the archive file and deletes the history it holds
+func (table *retentionTable) Archive(file *lq.ArchiveFile, jobs []*lq.ArchivedJob,
+	instances []*lq.ArchivedInstance) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed archiving history of user %d in org %d to %s", file.OwnerID,
+		file.OrgID, file.Key)
+
+	if err = tx.Create(file).Error; err != nil {
+		return
+	}
+	jobIDs, instanceIDs := archivedIDs(jobs, instances)
+	err = deleteHistory(tx, jobIDs, instanceIDs)
+	return
+}
+
+func deleteHistory(tx *gorm.DB, jobIDs, instanceIDs []uint) error {
+	// Trackers and build logs are soft deleted otherwise
+	unscoped := tx.Unscoped()
+	if len(jobIDs) > 0 {
+		if err := unscoped.Where("container_job_id IN (?)", jobIDs).Delete(&lq.ContainerJobTracker{}).Error; err != nil {
+			return err
+		}
+		if err := unscoped.Where("container_job_id IN (?)", jobIDs).Delete(&lq.ContainerJobBuildLog{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN (?)", jobIDs).Delete(&lq.ContainerJob{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(instanceIDs) > 0 {
+		resourceEvents := tx.Table("resource_events").Where("instance_id IN (?)", instanceIDs)
+		if err := resourceEvents.Delete(&lq.ResourceEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN (?)", instanceIDs).Delete(&lq.ResourceInstance{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Puts the history of an archive file back, with the ids it had and the time it was restored at, and forgets the
+// file. The history replaces rows with the same ids, so restoring a file twice leaves a single copy.
+func (table *retentionTable) Restore(file *lq.ArchiveFile, jobs []*lq.ArchivedJob,
+	instances []*lq.ArchivedInstance) (err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed restoring archive %s", file.Key)
+
+	jobIDs, instanceIDs := archivedIDs(jobs, instances)
+	if err = deleteHistory(tx, jobIDs, instanceIDs); err != nil {
+		return
+	}
+	for _, archived := range jobs {
+		if err = tx.Create(archived.Job).Error; err != nil {
+			return
+		}
+		for _, tracker := range archived.Events {
+			if err = tx.Create(tracker).Error; err != nil {
+				return
+			}
+		}
+		for _, buildLog := range archived.BuildLogs {
+			if err = tx.Create(buildLog).Error; err != nil {
+				return
+			}
+		}
+	}
+	for _, archived := range instances {
+		if err = tx.Create(archived.Instance).Error; err != nil {
+			return
+		}
+		for _, event := range archived.Events {
+			if err = tx.Table("resource_events").Create(event).Error; err != nil {
+				return
+			}
+		}
+	}
+	err = tx.Unscoped().Where("key = ?", file.Key).Delete(&lq.ArchiveFile{}).Error
+	return
+}
+
+func (table *retentionTable) GetArchive(key string) (*lq.ArchiveFile, error) {
+	var file lq.ArchiveFile
+	query := db.Where("key = ?", key).First(&file)
+	if query.Error != nil {
+		return &file, lq.NewErrorf(query.Error, "Failed getting archive %s", key)
+	}
+	return &file, nil
+}
+
+// The archives of the user and of their organization, most recent first
+func (table *retentionTable) ListArchivesVisibleTo(userID, orgID uint) ([]*lq.ArchiveFile, error) {
+	files := []*lq.ArchiveFile{}
+	query := visibleTo(userID, orgID).Order("id desc").Find(&files)
+	if query.Error != nil {
+		return files, lq.NewErrorf(query.Error, "Failed listing archives of user %d", userID)
+	}
+	return files, nil
+}
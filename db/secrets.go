@@ -0,0 +1,222 @@
+package db
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+// Secret values are envelope encrypted like account secrets. Only Resolve decrypts them, everything else returns
+// secrets without their value.
+type SecretsTable interface {
+	Create(secret *lq.Secret) error
+	GetByOwner(ownerID uint) ([]*lq.Secret, error)
+	SetValue(ownerID uint, name string, value string) error
+	Delete(ownerID uint, name string) error
+	MissingNames(ownerID uint, names []string) ([]string, error)
+	Resolve(ownerID uint, refs []lq.SecretRef) ([]lq.ResolvedSecret, error)
+	ReencryptAll() (int, error)
+}
+
+type secretsTable struct{}
+
+func Secrets() SecretsTable {
+	return &secretsTable{}
+}
+
+func encryptSecretValue(value string) (string, error) {
+	encoder, err := NewEncoder()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encoder.Encode([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+func (table *secretsTable) Create(secret *lq.Secret) error {
+	plaintext := secret.Value
+	defer func() { secret.Value = plaintext }()
+
+	encrypted, err := encryptSecretValue(secret.Value)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed encrypting secret %s", secret.Name)
+	}
+	secret.Value = encrypted
+
+	query := db.Create(secret)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating secret %s for user %d", secret.Name, secret.OwnerID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (table *secretsTable) GetByOwner(ownerID uint) ([]*lq.Secret, error) {
+	secrets := []*lq.Secret{}
+	query := db.Where("owner_id = ?", ownerID).Order("name").Find(&secrets)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting secrets of user %d", ownerID)
+		log.Error(err)
+		return secrets, err
+	}
+	for _, secret := range secrets {
+		secret.Value = ""
+	}
+	return secrets, nil
+}
+
+func (table *secretsTable) SetValue(ownerID uint, name string, value string) error {
+	encrypted, err := encryptSecretValue(value)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed encrypting secret %s", name)
+	}
+
+	query := db.Model(&lq.Secret{}).Where("owner_id = ? AND name = ?", ownerID, name).Update("value", encrypted)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed updating secret %s of user %d", name, ownerID)
+		log.Error(err)
+		return err
+	}
+	if query.RowsAffected == 0 {
+		return lq.NewErrorf(nil, "User %d has no secret %s", ownerID, name)
+	}
+	return nil
+}
+
+// Secrets are deleted for good, so that a secret of the same name can be created again
+func (table *secretsTable) Delete(ownerID uint, name string) error {
+	query := db.Unscoped().Where("owner_id = ? AND name = ?", ownerID, name).Delete(&lq.Secret{})
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed deleting secret %s of user %d", name, ownerID)
+		log.Error(err)
+		return err
+	}
+	if query.RowsAffected == 0 {
+		return lq.NewErrorf(nil, "User %d has no secret %s", ownerID, name)
+	}
+	return nil
+}
+
+// The names the owner has no secret for
+func (table *secretsTable) MissingNames(ownerID uint, names []string) ([]string, error) {
+	missing := []string{}
+	if len(names) == 0 {
+		return missing, nil
+	}
+
+	existing := []string{}
+	query := db.Model(&lq.Secret{}).Where("owner_id = ? AND name IN (?)", ownerID, names).Pluck("name", &existing)
+	if query.Error != nil {
+		return missing, lq.NewErrorf(query.Error, "Failed getting secrets of user %d", ownerID)
+	}
+
+	found := make(map[string]bool)
+	for _, name := range existing {
+		found[name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// Decrypts the referenced secrets of the owner. Fails if any of them does not exist anymore.
+func (table *secretsTable) Resolve(ownerID uint, refs []lq.SecretRef) ([]lq.ResolvedSecret, error) {
+	resolved := []lq.ResolvedSecret{}
+	if len(refs) == 0 {
+		return resolved, nil
+	}
+
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name
+	}
+	secrets := []*lq.Secret{}
+	query := db.Where("owner_id = ? AND name IN (?)", ownerID, names).Find(&secrets)
+	if query.Error != nil {
+		return resolved, lq.NewErrorf(query.Error, "Failed getting secrets of user %d", ownerID)
+	}
+
+	encoder, err := NewEncoder()
+	if err != nil {
+		return resolved, err
+	}
+	values := make(map[string]string)
+	for _, secret := range secrets {
+		value, err := encoder.Decode([]byte(secret.Value))
+		if err != nil {
+			return resolved, lq.NewErrorf(err, "Failed decrypting secret %s of user %d", secret.Name, ownerID)
+		}
+		values[secret.Name] = string(value)
+	}
+
+	for _, ref := range refs {
+		value, ok := values[ref.Name]
+		if !ok {
+			return resolved, lq.NewErrorf(nil, "Secret %s does not exist", ref.Name)
+		}
+		resolved = append(resolved, lq.ResolvedSecret{SecretRef: ref, Value: value})
+	}
+	return resolved, nil
+}
+
+// Re-encrypts the values of every secret that is not encrypted with the active master key, returning how many were.
+// Like AwsAccounts().ReencryptAll, secrets that fail are logged and skipped so that the rotation can be run again.
+func (table *secretsTable) ReencryptAll() (int, error) {
+	ids := []uint{}
+	if err := db.Model(&lq.Secret{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, lq.NewErrorf(err, "Failed listing secrets to re-encrypt")
+	}
+
+	reencrypted := 0
+	var failed error
+	for _, id := range ids {
+		done, err := table.reencrypt(id)
+		if err != nil {
+			log.Error(err)
+			failed = lq.NewErrorf(err, "Failed re-encrypting some secrets")
+			continue
+		}
+		if done {
+			reencrypted++
+		}
+	}
+	return reencrypted, failed
+}
+
+func (table *secretsTable) reencrypt(id uint) (done bool, err error) {
+	encoder, err := NewEncoder()
+	if err != nil {
+		return false, err
+	}
+
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed re-encrypting secret %d", id)
+
+	var secret lq.Secret
+	if err = tx.Raw("SELECT * FROM secret WHERE id = ? FOR UPDATE", id).Scan(&secret).Error; err != nil {
+		return
+	}
+	if !encoder.NeedsReencryption([]byte(secret.Value)) {
+		return
+	}
+
+	value, err := encoder.Decode([]byte(secret.Value))
+	if err != nil {
+		return
+	}
+	encrypted, err := encoder.Encode(value)
+	if err != nil {
+		return
+	}
+	if err = tx.Model(&secret).UpdateColumn("value", string(encrypted)).Error; err != nil {
+		return
+	}
+	return true, nil
+}
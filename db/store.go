@@ -0,0 +1,48 @@
+package db
+
+// Store gives access to every table. Services are given a store instead of using the tables of the package, so that
+// they can be tested against NewMemoryStore.
+type Store interface {
+	ApiKeys() ApiKeysTable
+	Assignments() AssignmentsTable
+	AuditLog() AuditLogTable
+	AwsAccounts() AwsAccountTable
+	BuildLogs() BuildLogsTable
+	IdempotencyKeys() IdempotencyKeysTable
+	Jobs() ContainerJobsTable
+	Mesos() MesosTable
+	Organizations() OrganizationsTable
+	PasswordResets() PasswordResetsTable
+	Quotas() QuotasTable
+	RefreshTokens() RefreshTokensTable
+	Resources() ResourcesTable
+	Retention() RetentionTable
+	Secrets() SecretsTable
+	Users() UsersTable
+	Webhooks() WebhooksTable
+}
+
+// The tables of the postgres database opened with Connect
+type postgresStore struct{}
+
+func NewPostgresStore() Store {
+	return &postgresStore{}
+}
+
+func (store *postgresStore) ApiKeys() ApiKeysTable                 { return ApiKeys() }
+func (store *postgresStore) Assignments() AssignmentsTable         { return Assignments() }
+func (store *postgresStore) AuditLog() AuditLogTable               { return AuditLog() }
+func (store *postgresStore) AwsAccounts() AwsAccountTable          { return AwsAccounts() }
+func (store *postgresStore) BuildLogs() BuildLogsTable             { return BuildLogs() }
+func (store *postgresStore) IdempotencyKeys() IdempotencyKeysTable { return IdempotencyKeys() }
+func (store *postgresStore) Jobs() ContainerJobsTable              { return Jobs() }
+func (store *postgresStore) Mesos() MesosTable                     { return Mesos() }
+func (store *postgresStore) Organizations() OrganizationsTable     { return Organizations() }
+func (store *postgresStore) PasswordResets() PasswordResetsTable   { return PasswordResets() }
+func (store *postgresStore) Quotas() QuotasTable                   { return Quotas() }
+func (store *postgresStore) RefreshTokens() RefreshTokensTable     { return RefreshTokens() }
+func (store *postgresStore) Resources() ResourcesTable             { return Resources() }
+func (store *postgresStore) Retention() RetentionTable             { return Retention() }
+func (store *postgresStore) Secrets() SecretsTable                 { return Secrets() }
+func (store *postgresStore) Users() UsersTable                     { return Users() }
+func (store *postgresStore) Webhooks() WebhooksTable               { return Webhooks() }
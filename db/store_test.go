@@ -0,0 +1,400 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+// Behaviour both stores share, so that services tested against the memory store behave the same on postgres
+var storeTests = []struct {
+	name string
+	test func(t *testing.T, store Store)
+}{
+	{"JobStatusRetries", testJobStatusRetries},
+	{"Assignments", testAssignments},
+	{"Events", testEvents},
+	{"ListVisibleTo", testListVisibleTo},
+	{"Organizations", testOrganizations},
+	{"IdempotencyKeys", testIdempotencyKeys},
+	{"AwsAccountRegions", testAwsAccountRegions},
+	{"Retention", testRetention},
+	{"WebhookRetries", testWebhookRetries},
+}
+
+func TestMemoryStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		t.Logf("memory store: %s", storeTest.name)
+		storeTest.test(t, NewMemoryStore())
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+	for _, storeTest := range storeTests {
+		func() {
+			defer useFreshSchema(t)()
+			if _, err := Migrations().Up(); err != nil {
+				t.Fatal(err)
+			}
+			t.Logf("postgres store: %s", storeTest.name)
+			storeTest.test(t, NewPostgresStore())
+		}()
+	}
+}
+
+func createUser(t *testing.T, store Store, email string) *lq.User {
+	user := &lq.User{Username: email, Email: email}
+	assert.Nil(t, store.Users().Create(user))
+	return user
+}
+
+func testJobStatusRetries(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	job := &lq.ContainerJob{Name: "job", OwnerID: user.ID}
+	assert.Nil(t, store.Jobs().Create(job))
+	assert.Equal(t, mesos.TaskState_TASK_STAGING.String(), job.Status)
+
+	// Lost jobs are staged again until they ran out of retries
+	for i := 1; i <= MAX_RETRIES; i++ {
+		assert.Nil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+		assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_LOST.String(), "lost"))
+		retried, err := store.Jobs().Get(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, mesos.TaskState_TASK_STAGING.String(), retried.Status)
+		assert.Equal(t, i, retried.RetryCount)
+	}
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_LOST.String(), "lost"))
+	failed, err := store.Jobs().Get(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, mesos.TaskState_TASK_FAILED.String(), failed.Status)
+	assert.NotEqual(t, int64(0), failed.EndTime)
+
+	// Terminated jobs do not change anymore
+	assert.NotNil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+	assert.NotNil(t, store.Jobs().SetStatus(job.ID+1000, lq.ContainerJobStatusLaunched, ""))
+}
+
+func testAssignments(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	job := &lq.ContainerJob{Name: "job", OwnerID: user.ID, Ram: 512, Cpu: 0.5, Disk: 100}
+	assert.Nil(t, store.Jobs().Create(job))
+
+	resource := &lq.ResourceInstance{OwnerId: user.ID, RamTotal: 1024, CpuTotal: 1}
+	assert.Nil(t, store.Assignments().AssignJob(job.ID, resource, true))
+	assert.Equal(t, lq.ResourceStatusNew, resource.Status)
+
+	assigned, err := store.Jobs().GetAssignedJobsByInstances([]uint{resource.ID})
+	assert.Nil(t, err)
+	if assert.Len(t, assigned, 1) {
+		assert.Equal(t, job.ID, assigned[0].ID)
+	}
+	unassigned, err := store.Jobs().GetUnassignedJobsByUser(user.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, unassigned)
+	stored, err := store.Resources().Get(resource.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 512, stored.RamUsed)
+	assert.Equal(t, 100, stored.DiskUsed)
+
+	// Resources only move through valid transitions
+	assert.NotNil(t, store.Resources().SetStatus(resource.ID, lq.ResourceStatusRunning, ""))
+	assert.Nil(t, store.Resources().SetStatus(resource.ID, lq.ResourceProvisioning, ""))
+	assert.Nil(t, store.Resources().SetStatus(resource.ID, lq.ResourceStatusDeprovisioning, "failed"))
+	terminated, err := store.Resources().GetTerminatedResourceIdsWithAssignedJobs()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{resource.ID}, terminated)
+
+	assert.Nil(t, store.Assignments().UnassignJob(job.ID))
+	stored, err = store.Resources().Get(resource.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stored.RamUsed)
+	unassigned, err = store.Jobs().GetUnassignedJobsByUser(user.ID)
+	assert.Nil(t, err)
+	assert.Len(t, unassigned, 1)
+}
+
+func testEvents(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	job := &lq.ContainerJob{Name: "job", OwnerID: user.ID, Ram: 512, Cpu: 0.5}
+	assert.Nil(t, store.Jobs().Create(job))
+	resource := &lq.ResourceInstance{OwnerId: user.ID, RamTotal: 1024, CpuTotal: 1}
+	assert.Nil(t, store.Assignments().AssignJob(job.ID, resource, true))
+	assert.Nil(t, store.Resources().SetStatus(resource.ID, lq.ResourceProvisioning, ""))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_LOST.String(), "lost"))
+
+	trackers, err := store.Jobs().GetEvents(job.ID)
+	assert.Nil(t, err)
+	statuses := []string{}
+	for _, tracker := range trackers {
+		statuses = append(statuses, tracker.Status)
+	}
+	assert.Equal(t, []string{"TASK_STAGING", "TASK_STAGING", lq.ContainerJobStatusLaunched, "TASK_LOST",
+		"TASK_STAGING"}, statuses)
+	if assert.Len(t, trackers, 5) {
+		assert.Equal(t, uint(0), trackers[0].InstanceID)
+		assert.Equal(t, resource.ID, trackers[1].InstanceID)
+		assert.Equal(t, 1, trackers[4].Attempt)
+		assert.Equal(t, "Retrying", trackers[4].Msg)
+	}
+
+	resourceEvents, err := store.Resources().GetEvents(resource.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, resourceEvents, 2) {
+		assert.Equal(t, lq.ResourceStatusNew, resourceEvents[0].Status)
+		assert.Equal(t, lq.ResourceProvisioning, resourceEvents[1].Status)
+	}
+
+	trackers, err = store.Jobs().GetEvents(job.ID + 1000)
+	assert.Nil(t, err)
+	assert.Empty(t, trackers)
+}
+
+func testListVisibleTo(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	other := createUser(t, store, "other@example.com")
+	ids := []uint{}
+	for _, name := range []string{"first", "second", "third"} {
+		job := &lq.ContainerJob{Name: name, OwnerID: user.ID, OrgID: 7}
+		assert.Nil(t, store.Jobs().Create(job))
+		ids = append(ids, job.ID)
+	}
+	assert.Nil(t, store.Jobs().Create(&lq.ContainerJob{Name: "other", OwnerID: other.ID}))
+
+	// Most recent first, continuing before the last id of a page
+	page, err := store.Jobs().ListVisibleTo(user.ID, 0, JobFilter{}, PageRequest{Limit: 2})
+	assert.Nil(t, err)
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, ids[2], page[0].ID)
+		assert.Equal(t, ids[1], page[1].ID)
+	}
+	page, err = store.Jobs().ListVisibleTo(user.ID, 0, JobFilter{}, PageRequest{BeforeID: ids[1], Limit: 2})
+	assert.Nil(t, err)
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, ids[0], page[0].ID)
+	}
+
+	// Members of the organization see its jobs
+	page, err = store.Jobs().ListVisibleTo(other.ID, 7, JobFilter{Name: "ir"}, PageRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, page, 2)
+	page, err = store.Jobs().ListVisibleTo(other.ID, 0, JobFilter{}, PageRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, page, 1)
+}
+
+func testOrganizations(t *testing.T, store Store) {
+	admin := createUser(t, store, "admin@example.com")
+	member := createUser(t, store, "member@example.com")
+	org := &lq.Organization{Name: "org"}
+	assert.Nil(t, store.Organizations().Create(org, admin.ID))
+	assert.Nil(t, store.Organizations().AddMember(&lq.Membership{OrgID: org.ID, UserID: member.ID,
+		Role: lq.RoleMember}))
+
+	// Users belong to a single organization
+	assert.NotNil(t, store.Organizations().AddMember(&lq.Membership{OrgID: org.ID, UserID: member.ID,
+		Role: lq.RoleViewer}))
+	members, err := store.Organizations().GetMembers(org.ID)
+	assert.Nil(t, err)
+	assert.Len(t, members, 2)
+
+	// The organization keeps an admin
+	assert.NotNil(t, store.Organizations().SetRole(org.ID, admin.ID, lq.RoleMember))
+	assert.NotNil(t, store.Organizations().RemoveMember(org.ID, admin.ID))
+	assert.Nil(t, store.Organizations().SetRole(org.ID, member.ID, lq.RoleAdmin))
+	assert.Nil(t, store.Organizations().RemoveMember(org.ID, admin.ID))
+	membership, err := store.Organizations().GetMembership(admin.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, membership)
+
+	_, err = store.AwsAccounts().GetIDForOwner(member.ID, org.ID)
+	assert.NotNil(t, err)
+}
+
+func testIdempotencyKeys(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	key := &lq.IdempotencyKey{UserID: user.ID, Key: "key", RequestHash: "hash"}
+	jobs := []*lq.ContainerJob{{Name: "first", OwnerID: user.ID}, {Name: "second", OwnerID: user.ID}}
+	assert.Nil(t, store.Jobs().CreateMany(jobs, key))
+
+	stored, err := store.IdempotencyKeys().Get(user.ID, "key")
+	assert.Nil(t, err)
+	if assert.NotNil(t, stored) {
+		ids, err := stored.GetJobIDs()
+		assert.Nil(t, err)
+		assert.Equal(t, []uint{jobs[0].ID, jobs[1].ID}, ids)
+	}
+
+	// Reusing a live key creates none of the jobs
+	again := &lq.IdempotencyKey{UserID: user.ID, Key: "key", RequestHash: "hash"}
+	assert.NotNil(t, store.Jobs().CreateMany([]*lq.ContainerJob{{Name: "third", OwnerID: user.ID}}, again))
+	created, err := store.Jobs().GetAllJobsByUser(user.ID)
+	assert.Nil(t, err)
+	assert.Len(t, created, 2)
+
+	missing, err := store.IdempotencyKeys().Get(user.ID, "other")
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+}
+
+func testAwsAccountRegions(t *testing.T, store Store) {
+	provider, _ := NewLocalKeyProvider("k1", map[string][]byte{"k1": testKey(1)})
+	SetKeyProvider(provider)
+	defer SetKeyProvider(nil)
+
+	user := createUser(t, store, "user@example.com")
+	account := &lq.AwsAccount{}
+	account.SetVpcId("eu-west-1", "vpc-1")
+	account.SetSshPrivateKey("eu-west-1", "key")
+	account.SetSubnetId("eu-west-1a", "subnet-a")
+	assert.Nil(t, store.AwsAccounts().Create(user.ID, account))
+	assert.Equal(t, "key", account.GetSshPrivateKey("eu-west-1"))
+
+	// Resources set up later are added to the stored regions
+	stored, err := store.AwsAccounts().GetForOwner(user.ID, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "key", stored.GetSshPrivateKey("eu-west-1"))
+	stored.SetSubnetId("eu-west-1b", "subnet-b")
+	stored.SetSecurityGroupId("us-east-1", "sg-1")
+	assert.Nil(t, store.AwsAccounts().Update(stored))
+
+	updated, err := store.AwsAccounts().Get(uint(account.GetID()))
+	assert.Nil(t, err)
+	assert.Len(t, updated.Regions, 2)
+	assert.Equal(t, "vpc-1", updated.GetVpcId("eu-west-1"))
+	assert.Equal(t, "subnet-a", updated.GetSubnetId("eu-west-1a"))
+	assert.Equal(t, "subnet-b", updated.GetSubnetId("eu-west-1b"))
+	assert.Equal(t, "sg-1", updated.GetSecurityGroupId("us-east-1"))
+	assert.Equal(t, "", updated.GetSubnetId("us-east-1a"))
+}
+
+func testRetention(t *testing.T, store Store) {
+	user := createUser(t, store, "user@example.com")
+	policy, err := store.Retention().GetPolicy(user.ID, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, lq.DefaultArchiveAfterDays, policy.ArchiveAfterDays)
+
+	// Setting a policy again replaces it, organization policies ignore the user setting them
+	assert.Nil(t, store.Retention().SetPolicy(&lq.RetentionPolicy{UserID: user.ID, ArchiveAfterDays: 10}))
+	assert.Nil(t, store.Retention().SetPolicy(&lq.RetentionPolicy{UserID: user.ID, ArchiveAfterDays: 20}))
+	assert.Nil(t, store.Retention().SetPolicy(&lq.RetentionPolicy{UserID: user.ID, OrgID: 3, ArchiveAfterDays: 30}))
+	policy, err = store.Retention().GetPolicy(user.ID, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, policy.ArchiveAfterDays)
+	policy, err = store.Retention().GetPolicy(user.ID+1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, policy.ArchiveAfterDays)
+
+	job := &lq.ContainerJob{Name: "job", OwnerID: user.ID}
+	assert.Nil(t, store.Jobs().Create(job))
+	running := &lq.ContainerJob{Name: "running", OwnerID: user.ID}
+	assert.Nil(t, store.Jobs().Create(running))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_KILLED.String(), "killed"))
+	stored, err := store.Jobs().Get(job.ID)
+	assert.Nil(t, err)
+
+	scopes, err := store.Retention().Scopes()
+	assert.Nil(t, err)
+	assert.Equal(t, []lq.RetentionScope{{OwnerID: user.ID}}, scopes)
+	scope := scopes[0]
+	expired, err := store.Retention().ExpiredJobs(scope, stored.EndTime, 10)
+	assert.Nil(t, err)
+	assert.Len(t, expired, 0)
+	expired, err = store.Retention().ExpiredJobs(scope, stored.EndTime+1, 10)
+	assert.Nil(t, err)
+	if !assert.Len(t, expired, 1) {
+		return
+	}
+	assert.Equal(t, job.ID, expired[0].Job.ID)
+	assert.Len(t, expired[0].Events, 2)
+
+	file := &lq.ArchiveFile{Key: "user/1", OwnerID: user.ID, Jobs: 1}
+	assert.Nil(t, store.Retention().Archive(file, expired, []*lq.ArchivedInstance{}))
+	assert.NotNil(t, store.Retention().Archive(&lq.ArchiveFile{Key: "user/1"}, []*lq.ArchivedJob{},
+		[]*lq.ArchivedInstance{}))
+	_, err = store.Jobs().Get(job.ID)
+	assert.NotNil(t, err)
+	archives, err := store.Retention().ListArchivesVisibleTo(user.ID, 0)
+	assert.Nil(t, err)
+	if assert.Len(t, archives, 1) {
+		assert.Equal(t, "user/1", archives[0].Key)
+	}
+
+	assert.Nil(t, store.Retention().Restore(file, expired, []*lq.ArchivedInstance{}))
+	stored, err = store.Jobs().Get(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, mesos.TaskState_TASK_KILLED.String(), stored.Status)
+	trackers, err := store.Jobs().GetEvents(job.ID)
+	assert.Nil(t, err)
+	assert.Len(t, trackers, 2)
+	_, err = store.Retention().GetArchive("user/1")
+	assert.NotNil(t, err)
+}
+
+func testWebhookRetries(t *testing.T, store Store) {
+	provider, _ := NewLocalKeyProvider("k1", map[string][]byte{"k1": testKey(1)})
+	SetKeyProvider(provider)
+	defer SetKeyProvider(nil)
+
+	user := createUser(t, store, "user@example.com")
+	hook := &lq.Webhook{OwnerID: user.ID, URL: "https://example.com/hook", Secret: "whsec_secret"}
+	assert.Nil(t, store.Webhooks().Create(hook))
+
+	now := time.Now()
+	due := &lq.WebhookDelivery{WebhookID: hook.ID, EventID: "due", Payload: `{"id":"due"}`,
+		NextAttemptAt: now.Add(-time.Second).UnixNano()}
+	later := &lq.WebhookDelivery{WebhookID: hook.ID, EventID: "later", Payload: `{"id":"later"}`,
+		NextAttemptAt: now.Add(time.Minute).UnixNano()}
+	for _, delivery := range []*lq.WebhookDelivery{due, later} {
+		claimed, err := store.Webhooks().ClaimDelivery(delivery)
+		assert.Nil(t, err)
+		assert.True(t, claimed)
+	}
+
+	// Only due deliveries are taken, and not again while leased
+	claimed, err := store.Webhooks().ClaimDueDeliveries(now, time.Minute, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, due.ID, claimed[0].ID)
+		assert.Equal(t, `{"id":"due"}`, claimed[0].Payload)
+		assert.Equal(t, now.Add(time.Minute).UnixNano(), claimed[0].NextAttemptAt)
+	}
+	claimed, err = store.Webhooks().ClaimDueDeliveries(now, time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, claimed)
+
+	// A lease that expires without an update makes the delivery due again
+	claimed, err = store.Webhooks().ClaimDueDeliveries(now.Add(2*time.Minute), time.Minute, 1)
+	assert.Nil(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, due.ID, claimed[0].ID)
+	}
+
+	// Deliveries that are no longer pending are not retried and drop their payload
+	claimed[0].Status = lq.WebhookDeliveryDelivered
+	assert.Nil(t, store.Webhooks().UpdateDelivery(claimed[0]))
+	claimed, err = store.Webhooks().ClaimDueDeliveries(now.Add(time.Hour), time.Minute, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, later.ID, claimed[0].ID)
+	}
+	deliveries, err := store.Webhooks().GetDeliveries(hook.ID, PageRequest{Limit: 10})
+	assert.Nil(t, err)
+	for _, delivery := range deliveries {
+		if delivery.ID == due.ID {
+			assert.Equal(t, "", delivery.Payload)
+		}
+	}
+
+	// Retries are signed with the secret of the webhook
+	signing, err := store.Webhooks().GetForDelivery(hook.ID)
+	assert.Nil(t, err)
+	if assert.NotNil(t, signing) {
+		assert.Equal(t, "whsec_secret", signing.Secret)
+	}
+}
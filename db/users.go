@@ -4,8 +4,6 @@ import (
 	lq "bargain/liquefy/models"
 	log "github.com/Sirupsen/logrus"
 	mesos "github.com/mesos/mesos-go/mesosproto"
-
-	"fmt"
 )
 
 type UsersTable interface {
@@ -15,6 +13,10 @@ type UsersTable interface {
 	GetAll() ([]*lq.User, error)
 	GetAllWithPendingJobs() ([]*lq.User, error)
 	Update(uint, string,string) (error)
+	RecordFailedLogin(userID uint) (int, error)
+	Lock(userID uint, until int64) error
+	ResetFailedLogins(userID uint) error
+	SetPassword(userID uint, passwordHash string) error
 }
 
 type usersTable struct{}
@@ -78,15 +80,18 @@ func (table *usersTable) Update(userID uint, field string, value string) (error)
 
 func (table *usersTable) GetAllWithPendingJobs() ([]*lq.User, error) {
 	var users []*lq.User
-	rows, err := db.Raw(fmt.Sprintf("SELECT id, api_key, username, firstname, lastname, email, public_id, " +
-		"aws_account_id  FROM public.user WHERE aws_account_id > 0 AND " +
-			"(SELECT COUNT(*) FROM container_job WHERE owner_id = public.user.id AND status = '%s') > 0",
-			mesos.TaskState_TASK_STAGING.String())).Rows()
+	rows, err := db.Raw(`SELECT id, api_key, username, firstname, lastname, email, public_id, ` +
+		`aws_account_id  FROM "user" WHERE (aws_account_id > 0 OR EXISTS (SELECT 1 FROM membership ` +
+		`JOIN organization ON organization.id = membership.org_id WHERE membership.user_id = "user".id ` +
+		`AND organization.aws_account_id > 0)) AND ` +
+			`(SELECT COUNT(*) FROM container_job WHERE owner_id = "user".id AND status = ?) > 0`,
+			mesos.TaskState_TASK_STAGING.String()).Rows()
 	if err != nil {
 		err = lq.NewErrorf(err, "Failed getting all users with pending jobs in bulk")
 		log.Error(err)
 		return users, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		user := lq.User{}
 		err = rows.Scan(&user.ID, &user.ApiKey, &user.Username, &user.Firstname, &user.Lastname, &user.Email,
@@ -98,4 +103,56 @@ func (table *usersTable) GetAllWithPendingJobs() ([]*lq.User, error) {
 		users = append(users, &user)
 	}
 	return users, nil
-}
\ No newline at end of file
+}
+
+// Counts a failed login, returning the number of consecutive failures. The count is incremented in the database so
+// concurrent attempts are all counted.
+func (table *usersTable) RecordFailedLogin(userID uint) (failures int, err error) {
+	tx := db.Begin()
+	defer TxCommitOrRollback(tx, &err, "Failed recording failed login of user %d", userID)
+
+	if err = tx.Exec("UPDATE \"user\" SET failed_logins = failed_logins + 1 WHERE id = ?", userID).Error; err != nil {
+		return
+	}
+	user := lq.User{}
+	if err = tx.Select("failed_logins").Where("id = ?", userID).First(&user).Error; err != nil {
+		return
+	}
+	failures = user.FailedLogins
+	return
+}
+
+// Refuses logins of the user until the given time in nanoseconds and starts counting failures again
+func (table *usersTable) Lock(userID uint, until int64) error {
+	query := db.Model(&lq.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": until})
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed locking user %d", userID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (table *usersTable) ResetFailedLogins(userID uint) error {
+	query := db.Model(&lq.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": 0})
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed resetting failed logins of user %d", userID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Sets the bcrypt hash of a new password, which also lifts any lockout
+func (table *usersTable) SetPassword(userID uint, passwordHash string) error {
+	query := db.Model(&lq.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"password": passwordHash, "failed_logins": 0, "locked_until": 0})
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed setting password of user %d", userID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
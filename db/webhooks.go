@@ -0,0 +1,197 @@
+package db
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+
+	lq "bargain/liquefy/models"
+)
+
+// Webhook secrets are envelope encrypted like secrets. Only GetForEvent and GetForDelivery decrypt them, to sign
+// deliveries.
+type WebhooksTable interface {
+	Create(hook *lq.Webhook) error
+	Get(webhookID uint) (*lq.Webhook, error)
+	GetByOwner(ownerID uint) ([]*lq.Webhook, error)
+	GetForEvent(event *lq.Event) ([]*lq.Webhook, error)
+	Delete(webhookID uint) error
+
+	GetForDelivery(webhookID uint) (*lq.Webhook, error)
+
+	ClaimDelivery(delivery *lq.WebhookDelivery) (bool, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*lq.WebhookDelivery, error)
+	UpdateDelivery(delivery *lq.WebhookDelivery) error
+	GetDeliveries(webhookID uint, page PageRequest) ([]*lq.WebhookDelivery, error)
+}
+
+type webhooksTable struct{}
+
+func Webhooks() WebhooksTable {
+	return &webhooksTable{}
+}
+
+func (table *webhooksTable) Create(hook *lq.Webhook) error {
+	plaintext := hook.Secret
+	defer func() { hook.Secret = plaintext }()
+
+	encrypted, err := encryptSecretValue(hook.Secret)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed encrypting webhook secret")
+	}
+	hook.Secret = encrypted
+
+	query := db.Create(hook)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed creating webhook for user %d", hook.OwnerID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func (table *webhooksTable) Get(webhookID uint) (*lq.Webhook, error) {
+	var hook lq.Webhook
+	query := db.Find(&hook, webhookID)
+	if query.Error != nil {
+		return nil, lq.NewErrorf(query.Error, "Failed getting webhook %d", webhookID)
+	}
+	hook.Secret = ""
+	return &hook, nil
+}
+
+func (table *webhooksTable) GetByOwner(ownerID uint) ([]*lq.Webhook, error) {
+	hooks := []*lq.Webhook{}
+	query := db.Where("owner_id = ?", ownerID).Order("id").Find(&hooks)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting webhooks of user %d", ownerID)
+		log.Error(err)
+		return hooks, err
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+// The webhooks the event is posted to, with their secrets decrypted
+func (table *webhooksTable) GetForEvent(event *lq.Event) ([]*lq.Webhook, error) {
+	candidates := []*lq.Webhook{}
+	query := db.Where("owner_id = ? OR (org_id <> 0 AND org_id = ?)", event.UserID, event.OrgID).Find(&candidates)
+	if query.Error != nil {
+		return candidates, lq.NewErrorf(query.Error, "Failed getting webhooks of event %s", event.ID)
+	}
+
+	encoder, err := NewEncoder()
+	if err != nil {
+		return []*lq.Webhook{}, err
+	}
+	hooks := []*lq.Webhook{}
+	for _, hook := range candidates {
+		if !hook.Accepts(event) {
+			continue
+		}
+		secret, err := encoder.Decode([]byte(hook.Secret))
+		if err != nil {
+			log.Error(lq.NewErrorf(err, "Failed decrypting secret of webhook %d", hook.ID))
+			continue
+		}
+		hook.Secret = string(secret)
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// The webhook a pending delivery is retried to, with its secret decrypted
+func (table *webhooksTable) GetForDelivery(webhookID uint) (*lq.Webhook, error) {
+	var hook lq.Webhook
+	query := db.Find(&hook, webhookID)
+	if query.Error != nil {
+		return nil, lq.NewErrorf(query.Error, "Failed getting webhook %d", webhookID)
+	}
+
+	encoder, err := NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := encoder.Decode([]byte(hook.Secret))
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed decrypting secret of webhook %d", hook.ID)
+	}
+	hook.Secret = string(secret)
+	return &hook, nil
+}
+
+func (table *webhooksTable) Delete(webhookID uint) error {
+	query := db.Where("id = ?", webhookID).Delete(&lq.Webhook{})
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed deleting webhook %d", webhookID)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Creates the delivery of an event to a webhook. Returns false if another api server already claimed it.
+func (table *webhooksTable) ClaimDelivery(delivery *lq.WebhookDelivery) (bool, error) {
+	delivery.Status = lq.WebhookDeliveryPending
+	query := db.Create(delivery)
+	if pqErr, ok := query.Error.(*pq.Error); ok && pqErr.Code == "23505" { // unique_violation
+		return false, nil
+	}
+	if query.Error != nil {
+		return false, lq.NewErrorf(query.Error, "Failed creating delivery of event %s to webhook %d",
+			delivery.EventID, delivery.WebhookID)
+	}
+	return true, nil
+}
+
+// Takes up to limit pending deliveries whose next attempt is due, oldest first. They are leased by moving their next
+// attempt past the lease, so that other api servers do not take them while they are attempted, and so that they are
+// taken again if this one stops before updating them.
+func (table *webhooksTable) ClaimDueDeliveries(now time.Time, lease time.Duration,
+	limit int) ([]*lq.WebhookDelivery, error) {
+	deliveries := []*lq.WebhookDelivery{}
+	query := db.Raw(`UPDATE webhook_delivery SET next_attempt_at = ? WHERE id IN (
+		SELECT id FROM webhook_delivery WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED
+	) RETURNING *`, now.Add(lease).UnixNano(), lq.WebhookDeliveryPending, now.UnixNano(), limit).Scan(&deliveries)
+	if query.Error != nil {
+		return deliveries, lq.NewErrorf(query.Error, "Failed claiming due webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// Records an attempt of the delivery. The payload is only kept while the delivery is pending.
+func (table *webhooksTable) UpdateDelivery(delivery *lq.WebhookDelivery) error {
+	if delivery.Status != lq.WebhookDeliveryPending {
+		delivery.Payload = ""
+		delivery.NextAttemptAt = 0
+	}
+	query := db.Model(delivery).UpdateColumns(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"response_code":   delivery.ResponseCode,
+		"error":           delivery.Error,
+		"payload":         delivery.Payload,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"updated_at":      delivery.UpdatedAt,
+	})
+	if query.Error != nil {
+		return lq.NewErrorf(query.Error, "Failed updating delivery %d", delivery.ID)
+	}
+	return nil
+}
+
+// Deliveries of the webhook, most recent first
+func (table *webhooksTable) GetDeliveries(webhookID uint, page PageRequest) ([]*lq.WebhookDelivery, error) {
+	deliveries := []*lq.WebhookDelivery{}
+	query := page.apply(db.Where("webhook_id = ?", webhookID)).Find(&deliveries)
+	if query.Error != nil {
+		err := lq.NewErrorf(query.Error, "Failed getting deliveries of webhook %d", webhookID)
+		log.Error(err)
+		return deliveries, err
+	}
+	return deliveries, nil
+}
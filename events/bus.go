@@ -0,0 +1,197 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+	"github.com/pborman/uuid"
+
+	"bargain/liquefy/cache"
+	lq "bargain/liquefy/models"
+)
+
+// Subscribers that fall this far behind miss events rather than block publishers
+const subscriberBuffer = 256
+
+// Bus carries events from the services emitting them, ex: the scheduler setting the status of a job, to the api
+// server notifying users
+type Bus interface {
+	Publish(event *lq.Event) error
+	// Events published from now on, until the returned function is called
+	Subscribe() (<-chan *lq.Event, func())
+}
+
+var (
+	busMutex sync.Mutex
+	bus      Bus
+)
+
+// Services share events through redis, unless LQ_EVENT_BUS is memory which keeps them in the process
+func NewBusFromEnv() (Bus, error) {
+	switch kind := os.Getenv("LQ_EVENT_BUS"); kind {
+	case "", "redis":
+		return NewRedisBus(cache.GetConnection), nil
+	case "memory":
+		return NewMemoryBus(), nil
+	default:
+		return nil, fmt.Errorf("Unknown LQ_EVENT_BUS %s, must be redis or memory", kind)
+	}
+}
+
+func SetBus(b Bus) {
+	busMutex.Lock()
+	defer busMutex.Unlock()
+	bus = b
+}
+
+func GetBus() Bus {
+	busMutex.Lock()
+	defer busMutex.Unlock()
+	if bus == nil {
+		var err error
+		if bus, err = NewBusFromEnv(); err != nil {
+			panic(err)
+		}
+	}
+	return bus
+}
+
+// Publishes an event of the owner of a job or instance. Notifications are best effort, failures are logged and do not
+// fail what emitted the event.
+func Publish(eventType string, userID, orgID, subjectID uint, data map[string]interface{}) {
+	event := &lq.Event{
+		ID:        uuid.NewRandom().String(),
+		Type:      eventType,
+		Time:      time.Now().UTC().UnixNano(),
+		UserID:    userID,
+		OrgID:     orgID,
+		SubjectID: subjectID,
+		Data:      data,
+	}
+	if err := GetBus().Publish(event); err != nil {
+		log.Warn(lq.NewErrorf(err, "Failed publishing %s event of user %d", eventType, userID))
+	}
+}
+
+type subscribers struct {
+	mutex    sync.Mutex
+	channels map[chan *lq.Event]struct{}
+}
+
+func (subs *subscribers) add() (chan *lq.Event, func()) {
+	channel := make(chan *lq.Event, subscriberBuffer)
+	subs.mutex.Lock()
+	subs.channels[channel] = struct{}{}
+	subs.mutex.Unlock()
+
+	var once sync.Once
+	return channel, func() {
+		once.Do(func() {
+			subs.mutex.Lock()
+			delete(subs.channels, channel)
+			subs.mutex.Unlock()
+			close(channel)
+		})
+	}
+}
+
+func (subs *subscribers) send(event *lq.Event) {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+	for channel := range subs.channels {
+		select {
+		case channel <- event:
+		default:
+			log.Warnf("Dropping event %s for a slow subscriber", event.ID)
+		}
+	}
+}
+
+// Delivers events to subscribers of the same process, for tests and single process deployments
+type memoryBus struct {
+	subscribers
+}
+
+func NewMemoryBus() Bus {
+	return &memoryBus{subscribers{channels: make(map[chan *lq.Event]struct{})}}
+}
+
+func (b *memoryBus) Publish(event *lq.Event) error {
+	b.send(event)
+	return nil
+}
+
+func (b *memoryBus) Subscribe() (<-chan *lq.Event, func()) {
+	return b.add()
+}
+
+const redisChannel = "liquefy|events"
+
+// Publishes events on a redis channel. A process subscribes to the channel once, and fans events out to its own
+// subscribers.
+type redisBus struct {
+	subscribers
+	getConnection func() redis.Conn
+	listenOnce    sync.Once
+}
+
+func NewRedisBus(getConnection func() redis.Conn) Bus {
+	return &redisBus{
+		subscribers:   subscribers{channels: make(map[chan *lq.Event]struct{})},
+		getConnection: getConnection,
+	}
+}
+
+func (b *redisBus) Publish(event *lq.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	conn := b.getConnection()
+	defer conn.Close()
+	_, err = conn.Do("PUBLISH", redisChannel, payload)
+	return err
+}
+
+func (b *redisBus) Subscribe() (<-chan *lq.Event, func()) {
+	b.listenOnce.Do(func() {
+		go b.listen()
+	})
+	return b.add()
+}
+
+// Receives the events of every service, reconnecting when the connection to redis is lost
+func (b *redisBus) listen() {
+	for {
+		conn := redis.PubSubConn{Conn: b.getConnection()}
+		if err := conn.Subscribe(redisChannel); err != nil {
+			log.Error(lq.NewErrorf(err, "Failed subscribing to events"))
+		} else {
+			b.receive(conn)
+		}
+		conn.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+func (b *redisBus) receive(conn redis.PubSubConn) {
+	for {
+		switch message := conn.Receive().(type) {
+		case redis.Message:
+			event := &lq.Event{}
+			if err := json.Unmarshal(message.Data, event); err != nil {
+				log.Warn(lq.NewErrorf(err, "Failed parsing event"))
+				continue
+			}
+			b.send(event)
+		case error:
+			log.Error(lq.NewErrorf(message, "Lost the connection to the event bus"))
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestMemoryBus(t *testing.T) {
+	SetBus(NewMemoryBus())
+	defer SetBus(nil)
+
+	first, unsubscribeFirst := GetBus().Subscribe()
+	second, unsubscribeSecond := GetBus().Subscribe()
+	defer unsubscribeSecond()
+
+	Publish(lq.EventJobStatus, 4, 2, 9, map[string]interface{}{"status": "TASK_RUNNING"})
+	for _, received := range []<-chan *lq.Event{first, second} {
+		event := <-received
+		assert.Equal(t, lq.EventJobStatus, event.Type)
+		assert.Equal(t, uint(4), event.UserID)
+		assert.Equal(t, uint(2), event.OrgID)
+		assert.Equal(t, uint(9), event.SubjectID)
+		assert.NotEmpty(t, event.ID)
+	}
+
+	// Unsubscribed channels are closed and receive nothing more
+	unsubscribeFirst()
+	unsubscribeFirst()
+	Publish(lq.EventJobStatus, 4, 0, 10, nil)
+	_, open := <-first
+	assert.False(t, open)
+	assert.Equal(t, uint(10), (<-second).SubjectID)
+}
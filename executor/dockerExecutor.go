@@ -6,8 +6,6 @@ import (
 	"io"
 	"encoding/json"
 	"strconv"
-	"time"
-	"bytes"
 
 	"github.com/fsouza/go-dockerclient"
 	log "github.com/Sirupsen/logrus"
@@ -25,13 +23,18 @@ const Container_Unknown ContainerState = "unknown"
 
 type DockerExecutor interface {
 	Start(job *lq.ContainerJob) (string, error)
-	CreateContainer(job *lq.ContainerJob) (string, error)
+	CreateContainer(job *lq.ContainerJob, buildLog io.Writer) (string, error)
+	BuildImage(job *lq.ContainerJob, buildLog io.Writer) (string, error)
 	ContainerStatus(job *lq.ContainerJob) (ContainerState, error)
 	CleanUp(job *lq.ContainerJob) error
 	AttachContainer(id string, stdIn io.Reader, stdOut, stdErr io.Writer) error
 	WaitOnContainer(id string) (int, error)
 	ListAllContainers() ([]docker.APIContainers, error)
 	KillContainer(jobId uint) error
+	RestartContainer(id string) error
+	CheckHealth(job *lq.ContainerJob, check *lq.HealthCheck) error
+	ReleaseImage(jobId uint)
+	CollectImages() (*lq.DiskStatus, error)
 }
 
 type dockerExecutor struct {
@@ -40,6 +43,7 @@ type dockerExecutor struct {
 	key         string
 	port        int
 	client      *docker.Client
+	images      *imageCache
 }
 
 func NewDockerExecutor(dockerEndpoint string) DockerExecutor{
@@ -56,7 +60,7 @@ func NewDockerExecutor(dockerEndpoint string) DockerExecutor{
 		panic(err)
 	}
 
-	return &dockerExecutor{ca: "", cert: "", key: "", port: 2375 , client: client}
+	return &dockerExecutor{ca: "", cert: "", key: "", port: 2375 , client: client, images: newImageCache(client)}
 }
 
 func NewDockerExecutorFromEnv() DockerExecutor {
@@ -66,7 +70,7 @@ func NewDockerExecutorFromEnv() DockerExecutor {
 		panic(err)
 	}
 
-	return &dockerExecutor{ca: "", cert: "", key: "", port: 2375 , client: client}
+	return &dockerExecutor{ca: "", cert: "", key: "", port: 2375 , client: client, images: newImageCache(client)}
 }
 
 func (e *dockerExecutor) Start(job *lq.ContainerJob) (string,error) {
@@ -125,22 +129,27 @@ func (e *dockerExecutor) CleanUp(job *lq.ContainerJob) error {
 	return nil
 }
 
-func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob) (string, error) {
+func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob, buildLog io.Writer) (string, error) {
 	//Default
 	var image string
 
 	//Build Image or ensure
+	//The image is acquired before it is pulled or built, so that it is not collected before the container is created
 	if (ctJob.SourceType == "code") {
-		if err := executor.buildImageFromRepo(ctJob); err != nil {
+		builtImage, err := executor.BuildImage(ctJob, buildLog)
+		if err != nil {
 			log.Error("Container image build failed")
+			executor.images.Release(ctJob.ID)
 			return "", err
 		}
-		image = "localbuild" + strconv.Itoa(int(ctJob.ID))
+		image = builtImage
 	} else if (ctJob.SourceType == "image") {
 		// if the pull fails, then send status FAILED for this job
+		executor.images.Acquire(ctJob.ID, ctJob.SourceImage)
 		err := executor.pullImage(ctJob.SourceImage, false)
 		if err != nil {
 			log.Error("Container image ensure failed")
+			executor.images.Release(ctJob.ID)
 			return "", err
 		}
 		image = ctJob.SourceImage
@@ -158,6 +167,7 @@ func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob) (string,
 	for i, envVar := range envVars {
 		env[i] = fmt.Sprintf("%s=%s", envVar.Variable, envVar.Value)
 	}
+	env = append(env, secretEnv(ctJob)...)
 
 	config := &docker.Config{
 		Image:     image,
@@ -171,9 +181,9 @@ func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob) (string,
 	}
 
 	// Add port bindings if they exist
-	var portMappings []lq.PortMapping
-	if err := json.Unmarshal([]byte(ctJob.PortMappings), &portMappings); err != nil {
-		return "", lq.NewErrorf(err, "Failed parsing port mappings from string %s", ctJob.Environment)
+	portMappings, err := ctJob.GetPortMappings()
+	if err != nil {
+		return "", err
 	}
 
 	portBindings := make(map[docker.Port][]docker.PortBinding)
@@ -194,6 +204,12 @@ func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob) (string,
 		NetworkMode: networkMode,
 	}
 
+	// Jobs on instance store get their own scratch directory on the instance store volumes
+	if ctJob.InstanceStore {
+		scratchDir := fmt.Sprintf("%s/job-%d", lq.InstanceStoreMountPath, ctJob.ID)
+		hostConfig.Binds = []string{ scratchDir + ":" + lq.InstanceStoreContainerPath }
+	}
+
 	//If the container is GPU container, perform mount devnodes
 	if (ctJob.Gpu > 0 ) {
 		cGroupPerms := "rwm"
@@ -230,6 +246,25 @@ func (executor *dockerExecutor) CreateContainer(ctJob *lq.ContainerJob) (string,
 		hostConfig.Binds = cudaLibs
 	}
 
+	// Secret files are mounted read only from tmpfs rather than written into the container
+	imageUser := ""
+	if hasSecretFiles(ctJob) {
+		inspected, err := executor.client.InspectImage(image)
+		if err != nil {
+			return "", lq.NewErrorf(err, "Failed inspecting image %s", image)
+		}
+		if inspected.Config != nil {
+			imageUser = inspected.Config.User
+		}
+	}
+	secretsDir, err := writeSecretFiles(ctJob, imageUser)
+	if err != nil {
+		return "", err
+	}
+	if secretsDir != "" {
+		hostConfig.Binds = append(hostConfig.Binds, secretsDir + ":" + lq.SecretsContainerPath + ":ro")
+	}
+
 	opts := docker.CreateContainerOptions{
 		Name: executor.getContainerName(ctJob.ID),
 		Config: config,
@@ -322,6 +357,15 @@ func (executor *dockerExecutor) KillContainer(jobId uint) error {
 //	return err
 //}
 
+// Allows the image of a finished job to be collected
+func (executor *dockerExecutor) ReleaseImage(jobId uint) {
+	executor.images.Release(jobId)
+}
+
+func (executor *dockerExecutor) CollectImages() (*lq.DiskStatus, error) {
+	return executor.images.Collect()
+}
+
 func (executor *dockerExecutor) pullImage(name string, force bool) error {
 	log.Infof("Pulling image %s", name)
 	_, err := executor.client.InspectImage(name)
@@ -344,39 +388,6 @@ func (executor *dockerExecutor) pullImage(name string, force bool) error {
 	return nil
 }
 
-func (e *dockerExecutor) buildImageFromRepo(ctJob *lq.ContainerJob) error{
-	//TODO: Maybe chroot here for security
-	//TODO :Cleanup io reader
-
-	log.Info("Cloning Repo")
-
-	buf := new(bytes.Buffer)
-	r := new(bytes.Buffer)
-
-	name:= "localbuild" + strconv.Itoa(int(ctJob.ID))
-
-	opts := docker.BuildImageOptions{
-		Name: name,
-		Remote: ctJob.SourceImage,
-		Memory: int64(ctJob.Ram * 1024 * 1024),
-		InputStream: r,
-		OutputStream: buf,
-	}
-
-	go func(){
-		for true {
-			log.Info(buf.String())
-			time.Sleep(10000 * time.Duration(time.Millisecond))
-		}
-	}()
-
-	log.Info("Starting Build Process")
-	err := e.client.BuildImage(opts)
-	log.Info("Build Complete")
-
-	return err
-}
-
 func (executor *dockerExecutor) removeImage(name string) error {
 	log.Infof("Removing image %s", name)
 	err := executor.client.RemoveImage(name)
@@ -5,6 +5,8 @@ import (
 	log "github.com/Sirupsen/logrus"
 	mesosExecutor "github.com/mesos/mesos-go/executor"
 	"bargain/liquefy/logging"
+	"bargain/liquefy/metrics"
+	"bargain/liquefy/tracing"
 	"runtime"
 	"time"
 	"flag"
@@ -17,14 +19,31 @@ func main() {
 	log.SetLevel(log.DebugLevel)
 
 	esIp := flag.String("esIp", "", "the ip of the es server for logs")
+	logSinks := flag.String("logSinks", "stdout",
+		"where logs are shipped, comma separated: stdout, file:///path or http://host:port of elasticsearch")
+	metricsAddr := flag.String("metricsAddr", ":9104", "address to serve /metrics on, empty to disable it")
+	traceExporter := flag.String("traceExporter", os.Getenv(tracing.TraceExporterEnv),
+		"where spans are exported: none, stdout or file:///path")
 	flag.Parse()
 
+	sinkSpec := *logSinks
 	if *esIp != "" {
-		identifier := "slave-" + os.Getenv("RESOURCE_ID")
-		log.AddHook(logging.NewElasticHook(*esIp, "9200", "liquefyslave-",identifier,""))
+		sinkSpec += ",http://" + *esIp + ":9200"
 	}
+	sinks, err := logging.ParseSinks(sinkSpec, "liquefyslave-", "executor")
+	if err != nil {
+		panic(err)
+	}
+	logging.Setup("executor", log.Fields{logging.FieldResourceID: os.Getenv("RESOURCE_ID")}, sinks...)
+
+	exporter, err := tracing.NewExporter(*traceExporter)
+	if err != nil {
+		log.Error(err)
+	}
+	tracing.SetExporter(exporter)
 
 	runtime.GOMAXPROCS(256)
+	metrics.Serve(*metricsAddr)
 
 	config := mesosExecutor.DriverConfig{
 		Executor: lqExecutor.NewLiquidExecutor("unix:///var/run/docker.sock"),
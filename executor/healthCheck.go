@@ -0,0 +1,102 @@
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+
+	lq "bargain/liquefy/models"
+)
+
+// CheckHealth runs a single health check against the container of a service job.
+// Http and tcp checks connect to the container directly on its bridge network address.
+func (executor *dockerExecutor) CheckHealth(job *lq.ContainerJob, check *lq.HealthCheck) error {
+	timeout := time.Duration(check.TimeoutSeconds) * time.Second
+
+	switch check.Type {
+	case lq.HealthCheckHttp, lq.HealthCheckTcp:
+		container, err := executor.client.InspectContainer(job.ContainerId)
+		if err != nil {
+			return lq.NewErrorf(err, "Failed inspecting container %s", job.ContainerId)
+		}
+		if container.NetworkSettings == nil || container.NetworkSettings.IPAddress == "" {
+			return fmt.Errorf("Container %s has no ip address", job.ContainerId)
+		}
+		address := net.JoinHostPort(container.NetworkSettings.IPAddress, strconv.Itoa(check.Port))
+
+		if check.Type == lq.HealthCheckTcp {
+			conn, err := net.DialTimeout("tcp", address, timeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", address, check.Path))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("Health check %s returned status %d", check.Path, resp.StatusCode)
+		}
+		return nil
+
+	case lq.HealthCheckCommand:
+		return executor.execHealthCheck(job, check.Command, timeout)
+	}
+
+	return fmt.Errorf("Invalid health check type %s", check.Type)
+}
+
+func (executor *dockerExecutor) execHealthCheck(job *lq.ContainerJob, command string, timeout time.Duration) error {
+	exec, err := executor.client.CreateExec(docker.CreateExecOptions{
+		Container:    job.ContainerId,
+		Cmd:          []string{"sh", "-c", command},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return lq.NewErrorf(err, "Failed creating health check exec in container %s", job.ContainerId)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.client.StartExec(exec.ID, docker.StartExecOptions{
+			OutputStream: ioutil.Discard,
+			ErrorStream:  ioutil.Discard,
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return lq.NewErrorf(err, "Failed running health check in container %s", job.ContainerId)
+		}
+	case <-time.After(timeout):
+		return fmt.Errorf("Health check command timed out after %s", timeout)
+	}
+
+	inspect, err := executor.client.InspectExec(exec.ID)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed inspecting health check exec in container %s", job.ContainerId)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("Health check command exited with code %d", inspect.ExitCode)
+	}
+	return nil
+}
+
+func (executor *dockerExecutor) RestartContainer(id string) error {
+	// Give the service 10 seconds to stop gracefully before it is killed
+	if err := executor.client.RestartContainer(id, 10); err != nil {
+		return lq.NewErrorf(err, "Failed restarting container %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+
+	lq "bargain/liquefy/models"
+)
+
+// Images built from source are tagged with the commit sha and build context they were built from, so a job building
+// a commit that was already built on this host (or pushed to the jobs registry) reuses the existing image instead of
+// rebuilding.
+const BuildRepositoryPrefix = "liquefy/build-"
+
+// Only the tail of the build output is reported back to the scheduler
+const MaxReportedBuildLog = 64 * 1024
+
+// BuildImage resolves the commit to build, and returns the name of an image for that commit. The image is reused
+// from the local host or pulled from the build registry if possible, otherwise it is built and pushed.
+// All build output is written to buildLog. The image is acquired for the job once its name is known.
+func (executor *dockerExecutor) BuildImage(job *lq.ContainerJob, buildLog io.Writer) (string, error) {
+	sha, err := resolveCommit(job)
+	if err != nil {
+		return "", lq.NewErrorf(err, "Failed resolving commit to build for job %d", job.ID)
+	}
+
+	repository := buildRepository(job)
+	tag := buildTag(job, sha)
+	image := fmt.Sprintf("%s:%s", repository, tag)
+	fmt.Fprintf(buildLog, "Building %s at commit %s as %s\n", job.SourceImage, sha, image)
+	executor.images.Acquire(job.ID, image)
+
+	// Reuse a previous build of the same commit on this host
+	if _, err := executor.client.InspectImage(image); err == nil {
+		fmt.Fprintf(buildLog, "Reusing existing image %s\n", image)
+		return image, nil
+	} else if err != docker.ErrNoSuchImage {
+		return "", lq.NewErrorf(err, "Failed inspecting image %s", image)
+	}
+
+	// Another instance may have built and pushed this commit already
+	if job.BuildRegistry != "" {
+		err := executor.client.PullImage(docker.PullImageOptions{
+			Repository:   repository,
+			Tag:          tag,
+			OutputStream: buildLog,
+		}, registryAuth(repository))
+		if err == nil {
+			fmt.Fprintf(buildLog, "Pulled existing image %s\n", image)
+			return image, nil
+		}
+		fmt.Fprintf(buildLog, "Could not pull %s, building instead: %s\n", image, err)
+	}
+
+	log.Infof("Building image %s for job %d", image, job.ID)
+	opts := docker.BuildImageOptions{
+		Name:         image,
+		Remote:       buildRemote(job, sha),
+		Dockerfile:   job.Dockerfile,
+		Memory:       int64(job.Ram * 1024 * 1024),
+		InputStream:  new(bytes.Buffer),
+		OutputStream: buildLog,
+	}
+	if err := executor.client.BuildImage(opts); err != nil {
+		return "", lq.NewErrorf(err, "Failed building image %s for job %d", image, job.ID)
+	}
+	log.Infof("Built image %s for job %d", image, job.ID)
+
+	// A failed push only costs other instances a rebuild, so it does not fail the job
+	if job.BuildRegistry != "" {
+		err := executor.client.PushImage(docker.PushImageOptions{
+			Name:         repository,
+			Tag:          tag,
+			OutputStream: buildLog,
+		}, registryAuth(repository))
+		if err != nil {
+			log.Warn(lq.NewErrorf(err, "Failed pushing image %s", image))
+			fmt.Fprintf(buildLog, "Failed pushing image %s: %s\n", image, err)
+		}
+	}
+
+	return image, nil
+}
+
+// The repository built images are tagged in. Without a registry, the name is derived from the source repository.
+func buildRepository(job *lq.ContainerJob) string {
+	if job.BuildRegistry != "" {
+		return job.BuildRegistry
+	}
+	return fmt.Sprintf("%s%x", BuildRepositoryPrefix, md5.Sum([]byte(job.SourceImage)))
+}
+
+// The tag of an image is the commit along with a hash of the build context and Dockerfile, which also change the
+// result of a build, ex: a1b2c3-5d41402abc4b
+func buildTag(job *lq.ContainerJob, sha string) string {
+	key := strings.Join([]string{path.Clean("/" + job.SourceDir), job.Dockerfile}, "|")
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(key)))
+	return sha + "-" + hash[:12]
+}
+
+// Docker accepts remote git contexts of the form <repo>#<ref>:<subdirectory>
+func buildRemote(job *lq.ContainerJob, sha string) string {
+	repo := job.SourceImage
+	if !strings.HasSuffix(repo, ".git") {
+		repo += ".git"
+	}
+
+	remote := fmt.Sprintf("%s#%s", repo, sha)
+	if dir := strings.Trim(path.Clean("/"+job.SourceDir), "/"); dir != "" {
+		remote += ":" + dir
+	}
+	return remote
+}
+
+// The commit to build is either pinned in the job, or the current head of the requested branch
+func resolveCommit(job *lq.ContainerJob) (string, error) {
+	if job.SourceCommit != "" {
+		return job.SourceCommit, nil
+	}
+
+	ref := "HEAD"
+	if job.SourceBranch != "" {
+		ref = "refs/heads/" + job.SourceBranch
+	}
+
+	output, err := exec.Command("git", "ls-remote", job.SourceImage, ref).Output()
+	if err != nil {
+		return "", lq.NewErrorf(err, "Failed listing remote refs of %s", job.SourceImage)
+	}
+
+	sha := parseLsRemote(output, ref)
+	if sha == "" {
+		return "", lq.NewErrorf(nil, "Could not find %s in %s", ref, job.SourceImage)
+	}
+	return sha, nil
+}
+
+// Parses the output of git ls-remote, which is a line of "<sha>\t<ref>" per matching ref
+func parseLsRemote(output []byte, ref string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// Credentials for the registry hosting repository are taken from the docker config of the host, if any
+func registryAuth(repository string) docker.AuthConfiguration {
+	auths, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		return docker.AuthConfiguration{}
+	}
+
+	registry := "https://index.docker.io/v1/"
+	if parts := strings.SplitN(repository, "/", 2); len(parts) == 2 && strings.ContainsAny(parts[0], ".:") {
+		registry = parts[0]
+	}
+
+	if auth, ok := auths.Configs[registry]; ok {
+		return auth
+	}
+	return docker.AuthConfiguration{}
+}
+
+// tailBuildLog trims a build log down to the size reported to the scheduler
+func tailBuildLog(buildLog string) string {
+	if len(buildLog) <= MaxReportedBuildLog {
+		return buildLog
+	}
+	return buildLog[len(buildLog)-MaxReportedBuildLog:]
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func TestBuildRepository(t *testing.T) {
+	job := &lq.ContainerJob{
+		SourceImage: "https://github.com/liquefy/example",
+		SourceDir:   "service",
+	}
+
+	repository := buildRepository(job)
+	assert.True(t, strings.HasPrefix(repository, BuildRepositoryPrefix))
+
+	// The same source builds into the same repository, regardless of the job
+	assert.Equal(t, repository, buildRepository(&lq.ContainerJob{
+		ID:          7,
+		SourceImage: "https://github.com/liquefy/example",
+		SourceDir:   "service",
+	}))
+
+	// A different source builds into a different repository
+	assert.NotEqual(t, repository, buildRepository(&lq.ContainerJob{
+		SourceImage: "https://github.com/liquefy/other",
+		SourceDir:   "service",
+	}))
+
+	job.BuildRegistry = "registry.example.com/liquefy/example"
+	assert.Equal(t, "registry.example.com/liquefy/example", buildRepository(job))
+}
+
+func TestBuildTag(t *testing.T) {
+	job := &lq.ContainerJob{
+		SourceImage:   "https://github.com/liquefy/example",
+		SourceDir:     "service",
+		BuildRegistry: "registry.example.com/liquefy/example",
+	}
+
+	tag := buildTag(job, "a1b2c3")
+	assert.True(t, strings.HasPrefix(tag, "a1b2c3-"))
+	assert.Equal(t, tag, buildTag(&lq.ContainerJob{SourceDir: "/service/"}, "a1b2c3"))
+
+	// The same commit with another build context or Dockerfile is another image, even in the same registry
+	assert.NotEqual(t, tag, buildTag(&lq.ContainerJob{SourceDir: "worker"}, "a1b2c3"))
+	assert.NotEqual(t, tag, buildTag(&lq.ContainerJob{SourceDir: "service", Dockerfile: "Dockerfile.gpu"}, "a1b2c3"))
+}
+
+func TestBuildRemote(t *testing.T) {
+	job := &lq.ContainerJob{
+		SourceImage: "https://github.com/liquefy/example",
+	}
+	assert.Equal(t, "https://github.com/liquefy/example.git#abc123", buildRemote(job, "abc123"))
+
+	job.SourceImage = "https://github.com/liquefy/example.git"
+	job.SourceDir = "/service/api/"
+	assert.Equal(t, "https://github.com/liquefy/example.git#abc123:service/api", buildRemote(job, "abc123"))
+}
+
+func TestParseLsRemote(t *testing.T) {
+	output := []byte("a1b2c3\trefs/heads/master\nd4e5f6\trefs/heads/develop\n")
+	assert.Equal(t, "d4e5f6", parseLsRemote(output, "refs/heads/develop"))
+	assert.Equal(t, "a1b2c3", parseLsRemote(output, "refs/heads/master"))
+	assert.Equal(t, "", parseLsRemote(output, "refs/heads/missing"))
+}
+
+func TestResolvePinnedCommit(t *testing.T) {
+	sha, err := resolveCommit(&lq.ContainerJob{
+		SourceImage:  "https://github.com/liquefy/example",
+		SourceCommit: "a1b2c3",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "a1b2c3", sha)
+}
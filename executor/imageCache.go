@@ -0,0 +1,232 @@
+package executor
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+
+	lq "bargain/liquefy/models"
+)
+
+// Images are collected once the disk holding them is more than ImageGCHighWaterMark full, evicting the least
+// recently used images until it is at most ImageGCLowWaterMark full.
+var ImageGCHighWaterMark = 0.85
+var ImageGCLowWaterMark = 0.70
+var ImageGCInterval = time.Duration(1) * time.Minute
+
+// The executor runs inside the mesos-slave container, where /var/lib/mesos is mounted from the root volume of the
+// instance that also holds Docker's root directory. Docker's root directory itself is not mounted into the slave, as
+// bind mounting it keeps the mounts of containers busy on the host.
+var ImageGCDiskPath = "/var/lib/mesos"
+
+// imageCache tracks when images were last used by a job on this host and removes unused images under disk pressure
+type imageCache struct {
+	client   *docker.Client
+	mutex    sync.Mutex
+	lastUsed map[string]time.Time // normalized image name -> last time a job was created from it
+	inUse    map[uint]string      // job id -> normalized image of a running task
+}
+
+func newImageCache(client *docker.Client) *imageCache {
+	return &imageCache{
+		client:   client,
+		lastUsed: make(map[string]time.Time),
+		inUse:    make(map[uint]string),
+	}
+}
+
+// Acquire marks the image as used by a job, which protects it from eviction until it is released
+func (cache *imageCache) Acquire(jobID uint, image string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	image = normalizeImageName(image)
+	cache.lastUsed[image] = time.Now()
+	cache.inUse[jobID] = image
+}
+
+func (cache *imageCache) Release(jobID uint) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if image, ok := cache.inUse[jobID]; ok {
+		cache.lastUsed[image] = time.Now()
+		delete(cache.inUse, jobID)
+	}
+}
+
+// Collect evicts least recently used images if the disk is above the high water mark, and returns the disk usage
+// after collection
+func (cache *imageCache) Collect() (*lq.DiskStatus, error) {
+	used, err := diskUsedFraction(ImageGCDiskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &lq.DiskStatus{UsedFraction: used}
+	if used <= ImageGCHighWaterMark {
+		return status, nil
+	}
+	log.Infof("Disk is %.0f%% full, collecting images", used*100)
+
+	images, err := cache.client.ListImages(docker.ListImagesOptions{All: false})
+	if err != nil {
+		return status, lq.NewErrorf(err, "Failed listing images for collection")
+	}
+	containers, err := cache.client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		return status, lq.NewErrorf(err, "Failed listing containers for image collection")
+	}
+
+	lastUsed, protected := cache.snapshot(containers)
+	for _, image := range gcCandidates(images, lastUsed, protected) {
+		if used <= ImageGCLowWaterMark {
+			break
+		}
+
+		if err := cache.remove(image); err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		if used, err = diskUsedFraction(ImageGCDiskPath); err != nil {
+			return status, err
+		}
+	}
+
+	status.UsedFraction = used
+	status.Pressure = used > ImageGCHighWaterMark
+	if status.Pressure {
+		log.Warnf("Disk is still %.0f%% full after collecting all unused images", used*100)
+	}
+	return status, nil
+}
+
+// The normalized names of the images that were used, with when, and of the images that must be kept: those of
+// running tasks and of any existing container, including the mesos-slave and logger
+func (cache *imageCache) snapshot(containers []docker.APIContainers) (map[string]time.Time, map[string]struct{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	protected := make(map[string]struct{})
+	for _, image := range cache.inUse {
+		protected[image] = struct{}{}
+	}
+	for _, container := range containers {
+		protected[normalizeImageName(container.Image)] = struct{}{}
+	}
+	lastUsed := make(map[string]time.Time)
+	for image, usedAt := range cache.lastUsed {
+		lastUsed[image] = usedAt
+	}
+	return lastUsed, protected
+}
+
+func (cache *imageCache) remove(image docker.APIImages) error {
+	names := image.RepoTags
+	if len(names) == 0 || (len(names) == 1 && names[0] == "<none>:<none>") {
+		names = []string{image.ID}
+	}
+
+	for _, name := range names {
+		log.Infof("Evicting image %s", name)
+		if err := cache.client.RemoveImage(name); err != nil {
+			return lq.NewErrorf(err, "Failed evicting image %s", name)
+		}
+
+		cache.mutex.Lock()
+		delete(cache.lastUsed, normalizeImageName(name))
+		cache.mutex.Unlock()
+	}
+	return nil
+}
+
+// Orders the images that may be evicted from least to most recently used. Images never used by a job on this host
+// are considered last used when they were created.
+func gcCandidates(images []docker.APIImages, lastUsed map[string]time.Time,
+	protected map[string]struct{}) []docker.APIImages {
+	candidates := []docker.APIImages{}
+	usedAt := make(map[string]time.Time)
+
+	for _, image := range images {
+		names := []string{image.ID}
+		for _, tag := range image.RepoTags {
+			names = append(names, normalizeImageName(tag))
+		}
+
+		isProtected := false
+		latest := time.Unix(image.Created, 0)
+		for _, name := range names {
+			if _, ok := protected[name]; ok {
+				isProtected = true
+				break
+			}
+			if t, ok := lastUsed[name]; ok && t.After(latest) {
+				latest = t
+			}
+		}
+
+		if !isProtected {
+			candidates = append(candidates, image)
+			usedAt[image.ID] = latest
+		}
+	}
+
+	sort.Sort(byLastUsed{candidates, usedAt})
+	return candidates
+}
+
+type byLastUsed struct {
+	images []docker.APIImages
+	usedAt map[string]time.Time
+}
+
+func (s byLastUsed) Len() int      { return len(s.images) }
+func (s byLastUsed) Swap(i, j int) { s.images[i], s.images[j] = s.images[j], s.images[i] }
+func (s byLastUsed) Less(i, j int) bool {
+	return s.usedAt[s.images[i].ID].Before(s.usedAt[s.images[j].ID])
+}
+
+// Names an image the way Docker resolves references, so that the names jobs use and the tags Docker lists compare
+// equal: images of Docker Hub get the docker.io domain, official images the library namespace, and untagged names
+// the latest tag. Image ids are left as they are.
+func normalizeImageName(name string) string {
+	if strings.HasPrefix(name, "sha256:") || imageIDRegexp.MatchString(name) {
+		return name
+	}
+
+	repository, suffix := name, ""
+	if at := strings.Index(name, "@"); at >= 0 {
+		repository, suffix = name[:at], name[at:]
+	} else if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		repository, suffix = name[:colon], name[colon:]
+	} else {
+		suffix = ":latest"
+	}
+
+	slash := strings.Index(repository, "/")
+	switch {
+	case slash < 0:
+		repository = "docker.io/library/" + repository
+	case !strings.ContainsAny(repository[:slash], ".:") && repository[:slash] != "localhost":
+		repository = "docker.io/" + repository
+	}
+	return repository + suffix
+}
+
+var imageIDRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+func diskUsedFraction(path string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0.0, lq.NewErrorf(err, "Failed getting disk usage of %s", path)
+	}
+	if stat.Blocks == 0 {
+		return 0.0, nil
+	}
+	return 1.0 - float64(stat.Bavail)/float64(stat.Blocks), nil
+}
@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGcCandidatesOrder(t *testing.T) {
+	now := time.Now()
+	images := []docker.APIImages{
+		{ID: "a", RepoTags: []string{"app:a"}, Created: now.Add(-time.Hour).Unix()},
+		{ID: "b", RepoTags: []string{"app:b"}, Created: now.Add(-3 * time.Hour).Unix()},
+		{ID: "c", RepoTags: []string{"app:c"}, Created: now.Add(-2 * time.Hour).Unix()},
+	}
+
+	// b was created first but used most recently
+	lastUsed := map[string]time.Time{"docker.io/library/app:b": now.Add(-time.Minute)}
+
+	candidates := gcCandidates(images, lastUsed, map[string]struct{}{})
+	assert.Equal(t, 3, len(candidates))
+	assert.Equal(t, "c", candidates[0].ID)
+	assert.Equal(t, "a", candidates[1].ID)
+	assert.Equal(t, "b", candidates[2].ID)
+}
+
+func TestGcCandidatesProtected(t *testing.T) {
+	images := []docker.APIImages{
+		{ID: "a", RepoTags: []string{"app:a"}},
+		{ID: "b", RepoTags: []string{"mesos-slave:latest"}},
+		{ID: "c", RepoTags: []string{"<none>:<none>"}},
+	}
+	protected := map[string]struct{}{
+		"docker.io/library/app:a":              struct{}{},
+		"docker.io/library/mesos-slave:latest": struct{}{},
+	}
+
+	candidates := gcCandidates(images, map[string]time.Time{}, protected)
+	assert.Equal(t, 1, len(candidates))
+	assert.Equal(t, "c", candidates[0].ID)
+}
+
+func TestNormalizeImageName(t *testing.T) {
+	for name, normalized := range map[string]string{
+		"ubuntu":                          "docker.io/library/ubuntu:latest",
+		"ubuntu:14.04":                    "docker.io/library/ubuntu:14.04",
+		"mesosphere/mesos-slave":          "docker.io/mesosphere/mesos-slave:latest",
+		"docker.io/library/ubuntu:latest": "docker.io/library/ubuntu:latest",
+		"localhost/app":                   "localhost/app:latest",
+		"registry.example.com:5000/app":   "registry.example.com:5000/app:latest",
+		"registry.example.com:5000/app:1": "registry.example.com:5000/app:1",
+		"ubuntu@sha256:abc":               "docker.io/library/ubuntu@sha256:abc",
+		"sha256:abc":                      "sha256:abc",
+	} {
+		assert.Equal(t, normalized, normalizeImageName(name), name)
+	}
+}
+
+func TestGcCandidatesOfUntaggedAcquire(t *testing.T) {
+	now := time.Now()
+	cache := newImageCache(nil)
+	cache.Acquire(1, "ubuntu")
+	cache.Acquire(2, "registry.example.com:5000/app")
+	cache.Release(2)
+
+	images := []docker.APIImages{
+		{ID: "a", RepoTags: []string{"ubuntu:latest"}, Created: now.Add(-3 * time.Hour).Unix()},
+		{ID: "b", RepoTags: []string{"registry.example.com:5000/app:latest"}, Created: now.Add(-2 * time.Hour).Unix()},
+		{ID: "c", RepoTags: []string{"other:1"}, Created: now.Add(-time.Hour).Unix()},
+		{ID: "d", RepoTags: []string{"mesosphere/mesos-slave:0.25.0"}},
+	}
+	lastUsed, protected := cache.snapshot([]docker.APIContainers{{Image: "mesosphere/mesos-slave:0.25.0"}})
+
+	// The image of the running job is kept, the released one was used after c was created
+	candidates := gcCandidates(images, lastUsed, protected)
+	if assert.Equal(t, 2, len(candidates)) {
+		assert.Equal(t, "c", candidates[0].ID)
+		assert.Equal(t, "b", candidates[1].ID)
+	}
+}
@@ -14,7 +14,9 @@ import (
 	exec "github.com/mesos/mesos-go/executor"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 
+	"bargain/liquefy/logging"
 	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
 )
 
 func init() {
@@ -37,6 +39,7 @@ func NewLiquidExecutor(dockerEndpoint string) *liquidExecutor {
 func (exec *liquidExecutor) Registered(driver exec.ExecutorDriver, execInfo *mesos.ExecutorInfo, fwinfo *mesos.FrameworkInfo, slaveInfo *mesos.SlaveInfo) {
 	log.Info("Registered executor on slave: ", slaveInfo.GetHostname())
 	log.Info("Slave attributes: ", slaveInfo.Attributes)
+	go exec.collectImages(driver)
 }
 
 func (exec *liquidExecutor) Reregistered(driver exec.ExecutorDriver, slaveInfo *mesos.SlaveInfo) {
@@ -58,12 +61,20 @@ func (exec *liquidExecutor) LaunchTask(driver exec.ExecutorDriver, taskInfo *mes
 		return
 	}
 
-	// Create Container
-	log.Infof("Creating container for job: %d", ctjob.ID)
-	containerId, err := exec.containerExecutor.CreateContainer(ctjob)
+	// The job carries the span of its launch by the scheduler, the phases on this host are traced under it
+	trace := tracing.ContextOf(ctjob.TraceParent)
+
+	// Create Container, building its image first if the job is built from source
+	logging.ForJob(ctjob).Infof("Creating container for job: %d", ctjob.ID)
+	buildLog := &bytes.Buffer{}
+	createSpan := tracing.StartSpan("executor.create_container", trace)
+	createSpan.SetAttribute("job.id", ctjob.ID)
+	createSpan.SetAttribute("source_type", ctjob.SourceType)
+	containerId, err := exec.containerExecutor.CreateContainer(ctjob, buildLog)
+	createSpan.Finish(err)
 	if err != nil {
-		log.Error("Container Create Failed :", err)
-		exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED, err.Error())
+		logging.ForJob(ctjob).Error("Container Create Failed :", err)
+		exec.sendStatusUpdateWithBuildLog(driver, taskInfo, mesos.TaskState_TASK_FAILED, err.Error(), buildLog.String())
 		return
 	}
 
@@ -78,14 +89,9 @@ func (exec *liquidExecutor) LaunchTask(driver exec.ExecutorDriver, taskInfo *mes
 
 	taskInfo.Data = bytData
 	log.Info("Container ID ", containerId)
-	exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_STARTING, "")
+	exec.sendStatusUpdateWithBuildLog(driver, taskInfo, mesos.TaskState_TASK_STARTING, "", buildLog.String())
 
-	var wg sync.WaitGroup
 	var outBuffer, errBuffer io.Writer
-	var stdIn io.Reader
-
-	stdOutReader, stdOutWriter := io.Pipe()
-	stdErrReader, stdErrWriter := io.Pipe()
 
 	//WTF IS THIS / JUST REMOVE IT
 	if ctjob.UsesFilePipe() {
@@ -108,45 +114,44 @@ func (exec *liquidExecutor) LaunchTask(driver exec.ExecutorDriver, taskInfo *mes
 	}
 
 	// Attach Container and Track
-	go func() {
-		defer stdOutWriter.Close()
-		defer stdErrWriter.Close()
-		err = exec.containerExecutor.AttachContainer(ctjob.ContainerId, stdIn, stdOutWriter, stdErrWriter)
-		if err != nil {
-			panic(err)
-		}
-	}()
+	output := exec.captureOutput(driver, ctjob, outBuffer, errBuffer)
 
 	// Start Running
+	runSpan := tracing.StartSpan("executor.run", trace)
+	runSpan.SetAttribute("job.id", ctjob.ID)
+	runSpan.SetAttribute("container.id", containerId)
 	_, err = exec.containerExecutor.Start(ctjob)
 	if err != nil {
-		log.Error("Container Start Failed :", err)
+		logging.ForJob(ctjob).Error("Container Start Failed :", err)
+		runSpan.Finish(err)
 		exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED, err.Error())
 		return
 	}
 	exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_RUNNING, "")
 
+	// Service jobs are restarted rather than finished when their container exits
+	if ctjob.IsService() {
+		go exec.superviseService(driver, taskInfo, ctjob, outBuffer, errBuffer)
+	}
+
 	go func() {
 		// Wait for job to finish asynchronously by capturing stdout and stderr
-		wg.Add(2)
-
-		go func() {
-			defer wg.Done()
-			exec.capture(ctjob, stdOutReader, outBuffer, driver)
-		}()
-
-		go func() {
-			defer wg.Done()
-			exec.capture(ctjob, stdErrReader, errBuffer, driver)
-		}()
+		output.Wait()
 
-		wg.Wait()
+		// The status of service jobs is reported by their supervisor
+		if ctjob.IsService() {
+			runSpan.Finish(nil)
+			return
+		}
 
 		// Introduce an artifical sleep to every job that is terminated to ensure that we capture all of the logs
 		time.Sleep(time.Duration(5) * time.Second)
 
 		// Report the status of the completed job
-		if status, err := exec.containerExecutor.ContainerStatus(ctjob); err != nil {
+		status, err := exec.containerExecutor.ContainerStatus(ctjob)
+		runSpan.SetAttribute("container.status", status)
+		runSpan.Finish(err)
+		if err != nil {
 			exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_ERROR, err.Error())
 		} else if status == Container_Failed {
 			exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED, "")
@@ -189,19 +194,54 @@ func (exec *liquidExecutor) Error(driver exec.ExecutorDriver, err string) {
 
 // ----------------- Helper Methods ----------------------- //
 
+// Periodically evicts unused images and reports the disk usage of this host to the scheduler, so that it stops
+// placing jobs here while the disk is under pressure
+func (exec *liquidExecutor) collectImages(driver exec.ExecutorDriver) {
+	instanceId, _ := strconv.Atoi(os.Getenv("RESOURCE_ID"))
+	for range time.Tick(ImageGCInterval) {
+		status, err := exec.containerExecutor.CollectImages()
+		if err != nil {
+			log.Error(err)
+			if status == nil {
+				continue
+			}
+		}
+
+		status.InstanceID = uint(instanceId)
+		msg, err := lq.SerializeDiskStatus(status)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if _, err := driver.SendFrameworkMessage(msg); err != nil {
+			log.Error("Failed to send disk status: ", err)
+		}
+	}
+}
+
 func (exec *liquidExecutor) sendStatusUpdate(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo, state mesos.TaskState, message string) {
+	exec.sendStatusUpdateWithBuildLog(driver, taskInfo, state, message, "")
+}
+
+// The build log of "code" jobs is sent along with the status update that ends the build, either starting or failed
+func (exec *liquidExecutor) sendStatusUpdateWithBuildLog(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo,
+		state mesos.TaskState, message string, buildLog string) {
 	log.Infof("Updating task %s with status %s", taskInfo.GetName(), state.String())
 
-	log.Infof("TASK INFO : %s", taskInfo)
 	job, err := lq.DeserializeJob(taskInfo.GetData())
 	if err != nil {
 		exec.forceSendFail(driver, taskInfo)
 		return
 	}
 
+	if isTerminalState(state) {
+		exec.containerExecutor.ReleaseImage(job.ID)
+		removeSecretFiles(job.ID)
+	}
+
 	//Send the correct task status to master
-	im := lq.StatusMessage{*job, message}
-	statusMsg, err := lq.SerializeStatusMessage(&im)
+	im := newStatusMessage(job, message, tailBuildLog(buildLog))
+	statusMsg, err := lq.SerializeStatusMessage(im)
 	if err != nil {
 		log.Error("Failed to serialize Status message " + err.Error())
 		exec.forceSendFail(driver, taskInfo)
@@ -220,6 +260,15 @@ func (exec *liquidExecutor) sendStatusUpdate(driver exec.ExecutorDriver, taskInf
 	}
 }
 
+func isTerminalState(state mesos.TaskState) bool {
+	switch state {
+	case mesos.TaskState_TASK_FINISHED, mesos.TaskState_TASK_FAILED, mesos.TaskState_TASK_KILLED,
+		mesos.TaskState_TASK_ERROR, mesos.TaskState_TASK_LOST:
+		return true
+	}
+	return false
+}
+
 func (exec *liquidExecutor) forceSendFail(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo) {
 	if _, err := driver.SendStatusUpdate(&mesos.TaskStatus{
 		TaskId: taskInfo.GetTaskId(),
@@ -231,6 +280,34 @@ func (exec *liquidExecutor) forceSendFail(driver exec.ExecutorDriver, taskInfo *
 	}
 }
 
+// Attaches to the container of the job and captures its output into the buffers, returning a wait group that is
+// done once the container exits. Restarted containers of service jobs are captured the same way.
+func (exec *liquidExecutor) captureOutput(driver exec.ExecutorDriver, cjob *lq.ContainerJob,
+		outBuffer, errBuffer io.Writer) *sync.WaitGroup {
+	stdOutReader, stdOutWriter := io.Pipe()
+	stdErrReader, stdErrWriter := io.Pipe()
+
+	go func(containerId string) {
+		defer stdOutWriter.Close()
+		defer stdErrWriter.Close()
+		if err := exec.containerExecutor.AttachContainer(containerId, nil, stdOutWriter, stdErrWriter); err != nil {
+			log.Error(lq.NewErrorf(err, "Failed attaching to container %s", containerId))
+		}
+	}(cjob.ContainerId)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		exec.capture(cjob, stdOutReader, outBuffer, driver)
+	}()
+	go func() {
+		defer wg.Done()
+		exec.capture(cjob, stdErrReader, errBuffer, driver)
+	}()
+	return wg
+}
+
 func (exec *liquidExecutor) capture(cjob *lq.ContainerJob, r io.Reader, w io.Writer, driver exec.ExecutorDriver) {
 
 	scanner := bufio.NewScanner(r)
@@ -245,7 +322,7 @@ func (exec *liquidExecutor) capture(cjob *lq.ContainerJob, r io.Reader, w io.Wri
 		line := scanner.Text()
 
 		//TODO: Probably have some filebeat spooler.
-		fmt.Println(line)
+		fmt.Println(lq.RedactSecrets(line, cjob.ResolvedSecrets))
 
 		if w != nil {
 			if cjob.UsesDelimitedOutput() && line == cjob.EndDelimiter {
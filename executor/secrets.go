@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+)
+
+// The host directory the secret files of a job are written to
+func secretsDir(jobId uint) string {
+	return filepath.Join(lq.SecretsHostPath, fmt.Sprintf("job-%d", jobId))
+}
+
+// Environment variables of the secrets injected as such
+func secretEnv(job *lq.ContainerJob) []string {
+	env := []string{}
+	for _, secret := range job.ResolvedSecrets {
+		if secret.EnvVar != "" {
+			env = append(env, fmt.Sprintf("%s=%s", secret.EnvVar, secret.Value))
+		}
+	}
+	return env
+}
+
+// Whether the job has secrets injected as files
+func hasSecretFiles(job *lq.ContainerJob) bool {
+	for _, secret := range job.ResolvedSecrets {
+		if secret.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// The uid and gid secret files are owned by, from the user of the image: empty for root, or a numeric uid with an
+// optional numeric gid. User names would have to be looked up in the image, so they are rejected.
+func secretFileOwner(user string) (int, int, error) {
+	if user == "" || user == "root" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Secret files require the image user to be root or a numeric uid, not %s", user)
+	}
+	gid := 0
+	if len(parts) == 2 {
+		if gid, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("Secret files require the image group to be numeric, not %s", parts[1])
+		}
+	}
+	return uid, gid, nil
+}
+
+// Writes the secrets injected as files to a tmpfs directory of the host, so they never reach a disk, returning the
+// directory or "" when the job has no secret files. Only the user the job runs as, from the user of its image, can
+// read them.
+func writeSecretFiles(job *lq.ContainerJob, imageUser string) (string, error) {
+	dir := secretsDir(job.ID)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", lq.NewErrorf(err, "Failed removing previous secrets of job %d", job.ID)
+	}
+	if !hasSecretFiles(job) {
+		return "", nil
+	}
+
+	uid, gid, err := secretFileOwner(imageUser)
+	if err != nil {
+		return "", lq.NewErrorf(err, "Failed writing secrets of job %d", job.ID)
+	}
+	if err := os.MkdirAll(lq.SecretsHostPath, 0700); err != nil {
+		return "", lq.NewErrorf(err, "Failed creating %s", lq.SecretsHostPath)
+	}
+	// The directory is created by docker when the mesos slave starts
+	if err := os.Chmod(lq.SecretsHostPath, 0700); err != nil {
+		return "", lq.NewErrorf(err, "Failed restricting %s", lq.SecretsHostPath)
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", lq.NewErrorf(err, "Failed creating secrets directory of job %d", job.ID)
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return "", lq.NewErrorf(err, "Failed changing the owner of the secrets of job %d", job.ID)
+	}
+
+	for _, secret := range job.ResolvedSecrets {
+		if secret.File == "" {
+			continue
+		}
+		path := filepath.Join(dir, secret.File)
+		if err := ioutil.WriteFile(path, []byte(secret.Value), 0400); err != nil {
+			return "", lq.NewErrorf(err, "Failed writing secret %s of job %d", secret.Name, job.ID)
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return "", lq.NewErrorf(err, "Failed changing the owner of secret %s of job %d", secret.Name, job.ID)
+		}
+	}
+	return dir, nil
+}
+
+func removeSecretFiles(jobId uint) {
+	if err := os.RemoveAll(secretsDir(jobId)); err != nil {
+		log.Error(lq.NewErrorf(err, "Failed removing secrets of job %d", jobId))
+	}
+}
+
+// The status message sent to the scheduler about a job. Secret values are left out of the job and redacted from the
+// messages, which end up in the database.
+func newStatusMessage(job *lq.ContainerJob, message string, buildLog string) *lq.StatusMessage {
+	sent := *job
+	sent.ResolvedSecrets = nil
+	return &lq.StatusMessage{
+		ContainerJob:  sent,
+		StatusMessage: lq.RedactSecrets(message, job.ResolvedSecrets),
+		BuildLog:      lq.RedactSecrets(buildLog, job.ResolvedSecrets),
+	}
+}
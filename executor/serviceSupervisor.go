@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gogo/protobuf/proto"
+	exec "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+
+	"bargain/liquefy/metrics"
+	lq "bargain/liquefy/models"
+)
+
+// Service jobs are supervised for the lifetime of their task:
+//   - the health check runs every interval once the grace period after (re)starting has passed
+//   - readiness changes are sent as TASK_RUNNING updates with the healthy flag set
+//   - a container that exits or fails its health check too many times in a row is restarted within the same task,
+//     until the job runs out of restarts and the task fails
+//   - a container killed through KillTask is never restarted
+//
+// The output of restarted containers is captured into the same buffers as that of the first container.
+func (exec *liquidExecutor) superviseService(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo, job *lq.ContainerJob,
+	outBuffer, errBuffer io.Writer) {
+	check, err := job.GetHealthCheck()
+	if err != nil {
+		exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED, err.Error())
+		return
+	}
+
+	for {
+		exited := make(chan struct{})
+		go func(containerId string) {
+			if _, err := exec.containerExecutor.WaitOnContainer(containerId); err != nil {
+				log.Error(lq.NewErrorf(err, "Failed waiting on container %s", containerId))
+			}
+			close(exited)
+		}(job.ContainerId)
+
+		reason := exec.watchServiceHealth(driver, taskInfo, job, check, exited)
+		if reason == "" {
+			// The container exited on its own or was killed
+			status, err := exec.containerExecutor.ContainerStatus(job)
+			if status == Container_Killed {
+				exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_KILLED, "")
+				return
+			}
+			reason = "Service exited"
+			if err != nil {
+				reason = fmt.Sprintf("Service exited: %s", err.Error())
+			}
+		}
+
+		if job.Restarts >= job.MaxRestarts {
+			log.Infof("Service job %d failed and has no restarts left: %s", job.ID,
+				lq.RedactSecrets(reason, job.ResolvedSecrets))
+			if err := exec.containerExecutor.KillContainer(job.ID); err != nil {
+				log.Debug(err)
+			}
+			exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED,
+				fmt.Sprintf("%s, no more restarts", reason))
+			return
+		}
+
+		job.Restarts += 1
+		msg := fmt.Sprintf("%s, restarting (%d/%d)", reason, job.Restarts, job.MaxRestarts)
+		log.Infof("Service job %d: %s", job.ID, lq.RedactSecrets(msg, job.ResolvedSecrets))
+		exec.sendHealthUpdate(driver, taskInfo, job, false, msg)
+
+		// The previous attachment ended with the old process, so capture the output of the new one
+		if err := exec.containerExecutor.RestartContainer(job.ContainerId); err != nil {
+			exec.sendStatusUpdate(driver, taskInfo, mesos.TaskState_TASK_FAILED, err.Error())
+			return
+		}
+		exec.captureOutput(driver, job, outBuffer, errBuffer)
+	}
+}
+
+// Runs health checks until the container exits, returning "", or fails its health check too many times in a row,
+// returning the reason. Without a health check the service is ready as soon as it is running.
+func (exec *liquidExecutor) watchServiceHealth(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo, job *lq.ContainerJob,
+	check *lq.HealthCheck, exited chan struct{}) string {
+	if check == nil {
+		exec.sendHealthUpdate(driver, taskInfo, job, true, "Service is running")
+		<-exited
+		return ""
+	}
+
+	select {
+	case <-exited:
+		return ""
+	case <-time.After(time.Duration(check.GracePeriodSeconds) * time.Second):
+	}
+
+	healthy := false
+	failures := 0
+	ticker := time.NewTicker(time.Duration(check.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := exec.containerExecutor.CheckHealth(job, check)
+		if err == nil {
+			failures = 0
+			if !healthy {
+				healthy = true
+				exec.sendHealthUpdate(driver, taskInfo, job, true, "Health check passed")
+			}
+		} else {
+			failures += 1
+			metrics.HealthCheckFailures.With(check.Type).Inc()
+			log.Debugf("Health check %d/%d of job %d failed: %s", failures, check.FailureThreshold, job.ID,
+				lq.RedactSecrets(err.Error(), job.ResolvedSecrets))
+			if failures >= check.FailureThreshold {
+				return fmt.Sprintf("Failed %d health checks in a row: %s", failures, err.Error())
+			}
+		}
+
+		select {
+		case <-exited:
+			return ""
+		case <-ticker.C:
+		}
+	}
+}
+
+// Health updates are TASK_RUNNING updates, sent while the task is already running, with the healthy flag set
+func (exec *liquidExecutor) sendHealthUpdate(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo, job *lq.ContainerJob,
+	healthy bool, message string) {
+	message = lq.RedactSecrets(message, job.ResolvedSecrets)
+	log.Infof("Updating task %s health to %t: %s", taskInfo.GetName(), healthy, message)
+
+	statusMsg, err := lq.SerializeStatusMessage(newStatusMessage(job, message, ""))
+	if err != nil {
+		log.Error("Failed to serialize Status message " + err.Error())
+		return
+	}
+
+	status := &mesos.TaskStatus{
+		TaskId:  taskInfo.GetTaskId(),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+		Data:    statusMsg,
+		Healthy: proto.Bool(healthy),
+	}
+
+	if _, err := driver.SendStatusUpdate(status); err != nil {
+		log.Errorf("Failed to update health of task %s", taskInfo.GetName())
+		log.Error(err)
+	}
+}
@@ -18,7 +18,7 @@ func main() {
         panic(err)
     }
 
-    awsCloud := cloudprovider.NewAwsCloud(&config.AccessKeyID, &config.SecretAccessKey)
+    awsCloud := cloudprovider.NewAwsCloudWithKeys(&config.AccessKeyID, &config.SecretAccessKey)
 
     for region, azs := range cloudprovider.AWSRegionsToAZs {
         for _, az := range azs {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"bargain/liquefy/cloudprovider"
+)
+
+// Generates the next version of the instance catalog from the instance types ec2 offers in each region, with the
+// credentials of the environment. Write the catalog services load from LIQUEFY_INSTANCE_CATALOG_FILE, which they
+// reload once it is regenerated, or with -format=go the default catalog compiled into them:
+//
+//	go run generateInstanceCatalog.go -previous=instances.json -out=instances.json
+//	go run generateInstanceCatalog.go -format=go -out=cloudprovider/catalogDefault.go
+//
+// Images are kept from the previous catalog, instance types of a region without images are not launched there.
+func main() {
+	previousPath := flag.String("previous", "", "catalog to take the version and images from, the default catalog when empty")
+	regionList := flag.String("regions", "", "comma separated regions to describe, the configured regions when empty")
+	out := flag.String("out", "", "file to write the catalog to")
+	format := flag.String("format", "json", "json for a catalog file, go for the default catalog")
+	flag.Parse()
+
+	if *out == "" || (*format != "json" && *format != "go") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	previous := cloudprovider.Catalog()
+	if *previousPath != "" {
+		var err error
+		if previous, err = cloudprovider.LoadCatalogFile(*previousPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	regions := cloudprovider.Regions()
+	if *regionList != "" {
+		regions = []cloudprovider.Region{}
+		for _, region := range strings.Split(*regionList, ",") {
+			regions = append(regions, cloudprovider.Region(strings.TrimSpace(region)))
+		}
+	}
+
+	catalog, err := cloudprovider.GenerateCatalog(cloudprovider.NewInstanceTypeDescriber(), regions, previous, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var data []byte
+	if *format == "go" {
+		data, err = catalog.MarshalDefault()
+	} else {
+		data, err = catalog.MarshalFile()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Wrote version %d of the instance catalog with %d instance types to %s", catalog.Version,
+		len(catalog.Instances), *out)
+}
@@ -18,9 +18,9 @@ func TestGetCurrentSpotPrices(t *testing.T) {
         }
 
         i := 0
-        instances := make([]string, len(awsCloud.AvailableInstances))
-        for instance := range awsCloud.AvailableInstances {
-            instances[i] = instance
+        instances := make([]string, len(awsCloud.Catalog().Instances))
+        for instance := range awsCloud.Catalog().Instances {
+            instances[i] = instance.String()
             i++
         }
 
@@ -39,11 +39,11 @@ func TestGetSpotPriceHistory(t *testing.T) {
         now.Unix()
 
         instances := []string{}
-        for instance := range awsCloud.AvailableInstances {
-            if strings.HasPrefix(instance, "t2") {
+        for instance := range awsCloud.Catalog().Instances {
+            if strings.HasPrefix(instance.String(), "t2") {
                 continue
             }
-            instances = append(instances, instance)
+            instances = append(instances, instance.String())
         }
 
         for _, instance := range instances {
@@ -31,7 +31,7 @@ func main() {
         AwsSecretKey: &AwsSecretKey,
     }
 
-    aws := clouds.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+    aws := clouds.NewAwsCloud(awsAccount)
     spotPriceInfo, err := aws.GetCurrentSpotPrices(clouds.Region(*region))
     if err != nil {
         fmt.Println(err)
@@ -237,7 +237,7 @@ func waitForSchedulerToAttach(masterIp string) *MesosMasterState {
 }
 
 func initDB(masterIp string) {
-	safeExecute(true, "go", "run", "../initDB.go", fmt.Sprintf("--masterip=%s", masterIp))
+	safeExecute(true, "go", "run", "../migrate.go", fmt.Sprintf("--masterip=%s", masterIp), "reset")
 }
 
 func deployScheduler(master string) {
@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"bargain/liquefy/metrics"
+)
+
+const (
+	DefaultBufferSize    = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 2 * time.Second
+)
+
+// Reasons entries are dropped, in metrics
+const (
+	dropBufferFull = "buffer_full"
+	dropSinkError  = "sink_error"
+)
+
+// Hook ships the entries of a logger to a sink without blocking the logger. Entries are buffered and written in
+// batches by a goroutine, when the buffer is full because the sink is slow or down new entries are dropped and counted.
+type Hook struct {
+	sink          Sink
+	fields        logrus.Fields
+	formatter     logrus.Formatter
+	entries       chan []byte
+	flushes       chan chan struct{}
+	batchSize     int
+	flushInterval time.Duration
+	dropped       uint64
+
+	// Serializes the writes of the goroutine with the synchronous writes of fatal entries
+	writeMutex sync.Mutex
+}
+
+// Ships entries to the sink with the fields added to every entry, ex: the service. Buffers up to bufferSize entries.
+func NewHook(sink Sink, fields logrus.Fields, bufferSize int) *Hook {
+	hook := &Hook{
+		sink:          sink,
+		fields:        fields,
+		formatter:     &logrus.JSONFormatter{},
+		entries:       make(chan []byte, bufferSize),
+		flushes:       make(chan chan struct{}),
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+	}
+	go hook.run()
+	return hook
+}
+
+func (hook *Hook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+		logrus.InfoLevel,
+		logrus.DebugLevel,
+	}
+}
+
+func (hook *Hook) Fire(entry *logrus.Entry) error {
+	document, err := hook.format(entry)
+	if err != nil {
+		return err
+	}
+
+	// The process exits right after fatal and panic entries, so they are written along with what is buffered
+	if entry.Level <= logrus.FatalLevel {
+		hook.Flush()
+		hook.write([][]byte{document})
+		return nil
+	}
+
+	select {
+	case hook.entries <- document:
+	default:
+		hook.drop(1, dropBufferFull)
+	}
+	return nil
+}
+
+// Writes the buffered entries, returning once they are written
+func (hook *Hook) Flush() {
+	done := make(chan struct{})
+	hook.flushes <- done
+	<-done
+}
+
+// Entries dropped since the hook was created, because the buffer was full or the sink failed
+func (hook *Hook) Dropped() uint64 {
+	return atomic.LoadUint64(&hook.dropped)
+}
+
+// The entry as a JSON document, without the fields of the entry overriding those of the hook
+func (hook *Hook) format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+len(hook.fields))
+	for key, value := range entry.Data {
+		data[key] = value
+	}
+	for key, value := range hook.fields {
+		data[key] = value
+	}
+	document, err := hook.formatter.Format(&logrus.Entry{
+		Logger:  entry.Logger,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Message: entry.Message,
+	})
+	return bytes.TrimRight(document, "\n"), err
+}
+
+func (hook *Hook) run() {
+	ticker := time.NewTicker(hook.flushInterval)
+	defer ticker.Stop()
+
+	batch := [][]byte{}
+	for {
+		select {
+		case document := <-hook.entries:
+			batch = append(batch, document)
+			if len(batch) >= hook.batchSize {
+				hook.write(batch)
+				batch = [][]byte{}
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				hook.write(batch)
+				batch = [][]byte{}
+			}
+
+		case done := <-hook.flushes:
+			for drained := false; !drained; {
+				select {
+				case document := <-hook.entries:
+					batch = append(batch, document)
+				default:
+					drained = true
+				}
+			}
+			for len(batch) > 0 {
+				size := len(batch)
+				if size > hook.batchSize {
+					size = hook.batchSize
+				}
+				hook.write(batch[:size])
+				batch = batch[size:]
+			}
+			batch = [][]byte{}
+			close(done)
+		}
+	}
+}
+
+// Failures are reported on stderr rather than logged, which would log through the failing hook
+func (hook *Hook) write(batch [][]byte) {
+	hook.writeMutex.Lock()
+	defer hook.writeMutex.Unlock()
+	if err := hook.sink.Write(batch); err != nil {
+		hook.drop(len(batch), dropSinkError)
+		fmt.Fprintf(os.Stderr, "Failed shipping %d log entries to %s: %s\n", len(batch), hook.sink.Name(), err)
+		return
+	}
+	metrics.LogEntriesShipped.With(hook.sink.Name()).Add(float64(len(batch)))
+}
+
+func (hook *Hook) drop(count int, reason string) {
+	atomic.AddUint64(&hook.dropped, uint64(count))
+	metrics.LogEntriesDropped.With(hook.sink.Name(), reason).Add(float64(count))
+}
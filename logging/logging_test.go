@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+// Stands in for Elasticsearch, keeping the bulk requests it receives
+type elasticStandIn struct {
+	mutex    sync.Mutex
+	server   *httptest.Server
+	requests []string
+	status   int
+}
+
+func newElasticStandIn() *elasticStandIn {
+	standIn := &elasticStandIn{status: http.StatusOK}
+	standIn.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		standIn.mutex.Lock()
+		defer standIn.mutex.Unlock()
+		if r.URL.Path != "/_bulk" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		standIn.requests = append(standIn.requests, string(body))
+		w.WriteHeader(standIn.status)
+		w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	return standIn
+}
+
+// The actions and documents of the bulk requests received
+func (standIn *elasticStandIn) lines() []map[string]interface{} {
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	lines := []map[string]interface{}{}
+	for _, request := range standIn.requests {
+		scanner := bufio.NewScanner(strings.NewReader(request))
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			json.Unmarshal(scanner.Bytes(), &line)
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func newTestLogger(hook *Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Level = logrus.DebugLevel
+	logger.Hooks.Add(hook)
+	return logger
+}
+
+func TestElasticSinkIndexesInBulk(t *testing.T) {
+	standIn := newElasticStandIn()
+	defer standIn.server.Close()
+
+	sink := NewElasticSink(standIn.server.URL, "liquefy-", "scheduler")
+	sink.now = func() time.Time { return time.Date(2016, 3, 14, 23, 0, 0, 0, time.UTC) }
+	hook := NewHook(sink, logrus.Fields{FieldService: "scheduler"}, 10)
+	logger := newTestLogger(hook)
+
+	logger.WithField(FieldJobID, 7).Info("Launching job 7")
+	logger.WithField(FieldService, "other").Debug("Assigned")
+	hook.Flush()
+
+	lines := standIn.lines()
+	if assert.Len(t, lines, 4) {
+		action := lines[0]["index"].(map[string]interface{})
+		assert.Equal(t, "liquefy--2016.03.14", action["_index"])
+		assert.Equal(t, "scheduler", action["_type"])
+
+		assert.Equal(t, "Launching job 7", lines[1]["msg"])
+		assert.Equal(t, "info", lines[1]["level"])
+		assert.Equal(t, "scheduler", lines[1][FieldService])
+		assert.Equal(t, float64(7), lines[1][FieldJobID])
+
+		// The service of the hook is not overridden by entries
+		assert.Equal(t, "scheduler", lines[3][FieldService])
+	}
+	assert.Equal(t, uint64(0), hook.Dropped())
+}
+
+func TestHookBatches(t *testing.T) {
+	standIn := newElasticStandIn()
+	defer standIn.server.Close()
+
+	hook := NewHook(NewElasticSink(standIn.server.URL, "liquefy-", "api"), nil, 100)
+	hook.batchSize = 2
+	logger := newTestLogger(hook)
+	for i := 0; i < 5; i++ {
+		logger.Info("entry")
+	}
+	hook.Flush()
+
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	assert.Len(t, standIn.requests, 3)
+}
+
+func TestHookDropsWhenSinkFails(t *testing.T) {
+	standIn := newElasticStandIn()
+	defer standIn.server.Close()
+	standIn.status = http.StatusServiceUnavailable
+
+	hook := NewHook(NewElasticSink(standIn.server.URL, "liquefy-", "api"), nil, 10)
+	logger := newTestLogger(hook)
+	logger.Info("first")
+	logger.Info("second")
+	hook.Flush()
+	assert.Equal(t, uint64(2), hook.Dropped())
+}
+
+// Blocks writes until released, like an Elasticsearch that stopped responding
+type blockedSink struct {
+	writing chan struct{}
+	release chan struct{}
+	written int
+}
+
+func (sink *blockedSink) Name() string {
+	return "blocked"
+}
+
+func (sink *blockedSink) Write(entries [][]byte) error {
+	sink.writing <- struct{}{}
+	<-sink.release
+	sink.written += len(entries)
+	return nil
+}
+
+func TestHookDoesNotBlockOnSlowSink(t *testing.T) {
+	sink := &blockedSink{writing: make(chan struct{}, 10), release: make(chan struct{})}
+	hook := NewHook(sink, nil, 2)
+	hook.batchSize = 1
+	logger := newTestLogger(hook)
+
+	logger.Info("written")
+	<-sink.writing
+
+	// The buffer holds two entries while the sink is stuck, the others are dropped
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			logger.Info("buffered or dropped")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Logging blocked on the sink")
+	}
+	assert.Equal(t, uint64(3), hook.Dropped())
+
+	close(sink.release)
+	hook.Flush()
+	assert.Equal(t, 3, sink.written)
+}
+
+func TestParseSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "provisioner.log")
+
+	sinks, err := ParseSinks("stdout, file://"+path+",http://10.0.0.5:9200", "liquefy-", "provisioner")
+	assert.Nil(t, err)
+	if assert.Len(t, sinks, 3) {
+		assert.Equal(t, "stdout", sinks[0].Name())
+		assert.Equal(t, "file", sinks[1].Name())
+		assert.Equal(t, "elasticsearch", sinks[2].Name())
+	}
+
+	assert.Nil(t, sinks[1].Write([][]byte{[]byte(`{"msg":"first"}`), []byte(`{"msg":"second"}`)}))
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"msg\":\"first\"}\n{\"msg\":\"second\"}\n", string(content))
+
+	_, err = ParseSinks("syslog", "liquefy-", "provisioner")
+	assert.NotNil(t, err)
+}
+
+func TestForJob(t *testing.T) {
+	job := &lq.ContainerJob{ID: 3, OwnerID: 5, InstanceID: 8,
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	entry := ForJob(job)
+	assert.Equal(t, uint(3), entry.Data[FieldJobID])
+	assert.Equal(t, uint(5), entry.Data[FieldUserID])
+	assert.Equal(t, uint(8), entry.Data[FieldResourceID])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry.Data[FieldTraceID])
+
+	entry = ForJob(&lq.ContainerJob{ID: 4, OwnerID: 5})
+	_, assigned := entry.Data[FieldResourceID]
+	assert.False(t, assigned)
+
+	entry = ForResource(&lq.ResourceInstance{ID: 8, OwnerId: 5})
+	assert.Equal(t, uint(8), entry.Data[FieldResourceID])
+	assert.Equal(t, uint(5), entry.Data[FieldUserID])
+}
@@ -0,0 +1,86 @@
+// Package logging sets up the logs of the Liquefy services: JSON entries with the service and the job, resource and
+// user they are about, shipped to sinks without blocking the service.
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
+)
+
+// Fields identifying what an entry is about, so that the logs of a job can be searched across services
+const (
+	FieldService    = "service"
+	FieldJobID      = "job_id"
+	FieldResourceID = "resource_id"
+	FieldUserID     = "user_id"
+	FieldTraceID    = "trace_id"
+)
+
+// Sinks of a comma separated list of stdout, file:///path and the url of an Elasticsearch server, ex:
+// stdout,http://10.0.0.5:9200. Entries are indexed in Elasticsearch under the base index, with the service as type.
+func ParseSinks(spec, baseIndex, service string) ([]Sink, error) {
+	sinks := []Sink{}
+	for _, value := range strings.Split(spec, ",") {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			continue
+		case value == "stdout":
+			sinks = append(sinks, NewStdoutSink())
+		case strings.HasPrefix(value, "file://"):
+			sink, err := NewFileSink(strings.TrimPrefix(value, "file://"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+			sinks = append(sinks, NewElasticSink(value, baseIndex, service))
+		default:
+			return nil, fmt.Errorf("Unknown log sink %s, must be stdout, file:///path or http://host:port", value)
+		}
+	}
+	return sinks, nil
+}
+
+// Logs of the service go to the sinks, each through its own hook so that a slow sink does not hold up the others.
+// The fields are added to every entry along with the service. Without sinks, logs go to stdout.
+func Setup(service string, fields logrus.Fields, sinks ...Sink) []*Hook {
+	if len(sinks) == 0 {
+		sinks = []Sink{NewStdoutSink()}
+	}
+	hookFields := logrus.Fields{FieldService: service}
+	for key, value := range fields {
+		hookFields[key] = value
+	}
+
+	logrus.SetOutput(ioutil.Discard)
+	hooks := []*Hook{}
+	for _, sink := range sinks {
+		hook := NewHook(sink, hookFields, DefaultBufferSize)
+		logrus.AddHook(hook)
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// Entries about a job, and the resource it is assigned to
+func ForJob(job *lq.ContainerJob) *logrus.Entry {
+	fields := logrus.Fields{FieldJobID: job.ID, FieldUserID: job.OwnerID}
+	if job.InstanceID != 0 {
+		fields[FieldResourceID] = job.InstanceID
+	}
+	if traceID := tracing.ContextOf(job.TraceParent).TraceID; traceID != "" {
+		fields[FieldTraceID] = traceID
+	}
+	return logrus.WithFields(fields)
+}
+
+func ForResource(resource *lq.ResourceInstance) *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{FieldResourceID: resource.ID, FieldUserID: resource.OwnerId})
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sink receives log entries in batches, each entry a JSON document
+type Sink interface {
+	// Name of the sink in metrics, ex: elasticsearch
+	Name() string
+	Write(entries [][]byte) error
+}
+
+// WriterSink writes entries as JSON lines, to stdout or a file
+type WriterSink struct {
+	name   string
+	writer io.Writer
+}
+
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{name: "stdout", writer: os.Stdout}
+}
+
+// Appends entries to the file, creating it if needed
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed opening log file %s: %s", path, err)
+	}
+	return &WriterSink{name: "file", writer: file}, nil
+}
+
+func (sink *WriterSink) Name() string {
+	return sink.name
+}
+
+func (sink *WriterSink) Write(entries [][]byte) error {
+	buffer := &bytes.Buffer{}
+	for _, entry := range entries {
+		buffer.Write(entry)
+		buffer.WriteByte('\n')
+	}
+	_, err := sink.writer.Write(buffer.Bytes())
+	return err
+}
+
+// ElasticSink indexes entries with the bulk api of Elasticsearch, into an index per day
+type ElasticSink struct {
+	url       string
+	baseIndex string
+	indexType string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// Indexes into <baseIndex>-<date> with the document type, ex: liquefy--2016.03.14, on the server at the url, ex:
+// http://10.0.0.5:9200
+func NewElasticSink(url, baseIndex, indexType string) *ElasticSink {
+	return &ElasticSink{
+		url:       strings.TrimSuffix(url, "/"),
+		baseIndex: baseIndex,
+		indexType: indexType,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+	}
+}
+
+func (sink *ElasticSink) Name() string {
+	return "elasticsearch"
+}
+
+type bulkAction struct {
+	Index bulkIndex `json:"index"`
+}
+
+type bulkIndex struct {
+	Index string `json:"_index"`
+	Type  string `json:"_type"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+}
+
+func (sink *ElasticSink) Write(entries [][]byte) error {
+	action, err := json.Marshal(bulkAction{bulkIndex{sink.index(), sink.indexType}})
+	if err != nil {
+		return err
+	}
+	body := &bytes.Buffer{}
+	for _, entry := range entries {
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(entry)
+		body.WriteByte('\n')
+	}
+
+	response, err := sink.client.Post(sink.url+"/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return fmt.Errorf("Failed indexing %d log entries: %s", len(entries), err)
+	}
+	defer response.Body.Close()
+	content, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Failed indexing %d log entries with status %d: %s", len(entries), response.StatusCode,
+			content)
+	}
+
+	// Entries are indexed one by one, so some may fail while others are indexed
+	result := bulkResponse{}
+	if err := json.Unmarshal(content, &result); err == nil && result.Errors {
+		return fmt.Errorf("Failed indexing some of %d log entries", len(entries))
+	}
+	return nil
+}
+
+func (sink *ElasticSink) index() string {
+	return sink.baseIndex + "-" + sink.now().UTC().Format("2006.01.02")
+}
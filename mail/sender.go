@@ -0,0 +1,144 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bargain/liquefy/common"
+	lq "bargain/liquefy/models"
+)
+
+// Sender delivers mails to users, ex: password reset tokens
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// Picks the sender from the environment:
+//
+//	MAIL_SENDER  smtp, file or stdout
+//	MAIL_FROM    address mails are sent from
+//	SMTP_ADDR    host:port of the smtp server, SMTP_USER and SMTP_PASS authenticate to it
+//	MAIL_FILE    file the file sender appends mails to
+//
+// Mails carry password reset tokens, so printing them to stdout when MAIL_SENDER is missing is only done locally.
+func NewSenderFromEnv() (Sender, error) {
+	kind := os.Getenv("MAIL_SENDER")
+	if kind == "" {
+		if !common.AllowsDevelopmentDefaults() {
+			return nil, errors.New("MAIL_SENDER is required in staging and production")
+		}
+		kind = "stdout"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@liquefy.io"
+	}
+
+	switch kind {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, errors.New("SMTP_ADDR is required by the smtp mail sender")
+		}
+		return NewSmtpSender(addr, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASS"), from), nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			return nil, errors.New("MAIL_FILE is required by the file mail sender")
+		}
+		return NewFileSender(path, from), nil
+	case "stdout":
+		return NewWriterSender(os.Stdout, from), nil
+	default:
+		return nil, fmt.Errorf("Unknown MAIL_SENDER %s, must be smtp, file or stdout", kind)
+	}
+}
+
+type smtpSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSmtpSender(addr, username, password, from string) Sender {
+	sender := &smtpSender{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+func (sender *smtpSender) Send(to, subject, body string) error {
+	err := smtp.SendMail(sender.addr, sender.auth, sender.from, []string{to}, formatMail(sender.from, to, subject, body))
+	if err != nil {
+		return lq.NewErrorf(err, "Failed sending mail %s to %s", subject, to)
+	}
+	return nil
+}
+
+// Writes mails to a writer instead of delivering them, for local deployments
+type writerSender struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	from   string
+}
+
+func NewWriterSender(writer io.Writer, from string) Sender {
+	return &writerSender{writer: writer, from: from}
+}
+
+func (sender *writerSender) Send(to, subject, body string) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if _, err := sender.writer.Write(formatMail(sender.from, to, subject, body)); err != nil {
+		return lq.NewErrorf(err, "Failed writing mail %s to %s", subject, to)
+	}
+	return nil
+}
+
+// Appends mails to a file instead of delivering them, so tests can read them back
+type fileSender struct {
+	mutex sync.Mutex
+	path  string
+	from  string
+}
+
+func NewFileSender(path, from string) Sender {
+	return &fileSender{path: path, from: from}
+}
+
+func (sender *fileSender) Send(to, subject, body string) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+
+	file, err := os.OpenFile(sender.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed opening mail file %s", sender.path)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(formatMail(sender.from, to, subject, body)); err != nil {
+		return lq.NewErrorf(err, "Failed writing mail %s to %s", subject, to)
+	}
+	return nil
+}
+
+func formatMail(from, to, subject, body string) []byte {
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSenderAppendsMails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sender := NewFileSender(filepath.Join(dir, "mails"), "from@liquefy.io")
+	assert.Nil(t, sender.Send("first@liquefy.io", "First", "first body"))
+	assert.Nil(t, sender.Send("second@liquefy.io", "Second", "second body"))
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "mails"))
+	assert.Nil(t, err)
+	mails := string(contents)
+	assert.True(t, strings.Contains(mails, "To: first@liquefy.io\r\n"))
+	assert.True(t, strings.Contains(mails, "Subject: Second\r\n"))
+	assert.True(t, strings.Index(mails, "first body") < strings.Index(mails, "second body"))
+}
+
+func TestWriterSender(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sender := NewWriterSender(buffer, "from@liquefy.io")
+	assert.Nil(t, sender.Send("to@liquefy.io", "Subject", "body"))
+	assert.True(t, strings.HasPrefix(buffer.String(), "From: from@liquefy.io\r\nTo: to@liquefy.io\r\n"))
+	assert.True(t, strings.HasSuffix(buffer.String(), "\r\n\r\nbody\r\n"))
+}
+
+func TestNewSenderFromEnv(t *testing.T) {
+	defer os.Setenv("MAIL_SENDER", "")
+	defer os.Setenv("MAIL_FILE", "")
+
+	os.Setenv("MAIL_SENDER", "file")
+	_, err := NewSenderFromEnv()
+	assert.NotNil(t, err)
+
+	os.Setenv("MAIL_FILE", "/tmp/mails")
+	sender, err := NewSenderFromEnv()
+	assert.Nil(t, err)
+	assert.IsType(t, &fileSender{}, sender)
+
+	os.Setenv("MAIL_SENDER", "pigeon")
+	_, err = NewSenderFromEnv()
+	assert.NotNil(t, err)
+}
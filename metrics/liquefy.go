@@ -0,0 +1,56 @@
+package metrics
+
+// The metrics of the Liquefy services, metrics/README.md documents them
+
+// ProvisioningBuckets suit the minutes it takes for a spot bid to be fulfilled and an instance to boot
+var ProvisioningBuckets = []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// Scheduler
+var (
+	OffersReceived = NewCounter("liquefy_scheduler_offers_received_total",
+		"Mesos offers received by the scheduler")
+	OffersDeclined = NewCounter("liquefy_scheduler_offers_declined_total",
+		"Mesos offers declined by the scheduler because no job used them")
+	EventQueueDepth = NewGauge("liquefy_scheduler_event_queue_depth",
+		"Assign, launch and user termination events waiting to be handled by the scheduler")
+	EventHandling = NewHistogramVec("liquefy_scheduler_event_handling_seconds",
+		"Time the scheduler took to handle an event, by event: assign, launch or user_termination",
+		DefaultBuckets, "event")
+	JobsTerminated = NewCounterVec("liquefy_jobs_terminated_total",
+		"Jobs that reached a terminal state, by status: TASK_FINISHED, TASK_FAILED, TASK_KILLED, ...",
+		"status")
+)
+
+// Provisioner
+var (
+	SpotRequests = NewCounterVec("liquefy_spot_requests_total",
+		"Spot requests that finished, by the status code AWS gave them and the market they were placed in",
+		"code", "availability_zone", "instance_type")
+	ProvisioningPhase = NewHistogramVec("liquefy_provisioning_phase_seconds",
+		"Time spent in each phase of provisioning a resource: bidding, booting, mesos_setup and total, from the "+
+			"bid to the resource running", ProvisioningBuckets, "phase")
+	SpendRate = NewGauge("liquefy_spend_rate_dollars_per_hour",
+		"Sum of the spot prices of the resources provisioned or running")
+)
+
+// Executor
+var (
+	HealthCheckFailures = NewCounterVec("liquefy_executor_health_check_failures_total",
+		"Failed health checks of service jobs, by type of check: http, tcp or command", "type")
+)
+
+// API
+var (
+	APIRequestDuration = NewHistogramVec("liquefy_api_request_duration_seconds",
+		"Time the API took to respond, by method, route template and status code", DefaultBuckets,
+		"method", "route", "status")
+)
+
+// Logging
+var (
+	LogEntriesShipped = NewCounterVec("liquefy_log_entries_shipped_total",
+		"Log entries written to a sink: stdout, file or elasticsearch", "sink")
+	LogEntriesDropped = NewCounterVec("liquefy_log_entries_dropped_total",
+		"Log entries dropped, by sink and reason: buffer_full when the sink falls behind, sink_error when writing "+
+			"to it failed", "sink", "reason")
+)
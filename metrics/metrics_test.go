@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Requests\nhandled", "code", "market")
+	requests.With("fulfilled", "us-east-1a").Add(2)
+	requests.With("price-too-low", `c4."large"`).Inc()
+	requests.With("fulfilled", "us-east-1a").Add(-1)
+
+	buffer := &bytes.Buffer{}
+	registry.Write(buffer)
+	assert.Equal(t, `# HELP requests_total Requests\nhandled
+# TYPE requests_total counter
+requests_total{code="fulfilled",market="us-east-1a"} 2
+requests_total{code="price-too-low",market="c4.\"large\""} 1
+`, buffer.String())
+
+	assert.Panics(t, func() { requests.With("fulfilled") })
+	assert.Panics(t, func() { registry.NewCounter("requests_total", "Requests again") })
+}
+
+func TestGaugeFormat(t *testing.T) {
+	registry := NewRegistry()
+	depth := registry.NewGauge("queue_depth", "Events queued")
+	depth.Set(3.5)
+	assert.Equal(t, 3.5, depth.Value())
+
+	queue := make(chan int, 10)
+	queue <- 1
+	depth.SetFunc(func() float64 { return float64(len(queue)) })
+	queue <- 2
+
+	buffer := &bytes.Buffer{}
+	registry.Write(buffer)
+	assert.Equal(t, "# HELP queue_depth Events queued\n# TYPE queue_depth gauge\nqueue_depth 2\n", buffer.String())
+}
+
+func TestHistogramFormat(t *testing.T) {
+	registry := NewRegistry()
+	latency := registry.NewHistogramVec("latency_seconds", "Latency", []float64{0.1, 1}, "route")
+	latency.With("/v1/jobs").Observe(0.0625)
+	latency.With("/v1/jobs").Observe(0.5)
+	latency.With("/v1/jobs").Observe(5)
+
+	buffer := &bytes.Buffer{}
+	registry.Write(buffer)
+	assert.Equal(t, `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/v1/jobs",le="0.1"} 1
+latency_seconds_bucket{route="/v1/jobs",le="1"} 2
+latency_seconds_bucket{route="/v1/jobs",le="+Inf"} 3
+latency_seconds_sum{route="/v1/jobs"} 5.5625
+latency_seconds_count{route="/v1/jobs"} 3
+`, buffer.String())
+
+	assert.Panics(t, func() { registry.NewHistogramVec("unsorted", "Unsorted", []float64{1, 0.1}) })
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("offers_total", "Offers").Inc()
+
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, request)
+	assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "offers_total 1\n")
+}
+
+// Every metric of the services is documented with its labels
+func TestLiquefyMetricsAreDocumented(t *testing.T) {
+	readme, err := ioutil.ReadFile("README.md")
+	assert.Nil(t, err)
+
+	names := DefaultRegistry.Names()
+	assert.NotEmpty(t, names)
+	for _, name := range names {
+		assert.True(t, strings.HasPrefix(name, "liquefy_"), name)
+		assert.Contains(t, string(readme), "`"+name+"`")
+		for _, label := range DefaultRegistry.Labels(name) {
+			assert.Contains(t, string(readme), "`"+label+"`", "label %s of %s", label, name)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ContentType is the version of the Prometheus text format metrics are exposed in
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metric interface {
+	describe() *desc
+	// Writes the samples of the metric, without its HELP and TYPE lines
+	writeSamples(w io.Writer)
+}
+
+// Registry holds metrics by name and exposes them in the Prometheus text format
+type Registry struct {
+	mutex   sync.Mutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// DefaultRegistry holds the metrics of the Liquefy services, it is what the /metrics endpoints expose
+var DefaultRegistry = NewRegistry()
+
+// Metrics are declared once, as package variables, so registering a name twice is a programming error
+func (registry *Registry) register(m metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.metrics[m.describe().name]; ok {
+		panic(fmt.Sprintf("Metric %s is registered already", m.describe().name))
+	}
+	registry.metrics[m.describe().name] = m
+}
+
+// Names of the registered metrics, sorted
+func (registry *Registry) Names() []string {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	names := []string{}
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Label names of a registered metric
+func (registry *Registry) Labels(name string) []string {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if m, ok := registry.metrics[name]; ok {
+		return append([]string{}, m.describe().labels...)
+	}
+	return nil
+}
+
+// Writes every metric, sorted by name
+func (registry *Registry) Write(w io.Writer) {
+	for _, name := range registry.Names() {
+		registry.mutex.Lock()
+		m := registry.metrics[name]
+		registry.mutex.Unlock()
+
+		d := m.describe()
+		fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+		m.writeSamples(w)
+	}
+}
+
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffer := &bytes.Buffer{}
+		registry.Write(buffer)
+		w.Header().Set("Content-Type", ContentType)
+		w.Write(buffer.Bytes())
+	})
+}
+
+// Handler exposes the default registry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// Serves /metrics on the address, for the services that do not serve http otherwise. An empty address disables it.
+func Serve(address string) {
+	if address == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Errorf("Failed serving metrics on %s: %s", address, err)
+		}
+	}()
+}
+
+// desc describes a metric, samples of a metric with labels are keyed by their label values
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("Metric %s has labels %v, got values %v", d.name, d.labels, labelValues))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// Formats the labels of a sample, with extra labels such as the le of histogram buckets after them
+func (d *desc) formatLabels(labelValues []string, extra ...string) string {
+	pairs := []string{}
+	for i, label := range d.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escapeLabelValue(labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
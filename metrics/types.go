@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets suit latencies in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter only goes up, ex: the offers received since the service started
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (counter *Counter) Inc() {
+	counter.Add(1)
+}
+
+// Negative values are ignored, counters never decrease
+func (counter *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.value += value
+}
+
+func (counter *Counter) Value() float64 {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	return counter.value
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	desc
+	mutex    sync.Mutex
+	counters map[string]*Counter
+	values   map[string][]string
+}
+
+// Registers a counter with labels in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+func (registry *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	vec := &CounterVec{
+		desc:     desc{name: name, help: help, kind: "counter", labels: labels},
+		counters: make(map[string]*Counter),
+		values:   make(map[string][]string),
+	}
+	registry.register(vec)
+	return vec
+}
+
+// Registers a counter without labels in the default registry
+func NewCounter(name, help string) *Counter {
+	return DefaultRegistry.NewCounter(name, help)
+}
+
+func (registry *Registry) NewCounter(name, help string) *Counter {
+	return registry.NewCounterVec(name, help).With()
+}
+
+// The counter of the label values, given in the order of the labels
+func (vec *CounterVec) With(labelValues ...string) *Counter {
+	key := vec.key(labelValues)
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	counter, ok := vec.counters[key]
+	if !ok {
+		counter = &Counter{}
+		vec.counters[key] = counter
+		vec.values[key] = append([]string{}, labelValues...)
+	}
+	return counter
+}
+
+func (vec *CounterVec) describe() *desc {
+	return &vec.desc
+}
+
+func (vec *CounterVec) writeSamples(w io.Writer) {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	for _, key := range sortedKeys(vec.values) {
+		fmt.Fprintf(w, "%s%s %s\n", vec.name, vec.formatLabels(vec.values[key]),
+			formatValue(vec.counters[key].Value()))
+	}
+}
+
+// Gauge is a value that goes up and down, either set or computed when the metrics are written
+type Gauge struct {
+	desc
+	mutex   sync.Mutex
+	value   float64
+	compute func() float64
+}
+
+// Registers a gauge without labels in the default registry
+func NewGauge(name, help string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help)
+}
+
+func (registry *Registry) NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{desc: desc{name: name, help: help, kind: "gauge"}}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64) {
+	gauge.mutex.Lock()
+	defer gauge.mutex.Unlock()
+	gauge.value, gauge.compute = value, nil
+}
+
+// The gauge takes the value of compute whenever it is read, until it is set
+func (gauge *Gauge) SetFunc(compute func() float64) {
+	gauge.mutex.Lock()
+	defer gauge.mutex.Unlock()
+	gauge.compute = compute
+}
+
+func (gauge *Gauge) Value() float64 {
+	gauge.mutex.Lock()
+	compute, value := gauge.compute, gauge.value
+	gauge.mutex.Unlock()
+	if compute != nil {
+		return compute()
+	}
+	return value
+}
+
+func (gauge *Gauge) describe() *desc {
+	return &gauge.desc
+}
+
+func (gauge *Gauge) writeSamples(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", gauge.name, formatValue(gauge.Value()))
+}
+
+// Histogram counts observations, ex: latencies, in cumulative buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (histogram *Histogram) Observe(value float64) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			histogram.counts[i]++
+		}
+	}
+	histogram.count++
+	histogram.sum += value
+}
+
+// Observes the seconds since the start
+func (histogram *Histogram) ObserveSince(start time.Time) {
+	histogram.Observe(time.Since(start).Seconds())
+}
+
+func (histogram *Histogram) Count() uint64 {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	return histogram.count
+}
+
+func (histogram *Histogram) Sum() float64 {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	return histogram.sum
+}
+
+// HistogramVec is a histogram per combination of label values, all with the same buckets
+type HistogramVec struct {
+	desc
+	buckets    []float64
+	mutex      sync.Mutex
+	histograms map[string]*Histogram
+	values     map[string][]string
+}
+
+// Registers a histogram with labels in the default registry, buckets are upper bounds in increasing order
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func (registry *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("Buckets of histogram %s are not sorted", name))
+	}
+	vec := &HistogramVec{
+		desc:       desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+		values:     make(map[string][]string),
+	}
+	registry.register(vec)
+	return vec
+}
+
+// The histogram of the label values, given in the order of the labels
+func (vec *HistogramVec) With(labelValues ...string) *Histogram {
+	key := vec.key(labelValues)
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	histogram, ok := vec.histograms[key]
+	if !ok {
+		histogram = &Histogram{buckets: vec.buckets, counts: make([]uint64, len(vec.buckets))}
+		vec.histograms[key] = histogram
+		vec.values[key] = append([]string{}, labelValues...)
+	}
+	return histogram
+}
+
+func (vec *HistogramVec) describe() *desc {
+	return &vec.desc
+}
+
+func (vec *HistogramVec) writeSamples(w io.Writer) {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+	for _, key := range sortedKeys(vec.values) {
+		values, histogram := vec.values[key], vec.histograms[key]
+		histogram.mutex.Lock()
+		for i, bound := range vec.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, vec.formatLabels(values, "le", formatValue(bound)),
+				histogram.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, vec.formatLabels(values, "le", formatValue(math.Inf(1))),
+			histogram.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", vec.name, vec.formatLabels(values), formatValue(histogram.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", vec.name, vec.formatLabels(values), histogram.count)
+		histogram.mutex.Unlock()
+	}
+}
+
+func sortedKeys(values map[string][]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	database "bargain/liquefy/db"
+)
+
+const usage = `Usage: go run migrate.go -masterip=<ip> <command>
+
+Commands:
+  up        apply the pending migrations
+  down      revert the last migration, outside production only
+  status    list the migrations and when they were applied
+  baseline  mark the initial schema as applied, for databases created by initDB.go
+  reset     drop every table, outside production only, then apply every migration
+`
+
+// Applies, reverts or lists the migrations of the database schema
+func main() {
+	masterIP := flag.String("masterip", "", "IP on which the master is running")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if *masterIP == "" {
+		panic(errors.New("No masterip, please provide valid values"))
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Postgres may still be starting
+	for attempt := 1; ; attempt++ {
+		err := database.Connect(*masterIP)
+		if err == nil {
+			break
+		}
+		if attempt == 30 {
+			log.Error(err)
+			os.Exit(1)
+		}
+		time.Sleep(time.Second)
+	}
+
+	if err := run(flag.Arg(0)); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
+
+func run(command string) error {
+	migrations := database.Migrations()
+	switch command {
+	case "up":
+		applied, err := migrations.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %s\n", migration)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("The database is up to date")
+		}
+		return err
+
+	case "down":
+		migration, err := migrations.Down()
+		if err == nil {
+			fmt.Printf("Reverted %s\n", migration)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrations.Status()
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+		return err
+
+	case "baseline":
+		if err := migrations.Baseline(); err != nil {
+			return err
+		}
+		fmt.Println("Baselined the database, run up to apply the following migrations")
+		return nil
+
+	case "reset":
+		if err := migrations.Reset(); err != nil {
+			return err
+		}
+		return run("up")
+	}
+
+	flag.Usage()
+	os.Exit(2)
+	return nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Scopes limit what a token or API key can be used for
+const (
+	ScopeAll            = "*"               // every scope, given to tokens of a logged in user
+	ScopeRead           = "read"            // read jobs, instances and the user
+	ScopeJobsWrite      = "jobs:write"      // submit and terminate jobs
+	ScopeInstancesWrite = "instances:write" // terminate instances
+	ScopeAccount        = "account"         // link aws accounts and manage API keys
+	ScopeAdmin          = "admin"           // manage the quotas of every user, only granted to operators
+)
+
+var Scopes = []string{ScopeRead, ScopeJobsWrite, ScopeInstancesWrite, ScopeAccount, ScopeAdmin}
+
+// ApiKey is a named, revocable, long lived key for scripts. Only a hash of the key is stored, the key itself is shown
+// once when it is created.
+type ApiKey struct {
+	gorm.Model
+	UserID     uint   `json:"user_id" sql:"not null;index"`
+	Name       string `json:"name" sql:"not null"`
+	Prefix     string `json:"prefix"` // start of the key, to tell keys apart
+	KeyHash    string `json:"-" sql:"not null;unique_index"`
+	Scopes     string `json:"scopes"` // comma separated
+	LastUsedAt int64  `json:"last_used_at"`
+	RevokedAt  int64  `json:"revoked_at"`
+}
+
+// RefreshToken is exchanged for a new access token and a new refresh token, after which it is revoked
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint   `sql:"not null;index"`
+	TokenHash string `sql:"not null;unique_index"`
+	Scopes    string
+	ExpiresAt int64
+	RevokedAt int64
+}
+
+func (key *ApiKey) GetScopes() []string {
+	return ParseScopes(key.Scopes)
+}
+
+func ParseScopes(scopes string) []string {
+	parsed := []string{}
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed
+}
+
+func IsValidScope(scope string) bool {
+	if scope == ScopeAll {
+		return true
+	}
+	for _, valid := range Scopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the granted scopes allow the required scope. Every scope but admin is granted by ScopeAll, admin has to be
+// granted explicitly.
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required || (scope == ScopeAll && required != ScopeAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+// The scopes a token or API key of the user actually grants: the admin scope is only granted to operators, who also
+// get it with ScopeAll
+func EffectiveScopes(user *User, granted []string) []string {
+	effective := []string{}
+	for _, scope := range granted {
+		if scope == ScopeAdmin && !user.Operator {
+			continue
+		}
+		effective = append(effective, scope)
+		if scope == ScopeAll && user.Operator {
+			effective = append(effective, ScopeAdmin)
+		}
+	}
+	return effective
+}
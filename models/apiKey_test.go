@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope([]string{ScopeAll}, ScopeJobsWrite))
+	assert.True(t, HasScope(ParseScopes("read, jobs:write"), ScopeJobsWrite))
+	assert.False(t, HasScope(ParseScopes("read"), ScopeJobsWrite))
+	assert.False(t, HasScope(ParseScopes(""), ScopeRead))
+	assert.False(t, HasScope([]string{ScopeAll}, ScopeAdmin))
+	assert.True(t, HasScope([]string{ScopeRead, ScopeAdmin}, ScopeAdmin))
+}
+
+func TestEffectiveScopes(t *testing.T) {
+	user := &User{}
+	assert.Equal(t, []string{ScopeAll}, EffectiveScopes(user, []string{ScopeAll}))
+	assert.Equal(t, []string{ScopeRead}, EffectiveScopes(user, []string{ScopeRead, ScopeAdmin}))
+
+	user.Operator = true
+	assert.Equal(t, []string{ScopeAll, ScopeAdmin}, EffectiveScopes(user, []string{ScopeAll}))
+	assert.Equal(t, []string{ScopeRead, ScopeAdmin}, EffectiveScopes(user, []string{ScopeRead, ScopeAdmin}))
+	assert.Equal(t, []string{ScopeRead}, EffectiveScopes(user, []string{ScopeRead}))
+}
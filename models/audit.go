@@ -0,0 +1,63 @@
+package models
+
+// Kinds of actors of audited actions
+const (
+	AuditActorUser   = "user"
+	AuditActorSystem = "system"
+)
+
+// Outcomes of audited actions
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"  // the actor was not allowed to perform the action
+	AuditFailure = "failure" // the action was allowed but failed
+)
+
+// Audited actions
+const (
+	AuditLogin               = "auth.login"
+	AuditPasswordChange      = "auth.password_change"
+	AuditPasswordReset       = "auth.password_reset"
+	AuditAwsAccountLink      = "aws_account.link"
+	AuditAwsAccountSetup     = "aws_account.setup"
+	AuditApiKeyCreate        = "api_key.create"
+	AuditApiKeyRevoke        = "api_key.revoke"
+	AuditSecretCreate        = "secret.create"
+	AuditSecretUpdate        = "secret.update"
+	AuditSecretDelete        = "secret.delete"
+	AuditWebhookCreate       = "webhook.create"
+	AuditWebhookDelete       = "webhook.delete"
+	AuditOrgCreate           = "org.create"
+	AuditMemberAdd           = "org.member_add"
+	AuditMemberRoleSet       = "org.member_role_set"
+	AuditMemberRemove        = "org.member_remove"
+	AuditJobCreate           = "job.create"
+	AuditJobBatchCreate      = "job.batch_create"
+	AuditJobDelete           = "job.delete"
+	AuditInstanceDelete      = "instance.delete"
+	AuditInstanceDeprovision = "instance.deprovision"       // the provisioner terminated an instance
+	AuditInstanceUnknown     = "instance.terminate_unknown" // reconciliation terminated an instance Liquefy does not know
+	AuditRetentionPolicySet  = "retention.policy_set"
+	AuditQuotaSet            = "quota.set"
+)
+
+// AuditEntry records an action of a user through the api or of a Liquefy service. Entries are only ever appended.
+// UserID and OrgID are who the entry concerns, the actor for api actions and the owner of the target for system
+// actions, and decide who can see the entry.
+type AuditEntry struct {
+	ID         uint   `gorm:"primary_key" json:"id"`
+	Time       int64  `json:"time" sql:"not null;index"` // unix nanoseconds
+	ActorType  string `json:"actor_type" sql:"not null"`
+	ActorID    uint   `json:"actor_id"`   // user performing api actions
+	ActorName  string `json:"actor_name"` // email of the user, or the name of the service
+	UserID     uint   `json:"user_id" sql:"index"`
+	OrgID      uint   `json:"org_id" sql:"index"`
+	IP         string `json:"ip,omitempty"`
+	RequestID  string `json:"request_id,omitempty" sql:"index"`
+	Action     string `json:"action" sql:"not null;index"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   string `json:"target_id,omitempty"`
+	Outcome    string `json:"outcome" sql:"not null"`
+	Status     int    `json:"status,omitempty"` // http status of api actions
+	Detail     string `json:"detail,omitempty" sql:"type:text"`
+}
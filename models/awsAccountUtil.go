@@ -1,122 +1,84 @@
 package models
 
-import (
-    "strings"
-    "reflect"
-)
-
 func AZtoRegion(az string) string {
     return az[:len(az) - 1]
 }
 
-// Turns "us_east_1" -> "UsEast1"
-func getRegionIdentifier(s string) string {
-    sTemp := strings.Replace(s, "-", " ", 2)
-    sTemp = strings.Title(sTemp)
-    return strings.Replace(sTemp, " ", "", 2)
+// The resources of the account in a region, or nil when none were set up there
+func (account *AwsAccount) FindRegion(region string) *AwsAccountRegion {
+    for _, accountRegion := range account.GetRegions() {
+        if accountRegion.GetRegion() == region {
+            return accountRegion
+        }
+    }
+    return nil
+}
+
+// The resources of the account in a region, adding the region when it has none yet
+func (account *AwsAccount) region(region string) *AwsAccountRegion {
+    if accountRegion := account.FindRegion(region); accountRegion != nil {
+        return accountRegion
+    }
+    accountRegion := &AwsAccountRegion{Region: &region, AwsAccountID: account.ID}
+    account.Regions = append(account.Regions, accountRegion)
+    return accountRegion
 }
 
-// Turns "us_east_1a" -> "UsEast1A"
-func getAzIdentifier(s string) string {
-    sTemp := strings.Replace(s, "-", " ", 2)
-    sTemp = strings.Title(sTemp)
-    sTemp = strings.Replace(sTemp, " ", "", 2)
-    az := sTemp[0:len(sTemp) - 1]
-    zone := sTemp[len(sTemp) - 1:]
-    return az + strings.ToUpper(zone)
+// The subnet of an availability zone, or nil when there is none
+func (region *AwsAccountRegion) FindSubnet(az string) *AwsSubnet {
+    for _, subnet := range region.GetSubnets() {
+        if subnet.GetAvailabilityZone() == az {
+            return subnet
+        }
+    }
+    return nil
 }
 
 func (account *AwsAccount) SetVpcId(region string, vpcId string) {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsVpcId" + regionIdentifier)
-    f.Set(reflect.ValueOf(&vpcId))
+    account.region(region).VpcId = &vpcId
 }
 
 func (account *AwsAccount) GetVpcId(region string) string {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsVpcId" + regionIdentifier)
-    val := f.Elem().String()
-    if val == "<invalid Value>" {
-        return ""
-    } else {
-        return val
-    }
+    return account.FindRegion(region).GetVpcId()
 }
 
 func (account *AwsAccount) SetSshPrivateKey(region string, sshPrivateKey string) {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSshPrivateKey" + regionIdentifier)
-    f.Set(reflect.ValueOf(&sshPrivateKey))
+    account.region(region).SshPrivateKey = &sshPrivateKey
 }
 
 func (account *AwsAccount) GetSshPrivateKey(region string) string {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSshPrivateKey" + regionIdentifier)
-    val := f.Elem().String()
-    if val == "<invalid Value>" {
-        return ""
-    } else {
-        return val
-    }
+    return account.FindRegion(region).GetSshPrivateKey()
 }
 
 func (account *AwsAccount) SetSubnetId(az string, subnetId string) {
-    azIdentifier := getAzIdentifier(az)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSubnetId" + azIdentifier)
-    f.Set(reflect.ValueOf(&subnetId))
+    accountRegion := account.region(AZtoRegion(az))
+    if subnet := accountRegion.FindSubnet(az); subnet != nil {
+        subnet.SubnetId = &subnetId
+        return
+    }
+    accountRegion.Subnets = append(accountRegion.Subnets, &AwsSubnet{
+        AwsAccountRegionID: accountRegion.ID,
+        AvailabilityZone:   &az,
+        SubnetId:           &subnetId,
+    })
 }
 
 func (account *AwsAccount) GetSubnetId(az string) string {
-    azIdentifier := getAzIdentifier(az)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSubnetId" + azIdentifier)
-    val := f.Elem().String()
-    if val == "<invalid Value>" {
-        return ""
-    } else {
-        return val
-    }
+    return account.FindRegion(AZtoRegion(az)).FindSubnet(az).GetSubnetId()
 }
 
 func (account *AwsAccount) SetSecurityGroupId(region string, sgId string) {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSecurityGroupId" + regionIdentifier)
-    f.Set(reflect.ValueOf(&sgId))
+    account.region(region).SecurityGroupId = &sgId
 }
 
 func (account *AwsAccount) GetSecurityGroupId(region string) string {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSecurityGroupId" + regionIdentifier)
-    val := f.Elem().String()
-    if val == "<invalid Value>" {
-        return ""
-    } else {
-        return val
-    }
+    return account.FindRegion(region).GetSecurityGroupId()
 }
 
 func (account *AwsAccount) SetSecurityGroupName(region string, sgName string) {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSecurityGroupName" + regionIdentifier)
-    f.Set(reflect.ValueOf(&sgName))
+    account.region(region).SecurityGroupName = &sgName
 }
 
 func (account *AwsAccount) GetSecurityGroupName(region string) string {
-    regionIdentifier := getRegionIdentifier(region)
-    mutable := reflect.ValueOf(account).Elem()
-    f := mutable.FieldByName("AwsSecurityGroupName" + regionIdentifier)
-    val := f.Elem().String()
-    if val == "<invalid Value>" {
-        return ""
-    } else {
-        return val
-    }
+    return account.FindRegion(region).GetSecurityGroupName()
 }
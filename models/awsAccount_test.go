@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsAccountRegionResources(t *testing.T) {
+	account := &AwsAccount{}
+	assert.Equal(t, "", account.GetVpcId("eu-west-1"))
+	assert.Equal(t, "", account.GetSubnetId("eu-west-1a"))
+
+	account.SetVpcId("eu-west-1", "vpc-1")
+	account.SetSshPrivateKey("eu-west-1", "key")
+	account.SetSubnetId("eu-west-1a", "subnet-a")
+	account.SetSubnetId("eu-west-1b", "subnet-b")
+	account.SetSubnetId("eu-west-1a", "subnet-c")
+	account.SetSecurityGroupId("us-east-1", "sg-1")
+
+	assert.Len(t, account.Regions, 2)
+	assert.Equal(t, "vpc-1", account.GetVpcId("eu-west-1"))
+	assert.Equal(t, "key", account.GetSshPrivateKey("eu-west-1"))
+	assert.Equal(t, "subnet-c", account.GetSubnetId("eu-west-1a"))
+	assert.Equal(t, "subnet-b", account.GetSubnetId("eu-west-1b"))
+	assert.Len(t, account.FindRegion("eu-west-1").Subnets, 2)
+	assert.Equal(t, "sg-1", account.GetSecurityGroupId("us-east-1"))
+	assert.Equal(t, "", account.GetSshPrivateKey("us-east-1"))
+	assert.Nil(t, account.FindRegion("us-west-2"))
+}
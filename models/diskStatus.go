@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// DiskStatus is sent by the executor to the scheduler as a framework message after every image collection, so
+// the scheduler can avoid placing jobs onto instances that are running out of disk.
+type DiskStatus struct {
+	InstanceID   uint    `json:"instance_id"`
+	UsedFraction float64 `json:"used_fraction"`
+	Pressure     bool    `json:"pressure"`
+}
+
+func SerializeDiskStatus(status *DiskStatus) (string, error) {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return "", NewError("Failed to serialize disk status", err)
+	}
+	return string(bytes), nil
+}
+
+func DeserializeDiskStatus(content string) (*DiskStatus, error) {
+	status := DiskStatus{}
+	if err := json.Unmarshal([]byte(content), &status); err != nil {
+		return nil, NewError("Failed to de-serialize disk status", err)
+	}
+	return &status, nil
+}
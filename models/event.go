@@ -0,0 +1,36 @@
+package models
+
+// Types of events, see the events package
+const (
+	EventJobStatus        = "job.status"                 // a job changed status
+	EventInstanceStatus   = "instance.status"            // an instance is provisioned or deprovisioned
+	EventSpotInterruption = "instance.spot_interruption" // aws marked a spot instance for termination
+	EventBudgetAlert      = "budget.alert"               // the costs of a user this month crossed a part of their budget
+)
+
+var EventTypes = []string{EventJobStatus, EventInstanceStatus, EventSpotInterruption, EventBudgetAlert}
+
+func IsValidEventType(eventType string) bool {
+	for _, valid := range EventTypes {
+		if eventType == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change users are notified of through webhooks and the event stream. UserID and OrgID are the owner of
+// what changed, and decide who is notified like they decide who can see it.
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Time      int64                  `json:"time"` // unix nanoseconds
+	UserID    uint                   `json:"user_id"`
+	OrgID     uint                   `json:"org_id,omitempty"`
+	SubjectID uint                   `json:"subject_id,omitempty"` // id of the job or instance
+	Data      map[string]interface{} `json:"data"`
+}
+
+func (event *Event) VisibleTo(userID, orgID uint) bool {
+	return event.UserID == userID || (event.OrgID != 0 && event.OrgID == orgID)
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Keys can be reused for other requests once they expire
+const IdempotencyKeyTTL = 24 * time.Hour
+
+var idempotencyKeyRegexp = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// IdempotencyKey is the Idempotency-Key a user submitted jobs with, along with the jobs that were created. A request
+// retried with the same key returns these jobs instead of creating them again. Keys are stored in the transaction
+// creating the jobs, so that concurrent retries cannot both create them.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primary_key"`
+	UserID      uint      `sql:"not null;unique_index:idx_idempotency_user_key"`
+	Key         string    `sql:"not null;unique_index:idx_idempotency_user_key"`
+	RequestHash string    `sql:"not null"` // hash of the request, a key cannot be reused for another request
+	JobIDs      string    `sql:"type:text;not null"`
+	CreatedAt   time.Time `sql:"index"`
+}
+
+func ValidateIdempotencyKey(key string) error {
+	if !idempotencyKeyRegexp.MatchString(key) {
+		return fmt.Errorf("Idempotency keys are 1 to 255 printable ascii characters without spaces")
+	}
+	return nil
+}
+
+func (key *IdempotencyKey) IsExpired(now time.Time) bool {
+	return now.Sub(key.CreatedAt) > IdempotencyKeyTTL
+}
+
+func (key *IdempotencyKey) GetJobIDs() ([]uint, error) {
+	ids := []uint{}
+	if err := json.Unmarshal([]byte(key.JobIDs), &ids); err != nil {
+		return ids, NewErrorf(err, "Failed parsing jobs of idempotency key %s", key.Key)
+	}
+	return ids, nil
+}
+
+func (key *IdempotencyKey) SetJobIDs(ids []uint) error {
+	bytes, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	key.JobIDs = string(bytes)
+	return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	assert.NoError(t, ValidateIdempotencyKey("pipeline-42/submit:3"))
+	assert.NoError(t, ValidateIdempotencyKey(strings.Repeat("k", 255)))
+
+	assert.Error(t, ValidateIdempotencyKey(""))
+	assert.Error(t, ValidateIdempotencyKey("with space"))
+	assert.Error(t, ValidateIdempotencyKey(strings.Repeat("k", 256)))
+}
+
+func TestIdempotencyKeyJobs(t *testing.T) {
+	key := &IdempotencyKey{Key: "retry", CreatedAt: time.Now()}
+	assert.NoError(t, key.SetJobIDs([]uint{4, 2, 7}))
+
+	ids, err := key.GetJobIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{4, 2, 7}, ids)
+
+	assert.False(t, key.IsExpired(time.Now()))
+	assert.True(t, key.IsExpired(time.Now().Add(IdempotencyKeyTTL+time.Minute)))
+}
@@ -6,6 +6,7 @@ import (
     "strings"
     "crypto/md5"
     "encoding/gob"
+    "encoding/json"
 
     log "github.com/Sirupsen/logrus"
     mesos "github.com/mesos/mesos-go/mesosproto"
@@ -18,6 +19,19 @@ const (
     ContainerJobStatusLaunched = "TASK_LAUNCHED"
 )
 
+// Kinds of jobs. Batch jobs run to completion, service jobs run until killed and are restarted when they fail.
+const (
+    ContainerJobKindBatch   = "batch"
+    ContainerJobKindService = "service"
+)
+
+// Types of health checks run by the executor against service jobs
+const (
+    HealthCheckHttp    = "http"
+    HealthCheckTcp     = "tcp"
+    HealthCheckCommand = "command"
+)
+
 type ContainerJobGroup struct {
     gorm.Model
     Name          string
@@ -32,26 +46,47 @@ type ContainerJob struct {
     Name            string          `json:"name"`
     Command         string          `json:"command"`
     OwnerID         uint            `json:"owner_id"`
+    OrgID           uint            `json:"org_id"` // organization the job was submitted in, 0 for personal jobs
     Status          string          `json:"status"`
     SourceImage     string          `json:"source_image"`
     SourceType      string          `json:"source_type"` // "code" or "image"
     Environment     string          `json:"environment"` // array of env vars
-    PortMappings    string          `json:"port_mappings"` // array of port mappings
+    Secrets         string          `json:"secrets"`     // array of secret refs, the values are never stored with the job
+    PortMappings    string          `json:"port_mappings"` // array of port mappings, host port 0 means any port
+    AssignedPorts   string          `json:"assigned_ports"` // array of port mappings with the host ports reserved at launch
+
+    Kind            string          `json:"kind"`           // "batch" or "service"
+    HealthCheck     string          `json:"health_check"`   // health check of a service job
+    MaxRestarts     int             `json:"max_restarts"`
+
+    // Build options, only used when SourceType is "code"
+    SourceBranch    string          `json:"source_branch"`
+    SourceCommit    string          `json:"source_commit"`
+    SourceDir       string          `json:"source_dir"`      // subdirectory of the repo used as build context
+    Dockerfile      string          `json:"dockerfile"`      // path of the Dockerfile within the build context
+    BuildRegistry   string          `json:"build_registry"`  // repository built images are pushed to and pulled from
 
     Ram             int             `json:"ram"`
     Cpu             float64         `json:"cpu"`
     Gpu             int             `json:"gpu"`
+    Disk            int             `json:"disk"`           // scratch space in MB
+    InstanceStore   bool            `json:"instance_store"` // whether the disk must be on instance store volumes
 
     //Internal
+    ResolvedSecrets []ResolvedSecret `sql:"-" json:"-"` // only set in the task sent to the executor
     InstanceID      uint            `json:"instance_id"`
     ContainerId     string          `json:"container_id"`
     RetryCount      int             `json:"retry_count"`
+    Restarts        int             `json:"restarts"`
+    Healthy         bool            `json:"healthy"`
     UserTerminated  bool            `json:"user_terminated"`
+    TraceParent     string          `json:"trace_parent"`   // root span of the trace of the job, created with it
 
     //Detail Tracking
     StartTime       int64           `json:"start_time"`
     EndTime         int64           `json:"end_time"`
     TotalCost       float64         `json:"total_cost"`
+    RestoredAt      int64           `json:"restored_at,omitempty"` // when the job was last restored from an archive
 
     Output          string          `json:"output"`
     BeginDelimiter  string          `json:"begin_delimiter"`
@@ -64,11 +99,100 @@ func (job *ContainerJob) IsTerminated() bool {
         job.Status == mesos.TaskState_TASK_FINISHED.String()        // finished via success
 }
 
+// Statuses a job no longer runs in. Jobs are normally retried from TASK_LOST and TASK_ERROR, but a job left in
+// either of them does not run anymore either.
+var TerminalJobStatuses = []string{
+    mesos.TaskState_TASK_KILLED.String(),
+    mesos.TaskState_TASK_FAILED.String(),
+    mesos.TaskState_TASK_FINISHED.String(),
+    mesos.TaskState_TASK_LOST.String(),
+    mesos.TaskState_TASK_ERROR.String(),
+}
+
+func IsTerminalJobStatus(status string) bool {
+    for _, terminal := range TerminalJobStatuses {
+        if status == terminal {
+            return true
+        }
+    }
+    return false
+}
+
+type HealthCheck struct {
+    Type                string  `json:"type"`            // "http", "tcp" or "command"
+    Port                int     `json:"port"`            // container port checked by http and tcp checks
+    Path                string  `json:"path"`            // path requested by http checks
+    Command             string  `json:"command"`         // command run inside the container by command checks
+    IntervalSeconds     int     `json:"interval_seconds"`
+    TimeoutSeconds      int     `json:"timeout_seconds"`
+    GracePeriodSeconds  int     `json:"grace_period_seconds"` // time after (re)starting before failures count
+    FailureThreshold    int     `json:"failure_threshold"`    // consecutive failures before restarting
+}
+
+// Fill in defaults for any unset health check timings
+func (check *HealthCheck) SetDefaults() {
+    if check.IntervalSeconds <= 0 {
+        check.IntervalSeconds = 10
+    }
+    if check.TimeoutSeconds <= 0 {
+        check.TimeoutSeconds = 5
+    }
+    if check.GracePeriodSeconds < 0 {
+        check.GracePeriodSeconds = 0
+    }
+    if check.FailureThreshold <= 0 {
+        check.FailureThreshold = 3
+    }
+    if check.Type == HealthCheckHttp && check.Path == "" {
+        check.Path = "/"
+    }
+}
+
+func (check *HealthCheck) Validate() error {
+    switch check.Type {
+    case HealthCheckHttp, HealthCheckTcp:
+        if check.Port <= 0 || check.Port > 65535 {
+            return fmt.Errorf("Health check port %d is invalid", check.Port)
+        }
+    case HealthCheckCommand:
+        if check.Command == "" {
+            return fmt.Errorf("Command health checks require a command")
+        }
+    default:
+        return fmt.Errorf("Invalid health check type %s", check.Type)
+    }
+    return nil
+}
+
 type PortMapping struct {
     HostPort      int `json:"host_port"`
     ContainerPort int `json:"container_port"`
 }
 
+// The port mappings the container is created with: the ports reserved at launch if any, otherwise the requested ones
+func (js ContainerJob) GetPortMappings() ([]PortMapping, error) {
+    if js.AssignedPorts != "" {
+        return parsePortMappings(js.AssignedPorts)
+    }
+    return parsePortMappings(js.PortMappings)
+}
+
+// The port mappings the job asked for, regardless of the ports reserved on a previous attempt
+func (js ContainerJob) GetRequestedPortMappings() ([]PortMapping, error) {
+    return parsePortMappings(js.PortMappings)
+}
+
+func parsePortMappings(mappings string) ([]PortMapping, error) {
+    portMappings := []PortMapping{}
+    if mappings == "" {
+        return portMappings, nil
+    }
+    if err := json.Unmarshal([]byte(mappings), &portMappings); err != nil {
+        return portMappings, NewErrorf(err, "Failed parsing port mappings from string %s", mappings)
+    }
+    return portMappings, nil
+}
+
 type ContainerJobTracker struct {
     gorm.Model
     ContainerJobID  uint        `sql:"not null"`
@@ -79,6 +203,14 @@ type ContainerJobTracker struct {
     Msg             string      `sql:"not null"`
 }
 
+// ContainerJobBuildLog holds the output of building the image of a "code" job on a given attempt.
+type ContainerJobBuildLog struct {
+    gorm.Model
+    ContainerJobID  uint        `sql:"not null"`
+    Attempt         int         `sql:"not null"`
+    Log             string      `sql:"type:text"`
+}
+
 type ContainerJobLog struct {
     Index int      `json:"index,omitempty"`
     Lines []string `json:"lines"`
@@ -90,6 +222,23 @@ type EnvVar struct {
     Value    string `json:"value"`
 }
 
+func (js ContainerJob) IsService() bool {
+    return js.Kind == ContainerJobKindService
+}
+
+// Returns the health check of a service job, or nil if it has none
+func (js ContainerJob) GetHealthCheck() (*HealthCheck, error) {
+    if js.HealthCheck == "" {
+        return nil, nil
+    }
+    check := &HealthCheck{}
+    if err := json.Unmarshal([]byte(js.HealthCheck), check); err != nil {
+        return nil, NewErrorf(err, "Failed parsing health check of job %d", js.ID)
+    }
+    check.SetDefaults()
+    return check, nil
+}
+
 func (js ContainerJob) UsesStdOutPipe() bool {
     return js.Output == "stdout" || js.Output == ""
 }
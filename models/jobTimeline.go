@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// JobTimelineSummary is the time a job spent in each phase before finishing, in seconds, over all of its attempts.
+// Phases still in progress count up to the time the summary is made.
+type JobTimelineSummary struct {
+	QueueTime        float64 `json:"queue_time"`        // waiting for an instance to be assigned
+	ProvisioningWait float64 `json:"provisioning_wait"` // assigned, waiting for the instance to be provisioned
+	ImageTime        float64 `json:"image_time"`        // launched, pulling or building the image and creating the container
+	RunTime          float64 `json:"run_time"`
+}
+
+// Summarizes the status history of a job, oldest first, as of now in unix nanoseconds. The phase of the job is the
+// one of its last status, a staging job being queued until it is assigned an instance.
+func SummarizeJobTimeline(trackers []*ContainerJobTracker, now int64) *JobTimelineSummary {
+	summary := &JobTimelineSummary{}
+	for i, tracker := range trackers {
+		end := now
+		if i+1 < len(trackers) {
+			end = trackers[i+1].Time
+		}
+		seconds := time.Duration(end - tracker.Time).Seconds()
+		if seconds < 0 {
+			seconds = 0
+		}
+
+		switch tracker.Status {
+		case mesos.TaskState_TASK_STAGING.String():
+			if tracker.InstanceID == 0 {
+				summary.QueueTime += seconds
+			} else {
+				summary.ProvisioningWait += seconds
+			}
+		case ContainerJobStatusLaunched, mesos.TaskState_TASK_STARTING.String():
+			summary.ImageTime += seconds
+		case mesos.TaskState_TASK_RUNNING.String():
+			summary.RunTime += seconds
+		case mesos.TaskState_TASK_FINISHED.String(), mesos.TaskState_TASK_FAILED.String(),
+			mesos.TaskState_TASK_KILLED.String():
+			return summary
+		}
+	}
+	return summary
+}
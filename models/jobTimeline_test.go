@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeJobTimeline(t *testing.T) {
+	second := int64(1000000000)
+	tracker := func(status string, instanceID uint, at int64) *ContainerJobTracker {
+		return &ContainerJobTracker{Status: status, InstanceID: instanceID, Time: at * second}
+	}
+	trackers := []*ContainerJobTracker{
+		tracker("TASK_STAGING", 0, 0),
+		tracker("TASK_STAGING", 7, 30),
+		tracker(ContainerJobStatusLaunched, 7, 150),
+		tracker("TASK_STARTING", 7, 170),
+		tracker("TASK_RUNNING", 7, 180),
+	}
+
+	// Running jobs run until now
+	assert.Equal(t, &JobTimelineSummary{QueueTime: 30, ProvisioningWait: 120, ImageTime: 30, RunTime: 20},
+		SummarizeJobTimeline(trackers, 200*second))
+
+	// Retries wait for the instance again, and nothing counts after the job finished
+	trackers = append(trackers,
+		tracker("TASK_LOST", 7, 200),
+		tracker("TASK_STAGING", 7, 200),
+		tracker(ContainerJobStatusLaunched, 7, 210),
+		tracker("TASK_RUNNING", 7, 220),
+		tracker("TASK_FINISHED", 7, 300),
+	)
+	assert.Equal(t, &JobTimelineSummary{QueueTime: 30, ProvisioningWait: 130, ImageTime: 40, RunTime: 100},
+		SummarizeJobTimeline(trackers, 1000*second))
+
+	assert.Equal(t, &JobTimelineSummary{}, SummarizeJobTimeline([]*ContainerJobTracker{}, 0))
+}
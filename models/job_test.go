@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	assert.Nil(t, (&HealthCheck{Type: HealthCheckHttp, Port: 80}).Validate())
+	assert.Nil(t, (&HealthCheck{Type: HealthCheckTcp, Port: 5432}).Validate())
+	assert.Nil(t, (&HealthCheck{Type: HealthCheckCommand, Command: "pg_isready"}).Validate())
+
+	assert.NotNil(t, (&HealthCheck{Type: HealthCheckHttp}).Validate())
+	assert.NotNil(t, (&HealthCheck{Type: HealthCheckTcp, Port: 70000}).Validate())
+	assert.NotNil(t, (&HealthCheck{Type: HealthCheckCommand}).Validate())
+	assert.NotNil(t, (&HealthCheck{Type: "udp", Port: 53}).Validate())
+}
+
+func TestGetHealthCheck(t *testing.T) {
+	job := ContainerJob{Kind: ContainerJobKindService}
+	check, err := job.GetHealthCheck()
+	assert.Nil(t, err)
+	assert.Nil(t, check)
+
+	job.HealthCheck = `{"type": "http", "port": 8080, "interval_seconds": 30}`
+	check, err = job.GetHealthCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, "/", check.Path)
+	assert.Equal(t, 30, check.IntervalSeconds)
+	assert.Equal(t, 5, check.TimeoutSeconds)
+	assert.Equal(t, 3, check.FailureThreshold)
+
+	job.HealthCheck = "not json"
+	_, err = job.GetHealthCheck()
+	assert.NotNil(t, err)
+}
+
+func TestRequestedPortMappingsIgnorePreviousAttempt(t *testing.T) {
+	job := ContainerJob{
+		PortMappings:  `[{"host_port": 0, "container_port": 80}]`,
+		AssignedPorts: `[{"host_port": 31005, "container_port": 80}]`,
+	}
+
+	assigned, err := job.GetPortMappings()
+	assert.Nil(t, err)
+	assert.Equal(t, []PortMapping{{HostPort: 31005, ContainerPort: 80}}, assigned)
+
+	requested, err := job.GetRequestedPortMappings()
+	assert.Nil(t, err)
+	assert.Equal(t, []PortMapping{{HostPort: 0, ContainerPort: 80}}, requested)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Roles of organization members
+const (
+	RoleAdmin  = "admin"  // manages members and the aws account, and every job and instance of the organization
+	RoleMember = "member" // submits jobs and terminates jobs and instances of the organization
+	RoleViewer = "viewer" // sees the jobs and instances of the organization
+)
+
+var Roles = []string{RoleAdmin, RoleMember, RoleViewer}
+
+// Actions that roles allow on the jobs and instances of an organization, and on the organization itself
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionManage = "manage"
+)
+
+var roleActions = map[string][]string{
+	RoleAdmin:  {ActionRead, ActionWrite, ActionManage},
+	RoleMember: {ActionRead, ActionWrite},
+	RoleViewer: {ActionRead},
+}
+
+// Organization shares an aws account between its members. Jobs members submit run on it and are visible to the
+// other members according to their role.
+type Organization struct {
+	gorm.Model
+	Name         string `json:"name" sql:"not null"`
+	AwsAccountID uint   `json:"aws_account_id"`
+}
+
+// Membership gives a user a role in an organization. A user belongs to at most one organization.
+type Membership struct {
+	gorm.Model
+	OrgID  uint   `json:"org_id" sql:"not null;index"`
+	UserID uint   `json:"user_id" sql:"not null;unique_index"`
+	Role   string `json:"role" sql:"not null"`
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleActions[role]
+	return ok
+}
+
+// Whether the role allows the action on resources of its organization
+func RoleAllows(role, action string) bool {
+	for _, allowed := range roleActions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, RoleAllows(RoleAdmin, ActionManage))
+	assert.True(t, RoleAllows(RoleMember, ActionWrite))
+	assert.False(t, RoleAllows(RoleMember, ActionManage))
+	assert.True(t, RoleAllows(RoleViewer, ActionRead))
+	assert.False(t, RoleAllows(RoleViewer, ActionWrite))
+	assert.False(t, RoleAllows("owner", ActionRead))
+
+	for _, role := range Roles {
+		assert.True(t, IsValidRole(role))
+	}
+	assert.False(t, IsValidRole(""))
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Limits of users without a quota of their own
+const (
+	DefaultMaxActiveJobs = 100
+	DefaultMaxInstances  = 20
+	DefaultMaxVCpus      = 256
+)
+
+// Quota limits what a user runs at once. Every job may request a spot instance in the aws account it runs on, so
+// quotas bound what a runaway script can spend.
+type Quota struct {
+	gorm.Model
+	UserID        uint    `json:"user_id" sql:"not null;unique_index"`
+	MaxActiveJobs int     `json:"max_active_jobs"` // jobs not finished, failed or killed
+	MaxInstances  int     `json:"max_instances"`   // instances not deprovisioned
+	MaxVCpus      float64 `json:"max_vcpus"`       // total cpus of those instances
+	MonthlyBudget float64 `json:"monthly_budget"`  // dollars, alerts are sent as job costs reach it, 0 for none
+}
+
+// Parts of the monthly budget alerts are sent at
+var BudgetAlertThresholds = []float64{0.5, 0.8, 1}
+
+func DefaultQuota(userID uint) *Quota {
+	return &Quota{
+		UserID:        userID,
+		MaxActiveJobs: DefaultMaxActiveJobs,
+		MaxInstances:  DefaultMaxInstances,
+		MaxVCpus:      DefaultMaxVCpus,
+	}
+}
+
+func (quota *Quota) Validate() error {
+	if quota.MaxActiveJobs < 0 || quota.MaxInstances < 0 || quota.MaxVCpus < 0 || quota.MonthlyBudget < 0 {
+		return fmt.Errorf("Quota limits cannot be negative")
+	}
+	return nil
+}
+
+// The thresholds the costs of the month reached going from before to after
+func (quota *Quota) CrossedBudgetThresholds(before, after float64) []float64 {
+	crossed := []float64{}
+	if quota.MonthlyBudget <= 0 {
+		return crossed
+	}
+	for _, threshold := range BudgetAlertThresholds {
+		limit := threshold * quota.MonthlyBudget
+		if before < limit && after >= limit {
+			crossed = append(crossed, threshold)
+		}
+	}
+	return crossed
+}
+
+// QuotaUsage is what a user currently runs
+type QuotaUsage struct {
+	ActiveJobs    int     `json:"active_jobs"`
+	ActiveJobCpus float64 `json:"active_job_vcpus"` // requested by the active jobs
+	Instances     int     `json:"instances"`
+	VCpus         float64 `json:"vcpus"`
+}
+
+// Whether the user can submit count jobs needing cpu vcpus in total, on top of the vcpus their active jobs need
+func (quota *Quota) AllowsJobs(usage *QuotaUsage, count int, cpu float64) error {
+	if usage.ActiveJobs+count > quota.MaxActiveJobs {
+		return fmt.Errorf("Quota of %d active jobs exceeded, %d jobs are active", quota.MaxActiveJobs,
+			usage.ActiveJobs)
+	}
+	if usage.ActiveJobCpus+cpu > quota.MaxVCpus {
+		return fmt.Errorf("Jobs need %g vcpus, active jobs already need %g vcpus of the quota of %g vcpus", cpu,
+			usage.ActiveJobCpus, quota.MaxVCpus)
+	}
+	return nil
+}
+
+// Whether an instance with cpu vcpus can be provisioned for the user
+func (quota *Quota) AllowsInstance(usage *QuotaUsage, cpu float64) error {
+	if usage.Instances+1 > quota.MaxInstances {
+		return fmt.Errorf("Quota of %d instances reached", quota.MaxInstances)
+	}
+	if usage.VCpus+cpu > quota.MaxVCpus {
+		return fmt.Errorf("Quota of %g vcpus exceeded, instances use %g vcpus", quota.MaxVCpus, usage.VCpus)
+	}
+	return nil
+}
+
+// Accounts for an instance provisioned after the usage was fetched
+func (usage *QuotaUsage) AddInstance(cpu float64) {
+	usage.Instances++
+	usage.VCpus += cpu
+}
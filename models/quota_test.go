@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaAllowsJobs(t *testing.T) {
+	quota := &Quota{MaxActiveJobs: 2, MaxInstances: 1, MaxVCpus: 8}
+
+	assert.NoError(t, quota.AllowsJobs(&QuotaUsage{ActiveJobs: 1}, 1, 4))
+	assert.Error(t, quota.AllowsJobs(&QuotaUsage{ActiveJobs: 2}, 1, 4))
+	assert.Error(t, quota.AllowsJobs(&QuotaUsage{ActiveJobs: 1}, 2, 4))
+	assert.Error(t, quota.AllowsJobs(&QuotaUsage{}, 1, 16))
+
+	// Vcpus of a batch add up, and add to those of the active jobs
+	assert.NoError(t, quota.AllowsJobs(&QuotaUsage{ActiveJobCpus: 4}, 1, 4))
+	assert.Error(t, quota.AllowsJobs(&QuotaUsage{ActiveJobCpus: 6}, 1, 4))
+	assert.Error(t, (&Quota{MaxActiveJobs: 10, MaxVCpus: 8}).AllowsJobs(&QuotaUsage{}, 3, 3*4))
+}
+
+func TestTerminalJobStatuses(t *testing.T) {
+	assert.True(t, IsTerminalJobStatus("TASK_LOST"))
+	assert.True(t, IsTerminalJobStatus("TASK_ERROR"))
+	assert.True(t, IsTerminalJobStatus("TASK_FINISHED"))
+	assert.False(t, IsTerminalJobStatus("TASK_RUNNING"))
+	assert.False(t, IsTerminalJobStatus(ContainerJobStatusLaunched))
+}
+
+func TestQuotaAllowsInstance(t *testing.T) {
+	quota := &Quota{MaxActiveJobs: 2, MaxInstances: 2, MaxVCpus: 8}
+	usage := &QuotaUsage{}
+
+	assert.NoError(t, quota.AllowsInstance(usage, 4))
+	usage.AddInstance(4)
+	assert.Error(t, quota.AllowsInstance(usage, 8))
+	assert.NoError(t, quota.AllowsInstance(usage, 4))
+	usage.AddInstance(4)
+	assert.Error(t, quota.AllowsInstance(usage, 1))
+
+	assert.Error(t, (&Quota{MaxVCpus: -1}).Validate())
+	assert.NoError(t, DefaultQuota(1).Validate())
+}
+
+func TestCrossedBudgetThresholds(t *testing.T) {
+	quota := &Quota{MonthlyBudget: 100}
+
+	assert.Equal(t, []float64{}, quota.CrossedBudgetThresholds(10, 40))
+	assert.Equal(t, []float64{0.5}, quota.CrossedBudgetThresholds(40, 50))
+	assert.Equal(t, []float64{0.8, 1}, quota.CrossedBudgetThresholds(60, 120))
+	assert.Equal(t, []float64{}, quota.CrossedBudgetThresholds(120, 130))
+
+	quota.MonthlyBudget = 0
+	assert.Equal(t, []float64{}, quota.CrossedBudgetThresholds(0, 1000))
+}
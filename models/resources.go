@@ -1,5 +1,10 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	ResourceStatusNew               = "new"
 	ResourceProvisioning            = "provisioning"
@@ -14,25 +19,32 @@ const (
 type ResourceInstance struct {
 	ID          uint            `gorm:primary_key json:"id"`
 	OwnerId     uint            `json:"owner_id"`
+	OrgID       uint            `json:"org_id"` // organization whose aws account the instance runs on, 0 if personal
 	RamTotal    int             `json:"ram_total"`
 	RamUsed     int             `json:"ram_used"`
 	CpuTotal    float64         `json:"cpu_total"`
 	CpuUsed     float64         `json:"cpu_used"`
 	GpuTotal    int             `json:"gpu_total"`
 	GpuUsed     int             `json:"gpu_used"`
+	DiskTotal   int             `json:"disk_total"`
+	DiskUsed    int             `json:"disk_used"`
 	Status      string          `json:"status"`
 	LaunchTime  int64           `json:"launch_time"`
+	RestoredAt  int64           `json:"restored_at,omitempty"` // when the instance was last restored from an archive
 	IP          string          `json:"ip"`
 
 	// Internal
 	SlaveID         string      `json:"slave_id"`
 	UserTerminated  bool        `json:"user_terminated"`
+	TraceParent     string      `json:"trace_parent"` // span that provisioning the resource is traced under
 
 	// Amazon specific
 	AwsInstanceId       string  `json:"aws_instance_id"`
 	AwsAvailabilityZone string  `json:"aws_availability_zone"`
 	AwsInstanceType     string  `json:"aws_instance_type"`
 	AwsSpotPrice        float64 `json:"aws_spot_price"`
+	AwsVolumeSize       int     `json:"aws_volume_size"` // size of the root volume in GB
+	AwsInstanceStore    bool    `json:"aws_instance_store"` // whether instance store volumes are mounted
 }
 
 type ResourceEvent struct {
@@ -41,4 +53,91 @@ type ResourceEvent struct {
 	Status      string          `json:"status" sql:"not null"`
 	Time        int64           `json:"time" sql:"not null"`
 	Msg         string          `json:"msg" sql:"type:varchar(1024);not null"`
-}
\ No newline at end of file
+}
+
+// PortRange is an inclusive range of host ports
+type PortRange struct {
+	Begin int
+	End   int
+}
+
+// Host ports advertised by every agent for jobs to bind to. Ssh, the mesos agent (5051) and the ephemeral port range
+// used for outgoing connections are left out.
+var AgentPortRanges = []PortRange{
+	{80, 80},
+	{443, 443},
+	{1025, 5050},
+	{5052, 32767},
+}
+
+func IsAgentPort(port int) bool {
+	for _, portRange := range AgentPortRanges {
+		if port >= portRange.Begin && port <= portRange.End {
+			return true
+		}
+	}
+	return false
+}
+
+// The agent port ranges in the format of the mesos --resources flag, ex: ports:[80-80,443-443]
+func AgentPortsResource() string {
+	ranges := make([]string, len(AgentPortRanges))
+	for i, portRange := range AgentPortRanges {
+		ranges[i] = fmt.Sprintf("%d-%d", portRange.Begin, portRange.End)
+	}
+	return fmt.Sprintf("ports:[%s]", strings.Join(ranges, ","))
+}
+
+// Root volumes also hold the OS, docker images and the mesos agent, which is reserved on top of the disk of jobs
+const RootVolumeReservedGB = 30
+const MinRootVolumeGB = 50
+const MaxRootVolumeGB = 1024
+
+// Instance store volumes are mounted on the host at InstanceStoreMountPath, and every job requesting instance store
+// gets its own directory there mounted into its container at InstanceStoreContainerPath
+const InstanceStoreMountPath = "/mnt/instance-store"
+const InstanceStoreContainerPath = "/scratch"
+
+// InstanceStorage is the storage an instance is provisioned with to run its assigned jobs
+type InstanceStorage struct {
+	VolumeSize    int  // GB of the root volume
+	InstanceStore bool // whether the instance store volumes are mounted
+	DiskTotal     int  // MB of disk advertised to mesos
+}
+
+// Sizes the root volume of an instance to fit the disk of the jobs assigned to it, and mounts the instance store
+// volumes (instanceStoreDisk MB in total) if any of the jobs requests it
+func PlanInstanceStorage(jobs []*ContainerJob, instanceStoreDisk int) InstanceStorage {
+	rootDisk := 0
+	instanceStore := false
+	for _, job := range jobs {
+		if job.InstanceStore && instanceStoreDisk > 0 {
+			instanceStore = true
+		} else {
+			rootDisk += job.Disk
+		}
+	}
+
+	// Round up to whole GB
+	volumeSize := (rootDisk+1023)/1024 + RootVolumeReservedGB
+	if volumeSize < MinRootVolumeGB {
+		volumeSize = MinRootVolumeGB
+	} else if volumeSize > MaxRootVolumeGB {
+		volumeSize = MaxRootVolumeGB
+	}
+
+	storage := InstanceStorage{
+		VolumeSize:    volumeSize,
+		InstanceStore: instanceStore,
+		DiskTotal:     (volumeSize - RootVolumeReservedGB) * 1024,
+	}
+	if instanceStore {
+		storage.DiskTotal += instanceStoreDisk
+	}
+	return storage
+}
+
+// The largest disk in MB a job can request without instance store
+func MaxRootDisk() int {
+	return (MaxRootVolumeGB - RootVolumeReservedGB) * 1024
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanInstanceStorage(t *testing.T) {
+	// Small jobs get the minimum root volume
+	storage := PlanInstanceStorage([]*ContainerJob{{Disk: 1024}}, 0)
+	assert.Equal(t, MinRootVolumeGB, storage.VolumeSize)
+	assert.False(t, storage.InstanceStore)
+	assert.Equal(t, (MinRootVolumeGB-RootVolumeReservedGB)*1024, storage.DiskTotal)
+
+	// The root volume grows with the disk of the jobs, rounded up to whole GB
+	storage = PlanInstanceStorage([]*ContainerJob{{Disk: 40 * 1024}, {Disk: 100}}, 0)
+	assert.Equal(t, 41+RootVolumeReservedGB, storage.VolumeSize)
+
+	// Jobs on instance store do not grow the root volume
+	storage = PlanInstanceStorage([]*ContainerJob{{Disk: 100 * 1024, InstanceStore: true}}, 160*1024)
+	assert.Equal(t, MinRootVolumeGB, storage.VolumeSize)
+	assert.True(t, storage.InstanceStore)
+	assert.Equal(t, (MinRootVolumeGB-RootVolumeReservedGB)*1024+160*1024, storage.DiskTotal)
+
+	// Without instance store volumes the disk goes on the root volume
+	storage = PlanInstanceStorage([]*ContainerJob{{Disk: 100 * 1024, InstanceStore: true}}, 0)
+	assert.False(t, storage.InstanceStore)
+	assert.Equal(t, 100+RootVolumeReservedGB, storage.VolumeSize)
+
+	storage = PlanInstanceStorage([]*ContainerJob{{Disk: 2048 * 1024}}, 0)
+	assert.Equal(t, MaxRootVolumeGB, storage.VolumeSize)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Days history is kept in the database when no retention policy was set
+const (
+	DefaultArchiveAfterDays = 90
+	MaxArchiveAfterDays     = 3650
+)
+
+// RetentionPolicy decides when the terminated jobs and deprovisioned instances of a user, or of an organization, are
+// moved from the database to the archive. Personal history follows the policy of its owner and the history of an
+// organization the policy of the organization, whoever owns it.
+type RetentionPolicy struct {
+	gorm.Model
+	UserID           uint `json:"user_id" sql:"unique_index:idx_retention_policy_scope"` // 0 for organizations
+	OrgID            uint `json:"org_id" sql:"unique_index:idx_retention_policy_scope"`  // 0 for users
+	ArchiveAfterDays int  `json:"archive_after_days"`
+}
+
+func DefaultRetentionPolicy(userID, orgID uint) *RetentionPolicy {
+	if orgID != 0 {
+		userID = 0
+	}
+	return &RetentionPolicy{UserID: userID, OrgID: orgID, ArchiveAfterDays: DefaultArchiveAfterDays}
+}
+
+func (policy *RetentionPolicy) Validate() error {
+	if policy.ArchiveAfterDays < 1 || policy.ArchiveAfterDays > MaxArchiveAfterDays {
+		return fmt.Errorf("History must be archived after 1 to %d days", MaxArchiveAfterDays)
+	}
+	return nil
+}
+
+// History that ended before the cutoff is archived, in unix nanoseconds
+func (policy *RetentionPolicy) Cutoff(now time.Time) int64 {
+	return now.Add(-time.Duration(policy.ArchiveAfterDays) * 24 * time.Hour).UnixNano()
+}
+
+// RetentionScope is the history of a user within an organization, or outside of any when OrgID is 0. The history of
+// a scope is archived together.
+type RetentionScope struct {
+	OwnerID uint
+	OrgID   uint
+}
+
+// ArchivedJob is a job as archived along with its status history and build logs
+type ArchivedJob struct {
+	Job       *ContainerJob           `json:"job"`
+	Events    []*ContainerJobTracker  `json:"events"`
+	BuildLogs []*ContainerJobBuildLog `json:"build_logs"`
+}
+
+// ArchivedInstance is an instance as archived along with its status history
+type ArchivedInstance struct {
+	Instance *ResourceInstance `json:"instance"`
+	Events   []*ResourceEvent  `json:"events"`
+}
+
+// ArchiveRecord is a line of an archive, holding either a job or an instance
+type ArchiveRecord struct {
+	Job      *ArchivedJob      `json:"job,omitempty"`
+	Instance *ArchivedInstance `json:"instance,omitempty"`
+}
+
+// ArchiveFile locates the archived history of a scope in the archive storage
+type ArchiveFile struct {
+	gorm.Model
+	Key            string `json:"key" sql:"not null;unique"`
+	OwnerID        uint   `json:"owner_id" sql:"not null;index"`
+	OrgID          uint   `json:"org_id" sql:"not null;index"`
+	Jobs           int    `json:"jobs"`
+	Instances      int    `json:"instances"`
+	ArchivedBefore int64  `json:"archived_before"` // cutoff of the policy, in unix nanoseconds
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Secret is a value a user stores once and jobs reference by name, ex: credentials of a database. The value is
+// encrypted at rest and never returned by the api.
+type Secret struct {
+	gorm.Model
+	OwnerID uint   `json:"-" sql:"not null;unique_index:idx_secret_owner_name"`
+	Name    string `json:"name" sql:"not null;unique_index:idx_secret_owner_name"`
+	Value   string `json:"-" sql:"type:text;not null"`
+}
+
+// Secret files are written to a tmpfs directory of the host, mounted read only into the container at
+// SecretsContainerPath, and removed once the job finishes. The executor runs in the mesos slave container, which
+// mounts SecretsHostPath at the same path, so that the directories it writes are the ones Docker binds.
+const SecretsHostPath = "/dev/shm/liquefy-secrets"
+const SecretsContainerPath = "/run/secrets"
+
+// Replaces secret values in text sent out of the executor
+const RedactedSecret = "[REDACTED]"
+
+var secretNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+var envVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func ValidateSecretName(name string) error {
+	if !secretNameRegexp.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("Invalid secret name %s, names are letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// SecretRef is how a job spec references a secret, which is injected as either an environment variable or a file
+type SecretRef struct {
+	Name   string `json:"name"`
+	EnvVar string `json:"env_var,omitempty"` // environment variable the value is set as
+	File   string `json:"file,omitempty"`    // name of the file in SecretsContainerPath the value is written to
+}
+
+func (ref SecretRef) Validate() error {
+	if err := ValidateSecretName(ref.Name); err != nil {
+		return err
+	}
+	if (ref.EnvVar == "") == (ref.File == "") {
+		return fmt.Errorf("Secret %s must be injected as exactly one of env_var and file", ref.Name)
+	}
+	if ref.EnvVar != "" && !envVarNameRegexp.MatchString(ref.EnvVar) {
+		return fmt.Errorf("Invalid environment variable name %s for secret %s", ref.EnvVar, ref.Name)
+	}
+	if ref.File != "" && ValidateSecretName(ref.File) != nil {
+		return fmt.Errorf("Invalid file name %s for secret %s", ref.File, ref.Name)
+	}
+	return nil
+}
+
+// ResolvedSecret is a referenced secret with its value. Secrets are only resolved into the task sent to the executor.
+type ResolvedSecret struct {
+	SecretRef
+	Value string
+}
+
+// The secrets referenced by a job
+func (js ContainerJob) GetSecretRefs() ([]SecretRef, error) {
+	refs := []SecretRef{}
+	if js.Secrets == "" {
+		return refs, nil
+	}
+	if err := json.Unmarshal([]byte(js.Secrets), &refs); err != nil {
+		return refs, NewErrorf(err, "Failed parsing secrets of job %d", js.ID)
+	}
+	return refs, nil
+}
+
+// Replaces every resolved secret value in text
+func RedactSecrets(text string, secrets []ResolvedSecret) string {
+	for _, secret := range secrets {
+		if secret.Value != "" {
+			text = strings.Replace(text, secret.Value, RedactedSecret, -1)
+		}
+	}
+	return text
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSecretRef(t *testing.T) {
+	assert.Nil(t, SecretRef{Name: "db.password", EnvVar: "DB_PASSWORD"}.Validate())
+	assert.Nil(t, SecretRef{Name: "tls-key", File: "tls.key"}.Validate())
+
+	assert.NotNil(t, SecretRef{Name: "db", EnvVar: "DB", File: "db"}.Validate())
+	assert.NotNil(t, SecretRef{Name: "db"}.Validate())
+	assert.NotNil(t, SecretRef{Name: "../db", EnvVar: "DB"}.Validate())
+	assert.NotNil(t, SecretRef{Name: "db", EnvVar: "1DB"}.Validate())
+	assert.NotNil(t, SecretRef{Name: "db", File: "../../etc/passwd"}.Validate())
+	assert.NotNil(t, SecretRef{Name: "db", File: ".."}.Validate())
+}
+
+func TestGetSecretRefs(t *testing.T) {
+	job := ContainerJob{Secrets: `[{"name":"db","env_var":"DB_PASSWORD"}]`}
+	refs, err := job.GetSecretRefs()
+	assert.Nil(t, err)
+	assert.Equal(t, []SecretRef{{Name: "db", EnvVar: "DB_PASSWORD"}}, refs)
+
+	refs, err = ContainerJob{}.GetSecretRefs()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(refs))
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := []ResolvedSecret{
+		{SecretRef: SecretRef{Name: "db", EnvVar: "DB_PASSWORD"}, Value: "hunter2"},
+		{SecretRef: SecretRef{Name: "empty", File: "empty"}, Value: ""},
+	}
+	assert.Equal(t, "login failed for [REDACTED] and [REDACTED]",
+		RedactSecrets("login failed for hunter2 and hunter2", secrets))
+	assert.Equal(t, "nothing to hide", RedactSecrets("nothing to hide", secrets))
+}
+
+func TestResolvedSecretsAreSerializedWithTheTask(t *testing.T) {
+	job := &ContainerJob{ID: 3, ResolvedSecrets: []ResolvedSecret{
+		{SecretRef: SecretRef{Name: "db", EnvVar: "DB_PASSWORD"}, Value: "hunter2"},
+	}}
+	data, err := SerializeJob(job)
+	assert.Nil(t, err)
+	deserialized, err := DeserializeJob(data)
+	assert.Nil(t, err)
+	assert.Equal(t, job.ResolvedSecrets, deserialized.ResolvedSecrets)
+}
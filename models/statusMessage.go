@@ -8,6 +8,7 @@ import (
 type StatusMessage struct {
 	ContainerJob ContainerJob
 	StatusMessage string
+	BuildLog string
 }
 
 
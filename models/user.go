@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
 type User struct {
 	ID                    uint   `gorm:primary_key json:"id"`
 	ApiKey                string `json:"apiKey"`
@@ -13,4 +19,21 @@ type User struct {
 	GithubOauthToken      string `json:"githubOauthToken"`
 	BitbucketOauthToken   string `json:"bitbucketOauthToken"`
 	BitbucketRefreshToken string `json:"bitbucketRefreshToken"`
+	FailedLogins          int    `json:"-"` // consecutive failed logins since the last successful one or lockout
+	LockedUntil           int64  `json:"-"` // logins are refused until this time in nanoseconds
+	Operator              bool   `json:"-"` // operators of Liquefy are granted the admin scope, set in the database
+}
+
+// Whether logins are refused because of too many failed attempts
+func (user *User) IsLocked(now time.Time) bool {
+	return user.LockedUntil > now.UnixNano()
+}
+
+// PasswordReset is a single use token mailed to a user to set a new password. Only a hash of the token is stored.
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint   `sql:"not null;index"`
+	TokenHash string `sql:"not null;unique_index"`
+	ExpiresAt int64
+	UsedAt    int64
 }
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Statuses of webhook deliveries
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // every attempt failed
+)
+
+// Webhook is a url events are posted to. Webhooks registered by members of an organization also receive the events
+// of the organization. Payloads are signed with the secret of the webhook, which is encrypted at rest and only
+// returned when the webhook is created.
+type Webhook struct {
+	gorm.Model
+	OwnerID    uint   `json:"-" sql:"not null;index"`
+	OrgID      uint   `json:"-" sql:"index"`
+	URL        string `json:"url" sql:"type:text;not null"`
+	EventTypes string `json:"-"` // comma separated, empty for every type
+	Secret     string `json:"-" sql:"type:text;not null"`
+}
+
+func ValidateWebhookURL(rawURL string, requireHTTPS bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("Invalid webhook url %s", rawURL)
+	}
+	if parsed.Scheme != "https" && (requireHTTPS || parsed.Scheme != "http") {
+		return fmt.Errorf("Webhook urls must use https")
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("Webhook urls cannot contain credentials")
+	}
+	return nil
+}
+
+func (hook *Webhook) GetEventTypes() []string {
+	if hook.EventTypes == "" {
+		return []string{}
+	}
+	return strings.Split(hook.EventTypes, ",")
+}
+
+// Whether the event is posted to the webhook
+func (hook *Webhook) Accepts(event *Event) bool {
+	if !event.VisibleTo(hook.OwnerID, hook.OrgID) {
+		return false
+	}
+	types := hook.GetEventTypes()
+	if len(types) == 0 {
+		return true
+	}
+	for _, eventType := range types {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Signs a payload as the value of the X-Liquefy-Signature header: t=<unix time>,v1=<hex hmac>. Receivers recompute
+// the hmac-sha256 of "<unix time>.<payload>" with the secret and reject old timestamps to prevent replays.
+func SignWebhookPayload(secret []byte, timestamp time.Time, payload []byte) string {
+	unix := timestamp.Unix()
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", unix)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// WebhookDelivery records the delivery of an event to a webhook and its attempts. There is a single delivery of an
+// event to a webhook, even when several api servers receive the event. Pending deliveries keep the payload and when
+// to attempt them next, so that any api server can retry them, including after a restart.
+type WebhookDelivery struct {
+	ID            uint      `gorm:"primary_key" json:"id"`
+	WebhookID     uint      `json:"webhook_id" sql:"not null;unique_index:idx_delivery_webhook_event"`
+	EventID       string    `json:"event_id" sql:"not null;unique_index:idx_delivery_webhook_event"`
+	EventType     string    `json:"event_type"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	ResponseCode  int       `json:"response_code,omitempty"` // of the last attempt
+	Error         string    `json:"error,omitempty" sql:"type:text"`
+	Payload       string    `json:"-" sql:"type:text"`         // cleared once the delivery is no longer pending
+	NextAttemptAt int64     `json:"next_attempt_at,omitempty"` // unix nanoseconds, while pending
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -11,7 +11,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 
 	"bargain/liquefy/db"
+	"bargain/liquefy/events"
+	"bargain/liquefy/logging"
+	"bargain/liquefy/metrics"
 	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
 	aws "bargain/liquefy/cloudprovider"
 	"strconv"
 )
@@ -27,43 +31,73 @@ type ResourceManager interface {
 	SetupMesos(resource *lq.ResourceInstance, masterIp string) error
 	DeprovisionResource(resource *lq.ResourceInstance) error
 	CheckHealth(resourceId uint) error
-	ReconcileResources(userId uint, knownResources []*lq.ResourceInstance) ([]*lq.ResourceInstance, error)
+	ReconcileResources(awsAccount *lq.AwsAccount, knownResources []*lq.ResourceInstance) ([]*lq.ResourceInstance, error)
 }
 
-type awsManager struct {}
+type awsManager struct {
+	store db.Store
+}
 
-func NewAwsManager() (ResourceManager) {
-	return awsManager{}
+func NewAwsManager(store db.Store) (ResourceManager) {
+	return awsManager{store: store}
 }
 
-func (manager awsManager) getAwsAccount(userId uint) (*lq.AwsAccount, error) {
-	user, err := db.Users().Get(userId)
+func (manager awsManager) getAwsAccount(resource *lq.ResourceInstance) (*lq.AwsAccount, error) {
+	awsAccount, err := manager.store.AwsAccounts().GetForOwner(resource.OwnerId, resource.OrgID)
 	if err != nil {
-		log.Errorf("Failed getting user %d when fetching aws account", userId)
-		return &lq.AwsAccount{}, err
+		log.Errorf("Failed getting aws account of resource %d", resource.ID)
 	}
-	return db.AwsAccounts().Get(user.AwsAccountID)
+	return awsAccount, err
 }
 
-func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) error {
-	awsAccount, err := manager.getAwsAccount(resource.OwnerId)
+func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) (err error) {
+	// Bidding then booting are traced, the span of the phase provisioning failed in records the error
+	phase := tracing.StartSpan("aws.bidding", tracing.ContextOf(resource.TraceParent))
+	phase.SetAttribute("resource.id", resource.ID)
+	defer func() { phase.Finish(err) }()
+
+	awsAccount, err := manager.getAwsAccount(resource)
 	if err != nil {
 		return lq.NewError("Failed to provision resource ", err)
 	}
 
 	az := resource.AwsAvailabilityZone
 	region := aws.Region(lq.AZtoRegion(az))
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 
-	if err = db.Resources().SetStatus(resource.ID, lq.ResourceSpotBidding, ""); err != nil {
+	if err = setResourceStatus(manager.store, resource, lq.ResourceSpotBidding, ""); err != nil {
 		return err
 	}
 
-	log.Infof("Provisioning resource %d via AWS API", resource.ID)
+	// Size the storage of the instance for the jobs assigned to it
+	jobs, err := manager.store.Jobs().GetAssignedJobsByInstances([]uint{resource.ID})
+	if err != nil {
+		return lq.NewErrorf(err, "Failed fetching jobs assigned to resource %d", resource.ID)
+	}
+	catalog := aws.Catalog()
+	instanceInfo, ok := catalog.Instances[aws.InstanceType(resource.AwsInstanceType)]
+	if !ok {
+		return fmt.Errorf("Instance type %s of resource %d is not in the instance catalog", resource.AwsInstanceType,
+			resource.ID)
+	}
+	imageId, err := catalog.ImageId(region, aws.InstanceType(resource.AwsInstanceType))
+	if err != nil {
+		return lq.NewErrorf(err, "Failed to provision resource %d", resource.ID)
+	}
+	storage := lq.PlanInstanceStorage(jobs, int(instanceInfo.Disk))
+	if err = manager.store.Resources().SetStorage(resource.ID, storage); err != nil {
+		return lq.NewErrorf(err, "Failed setting storage of resource %d", resource.ID)
+	}
+	resource.DiskTotal = storage.DiskTotal
+	resource.AwsVolumeSize = storage.VolumeSize
+	resource.AwsInstanceStore = storage.InstanceStore
+
+	logging.ForResource(resource).Infof("Provisioning resource %d via AWS API", resource.ID)
+	biddingStart := time.Now()
 	spotReq, err := awsCloud.CreateSpotInstanceRequest(region, az,
-		manager.getImageId(region.String(), resource.AwsInstanceType),
+		imageId,
 		awsAccount.GetSubnetId(az), awsAccount.GetSecurityGroupId(region.String()),
-		resource.AwsInstanceType, resource.AwsSpotPrice, resource.ID)
+		resource.AwsInstanceType, resource.AwsSpotPrice, resource.ID, storage)
 	if err != nil {
 		return lq.NewError("Creating spot instance request failed ", err)
 	}
@@ -75,13 +109,19 @@ func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) error
 	if err != nil {
 		return lq.NewErrorf(err, "Spot request failed")
 	}
+	metrics.ProvisioningPhase.With("bidding").ObserveSince(biddingStart)
+	phase.SetAttribute("spot_request.id", *spotReq.SpotInstanceRequestId)
+	phase.Finish(nil)
+	phase = tracing.StartSpan("aws.booting", tracing.ContextOf(resource.TraceParent))
+	phase.SetAttribute("resource.id", resource.ID)
+	bootingStart := time.Now()
 
 	log.Debugf("Tagging resource %d", resource.ID)
 	if err = awsCloud.TagInstance(region, *spotReq.InstanceId, AwsTag); err != nil {
 		return lq.NewError(fmt.Sprintf("Failed tagging resource %d ", resource.ID), err)
 	}
 
-	if err = db.Resources().SetStatus(resource.ID, lq.ResourceSpotBidAccepted, ""); err != nil {
+	if err = setResourceStatus(manager.store, resource, lq.ResourceSpotBidAccepted, ""); err != nil {
 		return err
 	}
 
@@ -92,12 +132,12 @@ func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) error
 
 	//At this point have an instance with its info
 	resource.LaunchTime = instance.LaunchTime.UnixNano()
-	if err = db.Resources().SetLaunchTime(resource.ID, resource.LaunchTime); err != nil {
+	if err = manager.store.Resources().SetLaunchTime(resource.ID, resource.LaunchTime); err != nil {
 		return lq.NewError(fmt.Sprintf("Provisioner : Failed setting launch time for resource %d", resource.ID), err)
 	}
 
 	resource.AwsInstanceId = *instance.InstanceId
-	err = db.Resources().SetInstanceId(resource.ID, resource.AwsInstanceId)
+	err = manager.store.Resources().SetInstanceId(resource.ID, resource.AwsInstanceId)
 	if err != nil {
 		return lq.NewError(fmt.Sprintf("Provisioner : Failed setting aws instance ID for %d", resource.ID), err)
 	}
@@ -114,10 +154,11 @@ func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) error
 	}
 
 	resource.IP = *instance.PublicIpAddress
-	if err = db.Resources().SetIP(resource.ID, resource.IP); err != nil {
+	if err = manager.store.Resources().SetIP(resource.ID, resource.IP); err != nil {
 		return lq.NewError(fmt.Sprintf("Provisioner : Failed setting public ip for resource: %d", resource.ID), err)
 	}
 
+	metrics.ProvisioningPhase.With("booting").ObserveSince(bootingStart)
 	log.Debugf("Successfully provisioned instance:\n%v", instance)
 	return nil
 }
@@ -125,7 +166,7 @@ func (manager awsManager) ProvisionResource(resource *lq.ResourceInstance) error
 func (manager awsManager) SetupMesos(resource *lq.ResourceInstance, masterIp string) error {
 	log.Infof("Setting up mesos on resource %d", resource.ID)
 	// Get SSH private key to use
-	awsAccount, err := manager.getAwsAccount(resource.OwnerId)
+	awsAccount, err := manager.getAwsAccount(resource)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed to setup mesos on resource %d", resource.ID)
 	}
@@ -234,9 +275,18 @@ func (manager awsManager) SetupMesos(resource *lq.ResourceInstance, masterIp str
 	}
 	log.Debugf("Set hostname to %s", hostname)
 
+	if resource.AwsInstanceStore {
+		log.Debugf("Mounting instance store volumes of resource %d", resource.ID)
+		if output, err = runCommandOverSsh(mountInstanceStoreCommand()); err != nil {
+			return lq.NewErrorf(err, "Failed mounting instance store volumes of resource %d", resource.ID)
+		}
+		log.Debugf("Output from mounting instance store volumes:\n%s", output)
+	}
+
 	// Setup command that will create mesos-slave container
-	mesosAttributes := fmt.Sprintf("liquefyid:%d", resource.ID)
-	mesosResources := fmt.Sprintf("cpus:%f;mem:%d", resource.CpuTotal, resource.RamTotal)
+	mesosAttributes := fmt.Sprintf("liquefyid:%d;instancestore:%t", resource.ID, resource.AwsInstanceStore)
+	mesosResources := fmt.Sprintf("cpus:%f;mem:%d;disk:%d;%s", resource.CpuTotal, resource.RamTotal,
+		resource.DiskTotal, lq.AgentPortsResource())
 	cmdStartMesosSlave := []string {
 		"docker run -d",
 		"--name=mesos-slave",
@@ -257,16 +307,12 @@ func (manager awsManager) SetupMesos(resource *lq.ResourceInstance, masterIp str
 		"-e MESOS_EXECUTOR_REGISTRATION_TIMEOUT=5mins",
 		"-e MESOS_ATTRIBUTES=\"" + mesosAttributes + "\"", // note the use of escaped quotes
 		"-e MESOS_RESOURCES=\"" + mesosResources + "\"", // note the use escaped quotes
-		"-v /lib/libpthread.so.0:/lib/libpthread.so.0:ro",
-		"-v /lib/x86_64-linux-gnu:/lib/x86_64-linux-gnu:ro",
-		"-v /lib/usr/x86_64-linux-gnu:/lib/usr/x86_64-linux-gnu:ro",
-		"-v /usr/bin/docker:/usr/bin/docker:ro",
-		"-v /var/run/docker.sock:/var/run/docker.sock:ro",
-		"-v /sys:/sys:ro",
-		"-v /var/lib/mesos:/var/lib/mesos",
+	}
+	cmdStartMesosSlave = append(cmdStartMesosSlave, mesosSlaveVolumes...)
+	cmdStartMesosSlave = append(cmdStartMesosSlave,
 		"-p 5051:5051",
 		"mesosphere/mesos-slave:0.25.0-0.2.70.ubuntu1404",
-	}
+	)
 
 	// Setup command that will create liquefy/logger container
 	cmdStartLogger := []string{
@@ -307,7 +353,7 @@ func (manager awsManager) DeprovisionResource(resource *lq.ResourceInstance) err
 	log.Debugf("Deprovisioning resource %v", resource)
 
 	// Try to verify that status of instance is shutting down or terminated
-	awsAccount, err := manager.getAwsAccount(resource.OwnerId)
+	awsAccount, err := manager.getAwsAccount(resource)
 	if err != nil {
 		return lq.NewError("Failed to Deprovision resource, cannot get aws creds ", err)
 	}
@@ -318,7 +364,7 @@ func (manager awsManager) DeprovisionResource(resource *lq.ResourceInstance) err
 	}
 
 	// Otherwise, terminate the instance and cancel the spot request
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 	var instance *ec2.Instance
 	region := aws.Region(lq.AZtoRegion(resource.AwsAvailabilityZone))
 
@@ -351,14 +397,14 @@ func (manager awsManager) DeprovisionResource(resource *lq.ResourceInstance) err
 }
 
 func (manager awsManager) CheckHealth(resourceId uint) error {
-	resource, err := db.Resources().Get(resourceId)
+	resource, err := manager.store.Resources().Get(resourceId)
 	if err != nil {
 		// log this error, but do not consider unhealthy because this is an internal error
 		log.Error(err)
 		return nil
 	}
 
-	awsAccount, err := manager.getAwsAccount(resource.OwnerId)
+	awsAccount, err := manager.getAwsAccount(resource)
 	if err != nil {
 		// log this error, but do not consider unhealthy because this is an internal error
 		log.Error(err)
@@ -366,7 +412,7 @@ func (manager awsManager) CheckHealth(resourceId uint) error {
 	}
 
 	region := aws.Region(lq.AZtoRegion(resource.AwsAvailabilityZone))
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 
 	// Check if instance is running
 	instance, err := awsCloud.GetInstance(region, resource.AwsInstanceId)
@@ -406,21 +452,23 @@ func (manager awsManager) CheckHealth(resourceId uint) error {
 		err := lq.NewErrorf(nil, "Aws Instance %s for resource %d is marked for termination",
 			resource.AwsInstanceId, resource.ID)
 		log.Error(err)
+		events.Publish(lq.EventSpotInterruption, resource.OwnerId, resource.OrgID, resource.ID,
+			map[string]interface{}{
+				"aws_instance_id": resource.AwsInstanceId,
+				"instance_type":   resource.AwsInstanceType,
+				"zone":            resource.AwsAvailabilityZone,
+			})
 		return err
 	}
 
 	return nil
 }
 
-func (manager awsManager) ReconcileResources(userId uint, knownResources []*lq.ResourceInstance) ([]*lq.ResourceInstance, error) {
-	//All known resources must have same user id
+func (manager awsManager) ReconcileResources(awsAccount *lq.AwsAccount, knownResources []*lq.ResourceInstance) ([]*lq.ResourceInstance, error) {
+	//All known resources must run on the aws account
 	badResources := []*lq.ResourceInstance{}
-	awsAccount, err := manager.getAwsAccount(userId)
-	if err != nil {
-		return badResources, err
-	}
 
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 
 	// TODO : This much also catch instances that we started and failed to TAG !
 	// Reconcile across each supported region
@@ -460,9 +508,12 @@ func (manager awsManager) ReconcileResources(userId uint, knownResources []*lq.R
 			// Only delete if it is older than the delay
 			if time.Since(*instance.LaunchTime) > DelayTillReconcillitation {
 				log.Debugf("Terminate unknown AWS instance %s", id)
+				outcome := lq.AuditSuccess
 				if err := awsCloud.TerminateInstance(region, id); err != nil {
 					log.Error(err)
+					outcome = lq.AuditFailure
 				}
+				manager.auditUnknownInstance(awsAccount, region.String(), id, outcome)
 			} else {
 				log.Debugf("Instance %s is unknown, but is younger than %s. Keeping", id, DelayTillReconcillitation)
 			}
@@ -474,93 +525,54 @@ func (manager awsManager) ReconcileResources(userId uint, knownResources []*lq.R
 
 /* Helpers */
 
-//TODO : If needed it should be moved to aws.go / read this from a tbh a .ini file in aws.go
-func (manager awsManager) getImageId(region string, instanceType string) string {
-	supportsHvm := true
-	supportsEbsBacked := true
-
-	// From Amazon Docs
-	// http://docs.aws.amazon.com/AWSEC2/latest/UserGuide/virtualization_types.html
-	// "All current generation instance types support HVM AMIs.
-	// The CC2, CR1, HI1, and HS1 previous generation instance types support HVM AMIs."
-	if strings.HasPrefix(instanceType, "t1") ||
-		strings.HasPrefix(instanceType, "m2") ||
-		strings.HasPrefix(instanceType, "m1") ||
-		strings.HasPrefix(instanceType, "c1") {
-		supportsHvm = false
-	}
-
-	if strings.HasPrefix(instanceType, "t2") {
-		supportsEbsBacked = false
-	}
-
-	// Filling in the remaining regions involves checking out:
-	// https://cloud-images.ubuntu.com/releases/14.04/release-20150305/
-	if !supportsHvm {
-		switch region {
-		case "us-east-1":
-			return "ami-988ad1f0"
-		case "us-west-1":
-			return "ami-397d997d"
-		case "us-west-2":
-			return "ami-cb1536fb"
-
-		default:
-			log.Errorf("Region %s not supported with instance type %s", region, instanceType)
-		}
+// Records the termination of an instance Liquefy does not know, for the owner of the account it ran on
+func (manager awsManager) auditUnknownInstance(awsAccount *lq.AwsAccount, region string, instanceId string, outcome string) {
+	ownerId, orgId, err := manager.store.AwsAccounts().GetOwner(uint(awsAccount.GetID()))
+	if err != nil {
+		log.Error(err)
 	}
+	manager.store.AuditLog().Append(&lq.AuditEntry{
+		ActorType:  lq.AuditActorSystem,
+		ActorName:  "provisioner",
+		UserID:     ownerId,
+		OrgID:      orgId,
+		Action:     lq.AuditInstanceUnknown,
+		TargetType: "aws_instance",
+		TargetID:   instanceId,
+		Outcome:    outcome,
+		Detail:     fmt.Sprintf("Terminated unknown instance in %s", region),
+	})
+}
 
-	if supportsEbsBacked {
-		// These amis were created by us
-		switch region {
-		case "us-east-1":
-			return "ami-07f4c96d"
-		case "us-west-1":
-			return "ami-ea76068a"
-		case "us-west-2":
-			return "ami-2fbd504f"
-
-		default:
-			log.Errorf("Region %s not supported with instance type %s", region, instanceType)
-		}
-	} else {
-		switch region {
-		case "ap-northeast-1":
-			return "ami-93876e93"
-
-		case "ap-southeast-1":
-			return "ami-66546234"
-
-		case "eu-central-1":
-			return "ami-e2a694ff"
-
-		case "eu-west-1":
-			return "ami-d7fd6ea0"
-
-		case "sa-east-1":
-			return "ami-a357eebe"
-
-		case "us-east-1":
-			return "ami-6089d208"
-
-		case "us-west-1":
-			return "ami-cf7d998b"
-
-		case "cn-north-1":
-			return "ami-d436a4ed"
-
-		case "us-gov-west-1":
-			return "ami-01523322"
-
-		case "ap-southeast-2":
-			return "ami-cd4e3ff7"
-
-		case "us-west-2":
-			return "ami-3b14370b"
+// Volumes of the mesos-slave container. The executor runs inside it and asks the Docker daemon of the host to bind
+// the secret files it writes into job containers, so the secrets directory is shared at the same path on both sides.
+var mesosSlaveVolumes = []string{
+	"-v /lib/libpthread.so.0:/lib/libpthread.so.0:ro",
+	"-v /lib/x86_64-linux-gnu:/lib/x86_64-linux-gnu:ro",
+	"-v /lib/usr/x86_64-linux-gnu:/lib/usr/x86_64-linux-gnu:ro",
+	"-v /usr/bin/docker:/usr/bin/docker:ro",
+	"-v /var/run/docker.sock:/var/run/docker.sock:ro",
+	"-v /sys:/sys:ro",
+	"-v /var/lib/mesos:/var/lib/mesos",
+	"-v " + lq.SecretsHostPath + ":" + lq.SecretsHostPath,
+}
 
-		default:
-			log.Errorf("Region %s not supported with instance type %s", region, instanceType)
-		}
-	}
-	return ""
+// Mounts the instance store volumes at lq.InstanceStoreMountPath, striping them together when there are several.
+// The instance store volume cloud-init mounts at /mnt is unmounted first, and every disk other than the one holding
+// the root volume is considered an instance store volume.
+func mountInstanceStoreCommand() string {
+	return strings.Join([]string{
+		"set -e",
+		"sudo umount /mnt 2>/dev/null || true",
+		"ROOT_DISK=/dev/$(lsblk -no PKNAME $(findmnt -no SOURCE /))",
+		"DEVICES=$(lsblk -dpno NAME,TYPE | awk '$2 == \"disk\" {print $1}' | grep -vx $ROOT_DISK || true)",
+		"COUNT=$(echo $DEVICES | wc -w)",
+		"if [ $COUNT -eq 0 ]; then echo 'No instance store volumes'; exit 0; fi",
+		"if [ $COUNT -gt 1 ]; then " +
+			"sudo mdadm --create /dev/md0 --run --level=0 --raid-devices=$COUNT $DEVICES; DEVICE=/dev/md0; " +
+			"else DEVICE=$DEVICES; fi",
+		"sudo mkfs.ext4 -F -q $DEVICE",
+		"sudo mkdir -p " + lq.InstanceStoreMountPath,
+		"sudo mount $DEVICE " + lq.InstanceStoreMountPath,
+	}, "\n")
 }
@@ -2,12 +2,14 @@ package provisioner
 
 import(
 	"fmt"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
 
 	lq "bargain/liquefy/models"
 	"bargain/liquefy/db"
+	"bargain/liquefy/events"
 )
 func TestAwsSetup(t *testing.T) {
 	Convey("Setting up user", t, func() {
@@ -52,4 +54,45 @@ func TestSetupOfMesos(t *testing.T) {
 			fmt.Println(err)
 		}
 	})
-}
\ No newline at end of file
+}
+func TestMesosSlaveSharesSecretsWithHost(t *testing.T) {
+	Convey("The secrets directory is mounted at the same path in the mesos slave", t, func() {
+		shared := false
+		for _, volume := range mesosSlaveVolumes {
+			parts := strings.Split(strings.TrimPrefix(volume, "-v "), ":")
+			if parts[0] == lq.SecretsHostPath {
+				So(parts[1], ShouldEqual, lq.SecretsHostPath)
+				shared = true
+			}
+		}
+		So(shared, ShouldBeTrue)
+	})
+}
+
+func TestSetResourceStatusNotifiesOwner(t *testing.T) {
+	Convey("Setting the status of a resource notifies its owner after the change", t, func() {
+		events.SetBus(events.NewMemoryBus())
+		defer events.SetBus(nil)
+		published, unsubscribe := events.GetBus().Subscribe()
+		defer unsubscribe()
+
+		store := db.NewMemoryStore()
+		job := &lq.ContainerJob{Name: "job", OwnerID: 1, OrgID: 2}
+		So(store.Jobs().Create(job), ShouldBeNil)
+		resource := &lq.ResourceInstance{OwnerId: 1, OrgID: 2, RamTotal: 1024, CpuTotal: 1}
+		So(store.Assignments().AssignJob(job.ID, resource, true), ShouldBeNil)
+
+		So(setResourceStatus(store, resource, lq.ResourceProvisioning, ""), ShouldBeNil)
+		So(resource.Status, ShouldEqual, lq.ResourceProvisioning)
+		event := <-published
+		So(event.Type, ShouldEqual, lq.EventInstanceStatus)
+		So(event.OrgID, ShouldEqual, uint(2))
+		So(event.Data["status"], ShouldEqual, lq.ResourceProvisioning)
+		So(event.Data["previous_status"], ShouldEqual, lq.ResourceStatusNew)
+
+		// Invalid transitions change and notify nothing
+		So(setResourceStatus(store, resource, lq.ResourceStatusNew, ""), ShouldNotBeNil)
+		So(resource.Status, ShouldEqual, lq.ResourceProvisioning)
+		So(len(published), ShouldEqual, 0)
+	})
+}
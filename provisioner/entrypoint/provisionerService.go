@@ -2,13 +2,18 @@ package main
 
 import (
     "flag"
+    "os"
 
     log "github.com/Sirupsen/logrus"
 
+    lqCloud "bargain/liquefy/cloudprovider"
     "bargain/liquefy/common"
     "bargain/liquefy/db"
     . "bargain/liquefy/provisioner"
     "bargain/liquefy/logging"
+    "bargain/liquefy/tracing"
+    "bargain/liquefy/metrics"
+    "bargain/liquefy/retention"
 )
 
 func main() {
@@ -17,6 +22,11 @@ func main() {
     mesosMasterIp := flag.String("mesosMasterIp", "", "the ip of the mesos master server")
     dbIp := flag.String("dbIp", "", "the ip of the db server")
     esIp := flag.String("esIp", "", "the ip of the es server for logs")
+    logSinks := flag.String("logSinks", "stdout",
+        "where logs are shipped, comma separated: stdout, file:///path or http://host:port of elasticsearch")
+    metricsAddr := flag.String("metricsAddr", ":9103", "address to serve /metrics on, empty to disable it")
+    traceExporter := flag.String("traceExporter", os.Getenv(tracing.TraceExporterEnv),
+        "where spans are exported: none, stdout or file:///path")
 
     flag.Parse()
 
@@ -33,16 +43,35 @@ func main() {
         if *esIp == "" {
             panic("Production and staging deployments require the esIp flag")
         }
-        log.AddHook(logging.NewElasticHook(*esIp, "9200", "liquefy-", "Provisioner", ""))
     }
+    sinkSpec := *logSinks
+    if *esIp != "" {
+        sinkSpec += ",http://" + *esIp + ":9200"
+    }
+    sinks, err := logging.ParseSinks(sinkSpec, "liquefy-", "provisioner")
+    if err != nil {
+        panic(err)
+    }
+    logging.Setup("provisioner", nil, sinks...)
 
-    err := db.Connect(*dbIp)
+    exporter, err := tracing.NewExporter(*traceExporter)
     if err != nil {
         panic(err)
     }
+    tracing.SetExporter(exporter)
+
+    err = db.Connect(*dbIp)
+    if err != nil {
+        panic(err)
+    }
+
+    lqCloud.StartCatalogRefresh()
+    metrics.Serve(*metricsAddr)
 
     log.Info("Connected to Database , Starting Provisioner")
-    provisioner := NewProvisioner(*mesosMasterIp)
+    store := db.NewPostgresStore()
+    retention.StartArchiver(store, retention.ArchiveInterval)
+    provisioner := NewProvisioner(store, *mesosMasterIp)
     err = provisioner.Run()
     if err != nil {
         log.Error("Provisioner failed")
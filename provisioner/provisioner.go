@@ -2,13 +2,18 @@ package provisioner
 
 import (
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	"bargain/liquefy/db"
+	"bargain/liquefy/events"
+	"bargain/liquefy/logging"
+	"bargain/liquefy/metrics"
 	lq "bargain/liquefy/models"
+	"bargain/liquefy/tracing"
 	
 )
 
@@ -26,6 +31,7 @@ type Provisioner interface {
 }
 
 type provisioner struct {
+	store               db.Store
 	mesosMasterIp       string
 	resourceManager     ResourceManager
 	deprovisioningChan  chan *DeprovisionEvent
@@ -37,11 +43,12 @@ type DeprovisionEvent struct {
 	msg         string
 }
 
-func NewProvisioner(mesosMasterIp string) Provisioner {
+func NewProvisioner(store db.Store, mesosMasterIp string) Provisioner {
 	// Create provisioner
 	prov := &provisioner {
+		store:              store,
 		mesosMasterIp:      mesosMasterIp,
-		resourceManager:    NewAwsManager(),
+		resourceManager:    NewAwsManager(store),
 		deprovisioningChan: make(chan *DeprovisionEvent, 10 * 1024),
 		healthCheckers:     make(map[uint]chan struct{}),
 	}
@@ -73,7 +80,7 @@ func (prov *provisioner) Run() error {
 	var provisionerThreadImpl = func() {
 		ticker := time.NewTicker(time.Duration(5) * time.Second)
 		for _ = range ticker.C {
-			newResources, err := db.Resources().GetNewResources()
+			newResources, err := prov.store.Resources().GetNewResources()
 			if err != nil {
 				log.Error(lq.NewErrorf(err, "Failed getting new resources in provisioner"))
 				continue
@@ -81,7 +88,7 @@ func (prov *provisioner) Run() error {
 
 			for _, newResource := range newResources {
 				log.Debugf("Provisioning new resource %d", newResource.ID)
-				if err := db.Resources().SetStatus(newResource.ID, lq.ResourceProvisioning, ""); err != nil {
+				if err := setResourceStatus(prov.store, newResource, lq.ResourceProvisioning, ""); err != nil {
 					log.Error(lq.NewErrorf(err, "Failed provisioning resource %d", newResource.ID))
 					continue
 				}
@@ -112,7 +119,7 @@ func (prov *provisioner) Run() error {
 	var deprovisionerThreadImpl = func() {
 		for event := range prov.deprovisioningChan {
 			log.Debugf("Deprovisioning resource %d because\n%s", event.resourceId, event.msg)
-			resource, err := db.Resources().Get(event.resourceId)
+			resource, err := prov.store.Resources().Get(event.resourceId)
 			if err != nil {
 				log.Errorf("Failed fetching resource %d during deprovisioning", event.resourceId)
 				continue
@@ -125,10 +132,21 @@ func (prov *provisioner) Run() error {
 			}
 
 			// Set status to prevent races with other attempts to deprovision this resource
-			if err := db.Resources().SetStatus(resource.ID, lq.ResourceStatusDeprovisioning, event.msg); err != nil {
+			if err := setResourceStatus(prov.store, resource, lq.ResourceStatusDeprovisioning, event.msg); err != nil {
 				log.Error(lq.NewErrorf(err, "Failed deprovisioning resource %d", resource.ID))
 				continue
 			}
+			prov.store.AuditLog().Append(&lq.AuditEntry{
+				ActorType:  lq.AuditActorSystem,
+				ActorName:  "provisioner",
+				UserID:     resource.OwnerId,
+				OrgID:      resource.OrgID,
+				Action:     lq.AuditInstanceDeprovision,
+				TargetType: "instance",
+				TargetID:   strconv.FormatUint(uint64(resource.ID), 10),
+				Outcome:    lq.AuditSuccess,
+				Detail:     event.msg,
+			})
 
 			// Deprovision asynchronously
 			// This is the only way that Provisioner::deprovision can be called!!!!
@@ -168,24 +186,39 @@ func (prov *provisioner) Run() error {
  * 3. Persist resource in db
  * 4. Setup mesos on resource
  */
-func (prov *provisioner) provisionImpl(resource *lq.ResourceInstance) error {
+func (prov *provisioner) provisionImpl(resource *lq.ResourceInstance) (err error) {
+	span := tracing.StartSpan("provisioner.provision", tracing.ContextOf(resource.TraceParent))
+	span.SetAttribute("resource.id", resource.ID)
+	span.SetAttribute("instance_type", resource.AwsInstanceType)
+	span.SetAttribute("availability_zone", resource.AwsAvailabilityZone)
+	defer func() { span.Finish(err) }()
 
+	// The phases of the resource manager are traced under this span
+	resource.TraceParent = span.Context().String()
+
+	start := time.Now()
 	if err := prov.resourceManager.ProvisionResource(resource); err != nil {
 		return err
 	}
 
-	if err := db.Resources().SetStatus(resource.ID, lq.ResourceStatusProvisioned, ""); err != nil {
+	if err := setResourceStatus(prov.store, resource, lq.ResourceStatusProvisioned, ""); err != nil {
 		return err
 	}
 
-	log.Infof("Initialize mesos on resource %d", resource.ID)
-	if err := prov.resourceManager.SetupMesos(resource, prov.mesosMasterIp); err != nil {
+	logging.ForResource(resource).Infof("Initialize mesos on resource %d", resource.ID)
+	mesosSpan := tracing.StartSpan("provisioner.mesos_setup", span.Context())
+	mesosStart := time.Now()
+	err = prov.resourceManager.SetupMesos(resource, prov.mesosMasterIp)
+	mesosSpan.Finish(err)
+	if err != nil {
 		return lq.NewErrorf(err, "Failed setuping up mesos on resource %d", resource.ID)
 	}
+	metrics.ProvisioningPhase.With("mesos_setup").ObserveSince(mesosStart)
 
-	if err := db.Resources().SetStatus(resource.ID, lq.ResourceStatusRunning, ""); err != nil {
+	if err := setResourceStatus(prov.store, resource, lq.ResourceStatusRunning, ""); err != nil {
 		return err
 	}
+	metrics.ProvisioningPhase.With("total").ObserveSince(start)
 
 	return nil
 }
@@ -195,25 +228,50 @@ func (prov *provisioner) deprovision(resourceId uint) {
 	// It is fine if the same resource gets deprovisioned many times, just not at once
 	log.Infof("Deprovisioning resource %d", resourceId)
 
-	resource, err := db.Resources().Get(resourceId)
+	resource, err := prov.store.Resources().Get(resourceId)
 	if err != nil {
 		log.Errorf("Failed to deprovision resource %d because of failure to query from db", resourceId)
 	}
 
 	prov.resourceManager.DeprovisionResource(resource)
 
-	if err = db.Resources().SetStatus(resource.ID, lq.ResourceStatusDeprovisioned, ""); err != nil {
+	if err = setResourceStatus(prov.store, resource, lq.ResourceStatusDeprovisioned, ""); err != nil {
 		log.Error(err)
 	}
 }
 
+// Sets the status of a resource and notifies its owner once the change is committed. The resource is updated to the
+// new status, so that the next change notifies the right previous status.
+func setResourceStatus(store db.Store, resource *lq.ResourceInstance, status, msg string) error {
+	if err := store.Resources().SetStatus(resource.ID, status, msg); err != nil {
+		return err
+	}
+
+	events.Publish(lq.EventInstanceStatus, resource.OwnerId, resource.OrgID, resource.ID,
+		map[string]interface{}{
+			"status":          status,
+			"previous_status": resource.Status,
+			"message":         msg,
+			"instance_type":   resource.AwsInstanceType,
+			"zone":            resource.AwsAvailabilityZone,
+		})
+	resource.Status = status
+	return nil
+}
+
 func (prov *provisioner) startResourceChecker() {
 	clock := time.NewTicker(HealthCheckInterval)
 	for range clock.C {
 		//Perform Check for all resources
-		if activeResources,err := db.Resources().GetAllProvisionedOrRunningResources(); err != nil {
+		if activeResources,err := prov.store.Resources().GetAllProvisionedOrRunningResources(); err != nil {
 			log.Error("Unable To Run Health Checker : " + err.Error())
 		} else {
+			spendRate := 0.0
+			for _, resource := range activeResources {
+				spendRate += resource.AwsSpotPrice
+			}
+			metrics.SpendRate.Set(spendRate)
+
 			for _,resource := range activeResources{
 				if err := prov.resourceManager.CheckHealth(resource.ID); err != nil {
 					err = lq.NewErrorf(err, "Health check failed")
@@ -225,7 +283,7 @@ func (prov *provisioner) startResourceChecker() {
 
 				if resource.Status == lq.ResourceStatusRunning {
 					// Check if resource has running jobs and if not, kill it
-					if jobs, err := db.Jobs().GetActiveJobsOnResource(resource.ID); err != nil {
+					if jobs, err := prov.store.Jobs().GetActiveJobsOnResource(resource.ID); err != nil {
 						log.Error(lq.NewErrorf(err, "Failed getting active jobs on resource %d", resource.ID))
 					} else if len(jobs) == 0 {
 						prov.deprovisioningChan <- &DeprovisionEvent{
@@ -242,33 +300,10 @@ func (prov *provisioner) startResourceChecker() {
 func (prov *provisioner) startResourceReconcilliation() {
 	clock := time.NewTicker(ReconcilliationInterval)
 	for range clock.C {
-		// Get all known resources in the database
-		if users, err := db.Users().GetAll(); err != nil {
-			log.Error(lq.NewErrorf(err, "Failed getting all users for resource reconcilliation"))
-		} else {
-			for _, user := range users {
-				knownResources, err := db.Resources().GetUsersProvisionedResources(user.ID)
-				if err != nil {
-					continue
-				}
-
-				badResources, err := prov.resourceManager.ReconcileResources(user.ID, knownResources)
-				if err != nil {
-					log.Error(err)
-				}
-
-				for _, resource := range badResources {
-					prov.deprovisioningChan <- &DeprovisionEvent{
-						resourceId: resource.ID,
-						msg: fmt.Sprintf("Resource %d failed resource reconcilliation. The AWS instance cannot be found",
-							resource.ID),
-					}
-				}
-			}
-		}
+		prov.reconcileResources()
 
 		// Get all resources marked for termination by the user
-		if userTerminatedResources, err := db.Resources().GetRunningUserTerminatedResources(); err != nil {
+		if userTerminatedResources, err := prov.store.Resources().GetRunningUserTerminatedResources(); err != nil {
 			log.Error(lq.NewErrorf(err, "Failed getting user terminated resources"))
 		} else {
 			for _, resource := range userTerminatedResources {
@@ -279,4 +314,48 @@ func (prov *provisioner) startResourceReconcilliation() {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// Reconciles the known resources with the instances of every aws account. Members of an organization share its
+// account, so the resources of an account are reconciled together whoever owns them.
+func (prov *provisioner) reconcileResources() {
+	resources, err := prov.store.Resources().GetAllProvisionedOrRunningResources()
+	if err != nil {
+		log.Error(lq.NewErrorf(err, "Failed getting all resources for resource reconcilliation"))
+		return
+	}
+
+	// A resource missing from its account would have its instance terminated as unknown, so nothing is reconciled
+	// unless the account of every resource is known
+	knownResources := make(map[uint][]*lq.ResourceInstance)
+	for _, resource := range resources {
+		accountID, err := prov.store.AwsAccounts().GetIDForOwner(resource.OwnerId, resource.OrgID)
+		if err != nil {
+			log.Error(lq.NewErrorf(err, "Failed getting aws account of resource %d for resource reconcilliation",
+				resource.ID))
+			return
+		}
+		knownResources[accountID] = append(knownResources[accountID], resource)
+	}
+
+	accounts, err := prov.store.AwsAccounts().GetAll()
+	if err != nil {
+		log.Error(lq.NewErrorf(err, "Failed getting all aws accounts for resource reconcilliation"))
+		return
+	}
+
+	for _, account := range accounts {
+		badResources, err := prov.resourceManager.ReconcileResources(account, knownResources[uint(account.GetID())])
+		if err != nil {
+			log.Error(err)
+		}
+
+		for _, resource := range badResources {
+			prov.deprovisioningChan <- &DeprovisionEvent{
+				resourceId: resource.ID,
+				msg: fmt.Sprintf("Resource %d failed resource reconcilliation. The AWS instance cannot be found",
+					resource.ID),
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	database "bargain/liquefy/db"
+)
+
+// The migration widening the secret columns of aws accounts to text. Envelope encrypted values do not fit the columns
+// of older databases, so they are refused.
+const textColumnsVersion = 2
+
+// Re-encrypts the secrets of every aws account and the secrets of users with the active master key. To rotate master
+// keys, add the new key to the configured master keys, make it active with LQ_MASTER_KEY_ID and run this once every
+// service uses the new configuration. The previous key can be removed once this reports no failures.
+func main() {
+	masterIP := flag.String("masterip", "", "IP on which the master is running")
+	flag.Parse()
+
+	if *masterIP == "" {
+		panic(errors.New("No masterip, please provide valid values"))
+	}
+	if err := database.Connect(*masterIP); err != nil {
+		panic(err)
+	}
+
+	version, err := database.Migrations().Version()
+	if err != nil {
+		panic(err)
+	}
+	if version < textColumnsVersion {
+		log.Errorf("The database is at version %d, migrate it to version %d before re-encrypting", version,
+			textColumnsVersion)
+		os.Exit(1)
+	}
+
+	failed := false
+	reencrypted, err := database.AwsAccounts().ReencryptAll()
+	fmt.Printf("Re-encrypted %d aws accounts\n", reencrypted)
+	if err != nil {
+		log.Error(err)
+		failed = true
+	}
+	reencrypted, err = database.Secrets().ReencryptAll()
+	fmt.Printf("Re-encrypted %d secrets\n", reencrypted)
+	if err != nil {
+		log.Error(err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
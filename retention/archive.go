@@ -0,0 +1,70 @@
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	lq "bargain/liquefy/models"
+)
+
+// Archives are gzipped JSON lines, one job or instance with its history per line
+func encodeArchive(jobs []*lq.ArchivedJob, instances []*lq.ArchivedInstance) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	encoder := json.NewEncoder(writer)
+	for _, job := range jobs {
+		if err := encoder.Encode(&lq.ArchiveRecord{Job: job}); err != nil {
+			return nil, lq.NewErrorf(err, "Failed encoding archived job %d", job.Job.ID)
+		}
+	}
+	for _, instance := range instances {
+		if err := encoder.Encode(&lq.ArchiveRecord{Instance: instance}); err != nil {
+			return nil, lq.NewErrorf(err, "Failed encoding archived instance %d", instance.Instance.ID)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, lq.NewErrorf(err, "Failed compressing archive")
+	}
+	return buffer.Bytes(), nil
+}
+
+func decodeArchive(data []byte) ([]*lq.ArchivedJob, []*lq.ArchivedInstance, error) {
+	jobs := []*lq.ArchivedJob{}
+	instances := []*lq.ArchivedInstance{}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return jobs, instances, lq.NewErrorf(err, "Failed decompressing archive")
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for {
+		record := lq.ArchiveRecord{}
+		if err := decoder.Decode(&record); err == io.EOF {
+			return jobs, instances, nil
+		} else if err != nil {
+			return jobs, instances, lq.NewErrorf(err, "Failed decoding archive")
+		}
+		if record.Job != nil && record.Job.Job != nil {
+			jobs = append(jobs, record.Job)
+		}
+		if record.Instance != nil && record.Instance.Instance != nil {
+			instances = append(instances, record.Instance)
+		}
+	}
+}
+
+// The jobs and instances of an archive file
+func ReadArchive(storage Storage, key string) ([]*lq.ArchivedJob, []*lq.ArchivedInstance, error) {
+	data, err := storage.Get(key)
+	if err != nil {
+		return []*lq.ArchivedJob{}, []*lq.ArchivedInstance{}, err
+	}
+	jobs, instances, err := decodeArchive(data)
+	if err != nil {
+		return jobs, instances, lq.NewErrorf(err, "Failed reading archive %s", key)
+	}
+	return jobs, instances, nil
+}
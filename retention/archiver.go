@@ -0,0 +1,152 @@
+package retention
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+)
+
+// ArchiveInterval is how often the provisioner archives expired history
+const ArchiveInterval = 6 * time.Hour
+
+// Jobs and instances written to a single archive file, at most
+const archiveBatchSize = 500
+
+// Archiver moves the history that expired under the retention policies from the database to the archive storage.
+// Files are stored before the rows are deleted, a failure in between leaves a file that is not recorded and the
+// history in the database, to be archived again.
+type Archiver struct {
+	store   db.Store
+	storage Storage
+	now     func() time.Time
+}
+
+func NewArchiver(store db.Store, storage Storage) *Archiver {
+	return &Archiver{store: store, storage: storage, now: time.Now}
+}
+
+// Archives the expired history of every scope, returning the files written
+func (archiver *Archiver) Run() ([]*lq.ArchiveFile, error) {
+	files := []*lq.ArchiveFile{}
+	scopes, err := archiver.store.Retention().Scopes()
+	if err != nil {
+		return files, err
+	}
+	for _, scope := range scopes {
+		archived, err := archiver.archiveScope(scope)
+		files = append(files, archived...)
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+func (archiver *Archiver) archiveScope(scope lq.RetentionScope) ([]*lq.ArchiveFile, error) {
+	files := []*lq.ArchiveFile{}
+	policy, err := archiver.store.Retention().GetPolicy(scope.OwnerID, scope.OrgID)
+	if err != nil {
+		return files, err
+	}
+	now := archiver.now()
+	cutoff := policy.Cutoff(now)
+
+	for batch := 0; ; batch++ {
+		jobs, err := archiver.store.Retention().ExpiredJobs(scope, cutoff, archiveBatchSize)
+		if err != nil {
+			return files, err
+		}
+		instances, err := archiver.store.Retention().ExpiredInstances(scope, cutoff, archiveBatchSize)
+		if err != nil {
+			return files, err
+		}
+		if len(jobs) == 0 && len(instances) == 0 {
+			return files, nil
+		}
+
+		file := &lq.ArchiveFile{
+			Key:            archiveKey(scope, now, batch),
+			OwnerID:        scope.OwnerID,
+			OrgID:          scope.OrgID,
+			Jobs:           len(jobs),
+			Instances:      len(instances),
+			ArchivedBefore: cutoff,
+		}
+		data, err := encodeArchive(jobs, instances)
+		if err != nil {
+			return files, err
+		}
+		if err := archiver.storage.Put(file.Key, data); err != nil {
+			return files, err
+		}
+		if err := archiver.store.Retention().Archive(file, jobs, instances); err != nil {
+			return files, err
+		}
+		log.Infof("Archived %d jobs and %d instances of user %d in org %d to %s", file.Jobs, file.Instances,
+			scope.OwnerID, scope.OrgID, file.Key)
+		files = append(files, file)
+
+		if len(jobs) < archiveBatchSize && len(instances) < archiveBatchSize {
+			return files, nil
+		}
+	}
+}
+
+func archiveKey(scope lq.RetentionScope, now time.Time, batch int) string {
+	return fmt.Sprintf("user-%d/org-%d/%d-%d.jsonl.gz", scope.OwnerID, scope.OrgID, now.UTC().UnixNano(), batch)
+}
+
+// Archives expired history every interval, when an archive storage is configured
+func StartArchiver(store db.Store, interval time.Duration) {
+	storage := GetStorage()
+	if storage == nil {
+		log.Info("No archive storage configured, history is kept in the database")
+		return
+	}
+	archiver := NewArchiver(store, storage)
+	go func() {
+		clock := time.NewTicker(interval)
+		for range clock.C {
+			if _, err := archiver.Run(); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+}
+
+// Puts the history of an archive file back in the database. The file is kept in the storage, restoring it again
+// replaces the restored rows. Restored history is only archived again once it expires under the retention policy
+// counting from the restore.
+func Restore(store db.Store, storage Storage, key string) (*lq.ArchiveFile, error) {
+	return NewArchiver(store, storage).Restore(key)
+}
+
+func (archiver *Archiver) Restore(key string) (*lq.ArchiveFile, error) {
+	store := archiver.store
+	file, err := store.Retention().GetArchive(key)
+	if err != nil {
+		// Files whose rows were deleted can still be restored, ex: after a failure between storing and recording them
+		file = &lq.ArchiveFile{Key: key}
+	}
+	jobs, instances, err := ReadArchive(archiver.storage, key)
+	if err != nil {
+		return file, err
+	}
+	file.Jobs, file.Instances = len(jobs), len(instances)
+
+	restoredAt := archiver.now().UnixNano()
+	for _, job := range jobs {
+		job.Job.RestoredAt = restoredAt
+	}
+	for _, instance := range instances {
+		instance.Instance.RestoredAt = restoredAt
+	}
+	if err := store.Retention().Restore(file, jobs, instances); err != nil {
+		return file, err
+	}
+	return file, nil
+}
@@ -0,0 +1,186 @@
+package retention
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+)
+
+// A killed job with a build log and a deprovisioned instance, of the user in the org
+func createHistory(t *testing.T, store db.Store, ownerID, orgID uint) (*lq.ContainerJob, *lq.ResourceInstance) {
+	job := &lq.ContainerJob{Name: "job", OwnerID: ownerID, OrgID: orgID}
+	assert.Nil(t, store.Jobs().Create(job))
+	instance := &lq.ResourceInstance{OwnerId: ownerID, OrgID: orgID}
+	assert.Nil(t, store.Assignments().AssignJob(job.ID, instance, true))
+	assert.Nil(t, store.Assignments().UnassignJob(job.ID))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_KILLED.String(), "Killed"))
+	assert.Nil(t, store.BuildLogs().Create(job.ID, 1, "built"))
+
+	for _, status := range []string{lq.ResourceProvisioning, lq.ResourceStatusDeprovisioning,
+		lq.ResourceStatusDeprovisioned} {
+		assert.Nil(t, store.Resources().SetStatus(instance.ID, status, ""))
+	}
+	return job, instance
+}
+
+func newTestArchiver(t *testing.T, store db.Store, daysFromNow int) (*Archiver, func()) {
+	root, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+	archiver := NewArchiver(store, NewFileStorage(root))
+	archiver.now = func() time.Time { return time.Now().Add(time.Duration(daysFromNow) * 24 * time.Hour) }
+	return archiver, func() { os.RemoveAll(root) }
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	store := db.NewMemoryStore()
+	job, instance := createHistory(t, store, 1, 0)
+	running := &lq.ContainerJob{Name: "running", OwnerID: 1}
+	assert.Nil(t, store.Jobs().Create(running))
+
+	archiver, cleanup := newTestArchiver(t, store, lq.DefaultArchiveAfterDays-1)
+	defer cleanup()
+
+	// Nothing expired before the policy says so
+	files, err := archiver.Run()
+	assert.Nil(t, err)
+	assert.Len(t, files, 0)
+
+	archiver.now = func() time.Time { return time.Now().Add((lq.DefaultArchiveAfterDays + 1) * 24 * time.Hour) }
+	files, err = archiver.Run()
+	assert.Nil(t, err)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	assert.Equal(t, 1, files[0].Jobs)
+	assert.Equal(t, 1, files[0].Instances)
+
+	// The history left the database, jobs still running stay
+	_, err = store.Jobs().Get(job.ID)
+	assert.NotNil(t, err)
+	_, err = store.Resources().Get(instance.ID)
+	assert.NotNil(t, err)
+	assert.Len(t, store.JobTrackers(job.ID), 0)
+	_, err = store.Jobs().Get(running.ID)
+	assert.Nil(t, err)
+
+	// and can be listed from the archive by those who see it
+	jobs, err := ListArchivedJobs(store, archiver.storage, 1, 0, db.JobFilter{}, db.PageRequest{Limit: 10})
+	assert.Nil(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, job.ID, jobs[0].ID)
+	}
+	jobs, err = ListArchivedJobs(store, archiver.storage, 1, 0, db.JobFilter{Status: "TASK_RUNNING"},
+		db.PageRequest{Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 0)
+	instances, err := ListArchivedInstances(store, archiver.storage, 2, 0, db.InstanceFilter{},
+		db.PageRequest{Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, instances, 0)
+
+	restored, err := archiver.Restore(files[0].Key)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, restored.Jobs)
+	stored, err := store.Jobs().Get(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, mesos.TaskState_TASK_KILLED.String(), stored.Status)
+	assert.Len(t, store.JobTrackers(job.ID), 4)
+	assert.Len(t, store.ResourceEvents(instance.ID), 4)
+	buildLogs, err := store.BuildLogs().GetByJob(job.ID)
+	assert.Nil(t, err)
+	assert.Len(t, buildLogs, 1)
+	_, err = store.Retention().GetArchive(files[0].Key)
+	assert.NotNil(t, err)
+
+	// Restoring twice leaves a single copy
+	_, err = Restore(store, archiver.storage, files[0].Key)
+	assert.Nil(t, err)
+	assert.Len(t, store.JobTrackers(job.ID), 4)
+}
+
+func TestRestoredHistoryIsKept(t *testing.T) {
+	store := db.NewMemoryStore()
+	job, instance := createHistory(t, store, 1, 0)
+	archiver, cleanup := newTestArchiver(t, store, lq.DefaultArchiveAfterDays+1)
+	defer cleanup()
+
+	files, err := archiver.Run()
+	assert.Nil(t, err)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	_, err = archiver.Restore(files[0].Key)
+	assert.Nil(t, err)
+
+	// The next runs keep the restored history, although it ended long enough ago
+	files, err = archiver.Run()
+	assert.Nil(t, err)
+	assert.Len(t, files, 0)
+	_, err = store.Jobs().Get(job.ID)
+	assert.Nil(t, err)
+	_, err = store.Resources().Get(instance.ID)
+	assert.Nil(t, err)
+
+	// until it expires again counting from the restore
+	restoredAt := archiver.now()
+	archiver.now = func() time.Time { return restoredAt.Add((lq.DefaultArchiveAfterDays + 1) * 24 * time.Hour) }
+	files, err = archiver.Run()
+	assert.Nil(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, 1, files[0].Jobs)
+		assert.Equal(t, 1, files[0].Instances)
+	}
+}
+
+func TestArchiveFollowsPolicies(t *testing.T) {
+	store := db.NewMemoryStore()
+	personal, _ := createHistory(t, store, 1, 0)
+	shared, _ := createHistory(t, store, 1, 5)
+	assert.Nil(t, store.Retention().SetPolicy(&lq.RetentionPolicy{UserID: 1, ArchiveAfterDays: 10}))
+	assert.Nil(t, store.Retention().SetPolicy(&lq.RetentionPolicy{OrgID: 5, ArchiveAfterDays: 30}))
+
+	archiver, cleanup := newTestArchiver(t, store, 20)
+	defer cleanup()
+	files, err := archiver.Run()
+	assert.Nil(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, uint(0), files[0].OrgID)
+	}
+	_, err = store.Jobs().Get(personal.ID)
+	assert.NotNil(t, err)
+	_, err = store.Jobs().Get(shared.ID)
+	assert.Nil(t, err)
+
+	// Members see the archives of their organization
+	archives, err := store.Retention().ListArchivesVisibleTo(2, 5)
+	assert.Nil(t, err)
+	assert.Len(t, archives, 0)
+	archiver.now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+	_, err = archiver.Run()
+	assert.Nil(t, err)
+	archives, err = store.Retention().ListArchivesVisibleTo(2, 5)
+	assert.Nil(t, err)
+	assert.Len(t, archives, 1)
+}
+
+func TestFileStorageRejectsKeysOutsideTheArchive(t *testing.T) {
+	root, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	storage := NewFileStorage(root)
+	assert.Nil(t, storage.Put("user-1/org-0/1.jsonl.gz", []byte("data")))
+	data, err := storage.Get("user-1/org-0/1.jsonl.gz")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+	assert.NotNil(t, storage.Put("../outside", []byte("data")))
+	_, err = storage.Get("user-1/org-0/2.jsonl.gz")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,76 @@
+package retention
+
+import (
+	"sort"
+
+	"bargain/liquefy/db"
+	lq "bargain/liquefy/models"
+)
+
+type jobsByIDDesc []*lq.ContainerJob
+
+func (jobs jobsByIDDesc) Len() int           { return len(jobs) }
+func (jobs jobsByIDDesc) Swap(i, j int)      { jobs[i], jobs[j] = jobs[j], jobs[i] }
+func (jobs jobsByIDDesc) Less(i, j int) bool { return jobs[i].ID > jobs[j].ID }
+
+type instancesByIDDesc []*lq.ResourceInstance
+
+func (instances instancesByIDDesc) Len() int { return len(instances) }
+func (instances instancesByIDDesc) Swap(i, j int) {
+	instances[i], instances[j] = instances[j], instances[i]
+}
+func (instances instancesByIDDesc) Less(i, j int) bool { return instances[i].ID > instances[j].ID }
+
+// The archived jobs of the user and of their organization that match the filter, paged like the jobs of the database.
+// Every archive visible to the user is read, archived history is meant for occasional lookups.
+func ListArchivedJobs(store db.Store, storage Storage, userID, orgID uint, filter db.JobFilter,
+	page db.PageRequest) ([]*lq.ContainerJob, error) {
+	jobs := []*lq.ContainerJob{}
+	files, err := store.Retention().ListArchivesVisibleTo(userID, orgID)
+	if err != nil {
+		return jobs, err
+	}
+	for _, file := range files {
+		archived, _, err := ReadArchive(storage, file.Key)
+		if err != nil {
+			return jobs, err
+		}
+		for _, job := range archived {
+			if filter.Matches(job.Job) && page.Includes(job.Job.ID) {
+				jobs = append(jobs, job.Job)
+			}
+		}
+	}
+	sort.Sort(jobsByIDDesc(jobs))
+	if page.Limit > 0 && len(jobs) > page.Limit {
+		jobs = jobs[:page.Limit]
+	}
+	return jobs, nil
+}
+
+// The archived instances of the user and of their organization that match the filter, paged like the instances of
+// the database
+func ListArchivedInstances(store db.Store, storage Storage, userID, orgID uint, filter db.InstanceFilter,
+	page db.PageRequest) ([]*lq.ResourceInstance, error) {
+	instances := []*lq.ResourceInstance{}
+	files, err := store.Retention().ListArchivesVisibleTo(userID, orgID)
+	if err != nil {
+		return instances, err
+	}
+	for _, file := range files {
+		_, archived, err := ReadArchive(storage, file.Key)
+		if err != nil {
+			return instances, err
+		}
+		for _, instance := range archived {
+			if filter.Matches(instance.Instance) && page.Includes(instance.Instance.ID) {
+				instances = append(instances, instance.Instance)
+			}
+		}
+	}
+	sort.Sort(instancesByIDDesc(instances))
+	if page.Limit > 0 && len(instances) > page.Limit {
+		instances = instances[:page.Limit]
+	}
+	return instances, nil
+}
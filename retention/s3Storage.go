@@ -0,0 +1,55 @@
+package retention
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	lq "bargain/liquefy/models"
+)
+
+// S3Storage keeps archive files in a bucket of the Liquefy aws account, with the credentials and region of the
+// environment
+type S3Storage struct {
+	Bucket string
+	Prefix string
+	client *s3.S3
+}
+
+func NewS3Storage(bucket, prefix string) *S3Storage {
+	return &S3Storage{Bucket: bucket, Prefix: prefix, client: s3.New(session.New())}
+}
+
+func (s *S3Storage) Put(key string, data []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(s.Bucket),
+		Key:                  aws.String(path.Join(s.Prefix, key)),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String("application/gzip"),
+		ServerSideEncryption: aws.String("AES256"),
+	})
+	if err != nil {
+		return lq.NewErrorf(err, "Failed storing archive %s in bucket %s", key, s.Bucket)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(key string) ([]byte, error) {
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(path.Join(s.Prefix, key)),
+	})
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading archive %s from bucket %s", key, s.Bucket)
+	}
+	defer output.Body.Close()
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading archive %s from bucket %s", key, s.Bucket)
+	}
+	return data, nil
+}
@@ -0,0 +1,116 @@
+package retention
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	lq "bargain/liquefy/models"
+)
+
+// ArchiveURLEnv locates the archive storage, ex: s3://bucket/prefix or file:///var/lib/liquefy/archive. History is not
+// archived when it is unset.
+const ArchiveURLEnv = "LQ_ARCHIVE_URL"
+
+// Storage keeps archive files under their keys. Files are written once and never modified.
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+var (
+	storageMutex sync.Mutex
+	storage      Storage
+	storageSet   bool
+)
+
+// The storage LQ_ARCHIVE_URL locates, nil when it is unset
+func NewStorageFromEnv() (Storage, error) {
+	archiveURL := os.Getenv(ArchiveURLEnv)
+	if archiveURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Invalid %s %s", ArchiveURLEnv, archiveURL)
+	}
+	switch parsed.Scheme {
+	case "file":
+		return NewFileStorage(parsed.Path), nil
+	case "s3":
+		return NewS3Storage(parsed.Host, strings.TrimPrefix(parsed.Path, "/")), nil
+	default:
+		return nil, fmt.Errorf("Unknown %s scheme %s, must be file or s3", ArchiveURLEnv, parsed.Scheme)
+	}
+}
+
+func SetStorage(s Storage) {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+	storage, storageSet = s, true
+}
+
+// The archive storage, nil when history is not archived
+func GetStorage() Storage {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+	if !storageSet {
+		var err error
+		if storage, err = NewStorageFromEnv(); err != nil {
+			panic(err)
+		}
+		storageSet = true
+	}
+	return storage
+}
+
+// FileStorage keeps archive files in a directory, for tests and single host deployments
+type FileStorage struct {
+	Root string
+}
+
+func NewFileStorage(root string) *FileStorage {
+	return &FileStorage{Root: root}
+}
+
+func (s *FileStorage) path(key string) (string, error) {
+	path := filepath.Join(s.Root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.Root)+string(filepath.Separator)) {
+		return "", fmt.Errorf("Archive key %s is outside of the archive", key)
+	}
+	return path, nil
+}
+
+// Files are written under a temporary name and renamed, so that a partial file is never read
+func (s *FileStorage) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return lq.NewErrorf(err, "Failed storing archive %s", key)
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return lq.NewErrorf(err, "Failed storing archive %s", key)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return lq.NewErrorf(err, "Failed storing archive %s", key)
+	}
+	return nil
+}
+
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, lq.NewErrorf(err, "Failed reading archive %s", key)
+	}
+	return data, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
     "flag"
+    "os"
 	"errors"
 	"runtime"
     "fmt"
@@ -9,9 +10,12 @@ import (
     log "github.com/Sirupsen/logrus"
 
     . "bargain/liquefy/scheduler"
+    lqCloud "bargain/liquefy/cloudprovider"
     "bargain/liquefy/common"
     "bargain/liquefy/db"
     "bargain/liquefy/logging"
+    "bargain/liquefy/tracing"
+    "bargain/liquefy/metrics"
 )
 
 func main() {
@@ -21,6 +25,11 @@ func main() {
 	executorIp := flag.String("executorIp", "", "IP of the Liquefy executor")
     dbIp := flag.String("dbIp", "", "IP of the DB")
     esIp := flag.String("esIp", "", "the ip of the es server for logs")
+    logSinks := flag.String("logSinks", "stdout",
+        "where logs are shipped, comma separated: stdout, file:///path or http://host:port of elasticsearch")
+    metricsAddr := flag.String("metricsAddr", ":9102", "address to serve /metrics on, empty to disable it")
+    traceExporter := flag.String("traceExporter", os.Getenv(tracing.TraceExporterEnv),
+        "where spans are exported: none, stdout or file:///path")
 
     flag.Parse()
 
@@ -42,19 +51,36 @@ func main() {
         if *esIp == "" {
             panic("Production and staging deployments require the esIp flag")
         }
-        log.AddHook(logging.NewElasticHook(*esIp, "9200", "liquefy-", "Provisioner", ""))
     }
+    sinkSpec := *logSinks
+    if *esIp != "" {
+        sinkSpec += ",http://" + *esIp + ":9200"
+    }
+    sinks, err := logging.ParseSinks(sinkSpec, "liquefy-", "scheduler")
+    if err != nil {
+        panic(err)
+    }
+    logging.Setup("scheduler", nil, sinks...)
+
+    exporter, err := tracing.NewExporter(*traceExporter)
+    if err != nil {
+        panic(err)
+    }
+    tracing.SetExporter(exporter)
 
     runtime.GOMAXPROCS(256)
-    err := db.Connect(*dbIp)
+    err = db.Connect(*dbIp)
     if err != nil {
         panic(err)
     }
 
+    lqCloud.StartCatalogRefresh()
+    metrics.Serve(*metricsAddr)
+
     //SLAVE EXEC
     //TODO:: Inject ESPublic ip
     command :=  fmt.Sprintf("./executor --esIp=%s", *mesosMasterIp)
-    lqScheduler := NewLqScheduler(*schedIp, *mesosMasterIp, *executorIp, command)
+    lqScheduler := NewLqScheduler(db.NewPostgresStore(), *schedIp, *mesosMasterIp, *executorIp, command)
 
     status, err := lqScheduler.Run()
     if err != nil {
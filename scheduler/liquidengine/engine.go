@@ -15,10 +15,12 @@ import (
 )
 
 type SpotRequest struct {
-	Cpu     float64
-	Memory  float64
-	Gpu     float64
-	Disk    float64
+	Cpu           float64
+	Memory        float64
+	Gpu           float64
+	Disk          float64
+	InstanceStore bool
+	OrgID         uint // organization whose aws account to launch on, 0 for the users own account
 }
 
 type SpotMatch struct {
@@ -33,10 +35,12 @@ type CostEngine interface {
 	GetResourceCostWithAwsApi(resource *lq.ResourceInstance, startTime, endTime time.Time) (float64, error)
 }
 
-type awsEngine struct {}
+type awsEngine struct {
+	store db.Store
+}
 
-func NewCostEngine() (CostEngine) {
-	return &awsEngine{}
+func NewCostEngine(store db.Store) (CostEngine) {
+	return &awsEngine{store: store}
 }
 
 // This algorithm will blow y'alls mother fucker's minds
@@ -45,11 +49,11 @@ func (engine *awsEngine) Match(userId uint, req *SpotRequest) (*SpotMatch, error
 	var optimalMatch SpotMatch
 	var minSpotPrice ec2.SpotPrice
 
-	user, err := db.Users().Get(userId)
+	user, err := engine.store.Users().Get(userId)
 	if err != nil {
 		return nil, lq.NewErrorf(err, "Engine failed matching request")
 	}
-	awsAccount, err := db.AwsAccounts().Get(user.AwsAccountID)
+	awsAccount, err := engine.store.AwsAccounts().GetForOwner(user.ID, req.OrgID)
 	if err != nil {
 		return nil, lq.NewErrorf(err, "Engine failed matching request")
 	}
@@ -58,7 +62,7 @@ func (engine *awsEngine) Match(userId uint, req *SpotRequest) (*SpotMatch, error
 
 	// Find all the possible markets to query for prices
 	marketsExist := false
-	availableInstances := aws.FindPossibleInstances(req.Cpu, req.Memory, req.Gpu, req.Disk)
+	availableInstances := aws.FindPossibleInstances(req.Cpu, req.Memory, req.Gpu, req.Disk, req.InstanceStore)
 	availableMarkets := make(map[aws.AZ]map[aws.InstanceType]struct{})
 	for _, az := range aws.AllAvailabilityZones {
 		availableMarkets[az] = make(map[aws.InstanceType]struct{})
@@ -75,7 +79,7 @@ func (engine *awsEngine) Match(userId uint, req *SpotRequest) (*SpotMatch, error
 		return &SpotMatch{}, fmt.Errorf("There are no available markets to run this job")
 	}
 
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 	azToSpotPrices := make(map[aws.AZ]map[aws.InstanceType]float64)
 	for az, instanceMap := range availableMarkets {
 		instances := []aws.InstanceType{}
@@ -134,22 +138,13 @@ func (engine *awsEngine) findUsersUnavailableMarkets(user *lq.User, awsAccount *
 	// Get current list of known unavailable markets
 	unavailableMarkets := aws.GetUnavailableMarkets()
 
-	// Remove markets which the user does not have a subnet for
-	for _, az := range aws.AllAvailabilityZones {
-		if awsAccount.GetSubnetId(az.String()) == "" {
-			log.Debugf("User does not have subnet for availability zone %s, skipping all markets", az.String())
-			for instance := range aws.AvailableInstances {
-				unavailableMarkets[az][instance] = struct{}{}
-			}
-		}
-	}
-
-	// Remove markets which the user does not have a ssh key for
+	// Remove markets which the user does not have a ssh key or a subnet for
 	for region, azs := range aws.AWSRegionsToAZs {
-		if awsAccount.GetSshPrivateKey(region.String()) == "" {
-			log.Debugf("User does not have private key for region %s, skipping all markets", region.String())
-			for _, az := range azs {
-				for instance := range aws.AvailableInstances {
+		accountRegion := awsAccount.FindRegion(region.String())
+		for _, az := range azs {
+			if accountRegion.GetSshPrivateKey() == "" || accountRegion.FindSubnet(az.String()).GetSubnetId() == "" {
+				log.Debugf("User is not set up in availability zone %s, skipping all markets", az.String())
+				for instance := range aws.Catalog().Instances {
 					unavailableMarkets[az][instance] = struct{}{}
 				}
 			}
@@ -164,7 +159,7 @@ func (engine *awsEngine) findUsersUnavailableMarkets(user *lq.User, awsAccount *
  * Finds the total cost of running an AWS spot instance
  */
 func (engine *awsEngine) TrackResourceCost(resourceId uint) (float64, error) {
-	resource, err := db.Resources().Get(resourceId)
+	resource, err := engine.store.Resources().Get(resourceId)
 	if err != nil {
 		return 0.0, err
 	}
@@ -174,17 +169,12 @@ func (engine *awsEngine) TrackResourceCost(resourceId uint) (float64, error) {
 func (engine *awsEngine) GetResourceCostWithAwsApi(resource *lq.ResourceInstance, startTime, endTime time.Time) (float64, error) {
 	log.Debugf("Getting resource cost for market (%s, %s) between %s and %s",
 		resource.AwsAvailabilityZone, resource.AwsInstanceType, startTime.UTC().String(), endTime.UTC().String())
-	user, err := db.Users().Get(resource.OwnerId)
-	if err != nil {
-		return 0.0, lq.NewError("Failed getting resource cost", err)
-	}
-
-	awsAccount, err := db.AwsAccounts().Get(user.AwsAccountID)
+	awsAccount, err := engine.store.AwsAccounts().GetForOwner(resource.OwnerId, resource.OrgID)
 	if err != nil {
 		return 0.0, lq.NewError("Failed getting resource cost", err)
 	}
 
-	awsCloud := aws.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+	awsCloud := aws.NewAwsCloud(awsAccount)
 	history, err := awsCloud.GetSpotPriceHistory(aws.AZ(resource.AwsAvailabilityZone),
 		aws.InstanceType(resource.AwsInstanceType), startTime, endTime)
 	if err != nil {
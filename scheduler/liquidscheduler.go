@@ -1,10 +1,12 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"strconv"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -15,6 +17,10 @@ import (
 	sched "github.com/mesos/mesos-go/scheduler"
 
 	"bargain/liquefy/db"
+	"bargain/liquefy/events"
+	"bargain/liquefy/logging"
+	"bargain/liquefy/metrics"
+	"bargain/liquefy/tracing"
 	lq "bargain/liquefy/models"
 	aws "bargain/liquefy/cloudprovider"
 	lqEngine "bargain/liquefy/scheduler/liquidengine"
@@ -27,15 +33,18 @@ var ExecutorPort = 4949
 var FetcherTimeoutUserTerminatedJobs = time.Duration(15) * time.Second
 var FetcherTimeoutResourceTerminations = time.Duration(15) * time.Second
 
+// Events carry the trace of their job, their handling is recorded as a span of it
 type AssignEvent struct {
 	jobId           uint
 	resource        *lq.ResourceInstance
 	createResource  bool
+	trace           tracing.SpanContext
 }
 
 type LaunchEvent struct {
 	jobId   uint
 	offer   *mesos.Offer
+	trace   tracing.SpanContext
 }
 
 type UserTerminationEvent struct {
@@ -47,10 +56,15 @@ type LqScheduler interface {
 }
 
 type lqScheduler struct {
+	store           db.Store
 	executor        *mesos.ExecutorInfo
 	engine          lqEngine.CostEngine
 	driver          *sched.MesosSchedulerDriver
 	eventChan       chan interface{}
+
+	// Instances whose executor reported that collecting images could not free enough disk
+	diskPressure    map[uint]bool
+	diskMutex       sync.Mutex
 }
 
 //
@@ -73,7 +87,7 @@ type lqScheduler struct {
 // - User termination thread: looks for all non-terminated jobs that have been user terminated
 //      - User termination event
 //
-func NewLqScheduler(bindIp, mesosMasterIp, executorIp string, executorLaunch string ) LqScheduler {
+func NewLqScheduler(store db.Store, bindIp, mesosMasterIp, executorIp string, executorLaunch string ) LqScheduler {
 	// Setup Executor Info
 	executorInfo := &mesos.ExecutorInfo{
 		ExecutorId: mesosutil.NewExecutorID("Liquefy"),
@@ -91,9 +105,11 @@ func NewLqScheduler(bindIp, mesosMasterIp, executorIp string, executorLaunch str
 	}
 
 	scheduler := &lqScheduler{
+		store: store,
 		executor: executorInfo,
-		engine: lqEngine.NewCostEngine(),
+		engine: lqEngine.NewCostEngine(store),
 		eventChan: make(chan interface{}, 10 * 1024),
+		diskPressure: make(map[uint]bool),
 	}
 
 	// Setup Driver Config
@@ -105,7 +121,7 @@ func NewLqScheduler(bindIp, mesosMasterIp, executorIp string, executorLaunch str
 		FailoverTimeout: &timeout,
 	}
 
-	if frameworkId, err := db.Mesos().GetFrameworkId(); err != nil {
+	if frameworkId, err := store.Mesos().GetFrameworkId(); err != nil {
 		panic(err)
 	} else if frameworkId != "" {
 		log.Debugf("Registering with framework id: %s", frameworkId)
@@ -129,6 +145,8 @@ func NewLqScheduler(bindIp, mesosMasterIp, executorIp string, executorLaunch str
 
 	scheduler.driver = driver
 
+	metrics.EventQueueDepth.SetFunc(func() float64 { return float64(len(scheduler.eventChan)) })
+
 	// Start the event handler thread
 	go scheduler.eventHandlerThread()
 
@@ -147,6 +165,7 @@ func (sched *lqScheduler) Run() (mesos.Status, error) {
 
 func (sched *lqScheduler) eventHandlerThread() {
 	for event := range sched.eventChan {
+		start := time.Now()
 		if assignEvent, ok := event.(*AssignEvent); ok {
 			if assignEvent.createResource {
 				log.Debug("Recieved assign event for job to create a new resource")
@@ -157,18 +176,21 @@ func (sched *lqScheduler) eventHandlerThread() {
 			if err := sched.handleAssignEvent(assignEvent); err != nil {
 				log.Error(lq.NewErrorf(err, "Failed assigning job %d to resource %d", assignEvent.jobId, assignEvent.resource.ID))
 			}
+			metrics.EventHandling.With("assign").ObserveSince(start)
 		} else if launchEvent, ok := event.(*LaunchEvent); ok {
 			log.Debugf("Recieved launch event for job %d", launchEvent.jobId)
 
 			if err := sched.handleLaunchEvent(launchEvent); err != nil {
 				log.Error(lq.NewErrorf(err, "Failed launching job %d", launchEvent.jobId))
 			}
+			metrics.EventHandling.With("launch").ObserveSince(start)
 		} else if userTermEvent, ok := event.(*UserTerminationEvent); ok {
 			log.Debugf("Recieved user termination event for job %d", userTermEvent.jobId)
 
 			if err := sched.handleUserTerminationEvent(userTermEvent); err != nil {
 				log.Error(lq.NewErrorf(err, "Failed user terminating job %d", userTermEvent.jobId))
 			}
+			metrics.EventHandling.With("user_termination").ObserveSince(start)
 		} else {
 			log.Errorf("Recieved invalid event %v", event)
 		}
@@ -188,8 +210,13 @@ func (sched *lqScheduler) eventHandlerThread() {
 //      - do not assign the job to the resource (this could be due to a user termination for example)
 //  - resource being assigned to is not running
 //      - do not assign the job
-func (sched *lqScheduler) handleAssignEvent(event *AssignEvent) error {
-	job, err := db.Jobs().Get(event.jobId)
+func (sched *lqScheduler) handleAssignEvent(event *AssignEvent) (err error) {
+	span := tracing.StartSpan("scheduler.assign", event.trace)
+	span.SetAttribute("job.id", event.jobId)
+	span.SetAttribute("create_resource", event.createResource)
+	defer func() { span.Finish(err) }()
+
+	job, err := sched.store.Jobs().Get(event.jobId)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed assigning job %d to resource %d", event.jobId, event.resource.ID)
 	}
@@ -201,7 +228,7 @@ func (sched *lqScheduler) handleAssignEvent(event *AssignEvent) error {
 
 	if ! event.createResource {
 		// Verify that the resource being assigned to is running
-		resource, err := db.Resources().Get(event.resource.ID)
+		resource, err := sched.store.Resources().Get(event.resource.ID)
 		if err != nil {
 			return lq.NewErrorf(err, "Failed assigning job %d to resource %d", event.jobId, event.resource.ID)
 		}
@@ -212,10 +239,15 @@ func (sched *lqScheduler) handleAssignEvent(event *AssignEvent) error {
 		}
 	}
 
-	err = db.Assignments().AssignJob(event.jobId, event.resource, event.createResource)
+	// Provisioning a resource created for the job is traced under its assignment
+	if event.createResource {
+		event.resource.TraceParent = span.Context().String()
+	}
+	err = sched.store.Assignments().AssignJob(event.jobId, event.resource, event.createResource)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed assigning job %d to instance %d", event.jobId, event.resource.ID)
 	}
+	span.SetAttribute("resource.id", event.resource.ID)
 
 	return nil
 }
@@ -231,32 +263,46 @@ func (sched *lqScheduler) handleAssignEvent(event *AssignEvent) error {
 //      This could be due to a user termination or a resource termination, in either case, do not launch the job
 //  - Job is not correctly assigned to the mesos offer
 //      Do not launch the job on this offer and return
-func (sched *lqScheduler) handleLaunchEvent(event *LaunchEvent) error {
-	job, err := db.Jobs().Get(event.jobId)
+func (sched *lqScheduler) handleLaunchEvent(event *LaunchEvent) (err error) {
+	span := tracing.StartSpan("scheduler.launch", event.trace)
+	span.SetAttribute("job.id", event.jobId)
+	span.SetAttribute("offer.id", event.offer.GetId().GetValue())
+	defer func() { span.Finish(err) }()
+
+	job, err := sched.store.Jobs().Get(event.jobId)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed processing launch event for job %d", event.jobId)
 	}
 
 	// If job was terminated, do nothing
 	if job.IsTerminated() {
-		log.Debugf("Skipping launch of job %d. Is already terminated with status %s", job.ID, job.Status)
+		logging.ForJob(job).Debugf("Skipping launch of job %d. Is already terminated with status %s", job.ID, job.Status)
 		return nil
 	}
 
 	// If job is not correctly assigned to offer, do not launch
 	resourceId := sched.parseInstanceIDFromOffer(event.offer)
 	if job.InstanceID != resourceId {
-		log.Debugf("Skipping launch of job %d on resource %d because job is assigned to resource %d",
+		logging.ForJob(job).Debugf("Skipping launch of job %d on resource %d because job is assigned to resource %d",
 			job.ID, resourceId, job.InstanceID)
 		return nil
 	}
 
 	// Set status to launched, safe to do because it is not running on mesos yet
-	err = db.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, "")
+	launched, err := sched.setJobStatus(job, lq.ContainerJobStatusLaunched, "")
 	if err != nil {
 		return err
 	}
 
+	// Secrets are resolved into the task only, a job whose secrets were deleted since it was created fails
+	if err = sched.resolveSecrets(job); err != nil {
+		log.Error(err)
+		_, err = sched.setJobStatus(launched, mesos.TaskState_TASK_FAILED.String(), err.Error())
+		return err
+	}
+
+	// The executor records its spans under the launch
+	job.TraceParent = span.Context().String()
 	err =  sched.launchJob(job, event.offer)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed launching job %d", job.ID)
@@ -281,21 +327,21 @@ func (sched *lqScheduler) handleLaunchEvent(event *LaunchEvent) error {
 //      - kill the job via the mesos driver
 //      - wait for the killde update status to be recieved from mesos
 func (sched *lqScheduler) handleUserTerminationEvent(event *UserTerminationEvent) error {
-	job, err := db.Jobs().Get(event.jobId)
+	job, err := sched.store.Jobs().Get(event.jobId)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed processing user termination event for job %d", event.jobId)
 	}
 
-	log.Debugf("Killing job %d at users request", job.ID)
+	logging.ForJob(job).Debugf("Killing job %d at users request", job.ID)
 	if job.Status == mesos.TaskState_TASK_STAGING.String() {
 		if job.InstanceID != 0 {
-			err := db.Assignments().UnassignJob(job.ID)
+			err := sched.store.Assignments().UnassignJob(job.ID)
 			if err != nil {
 				return lq.NewErrorf(err, "Failed unassigning job after failed mesos launching of job %d", job.ID)
 			}
 		}
 
-		err = db.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_KILLED.String(), "Job killed by user")
+		_, err = sched.setJobStatus(job, mesos.TaskState_TASK_KILLED.String(), "Job killed by user")
 		if err != nil {
 			return lq.NewErrorf(err, "Failed setting job %d status back to staging after failed mesos launch", job.ID)
 		}
@@ -318,7 +364,7 @@ func (sched *lqScheduler) handleUserTerminationEvent(event *UserTerminationEvent
 func (sched *lqScheduler) fetchUserTerminatedJobs() {
 	clock := time.NewTicker(FetcherTimeoutUserTerminatedJobs)
 	for range clock.C {
-		userTerminatedJobs, err := db.Jobs().GetNonTerminatedUserTerminatedJobs()
+		userTerminatedJobs, err := sched.store.Jobs().GetNonTerminatedUserTerminatedJobs()
 		if err != nil {
 			log.Error(lq.NewErrorf(err, "Failed getting non-terminated, user terminated jobs"))
 			continue
@@ -336,7 +382,7 @@ func (sched *lqScheduler) fetchUserTerminatedJobs() {
 func (sched *lqScheduler) handleResourceTerminations() {
 	clock := time.NewTicker(FetcherTimeoutResourceTerminations)
 	for range clock.C {
-		terminatedResourceIds, err := db.Resources().GetTerminatedResourceIdsWithAssignedJobs()
+		terminatedResourceIds, err := sched.store.Resources().GetTerminatedResourceIdsWithAssignedJobs()
 		if err != nil {
 			log.Error(lq.NewErrorf(err, "Failed getting terminated resources with assigned jobs"))
 			continue
@@ -344,23 +390,21 @@ func (sched *lqScheduler) handleResourceTerminations() {
 
 		for _, resourceId := range terminatedResourceIds {
 			// for all jobs that are staging and intended to run on this resource, unassign the job
-			var stagedJobs []lq.ContainerJob
-			err := db.GetDB().Where("instance_id = ? AND status = ? AND user_terminated = false",
-				resourceId, mesos.TaskState_TASK_STAGING.String()).Find(&stagedJobs).Error
+			stagedJobs, err := sched.store.Jobs().GetAssignedJobsByInstances([]uint{resourceId})
 			if err != nil {
 				log.Error(lq.NewErrorf(err, "Failed finding jobs staging and assigned to resource %d", resourceId))
 				continue
 			}
 
 			// TODO: FIX THE HACK OF NOT SHARING MEMORY OF AWS MARKET MONITOR MAP
-			if resource, err := db.Resources().Get(resourceId); err != nil {
+			if resource, err := sched.store.Resources().Get(resourceId); err != nil {
 				log.Error(lq.NewErrorf(err, "Failed getting resource to mark market as unavailable"))
 			} else {
 				aws.MarkMarketUnavailable(aws.AZ(resource.AwsAvailabilityZone), aws.InstanceType(resource.AwsInstanceType))
 			}
 
 			for _, job := range stagedJobs {
-				err = db.Assignments().UnassignJob(job.ID)
+				err = sched.store.Assignments().UnassignJob(job.ID)
 				if err != nil {
 					log.Error(lq.NewErrorf(err, "Failed unassigning job %d from resource %d due to resource termination",
 						job.ID, job.InstanceID))
@@ -374,7 +418,7 @@ func (sched *lqScheduler) Registered(driver sched.SchedulerDriver, frameworkId *
 		masterInfo *mesos.MasterInfo) {
 	log.Info("Framework Registered with Master ", masterInfo)
 
-	dbFrameworkId, err := db.Mesos().GetFrameworkId()
+	dbFrameworkId, err := sched.store.Mesos().GetFrameworkId()
 	if err != nil {
 		log.Error("FAILED GETTING FRAMEWORK ID FROM DB!!!!")
 		driver.Abort()
@@ -383,7 +427,7 @@ func (sched *lqScheduler) Registered(driver sched.SchedulerDriver, frameworkId *
 
 	// Persist the framework id if we dont have one
 	if dbFrameworkId == "" {
-		if err := db.Mesos().SetFrameworkId(frameworkId.GetValue()); err != nil {
+		if err := sched.store.Mesos().SetFrameworkId(frameworkId.GetValue()); err != nil {
 			log.Error("FAILED PERSISTING FRAMEWORK ID!!!!!")
 			driver.Abort()
 			return
@@ -391,7 +435,7 @@ func (sched *lqScheduler) Registered(driver sched.SchedulerDriver, frameworkId *
 	}
 
 	//Find all non Killed / Failed / Finished tasks and reconcile
-	jobs,err := db.Jobs().GetAllNonCompletedJobs()
+	jobs,err := sched.store.Jobs().GetAllNonCompletedJobs()
 	if (err != nil ){
 		log.Error("FAILED to reconcile jobs on register :" +  err.Error())
 		driver.Abort()
@@ -428,6 +472,7 @@ func (sched *lqScheduler) Disconnected(sched.SchedulerDriver) {
 }
 
 func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []*mesos.Offer) {
+	metrics.OffersReceived.Add(float64(len(offers)))
 
 	//
 	// Process offers: sort by users and create unused offer set
@@ -469,7 +514,7 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 	// - process assigned jobs
 	// - process unassigned jobs
 	//
-	users, err := db.Users().GetAllWithPendingJobs()
+	users, err := sched.store.Users().GetAllWithPendingJobs()
 	if err != nil {
 		log.Error("Failed to retrieve all users")
 		return
@@ -490,7 +535,7 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 		}
 
 		// Handle users assigned jobs: find and launch on each jobs associated offer
-		assignedJobs, err := db.Jobs().GetAssignedJobsByInstances(instanceIds)
+		assignedJobs, err := sched.store.Jobs().GetAssignedJobsByInstances(instanceIds)
 		if err == nil {
 			for _, assignedJob := range assignedJobs {
 				if assignedJob.InstanceID == 0 {
@@ -508,6 +553,7 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 				launchEvent := &LaunchEvent{
 					jobId: assignedJob.ID,
 					offer: offer,
+					trace: tracing.ContextOf(assignedJob.TraceParent),
 				}
 
 				sched.eventChan <- launchEvent
@@ -518,11 +564,23 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 		}
 
 		// Handle users unassigned jobs: try to fit into unused offers and if not provision an instance
-		unassignedJobs, err := db.Jobs().GetUnassignedJobsByUser(user.ID)
+		unassignedJobs, err := sched.store.Jobs().GetUnassignedJobsByUser(user.ID)
 		if err != nil {
 			log.Errorf("Failed getting users %d unassigned jobs", user.ID)
 		}
 
+		// Instances are only provisioned within the quota of the user, jobs that do not fit wait for instances to
+		// free up
+		quota, err := sched.store.Quotas().GetForUser(user.ID)
+		if err != nil {
+			continue
+		}
+		usage, err := sched.store.Quotas().Usage(user.ID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
 		for _, unassignedJob := range unassignedJobs {
 			if unassignedJob.InstanceID != 0 {
 				log.Errorf("Job %d is unassigned but has a non-zero instance id %d",
@@ -536,23 +594,26 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 				if sched.offerSatisfiesJob(offer, unassignedJob) {
 					// TODO: Cache this instance retrieval
 					instanceID := sched.parseInstanceIDFromOffer(offer)
-					instance, err := db.Resources().Get(instanceID)
+					instance, err := sched.store.Resources().Get(instanceID)
 					if err != nil {
 						log.Error(lq.NewErrorf(err, "Failed fetching instance for offer %s", offer.GetId().GetValue()))
 						continue
 					}
-					if instance.Status == lq.ResourceStatusRunning {
+					// Jobs only run on instances of the aws account they were submitted to
+					if instance.Status == lq.ResourceStatusRunning && instance.OrgID == unassignedJob.OrgID {
 						log.Infof("Found existing offer for job %d", unassignedJob.ID)
 
 						assignEvent := &AssignEvent{
 							jobId:          unassignedJob.ID,
 							resource:       instance,
 							createResource: false,
+							trace:          tracing.ContextOf(unassignedJob.TraceParent),
 						}
 
 						launchEvent := &LaunchEvent{
 							jobId: unassignedJob.ID,
 							offer: offer,
+							trace: tracing.ContextOf(unassignedJob.TraceParent),
 						}
 
 						// These need to be two separate events because assign is distinct from launch.
@@ -569,10 +630,12 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 			if !jobLaunched {
 				log.Infof("Provisioning resource for job %d", unassignedJob.ID)
 				req := &lqEngine.SpotRequest{
-					Cpu:    unassignedJob.Cpu,
-					Memory: float64(unassignedJob.Ram),
-					Gpu:    float64(unassignedJob.Gpu),
-					Disk:   0.0, // We do not currently support disk matching
+					Cpu:           unassignedJob.Cpu,
+					Memory:        float64(unassignedJob.Ram),
+					Gpu:           float64(unassignedJob.Gpu),
+					Disk:          float64(unassignedJob.Disk),
+					InstanceStore: unassignedJob.InstanceStore,
+					OrgID:         unassignedJob.OrgID,
 				}
 
 				// Calculate the optimal spot price match for this request
@@ -582,9 +645,19 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 					continue
 				}
 
-				instanceInfo := aws.AvailableInstances[spotMatch.AwsInstanceType]
+				instanceInfo, ok := aws.Catalog().Instances[spotMatch.AwsInstanceType]
+				if !ok {
+					log.Errorf("Instance type %s matched for job %d is not in the instance catalog",
+						spotMatch.AwsInstanceType, unassignedJob.ID)
+					continue
+				}
+				if err := quota.AllowsInstance(usage, instanceInfo.Cpu); err != nil {
+					log.Infof("Not provisioning resource for job %d of user %d: %s", unassignedJob.ID, user.ID, err)
+					continue
+				}
 			    optimalResource := &lq.ResourceInstance{
 				    OwnerId:             user.ID,
+					OrgID:               unassignedJob.OrgID,
 					AwsAvailabilityZone: spotMatch.AwsAvailabilityZone.String(),
 					AwsInstanceType:     spotMatch.AwsInstanceType.String(),
 					AwsSpotPrice:        spotMatch.AwsSpotPrice,
@@ -602,15 +675,18 @@ func (sched *lqScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []
 					jobId:          unassignedJob.ID,
 					resource:       optimalResource,
 					createResource: true,
+					trace:          tracing.ContextOf(unassignedJob.TraceParent),
 				}
 
 				sched.eventChan <- assignEvent
+				usage.AddInstance(instanceInfo.Cpu)
 			}
 		}
 	}
 }
 
 func (sched *lqScheduler) releaseUnusedOffers(offers []*mesos.Offer) {
+	metrics.OffersDeclined.Add(float64(len(offers)))
 	for _, offer := range offers {
 		sched.driver.DeclineOffer(offer.Id, &mesos.Filters{RefuseSeconds: proto.Float64(20)})
 	}
@@ -640,19 +716,24 @@ func (sched *lqScheduler) StatusUpdate(driver sched.SchedulerDriver, status *mes
 		statusMsg = extractedMsg
 	}
 
-	job, err := db.Jobs().Get(uint(jobId))
+	job, err := sched.store.Jobs().Get(uint(jobId))
 	if err != nil {
 		log.Error(lq.NewErrorf(err, "Failed processing update event for job %d", uint(jobId)))
 		return
 	}
 
+	span := tracing.StartSpan("scheduler.status_update", tracing.ContextOf(job.TraceParent))
+	span.SetAttribute("job.id", job.ID)
+	span.SetAttribute("status", status.GetState().String())
+	defer span.Finish(nil)
+
 	// If the task transitions to starting, store the container id
 	if status.GetState() == mesos.TaskState_TASK_STARTING {
 		if statusMsg.ContainerJob.ContainerId == "" {
 			log.Error(fmt.Errorf("Failed recieving container id when setting job %d status to TASK_STARTING", job.ID))
 		} else {
-			log.Infof("Recieved container id: %s", statusMsg.ContainerJob.ContainerId)
-			err := db.Jobs().SetContainerId(job.ID, statusMsg.ContainerJob.ContainerId)
+			logging.ForJob(job).Infof("Recieved container id: %s", statusMsg.ContainerJob.ContainerId)
+			err := sched.store.Jobs().SetContainerId(job.ID, statusMsg.ContainerJob.ContainerId)
 			if err != nil {
 				log.Error("Failed setting container id: ", err)
 				return
@@ -660,21 +741,32 @@ func (sched *lqScheduler) StatusUpdate(driver sched.SchedulerDriver, status *mes
 		}
 	}
 
-	err = db.Jobs().SetStatus(job.ID, status.GetState().String(), statusMsg.StatusMessage)
-	if err != nil {
-		log.Error(lq.NewErrorf(err, "Failed setting status of job %d to %s", job.ID, status.String()))
+	// Running service jobs report their health and restarts with further running updates
+	if job.IsService() && status.GetState() == mesos.TaskState_TASK_RUNNING &&
+		job.Status == mesos.TaskState_TASK_RUNNING.String() {
+		err := sched.store.Jobs().SetHealth(job.ID, status.GetHealthy(), statusMsg.ContainerJob.Restarts, statusMsg.StatusMessage)
+		if err != nil {
+			log.Error(lq.NewErrorf(err, "Failed updating health of job %d", job.ID))
+		}
 		return
 	}
 
-	// Re-fetch the job to get the current state after the state transition
-	job, err = db.Jobs().Get(job.ID)
+	// The executor sends the build log of "code" jobs once the image is built or the build failed
+	if statusMsg.BuildLog != "" {
+		if err := sched.store.BuildLogs().Create(job.ID, job.RetryCount, statusMsg.BuildLog); err != nil {
+			log.Error(lq.NewErrorf(err, "Failed storing build log of job %d", job.ID))
+		}
+	}
+
+	job, err = sched.setJobStatus(job, status.GetState().String(), statusMsg.StatusMessage)
 	if err != nil {
-		log.Error(lq.NewErrorf(err, "Could not get re-fetch job %d to get current status", job.ID))
+		log.Error(lq.NewErrorf(err, "Failed setting status of job %d to %s", job.ID, status.String()))
 		return
 	}
 
 	// If the job is finished, calculate and update the cost of the job
 	if job.IsTerminated() {
+		metrics.JobsTerminated.With(job.Status).Inc()
 		// if a job does not have a launch time, then it was never sent to the resource and thus we can assume that
 		// the resource was not properly provisioned and there was no cost incurred for the job
 		if job.StartTime > 0 {
@@ -695,8 +787,8 @@ func (sched *lqScheduler) StatusUpdate(driver sched.SchedulerDriver, status *mes
 		status.GetState() == mesos.TaskState_TASK_ERROR ||
 		status.GetState() == mesos.TaskState_TASK_FINISHED)
 	if jobFailed && job.InstanceID != 0 {
-		log.Infof("Unregistering job %d from resource %d", job.ID, job.InstanceID)
-		err = db.Assignments().UnassignJob(job.ID)
+		logging.ForJob(job).Infof("Unregistering job %d from resource %d", job.ID, job.InstanceID)
+		err = sched.store.Assignments().UnassignJob(job.ID)
 		if err != nil {
 			log.Error(err)
 		}
@@ -712,6 +804,34 @@ func (sched *lqScheduler) OfferRescinded(_ sched.SchedulerDriver, oid *mesos.Off
 
 func (sched *lqScheduler) FrameworkMessage(driver sched.SchedulerDriver, eid *mesos.ExecutorID, sid *mesos.SlaveID, msg string) {
 	log.Infof("Recieved framework message: %s", msg)
+
+	// The only framework messages sent by executors are disk status reports
+	status, err := lq.DeserializeDiskStatus(msg)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if status.InstanceID == 0 {
+		return
+	}
+
+	sched.diskMutex.Lock()
+	defer sched.diskMutex.Unlock()
+	if status.Pressure != sched.diskPressure[status.InstanceID] {
+		log.Infof("Disk pressure of instance %d changed to %t (%.0f%% used)", status.InstanceID, status.Pressure,
+			status.UsedFraction * 100)
+	}
+	if status.Pressure {
+		sched.diskPressure[status.InstanceID] = true
+	} else {
+		delete(sched.diskPressure, status.InstanceID)
+	}
+}
+
+func (sched *lqScheduler) underDiskPressure(instanceID uint) bool {
+	sched.diskMutex.Lock()
+	defer sched.diskMutex.Unlock()
+	return sched.diskPressure[instanceID]
 }
 
 func (sched *lqScheduler) SlaveLost(_ sched.SchedulerDriver, sid *mesos.SlaveID) {
@@ -742,7 +862,7 @@ func (sched *lqScheduler) getOffersOwnerID(offer *mesos.Offer) (uint, error) {
 		return 0, errors.New("Dummy slave does not have an owner")
 	}
 
-	resource, err := db.Resources().Get(resourceID)
+	resource, err := sched.store.Resources().Get(resourceID)
 	if err != nil {
 		log.Error(lq.NewErrorf(err, "Failed getting owner of offer %s", offer.Id.GetValue()))
 		return 0, err
@@ -756,12 +876,12 @@ func (sched *lqScheduler) getOffersOwnerID(offer *mesos.Offer) (uint, error) {
  */
 func (sched *lqScheduler) updateCostOfJob(jobId uint) (error) {
 	log.Debugf("Tracking cost of job %d", jobId)
-	job, err := db.Jobs().Get(jobId)
+	job, err := sched.store.Jobs().Get(jobId)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed updating cost of job %d", jobId)
 	}
 
-	resource, err := db.Resources().Get(job.InstanceID)
+	resource, err := sched.store.Resources().Get(job.InstanceID)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed updating cost of job %d", jobId)
 	}
@@ -772,13 +892,64 @@ func (sched *lqScheduler) updateCostOfJob(jobId uint) (error) {
 	}
 
 	log.Infof("Job %d: Total cost $%f", jobId, cost)
-	err = db.Jobs().SetTotalCost(job.ID, job.TotalCost + cost)
+	err = sched.store.Jobs().SetTotalCost(job.ID, job.TotalCost + cost)
 	if err != nil {
 		return lq.NewErrorf(err, "Failed updating cost of job %d", jobId)
 	}
+
+	sched.checkBudget(job, cost)
 	return nil
 }
 
+// Alerts the owner of a job when its cost takes their costs of the month past a threshold of their budget
+func (sched *lqScheduler) checkBudget(job *lq.ContainerJob, cost float64) {
+	quota, err := sched.store.Quotas().GetForUser(job.OwnerID)
+	if err != nil || quota.MonthlyBudget <= 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthCost, err := sched.store.Jobs().GetCostSince(job.OwnerID, monthStart.UnixNano())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, threshold := range quota.CrossedBudgetThresholds(monthCost - cost, monthCost) {
+		events.Publish(lq.EventBudgetAlert, job.OwnerID, job.OrgID, job.ID, map[string]interface{}{
+			"threshold":      threshold,
+			"monthly_budget": quota.MonthlyBudget,
+			"month_cost":     monthCost,
+			"month":          monthStart.Format("2006-01"),
+		})
+	}
+}
+
+// Sets the status of a job and notifies its owner once the change is committed. Returns the job as it is after the
+// change, which is staging again when a lost job is retried.
+func (sched *lqScheduler) setJobStatus(job *lq.ContainerJob, status, statusMsg string) (*lq.ContainerJob, error) {
+	if err := sched.store.Jobs().SetStatus(job.ID, status, statusMsg); err != nil {
+		return job, err
+	}
+
+	// Re-fetch the job to get the current state after the state transition
+	current, err := sched.store.Jobs().Get(job.ID)
+	if err != nil {
+		return job, lq.NewErrorf(err, "Could not get re-fetch job %d to get current status", job.ID)
+	}
+
+	events.Publish(lq.EventJobStatus, job.OwnerID, job.OrgID, job.ID, map[string]interface{}{
+		"name":            job.Name,
+		"status":          current.Status,
+		"previous_status": job.Status,
+		"message":         statusMsg,
+		"attempt":         job.RetryCount,
+		"instance_id":     job.InstanceID,
+	})
+	return current, nil
+}
+
 //------------------ STUPID RANDOM UTILITY HELPER FUNCTIONS -------------------- //
 
 func (sched *lqScheduler) parseInstanceIDFromOffer(offer *mesos.Offer) uint {
@@ -791,6 +962,16 @@ func (sched *lqScheduler) parseInstanceIDFromOffer(offer *mesos.Offer) uint {
 	return 0 // IDs start from 1 so this is an invalid ID
 }
 
+// Whether the instance of the offer has mounted its instance store volumes
+func (sched *lqScheduler) offerHasInstanceStore(offer *mesos.Offer) bool {
+	for _, attribute := range offer.Attributes {
+		if attribute.GetName() == "instancestore" {
+			return attribute.GetText().GetValue() == "true"
+		}
+	}
+	return false
+}
+
 func (sched *lqScheduler) offerSatisfiesJob(offer *mesos.Offer, job *lq.ContainerJob) bool {
 	cpuResources := mesosutil.FilterResources(offer.Resources, func(res *mesos.Resource) bool {
 		return res.GetName() == "cpus"
@@ -818,15 +999,68 @@ func (sched *lqScheduler) offerSatisfiesJob(offer *mesos.Offer, job *lq.Containe
 
 	log.Info(fmt.Sprintf("Cpu: offer = %f, job = %f\nRam: offer = %f, job = %d\nGpus: offer = %f, job = %d",
 		cpus, job.Cpu, mems, job.Ram, gpus, job.Gpu))
-	if job.Cpu <= cpus && job.Ram <= int(mems) && job.Gpu <= int(gpus) {
-		return true
+	if job.Cpu > cpus || job.Ram > int(mems) || job.Gpu > int(gpus) {
+		return false
 	}
 
-	return false
+	diskResources := mesosutil.FilterResources(offer.Resources, func(res *mesos.Resource) bool {
+		return res.GetName() == "disk"
+	})
+	disk := 0.0
+	for _, res := range diskResources {
+		disk += res.GetScalar().GetValue()
+	}
+
+	if job.Disk > int(disk) {
+		log.Infof("Offer %s has %f disk, job %d needs %d", offer.Id.GetValue(), disk, job.ID, job.Disk)
+		return false
+	}
+	if job.InstanceStore && !sched.offerHasInstanceStore(offer) {
+		log.Infof("Offer %s does not have instance store for job %d", offer.Id.GetValue(), job.ID)
+		return false
+	}
+
+	// A retried job still holds the ports assigned on its previous attempt, which may not be free on this offer
+	portMappings, err := job.GetRequestedPortMappings()
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	if !portsSatisfyMappings(offerPortRanges(offer), portMappings) {
+		log.Infof("Offer %s cannot satisfy the host ports of job %d", offer.Id.GetValue(), job.ID)
+		return false
+	}
+
+	if sched.underDiskPressure(sched.parseInstanceIDFromOffer(offer)) {
+		log.Infof("Offer %s is from an instance under disk pressure", offer.Id.GetValue())
+		return false
+	}
+
+	return true
 }
 
 func (sched *lqScheduler) launchJob(job *lq.ContainerJob, offer *mesos.Offer) error {
-	log.Infof("Launching job %d onto offer %s", job.ID, offer.Id.GetValue())
+	logging.ForJob(job).Infof("Launching job %d onto offer %s", job.ID, offer.Id.GetValue())
+
+	// Reserve concrete host ports for the jobs port mappings out of the offer
+	// Requested mappings are used rather than the ports assigned on a previous attempt, which may be on another instance
+	job.AssignedPorts = ""
+	requestedPorts, err := job.GetRequestedPortMappings()
+	if err != nil {
+		return err
+	}
+	assignedPorts, err := allocatePorts(offerPortRanges(offer), requestedPorts)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed reserving host ports for job %d on offer %s", job.ID, offer.Id.GetValue())
+	}
+	assignedPortsBytes, err := json.Marshal(assignedPorts)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed serializing assigned ports of job %d", job.ID)
+	}
+	job.AssignedPorts = string(assignedPortsBytes)
+	if err = sched.store.Jobs().SetAssignedPorts(job.ID, job.AssignedPorts); err != nil {
+		return err
+	}
 
 	jobData, err := lq.SerializeJob(job)
 	if err != nil {
@@ -847,12 +1081,16 @@ func (sched *lqScheduler) launchJob(job *lq.ContainerJob, offer *mesos.Offer) er
 		Resources: []*mesos.Resource{
 			mesosutil.NewScalarResource("cpus", float64(job.Cpu)),
 			mesosutil.NewScalarResource("mem", float64(job.Ram)),
+			mesosutil.NewScalarResource("disk", float64(job.Disk)),
 
 			//TODO fix gpu use
 			//mesosutil.NewSetResource("gpus", []string{"0"}),
 		},
 		Data: jobData,
 	}
+	if len(assignedPorts) > 0 {
+		task.Resources = append(task.Resources, portsResource(assignedPorts))
+	}
 
 	// Launch via mesos driver
 	_, err = sched.driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{task},
@@ -860,6 +1098,20 @@ func (sched *lqScheduler) launchJob(job *lq.ContainerJob, offer *mesos.Offer) er
 	return err
 }
 
+// Sets the values of the secrets the job references, to be sent along with the task to the executor
+func (sched *lqScheduler) resolveSecrets(job *lq.ContainerJob) error {
+	refs, err := job.GetSecretRefs()
+	if err != nil {
+		return err
+	}
+	secrets, err := sched.store.Secrets().Resolve(job.OwnerID, refs)
+	if err != nil {
+		return lq.NewErrorf(err, "Failed resolving the secrets of job %d", job.ID)
+	}
+	job.ResolvedSecrets = secrets
+	return nil
+}
+
 func (sched *lqScheduler) getMesosTaskId(job *lq.ContainerJob) *mesos.TaskID {
 	return &mesos.TaskID{
 		Value: proto.String(strconv.Itoa(int(job.ID))),
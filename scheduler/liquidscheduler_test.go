@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+
+	"bargain/liquefy/db"
+	"bargain/liquefy/events"
+	lq "bargain/liquefy/models"
+)
+
+func TestSetJobStatusNotifiesOwner(t *testing.T) {
+	events.SetBus(events.NewMemoryBus())
+	defer events.SetBus(nil)
+	published, unsubscribe := events.GetBus().Subscribe()
+	defer unsubscribe()
+
+	sched := &lqScheduler{store: db.NewMemoryStore()}
+	job := &lq.ContainerJob{Name: "job", OwnerID: 1, OrgID: 2}
+	assert.Nil(t, sched.store.Jobs().Create(job))
+
+	launched, err := sched.setJobStatus(job, lq.ContainerJobStatusLaunched, "")
+	assert.Nil(t, err)
+	assert.Equal(t, lq.ContainerJobStatusLaunched, launched.Status)
+	event := <-published
+	assert.Equal(t, lq.EventJobStatus, event.Type)
+	assert.Equal(t, uint(1), event.UserID)
+	assert.Equal(t, uint(2), event.OrgID)
+	assert.Equal(t, job.ID, event.SubjectID)
+	assert.Equal(t, lq.ContainerJobStatusLaunched, event.Data["status"])
+	assert.Equal(t, mesos.TaskState_TASK_STAGING.String(), event.Data["previous_status"])
+
+	// Lost jobs are notified with the status they are retried in
+	retried, err := sched.setJobStatus(launched, mesos.TaskState_TASK_LOST.String(), "lost")
+	assert.Nil(t, err)
+	assert.Equal(t, mesos.TaskState_TASK_STAGING.String(), retried.Status)
+	event = <-published
+	assert.Equal(t, mesos.TaskState_TASK_STAGING.String(), event.Data["status"])
+	assert.Equal(t, lq.ContainerJobStatusLaunched, event.Data["previous_status"])
+	assert.Equal(t, "lost", event.Data["message"])
+
+	// Changes that fail notify nothing
+	_, err = sched.setJobStatus(&lq.ContainerJob{ID: job.ID + 1000}, lq.ContainerJobStatusLaunched, "")
+	assert.NotNil(t, err)
+	select {
+	case event = <-published:
+		t.Errorf("Unexpected event %v", event)
+	default:
+	}
+}
+
+func TestBudgetAlertsReachTheOrganization(t *testing.T) {
+	events.SetBus(events.NewMemoryBus())
+	defer events.SetBus(nil)
+	published, unsubscribe := events.GetBus().Subscribe()
+	defer unsubscribe()
+
+	store := db.NewMemoryStore()
+	sched := &lqScheduler{store: store}
+	quota := lq.DefaultQuota(1)
+	quota.MonthlyBudget = 10
+	assert.Nil(t, store.Quotas().Set(quota))
+
+	job := &lq.ContainerJob{Name: "job", OwnerID: 1, OrgID: 2}
+	assert.Nil(t, store.Jobs().Create(job))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, lq.ContainerJobStatusLaunched, ""))
+	assert.Nil(t, store.Jobs().SetStatus(job.ID, mesos.TaskState_TASK_KILLED.String(), ""))
+	assert.Nil(t, store.Jobs().SetTotalCost(job.ID, 9))
+
+	sched.checkBudget(job, 9)
+	event := <-published
+	assert.Equal(t, lq.EventBudgetAlert, event.Type)
+	assert.Equal(t, uint(1), event.UserID)
+	assert.Equal(t, uint(2), event.OrgID)
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/mesosutil"
+
+	lq "bargain/liquefy/models"
+)
+
+// The port ranges available in an offer
+func offerPortRanges(offer *mesos.Offer) []*mesos.Value_Range {
+	portResources := mesosutil.FilterResources(offer.Resources, func(res *mesos.Resource) bool {
+		return res.GetName() == "ports"
+	})
+
+	ranges := []*mesos.Value_Range{}
+	for _, res := range portResources {
+		ranges = append(ranges, res.GetRanges().GetRange()...)
+	}
+	return ranges
+}
+
+func portInRanges(port int, ranges []*mesos.Value_Range) bool {
+	for _, portRange := range ranges {
+		if uint64(port) >= portRange.GetBegin() && uint64(port) <= portRange.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that the host ports requested by the port mappings can be reserved from the available ranges:
+// explicit host ports must be available, and enough other ports must remain for the mappings asking for any port
+func portsSatisfyMappings(ranges []*mesos.Value_Range, mappings []lq.PortMapping) bool {
+	_, err := allocatePorts(ranges, mappings)
+	return err == nil
+}
+
+// Reserves concrete host ports for the port mappings out of the available ranges.
+// Mappings with host port 0 are given the lowest free ports that no other mapping asked for.
+func allocatePorts(ranges []*mesos.Value_Range, mappings []lq.PortMapping) ([]lq.PortMapping, error) {
+	assigned := make([]lq.PortMapping, len(mappings))
+	used := make(map[int]struct{})
+
+	for i, mapping := range mappings {
+		assigned[i] = mapping
+		if mapping.HostPort == 0 {
+			continue
+		}
+		if !portInRanges(mapping.HostPort, ranges) {
+			return nil, fmt.Errorf("Host port %d is not available", mapping.HostPort)
+		}
+		if _, taken := used[mapping.HostPort]; taken {
+			return nil, fmt.Errorf("Host port %d is requested more than once", mapping.HostPort)
+		}
+		used[mapping.HostPort] = struct{}{}
+	}
+
+	sortedRanges := make([]*mesos.Value_Range, len(ranges))
+	copy(sortedRanges, ranges)
+	sort.Sort(byBegin(sortedRanges))
+
+	rangeIndex := 0
+	var next uint64
+	if len(sortedRanges) > 0 {
+		next = sortedRanges[0].GetBegin()
+	}
+
+	for i := range assigned {
+		if assigned[i].HostPort != 0 {
+			continue
+		}
+
+		for {
+			if rangeIndex >= len(sortedRanges) {
+				return nil, fmt.Errorf("Not enough free host ports for %d port mappings", len(mappings))
+			}
+			if next > sortedRanges[rangeIndex].GetEnd() {
+				rangeIndex++
+				if rangeIndex < len(sortedRanges) && next < sortedRanges[rangeIndex].GetBegin() {
+					next = sortedRanges[rangeIndex].GetBegin()
+				}
+				continue
+			}
+			if _, taken := used[int(next)]; taken {
+				next++
+				continue
+			}
+			break
+		}
+
+		assigned[i].HostPort = int(next)
+		used[int(next)] = struct{}{}
+		next++
+	}
+
+	return assigned, nil
+}
+
+// The ports resource of a task reserving the host ports of the port mappings
+func portsResource(mappings []lq.PortMapping) *mesos.Resource {
+	ports := make([]int, len(mappings))
+	for i, mapping := range mappings {
+		ports[i] = mapping.HostPort
+	}
+	sort.Ints(ports)
+
+	ranges := []*mesos.Value_Range{}
+	for _, port := range ports {
+		last := len(ranges) - 1
+		if last >= 0 && ranges[last].GetEnd()+1 == uint64(port) {
+			ranges[last] = mesosutil.NewValueRange(ranges[last].GetBegin(), uint64(port))
+		} else {
+			ranges = append(ranges, mesosutil.NewValueRange(uint64(port), uint64(port)))
+		}
+	}
+	return mesosutil.NewRangesResource("ports", ranges)
+}
+
+type byBegin []*mesos.Value_Range
+
+func (r byBegin) Len() int           { return len(r) }
+func (r byBegin) Less(i, j int) bool { return r[i].GetBegin() < r[j].GetBegin() }
+func (r byBegin) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+
+	lq "bargain/liquefy/models"
+)
+
+func testPortRanges() []*mesos.Value_Range {
+	return []*mesos.Value_Range{
+		mesosutil.NewValueRange(8000, 8002),
+		mesosutil.NewValueRange(80, 80),
+	}
+}
+
+func TestAllocateExplicitPorts(t *testing.T) {
+	assigned, err := allocatePorts(testPortRanges(), []lq.PortMapping{
+		{HostPort: 80, ContainerPort: 8080},
+		{HostPort: 8001, ContainerPort: 9090},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 80, assigned[0].HostPort)
+	assert.Equal(t, 8001, assigned[1].HostPort)
+
+	// A port outside of the offer cannot be reserved
+	_, err = allocatePorts(testPortRanges(), []lq.PortMapping{{HostPort: 443, ContainerPort: 443}})
+	assert.NotNil(t, err)
+
+	// Neither can the same port twice
+	_, err = allocatePorts(testPortRanges(), []lq.PortMapping{
+		{HostPort: 80, ContainerPort: 8080},
+		{HostPort: 80, ContainerPort: 9090},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestAllocateAnyPorts(t *testing.T) {
+	assigned, err := allocatePorts(testPortRanges(), []lq.PortMapping{
+		{HostPort: 0, ContainerPort: 8080},
+		{HostPort: 80, ContainerPort: 80},
+		{HostPort: 0, ContainerPort: 9090},
+		{HostPort: 0, ContainerPort: 9091},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 8000, assigned[0].HostPort)
+	assert.Equal(t, 80, assigned[1].HostPort)
+	assert.Equal(t, 8001, assigned[2].HostPort)
+	assert.Equal(t, 8002, assigned[3].HostPort)
+	assert.Equal(t, 8080, assigned[0].ContainerPort)
+
+	// The offer only has four ports
+	assert.False(t, portsSatisfyMappings(testPortRanges(), []lq.PortMapping{
+		{HostPort: 0, ContainerPort: 1},
+		{HostPort: 0, ContainerPort: 2},
+		{HostPort: 0, ContainerPort: 3},
+		{HostPort: 0, ContainerPort: 4},
+		{HostPort: 0, ContainerPort: 5},
+	}))
+	assert.True(t, portsSatisfyMappings(testPortRanges(), []lq.PortMapping{}))
+}
+
+func TestPortsResource(t *testing.T) {
+	resource := portsResource([]lq.PortMapping{
+		{HostPort: 8001},
+		{HostPort: 80},
+		{HostPort: 8000},
+	})
+	ranges := resource.GetRanges().GetRange()
+	assert.Equal(t, "ports", resource.GetName())
+	assert.Equal(t, 2, len(ranges))
+	assert.Equal(t, uint64(80), ranges[0].GetBegin())
+	assert.Equal(t, uint64(80), ranges[0].GetEnd())
+	assert.Equal(t, uint64(8000), ranges[1].GetBegin())
+	assert.Equal(t, uint64(8001), ranges[1].GetEnd())
+}
@@ -26,5 +26,5 @@ docker run -d \
     -v /home/ubuntu/postgres:/var/lib/postgresql/data \
     postgres
 
-echo "Initializing the db"
-go run ../initDB.go --masterip=${MASTER_PUBLIC_IP}
\ No newline at end of file
+echo "Migrating the db"
+go run ../migrate.go --masterip=${MASTER_PUBLIC_IP} up
\ No newline at end of file
@@ -26,9 +26,10 @@ func main() {
         AwsSecretKey:           &config.SecretAccessKey,
     }
 
-    awsCloud := awsCloud.NewAwsCloud(awsAccount.AwsAccessKey, awsAccount.AwsSecretKey)
+    awsCloud := awsCloud.NewAwsCloud(awsAccount)
     spotReq, err := awsCloud.CreateSpotInstanceRequest(config.Region, config.AvailabilityZone, "ami-398bdc53",
-        config.Subnet, config.SecurityGroup, "g2.2xlarge", 0.10, 3)
+        config.Subnet, config.SecurityGroup, "g2.2xlarge", 0.10, 3,
+        lq.InstanceStorage{VolumeSize: lq.MinRootVolumeGB})
     if err != nil {
         panic(err)
     }
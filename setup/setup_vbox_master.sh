@@ -102,6 +102,6 @@ docker run -d \
     elasticsearch
 
 echo "Initializing the db"
-go run ../initDB.go --masterip=$MASTER_IP
+go run ../migrate.go --masterip=$MASTER_IP reset
 
 exit 0
\ No newline at end of file
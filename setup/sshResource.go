@@ -35,13 +35,8 @@ func main() {
         panic("Cannot get resource ")
     }
 
-    user, err := db.Users().Get(resource.OwnerId)
-    if err != nil {
-        panic("Cannot get user")
-    }
-
     // Get SSH private key to use
-    awsAccount, err := db.AwsAccounts().Get(user.AwsAccountID)
+    awsAccount, err := db.AwsAccounts().GetForOwner(resource.OwnerId, resource.OrgID)
     if err != nil {
         panic("Failed to setup mesos on resource %d")
     }
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// TraceExporterEnv selects where the spans of a service are exported: stdout, or file:///path to append them to a
+// file. Spans are dropped when it is unset or none.
+const TraceExporterEnv = "LQ_TRACE_EXPORTER"
+
+// Exporter sends finished spans to where traces are collected
+type Exporter interface {
+	Export(span *Span) error
+}
+
+var (
+	exporterMutex sync.Mutex
+	exporter      Exporter
+	exporterSet   bool
+)
+
+// The exporter of a LQ_TRACE_EXPORTER value, nil for none
+func NewExporter(spec string) (Exporter, error) {
+	switch {
+	case spec == "" || spec == "none":
+		return nil, nil
+	case spec == "stdout":
+		return NewWriterExporter(os.Stdout), nil
+	case strings.HasPrefix(spec, "file://"):
+		exporter, err := NewFileExporter(strings.TrimPrefix(spec, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("Unknown %s %s, must be none, stdout or file:///path", TraceExporterEnv, spec)
+	}
+}
+
+func NewExporterFromEnv() (Exporter, error) {
+	return NewExporter(os.Getenv(TraceExporterEnv))
+}
+
+func SetExporter(e Exporter) {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+	exporter, exporterSet = e, true
+}
+
+// The exporter set by the service, or else the one of LQ_TRACE_EXPORTER. Services validate LQ_TRACE_EXPORTER when
+// they start, so an invalid value only reaches here in tools and tests, where spans are dropped instead.
+func GetExporter() Exporter {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+	if !exporterSet {
+		var err error
+		if exporter, err = NewExporterFromEnv(); err != nil {
+			log.Error(err)
+			exporter = nil
+		}
+		exporterSet = true
+	}
+	return exporter
+}
+
+// WriterExporter writes spans as JSON lines
+type WriterExporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{encoder: json.NewEncoder(w)}
+}
+
+// Appends spans to the file, creating it if needed
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed opening trace file %s: %s", path, err)
+	}
+	return NewWriterExporter(file), nil
+}
+
+func (exporter *WriterExporter) Export(span *Span) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	return exporter.encoder.Encode(span)
+}
+
+// Reads the spans a WriterExporter wrote
+func ReadSpans(r io.Reader) ([]*Span, error) {
+	spans := []*Span{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		span := &Span{}
+		if err := json.Unmarshal(scanner.Bytes(), span); err != nil {
+			return nil, fmt.Errorf("Invalid span %q: %s", scanner.Text(), err)
+		}
+		spans = append(spans, span)
+	}
+	return spans, scanner.Err()
+}
+
+// MemoryExporter keeps spans in the process, for tests
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (exporter *MemoryExporter) Export(span *Span) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	exporter.spans = append(exporter.spans, span)
+	return nil
+}
+
+// The spans exported so far, in the order they finished
+func (exporter *MemoryExporter) Spans() []*Span {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	return append([]*Span{}, exporter.spans...)
+}
@@ -0,0 +1,132 @@
+// Package tracing follows a job across the services it crosses: the api, the scheduler, the provisioner and the
+// executor. A trace is started when the job is created and its context is persisted with the job, so that every
+// service records its spans in the same trace. Contexts are carried in the W3C traceparent format.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var traceparentRegexp = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// SpanContext identifies a span, spans started with it as parent are its children. The zero value is no span.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+func (context SpanContext) IsValid() bool {
+	return context.TraceID != "" && context.SpanID != ""
+}
+
+// The context in the W3C traceparent format, ex: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01. Empty
+// when the context is not valid.
+func (context SpanContext) String() string {
+	if !context.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", context.TraceID, context.SpanID)
+}
+
+// Parses a context in the W3C traceparent format
+func ParseSpanContext(traceparent string) (SpanContext, error) {
+	match := traceparentRegexp.FindStringSubmatch(traceparent)
+	if match == nil {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent %q", traceparent)
+	}
+	return SpanContext{TraceID: match[1], SpanID: match[2]}, nil
+}
+
+// The context persisted with a job or resource. Those created before they were traced have none, their spans start
+// new traces.
+func ContextOf(traceparent string) SpanContext {
+	if traceparent == "" {
+		return SpanContext{}
+	}
+	context, err := ParseSpanContext(traceparent)
+	if err != nil {
+		log.Warn(err)
+	}
+	return context
+}
+
+// Span is a phase of the lifecycle of a job, ex: assigning it to a resource. Times are unix nanoseconds.
+type Span struct {
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	StartTime  int64             `json:"start_time"`
+	EndTime    int64             `json:"end_time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	mutex sync.Mutex
+	ended bool
+}
+
+// Starts a span, as a child of the parent or as the root of a new trace when the parent is not valid
+func StartSpan(name string, parent SpanContext) *Span {
+	span := &Span{
+		Name:       name,
+		SpanID:     newID(8),
+		StartTime:  time.Now().UTC().UnixNano(),
+		Attributes: make(map[string]string),
+	}
+	if parent.IsValid() {
+		span.TraceID, span.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+	return span
+}
+
+func (span *Span) Context() SpanContext {
+	return SpanContext{TraceID: span.TraceID, SpanID: span.SpanID}
+}
+
+func (span *Span) SetAttribute(key string, value interface{}) {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.Attributes[key] = fmt.Sprint(value)
+}
+
+// Ends the span, failed when err is not nil, and exports it. Only the first call has an effect.
+func (span *Span) Finish(err error) {
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+	span.ended = true
+	span.EndTime = time.Now().UTC().UnixNano()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	span.mutex.Unlock()
+
+	if exporter := GetExporter(); exporter != nil {
+		if err := exporter.Export(span); err != nil {
+			log.Warnf("Failed exporting span %s of trace %s: %s", span.Name, span.TraceID, err)
+		}
+	}
+}
+
+func (span *Span) Duration() time.Duration {
+	return time.Duration(span.EndTime - span.StartTime)
+}
+
+func newID(bytes int) string {
+	id := make([]byte, bytes)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
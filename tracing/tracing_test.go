@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Exports spans to a new memory exporter, returning a function restoring the previous exporter
+func useMemoryExporter() (*MemoryExporter, func()) {
+	exporterMutex.Lock()
+	previous, previousSet := exporter, exporterSet
+	exporterMutex.Unlock()
+
+	memory := NewMemoryExporter()
+	SetExporter(memory)
+	return memory, func() {
+		exporterMutex.Lock()
+		defer exporterMutex.Unlock()
+		exporter, exporterSet = previous, previousSet
+	}
+}
+
+func TestSpanContext(t *testing.T) {
+	span := StartSpan("api.create_job", SpanContext{})
+	context, err := ParseSpanContext(span.Context().String())
+	assert.Nil(t, err)
+	assert.Equal(t, span.Context(), context)
+	assert.Len(t, context.TraceID, 32)
+	assert.Len(t, context.SpanID, 16)
+
+	_, err = ParseSpanContext("00-abc-def-01")
+	assert.NotNil(t, err)
+	assert.Equal(t, "", SpanContext{}.String())
+
+	// Jobs created before they were traced start new traces
+	assert.False(t, ContextOf("").IsValid())
+	assert.False(t, ContextOf("invalid").IsValid())
+}
+
+func TestSpansOfATrace(t *testing.T) {
+	memory, restore := useMemoryExporter()
+	defer restore()
+
+	root := StartSpan("api.create_job", SpanContext{})
+	assign := StartSpan("scheduler.assign", ContextOf(root.Context().String()))
+	assign.SetAttribute("job.id", uint(3))
+	assign.Finish(errors.New("resource is not running"))
+	assign.Finish(nil)
+	root.Finish(nil)
+
+	spans := memory.Spans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "scheduler.assign", spans[0].Name)
+		assert.Equal(t, root.TraceID, spans[0].TraceID)
+		assert.Equal(t, root.SpanID, spans[0].ParentID)
+		assert.Equal(t, "3", spans[0].Attributes["job.id"])
+		assert.Equal(t, "resource is not running", spans[0].Error)
+		assert.True(t, spans[0].EndTime >= spans[0].StartTime)
+
+		assert.Equal(t, "", spans[1].ParentID)
+		assert.Equal(t, "", spans[1].Error)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.jsonl")
+
+	file, err := NewExporter("file://" + path)
+	assert.Nil(t, err)
+	_, restore := useMemoryExporter()
+	defer restore()
+	SetExporter(file)
+
+	root := StartSpan("api.create_job", SpanContext{})
+	launch := StartSpan("scheduler.launch", root.Context())
+	launch.SetAttribute("offer.id", "offer-1")
+	launch.Finish(nil)
+	root.Finish(nil)
+
+	content, err := os.Open(path)
+	assert.Nil(t, err)
+	defer content.Close()
+	spans, err := ReadSpans(content)
+	assert.Nil(t, err)
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "scheduler.launch", spans[0].Name)
+		assert.Equal(t, "offer-1", spans[0].Attributes["offer.id"])
+		assert.Equal(t, root.SpanID, spans[0].ParentID)
+		assert.Equal(t, root.TraceID, spans[1].TraceID)
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := NewExporter("")
+	assert.Nil(t, err)
+	assert.Nil(t, exporter)
+	exporter, err = NewExporter("none")
+	assert.Nil(t, err)
+	assert.Nil(t, exporter)
+	exporter, err = NewExporter("stdout")
+	assert.Nil(t, err)
+	assert.NotNil(t, exporter)
+	_, err = NewExporter("jaeger://localhost")
+	assert.NotNil(t, err)
+}
+
+func TestInvalidExporterEnvDropsSpans(t *testing.T) {
+	_, restore := useMemoryExporter()
+	defer restore()
+	exporterMutex.Lock()
+	exporter, exporterSet = nil, false
+	exporterMutex.Unlock()
+
+	previous := os.Getenv(TraceExporterEnv)
+	os.Setenv(TraceExporterEnv, "jaeger://localhost")
+	defer os.Setenv(TraceExporterEnv, previous)
+
+	assert.Nil(t, GetExporter())
+	StartSpan("api.create_job", SpanContext{}).Finish(nil)
+}